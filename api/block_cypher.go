@@ -1,155 +1,272 @@
 package api
 
-/**
-*
-* WARNING: This api is on hold at the moment and not in use anywhere
-* It was supposed to be a BTC gateway for testnet on staging but the number of requests
-* allowed makes it difficult to leverage the api for free
-*
-**/
-
 import (
+	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"math/big"
-	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/SoteriaTech/blockchain-functions/btc"
 	"github.com/SoteriaTech/blockchain-functions/env"
-	"github.com/SoteriaTech/blockchain-functions/utils"
 
 	"github.com/blockcypher/gobcy"
 )
 
 const (
-	token string = "8dec31da4fbc4b6794ca4abc8eb77bf1"
+	// blockCypherBatchSize largest number of transactions BlockCypher returns in a batch
+	blockCypherBatchSize int = 100
+	// blockCypherPageSize number of txids of a block, and of inputs or outputs of a transaction, fetched per page
+	blockCypherPageSize int = 500
+	// blockCypherCallTimeout deadline of each request, retries included, once the rate limiter allowed it
+	blockCypherCallTimeout time.Duration = 60 * time.Second
 )
 
-// BlockCypherClient structure of the blockCypher client
+// BlockCypherClient structure of the blockCypher client. The endpoint is the url of the chain,
+// e.g. https://api.blockcypher.com/v1/btc/test3, and every request goes through the rate limiter
+// of the token's plan
 type BlockCypherClient struct {
-	client gobcy.API
-	http   *http.Client
-	config *env.ChainConfig
+	transport *Transport
+	endpoint  string
+	token     string
+	limiter   *RateLimiter
+}
+
+// blockCypherTx transaction of BlockCypher, with the fields missing in gobcy
+type blockCypherTx struct {
+	gobcy.TX
+	VSize int    `json:"vsize"`
+	Error string `json:"error"`
 }
 
 // BlockCypher BlockCypher client instance
 var BlockCypher *BlockCypherClient
 
-// InitBlockCypherClient initialize an instance of BlockCypher. Chain is either "main" or "test3"
-func InitBlockCypherClient(config *env.ChainConfig) {
-	client := gobcy.API{Token: token, Coin: "btc", Chain: config.Chain}
+// InitBlockCypherClient initialize an instance of BlockCypher
+func InitBlockCypherClient(endpoint string, token string, limit *env.RateLimitConfig) {
+	BlockCypher = NewBlockCypherClient(endpoint, token, limit)
+}
 
-	BlockCypher = &BlockCypherClient{
-		client: client,
-		http:   &http.Client{},
-		config: config,
+// NewBlockCypherClient create a new BlockCypherClient for the given chain endpoint and token. Without
+// rate limit config, the quotas of the free plan are used
+func NewBlockCypherClient(endpoint string, token string, limit *env.RateLimitConfig) *BlockCypherClient {
+	if limit == nil {
+		limit = &env.RateLimitConfig{PerSecond: 3, PerHour: 100}
+	}
+	return &BlockCypherClient{
+		transport: ProviderTransport,
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		token:     token,
+		limiter:   NewRateLimiter(limit.PerSecond, limit.PerHour),
 	}
 }
 
-//GetBalance get the balance of a given account
-func (b *BlockCypherClient) GetBalance(address string) (*big.Float, error) {
-
-	acc, err := b.client.GetAddrBal(address, nil)
-	if err != nil {
-		utils.ErrorReport.LogAndPrintError(err)
+// GetBalance get the confirmed balance of the account corresponding to the given address
+func (b *BlockCypherClient) GetBalance(address string) (*big.Int, error) {
+	acc := &gobcy.Addr{}
+	if err := b.request("/addrs/"+address+"/balance", nil, 1, acc); err != nil {
 		return nil, err
 	}
-	balance := acc.Balance
-	return new(big.Float).SetInt(&balance), nil
+	return &acc.Balance, nil
 }
 
-// FetchTransactionsFromBlock fetch
-func (b *BlockCypherClient) FetchTransactionsFromBlock(height int) ([]*gobcy.TX, error) {
-	block, err := b.GetBlock(height)
-	if err != nil {
+// GetHeadBlock get the head block basic info
+func (b *BlockCypherClient) GetHeadBlock() (*btc.HeadBlock, error) {
+	chain := &gobcy.Blockchain{}
+	if err := b.request("", nil, 1, chain); err != nil {
 		return nil, err
 	}
 
-	txs, errs := b.aggregateTransactions(block.TXids)
-	if len(errs) > 0 {
-		return nil, errs[0]
-	}
-	return txs, nil
+	return &btc.HeadBlock{
+		Hash:   chain.Hash,
+		Time:   int(chain.Time.Unix()),
+		Height: chain.Height,
+	}, nil
 }
 
-// GetBlock get the data of a given block, if provided height is 0 then get the head block
-func (b *BlockCypherClient) GetBlock(height int) (*gobcy.Block, error) {
-	var block gobcy.Block
-	var err error
+// GetBlockHash get the hash of the block at the given height
+func (b *BlockCypherClient) GetBlockHash(height int) (string, error) {
+	block := &gobcy.Block{}
+	if err := b.request("/blocks/"+strconv.Itoa(height), url.Values{"limit": {"1"}}, 1, block); err != nil {
+		return "", err
+	}
+	return block.Hash, nil
+}
 
-	if height == 0 {
-		height, err = b.getHeadBlock()
+// GetBlock get the block at the given height along with all of its transactions. The txids of the
+// block are paged and its transactions fetched in batches
+func (b *BlockCypherClient) GetBlock(height int) (*btc.Block, error) {
+	var block *gobcy.Block
+	var txids []string
+	for start := 0; block == nil || start < block.NumTX; start += blockCypherPageSize {
+		page := &gobcy.Block{}
+		query := url.Values{"txstart": {strconv.Itoa(start)}, "limit": {strconv.Itoa(blockCypherPageSize)}}
+		if err := b.request("/blocks/"+strconv.Itoa(height), query, 1, page); err != nil {
+			return nil, err
+		}
+		if block != nil && page.Hash != block.Hash {
+			return nil, fmt.Errorf("block %d changed from %s to %s while paging its transactions", height, block.Hash, page.Hash)
+		}
+		if block != nil && len(page.TXids) == 0 {
+			return nil, fmt.Errorf("blockcypher returned an empty page at index %d for block %s", start, page.Hash)
+		}
+		block = page
+		txids = append(txids, page.TXids...)
 	}
 
-	block, err = b.client.GetBlock(height, "", map[string]string{"limit": "500"})
+	txs, err := b.getTransactions(txids)
 	if err != nil {
-		utils.ErrorReport.LogAndPrintError(err)
 		return nil, err
 	}
 
-	return &block, nil
+	formatted := formatBlock(block)
+	for _, t := range txs {
+		formatted.Txs = append(formatted.Txs, *formatTx(t))
+	}
+	return formatted, nil
 }
 
-//AggregateTransactions aggregate transactions from a list of txIds
-func (b *BlockCypherClient) aggregateTransactions(txIDs []string) ([]*gobcy.TX, []error) {
-	var txs []*gobcy.TX
+// GetTransactionsFromBlock extract and parse transactions from a given block
+func (b *BlockCypherClient) GetTransactionsFromBlock(block *btc.Block) ([]*btc.Transaction, []error) {
+	var txs []*btc.Transaction
 	var errs []error
-
-	for _, txID := range txIDs {
-		time.Sleep(2 * time.Second)
-		tx, err := b.GetTransaction(txID)
-		if err != nil {
-			errs = append(errs, err)
-			continue
-		}
-		txs = append(txs, tx)
+	for _, tx := range block.Txs {
+		txs = append(txs, parseTx(&tx, block.Height)...)
 	}
 	return txs, errs
 }
 
-// GetTransaction get details of the transaction with the given txId
-func (b *BlockCypherClient) GetTransaction(txID string) (*gobcy.TX, error) {
-	tx := &gobcy.TX{}
-	if err := b.RequestTxURL(txID, tx); err != nil {
-		utils.ErrorReport.LogAndPrintError(err)
+// GetTransactionByHash get the detail of a confirmed transaction from its hash
+func (b *BlockCypherClient) GetTransactionByHash(hash string) (*btc.Transaction, error) {
+	t := &blockCypherTx{}
+	if err := b.request("/txs/"+hash, url.Values{"limit": {"1"}}, 1, t); err != nil {
 		return nil, err
 	}
-	return tx, nil
+	if t.BlockHeight <= 0 {
+		return nil, fmt.Errorf("transaction %s is not confirmed yet", hash)
+	}
+
+	return &btc.Transaction{
+		Hash:        t.Hash,
+		BlockHeight: t.BlockHeight,
+	}, nil
 }
 
-// RequestTxURL make a request to the transaction URL for transaction details
-func (b *BlockCypherClient) RequestTxURL(txID string, i interface{}) error {
-	rsp, err := b.http.Get(b.getBaseTxURL() + txID + "?token=" + token)
-	if err != nil {
-		return err
+// GetRawTransaction get the raw serialization of a transaction from its hash
+func (b *BlockCypherClient) GetRawTransaction(hash string) ([]byte, error) {
+	t := &blockCypherTx{}
+	query := url.Values{"includeHex": {"true"}, "limit": {"1"}}
+	if err := b.request("/txs/"+hash, query, 1, t); err != nil {
+		return nil, err
 	}
+	return hex.DecodeString(t.Hex)
+}
 
-	defer rsp.Body.Close()
-	data, err := ioutil.ReadAll(rsp.Body)
-	if err != nil {
-		return err
+// getTransactions fetch the transactions with the given hashes in batches, in the same order. A batch
+// counts as one request per transaction against the quotas, so batches never exceed the per-second quota
+func (b *BlockCypherClient) getTransactions(hashes []string) ([]*blockCypherTx, error) {
+	size := blockCypherBatchSize
+	if burst := b.limiter.Burst(); burst > 0 && burst < size {
+		size = burst
 	}
 
-	if rsp.Status[0] != '2' {
-		return fmt.Errorf("expected status 2xx, got %s: %s", rsp.Status, string(data))
+	var txs []*blockCypherTx
+	for start := 0; start < len(hashes); start += size {
+		end := start + size
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+		batch := hashes[start:end]
+
+		query := url.Values{"limit": {strconv.Itoa(blockCypherPageSize)}}
+		var page []*blockCypherTx
+		if len(batch) == 1 {
+			t := &blockCypherTx{}
+			if err := b.request("/txs/"+batch[0], query, 1, t); err != nil {
+				return nil, err
+			}
+			page = append(page, t)
+		} else if err := b.request("/txs/"+strings.Join(batch, ";"), query, len(batch), &page); err != nil {
+			return nil, err
+		}
+
+		// the transactions of a batch are not returned in the order of the request
+		byHash := make(map[string]*blockCypherTx, len(page))
+		for _, t := range page {
+			if t.Error != "" {
+				return nil, fmt.Errorf("blockcypher batch error: %s", t.Error)
+			}
+			byHash[t.Hash] = t
+		}
+		for _, hash := range batch {
+			t, ok := byHash[hash]
+			if !ok {
+				return nil, fmt.Errorf("transaction %s missing from the blockcypher batch", hash)
+			}
+			if err := b.completeTransaction(t); err != nil {
+				return nil, err
+			}
+			txs = append(txs, t)
+		}
 	}
+	return txs, nil
+}
 
-	return json.Unmarshal(data, &i)
+// completeTransaction fetch the inputs and outputs of a transaction past the first page
+func (b *BlockCypherClient) completeTransaction(t *blockCypherTx) error {
+	for len(t.Inputs) < t.VinSize || len(t.Outputs) < t.VoutSize {
+		query := url.Values{
+			"instart":  {strconv.Itoa(len(t.Inputs))},
+			"outstart": {strconv.Itoa(len(t.Outputs))},
+			"limit":    {strconv.Itoa(blockCypherPageSize)},
+		}
+		page := &blockCypherTx{}
+		if err := b.request("/txs/"+t.Hash, query, 1, page); err != nil {
+			return err
+		}
+		if len(page.Inputs) == 0 && len(page.Outputs) == 0 {
+			return fmt.Errorf("blockcypher returned an empty page of inputs and outputs for transaction %s", t.Hash)
+		}
+		if len(t.Inputs) < t.VinSize {
+			t.Inputs = append(t.Inputs, page.Inputs...)
+		}
+		if len(t.Outputs) < t.VoutSize {
+			t.Outputs = append(t.Outputs, page.Outputs...)
+		}
+	}
+	return nil
 }
 
-func (b *BlockCypherClient) getHeadBlock() (int, error) {
-	chain, err := b.client.GetChain()
+// request call the given path of the chain endpoint once the rate limiter allows the given number of requests.
+// The wait for the rate limiter is not part of the deadline of the request
+func (b *BlockCypherClient) request(path string, query url.Values, n int, i interface{}) error {
+	if err := b.limiter.Wait(context.Background(), n); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), blockCypherCallTimeout)
+	defer cancel()
+
+	if query == nil {
+		query = url.Values{}
+	}
+	if b.token != "" {
+		query.Set("token", b.token)
+	}
+	u := b.endpoint + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	data, err := b.transport.Get(ctx, u)
 	if err != nil {
-		utils.ErrorReport.LogAndPrintError(err)
-		return 0, err
+		return err
 	}
-	return chain.Height, nil
-}
 
-func (b *BlockCypherClient) getBaseTxURL() string {
-	return b.config.Endpoint + "txs/"
+	return json.Unmarshal(data, i)
 }
 
 func formatBlock(b *gobcy.Block) *btc.Block {
@@ -161,18 +278,61 @@ func formatBlock(b *gobcy.Block) *btc.Block {
 		MrklRoot:     b.MerkleRoot,
 		NTx:          b.NumTX,
 		Nonce:        b.Nonce,
+		MainChain:    true,
 		Time:         int(b.Time.Unix()),
 		ReceivedTime: int(b.ReceivedTime.Unix()),
 	}
 }
 
-func formatTx(t *gobcy.TX) *btc.Tx {
-	return &btc.Tx{
+func formatTx(t *blockCypherTx) *btc.Tx {
+	tx := &btc.Tx{
+		Ver:         t.Ver,
+		Size:        t.Size,
+		Weight:      t.VSize * 4,
 		Hash:        t.Hash,
 		BlockHeight: t.BlockHeight,
-		Time:        int(t.Received.Unix()),
+		Time:        int(t.Confirmed.Unix()),
 		Fee:         t.Fees,
 		VinSz:       t.VinSize,
 		VoutSz:      t.VoutSize,
+		RelayedBy:   t.RelayedBy,
+	}
+
+	for _, in := range t.Inputs {
+		i := &btc.Inputs{
+			Sequence: in.Sequence,
+			Script:   in.Script,
+		}
+		// coinbase inputs have no previous output
+		if in.PrevHash != "" {
+			i.PrevOut = btc.PrevOut{
+				Hash:  in.PrevHash,
+				Spent: true,
+				Addr:  singleAddress(in.Addresses),
+				Value: *big.NewInt(int64(in.OutputValue)),
+				N:     in.OutputIndex,
+			}
+		}
+		tx.Inputs = append(tx.Inputs, i)
+	}
+
+	for n, out := range t.Outputs {
+		tx.Out = append(tx.Out, &btc.Out{
+			Spent:  out.SpentBy != "",
+			Addr:   singleAddress(out.Addresses),
+			Value:  out.Value,
+			N:      n,
+			Script: out.Script,
+		})
+	}
+
+	return tx
+}
+
+// singleAddress address of an output paying to a single address, BlockCypher lists the keys of bare multisig outputs
+func singleAddress(addresses []string) string {
+	if len(addresses) != 1 {
+		return ""
 	}
+	return addresses[0]
 }
@@ -1,12 +1,13 @@
 package api
 
 import (
+	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"math/big"
-	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/SoteriaTech/blockchain-functions/btc"
 )
@@ -17,8 +18,12 @@ const (
 
 // BlockInfoClient structure of the blockInfo api client
 type BlockInfoClient struct {
-	*http.Client
-	endpoint string
+	transport *Transport
+	endpoint  string
+}
+
+type bIBlockHeight struct {
+	Blocks []*btc.Block `json:"blocks"`
 }
 
 type bIAccount struct {
@@ -35,9 +40,14 @@ var BlockInfo *BlockInfoClient
 
 // InitBlockInfoClient initialize an instance of BlockInfo
 func InitBlockInfoClient(endpoint string) {
-	BlockInfo = &BlockInfoClient{
-		Client:   &http.Client{},
-		endpoint: endpoint,
+	BlockInfo = NewBlockInfoClient(endpoint)
+}
+
+// NewBlockInfoClient create a new BlockInfoClient for the given endpoint
+func NewBlockInfoClient(endpoint string) *BlockInfoClient {
+	return &BlockInfoClient{
+		transport: ProviderTransport,
+		endpoint:  endpoint,
 	}
 }
 
@@ -75,6 +85,34 @@ func (b *BlockInfoClient) GetBlock(height int) (*btc.Block, error) {
 	return block, nil
 }
 
+// GetBlockHash get the hash of the main chain block at the given height
+func (b *BlockInfoClient) GetBlockHash(height int) (string, error) {
+	bh := &bIBlockHeight{}
+	if err := b.request("/block-height/"+strconv.Itoa(height), bh, true); err != nil {
+		return "", err
+	}
+	for _, block := range bh.Blocks {
+		if block.MainChain {
+			return block.Hash, nil
+		}
+	}
+	return "", fmt.Errorf("no main chain block found at height %d", height)
+}
+
+// GetRawBlock get the raw serialization of the main chain block at the given height
+func (b *BlockInfoClient) GetRawBlock(height int) ([]byte, error) {
+	hash, err := b.GetBlockHash(height)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := b.requestRaw("/rawblock/" + hash + "?format=hex")
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(strings.TrimSpace(string(data)))
+}
+
 // GetTransactionsFromBlock extract and parse transactions from a given block
 func (b *BlockInfoClient) GetTransactionsFromBlock(block *btc.Block) ([]*btc.Transaction, []error) {
 	var txs []*btc.Transaction
@@ -95,30 +133,32 @@ func (b *BlockInfoClient) GetTransactionByHash(hash string) (tx *btc.Transaction
 	return tx, nil
 }
 
-func (b *BlockInfoClient) request(query string, i interface{}, isJSON bool) error {
-	fullPath := b.endpoint + query
-	if isJSON {
-		fullPath = b.endpoint + query + "?format=json"
+// GetRawTransaction get the raw serialization of a transaction from its hash
+func (b *BlockInfoClient) GetRawTransaction(hash string) ([]byte, error) {
+	data, err := b.requestRaw("/rawtx/" + hash + "?format=hex")
+	if err != nil {
+		return nil, err
 	}
+	return hex.DecodeString(strings.TrimSpace(string(data)))
+}
 
-	rsp, err := b.Get(fullPath)
-	if err != nil {
-		return err
+func (b *BlockInfoClient) request(query string, i interface{}, isJSON bool) error {
+	if isJSON {
+		query = query + "?format=json"
 	}
 
-	defer rsp.Body.Close()
-	data, err := ioutil.ReadAll(rsp.Body)
+	data, err := b.requestRaw(query)
 	if err != nil {
 		return err
 	}
 
-	if rsp.Status[0] != '2' {
-		return fmt.Errorf("expected status 2xx, got %s: %s", rsp.Status, string(data))
-	}
-
 	return json.Unmarshal(data, &i)
 }
 
+func (b *BlockInfoClient) requestRaw(query string) ([]byte, error) {
+	return b.transport.Get(context.Background(), b.endpoint+query)
+}
+
 func parseTx(tx *btc.Tx, height int) (ts []*btc.Transaction) {
 
 	outs := parseOutTxs(tx.Out, tx.Hash, height)
@@ -136,6 +176,7 @@ func parseOutTxs(out []*btc.Out, hash string, height int) (ts []*btc.Transaction
 			TxIndex:     o.TxIndex,
 			N:           o.N,
 			BlockHeight: height,
+			Script:      o.Script,
 		}
 		ts = append(ts, t)
 	}
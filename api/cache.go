@@ -0,0 +1,383 @@
+package api
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+)
+
+const (
+	// cacheDefaultSizeMB size of the memory and disk caches when the config does not set one
+	cacheDefaultSizeMB int = 64
+	// cacheHeadTTL time during which the head fetched to check the depth of a block is reused
+	cacheHeadTTL time.Duration = 30 * time.Second
+)
+
+// Kinds of the cached responses
+const (
+	cacheBlock       string = "block"
+	cacheRawBlock    string = "raw_block"
+	cacheBlockHash   string = "block_hash"
+	cacheTransaction string = "tx"
+	cacheReceipt     string = "receipt"
+	cacheTrace       string = "trace"
+)
+
+// CacheBackend storage of the response cache, values are the json of the responses
+type CacheBackend interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte) error
+}
+
+// CacheStats hits and misses of a kind of response
+type CacheStats struct {
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	Writes   int64   `json:"writes"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+// ResponseCache cache of the immutable responses of the providers of a chain. Callers only store
+// the responses of blocks deeper than the confirmations of the chain, which cannot be reorganized
+type ResponseCache struct {
+	backend   CacheBackend
+	namespace string
+
+	mu    sync.Mutex
+	stats map[string]*CacheStats
+}
+
+// caches response caches by namespace, to expose their stats
+var (
+	cachesMu sync.Mutex
+	caches   = make(map[string]*ResponseCache)
+)
+
+// NewResponseCache create the response cache of a chain with the backend of the config
+func NewResponseCache(config *env.CacheConfig, namespace string) (*ResponseCache, error) {
+	size := config.MaxSizeMB
+	if size <= 0 {
+		size = cacheDefaultSizeMB
+	}
+	var backend CacheBackend
+	switch config.Backend {
+	case env.CacheDisk:
+		// the temporary directory of cloud functions is in memory, the disk cache is bounded as well
+		path := config.Path
+		if path == "" {
+			path = filepath.Join(os.TempDir(), "blockchain-functions-cache")
+		}
+		d, err := newDiskCache(filepath.Join(path, namespace), int64(size)<<20)
+		if err != nil {
+			return nil, err
+		}
+		backend = d
+	case env.CacheMemory, "":
+		backend = newMemoryCache(int64(size) << 20)
+	default:
+		return nil, fmt.Errorf("unknown cache backend %s", config.Backend)
+	}
+
+	c := &ResponseCache{
+		backend:   backend,
+		namespace: namespace,
+		stats:     make(map[string]*CacheStats),
+	}
+	cachesMu.Lock()
+	caches[namespace] = c
+	cachesMu.Unlock()
+	return c, nil
+}
+
+// AllCacheStats returns the stats of every response cache by namespace and kind of response
+func AllCacheStats() map[string]map[string]CacheStats {
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+
+	all := make(map[string]map[string]CacheStats, len(caches))
+	for namespace, c := range caches {
+		all[namespace] = c.Stats()
+	}
+	return all
+}
+
+// Stats returns a snapshot of the stats of the cache by kind of response
+func (c *ResponseCache) Stats() map[string]CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make(map[string]CacheStats, len(c.stats))
+	for kind, s := range c.stats {
+		st := *s
+		if st.Hits+st.Misses > 0 {
+			st.HitRatio = float64(st.Hits) / float64(st.Hits+st.Misses)
+		}
+		stats[kind] = st
+	}
+	return stats
+}
+
+// get decode the cached response of the given kind and key into v, returns false on a miss
+func (c *ResponseCache) get(kind string, key string, v interface{}) bool {
+	data, ok := c.backend.Get(kind + "/" + key)
+	if ok && json.Unmarshal(data, v) != nil {
+		ok = false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.kindStats(kind)
+	if ok {
+		s.Hits++
+	} else {
+		s.Misses++
+	}
+	return ok
+}
+
+// set store a response. A failure to store only costs a future refetch, so it is not returned
+func (c *ResponseCache) set(kind string, key string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	if err = c.backend.Set(kind+"/"+key, data); err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.kindStats(kind).Writes++
+}
+
+func (c *ResponseCache) kindStats(kind string) *CacheStats {
+	s, ok := c.stats[kind]
+	if !ok {
+		s = &CacheStats{}
+		c.stats[kind] = s
+	}
+	return s
+}
+
+// memoryCache LRU cache bounded by the total size of its values
+type memoryCache struct {
+	mu      sync.Mutex
+	maxSize int64
+	size    int64
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key   string
+	value []byte
+}
+
+func newMemoryCache(maxSize int64) *memoryCache {
+	return &memoryCache{
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (m *memoryCache) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	m.order.MoveToFront(e)
+	return e.Value.(*memoryEntry).value, true
+}
+
+func (m *memoryCache) Set(key string, value []byte) error {
+	if int64(len(value)) > m.maxSize {
+		return fmt.Errorf("value of %d bytes is larger than the cache", len(value))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.entries[key]; ok {
+		m.size -= int64(len(e.Value.(*memoryEntry).value))
+		m.order.Remove(e)
+	}
+	m.entries[key] = m.order.PushFront(&memoryEntry{key: key, value: value})
+	m.size += int64(len(value))
+
+	for m.size > m.maxSize {
+		last := m.order.Back()
+		entry := last.Value.(*memoryEntry)
+		m.order.Remove(last)
+		delete(m.entries, entry.key)
+		m.size -= int64(len(entry.value))
+	}
+	return nil
+}
+
+// diskCache cache keeping each value in a file under its directory, up to its max size. The least recently
+// used files are removed first, the files left by a previous instance are indexed by modification time
+type diskCache struct {
+	dir     string
+	mu      sync.Mutex
+	maxSize int64
+	size    int64
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type diskEntry struct {
+	name string
+	size int64
+}
+
+func newDiskCache(dir string, maxSize int64) (*diskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	d := &diskCache{
+		dir:     dir,
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		// a temporary file is the write of an entry that was interrupted
+		if strings.HasPrefix(f.Name(), "tmp-") {
+			os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+		d.entries[f.Name()] = d.order.PushFront(&diskEntry{name: f.Name(), size: f.Size()})
+		d.size += f.Size()
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.evict()
+	return d, nil
+}
+
+func (d *diskCache) name(key string) string {
+	return url.PathEscape(key) + ".json"
+}
+
+func (d *diskCache) Get(key string) ([]byte, bool) {
+	name := d.name(key)
+	data, err := ioutil.ReadFile(filepath.Join(d.dir, name))
+	if err != nil {
+		return nil, false
+	}
+	d.mu.Lock()
+	if e, ok := d.entries[name]; ok {
+		d.order.MoveToFront(e)
+	}
+	d.mu.Unlock()
+	return data, true
+}
+
+// Set write the value to a temporary file renamed over the entry, so that readers never see a partial
+// value, then remove the least recently used entries above the max size
+func (d *diskCache) Set(key string, value []byte) error {
+	if int64(len(value)) > d.maxSize {
+		return fmt.Errorf("value of %d bytes is larger than the cache", len(value))
+	}
+	name := d.name(key)
+	f, err := ioutil.TempFile(d.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(value); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err = os.Rename(f.Name(), filepath.Join(d.dir, name)); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.entries[name]; ok {
+		d.size -= e.Value.(*diskEntry).size
+		d.order.Remove(e)
+	}
+	d.entries[name] = d.order.PushFront(&diskEntry{name: name, size: int64(len(value))})
+	d.size += int64(len(value))
+	d.evict()
+	return nil
+}
+
+// evict remove the least recently used files until the cache fits its max size
+func (d *diskCache) evict() {
+	for d.size > d.maxSize {
+		last := d.order.Back()
+		entry := last.Value.(*diskEntry)
+		d.order.Remove(last)
+		delete(d.entries, entry.name)
+		d.size -= entry.size
+		os.Remove(filepath.Join(d.dir, entry.name))
+	}
+}
+
+// cacheDepth tracks the head of a chain to tell whether a block is deep enough to be cached
+type cacheDepth struct {
+	mu            sync.Mutex
+	confirmations int
+	head          int
+	fetchedAt     time.Time
+	fetchHead     func() (int, error)
+}
+
+// observe record a head returned by the provider
+func (d *cacheDepth) observe(head int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if head >= d.head {
+		d.head, d.fetchedAt = head, time.Now()
+	}
+}
+
+// deep returns true if the block at the given height is deeper than the confirmations of the chain.
+// The head is refetched when it is older than the head ttl, and nothing is deep if it cannot be fetched
+func (d *cacheDepth) deep(height int) bool {
+	d.mu.Lock()
+	stale := time.Since(d.fetchedAt) > cacheHeadTTL
+	d.mu.Unlock()
+
+	if stale {
+		head, err := d.fetchHead()
+		if err != nil {
+			return false
+		}
+		d.observe(head)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return height > 0 && height <= d.head-d.confirmations
+}
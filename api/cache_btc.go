@@ -0,0 +1,151 @@
+package api
+
+import (
+	"math/big"
+	"strconv"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+)
+
+// CachedBitcoinClient btc.BitcoinAPI serving the blocks and confirmed transactions deeper than the
+// confirmations of the chain from a response cache, and everything else from its provider
+type CachedBitcoinClient struct {
+	api   btc.BitcoinAPI
+	cache *ResponseCache
+	depth *cacheDepth
+}
+
+// NewCachedBitcoinClient put a response cache in front of a provider
+func NewCachedBitcoinClient(a btc.BitcoinAPI, cache *ResponseCache, confirmations int) *CachedBitcoinClient {
+	c := &CachedBitcoinClient{
+		api:   a,
+		cache: cache,
+	}
+	c.depth = &cacheDepth{
+		confirmations: confirmations,
+		fetchHead: func() (int, error) {
+			head, err := a.GetHeadBlock()
+			if err != nil {
+				return 0, err
+			}
+			return head.Height, nil
+		},
+	}
+	return c
+}
+
+// GetBalance get the balance of the account corresponding to the given address, never cached
+func (c *CachedBitcoinClient) GetBalance(address string) (*big.Int, error) {
+	return c.api.GetBalance(address)
+}
+
+// GetHeadBlock get the head block basic info, never cached
+func (c *CachedBitcoinClient) GetHeadBlock() (*btc.HeadBlock, error) {
+	head, err := c.api.GetHeadBlock()
+	if err != nil {
+		return nil, err
+	}
+	c.depth.observe(head.Height)
+	return head, nil
+}
+
+// GetBlock get the block at the given height along with all of its transactions
+func (c *CachedBitcoinClient) GetBlock(height int) (*btc.Block, error) {
+	key := strconv.Itoa(height)
+	block := &btc.Block{}
+	if c.cache.get(cacheBlock, key, block) {
+		return block, nil
+	}
+
+	block, err := c.api.GetBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	if c.depth.deep(height) {
+		c.cache.set(cacheBlock, key, block)
+	}
+	return block, nil
+}
+
+// GetBlockHash get the hash of the block at the given height
+func (c *CachedBitcoinClient) GetBlockHash(height int) (string, error) {
+	key := strconv.Itoa(height)
+	var hash string
+	if c.cache.get(cacheBlockHash, key, &hash) {
+		return hash, nil
+	}
+
+	hash, err := blockHash(c.api, height)
+	if err != nil {
+		return "", err
+	}
+	if c.depth.deep(height) {
+		c.cache.set(cacheBlockHash, key, hash)
+	}
+	return hash, nil
+}
+
+// GetRawBlock get the raw serialization of the block at the given height
+func (c *CachedBitcoinClient) GetRawBlock(height int) ([]byte, error) {
+	raw, ok := c.api.(btc.RawBlockAPI)
+	if !ok {
+		return nil, errUnsupported
+	}
+
+	key := strconv.Itoa(height)
+	var data []byte
+	if c.cache.get(cacheRawBlock, key, &data) {
+		return data, nil
+	}
+
+	data, err := raw.GetRawBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	if c.depth.deep(height) {
+		c.cache.set(cacheRawBlock, key, data)
+	}
+	return data, nil
+}
+
+// GetTransactionsFromBlock extract and parse transactions from a given block
+func (c *CachedBitcoinClient) GetTransactionsFromBlock(block *btc.Block) ([]*btc.Transaction, []error) {
+	return c.api.GetTransactionsFromBlock(block)
+}
+
+// GetTransactionByHash get the detail of a confirmed transaction from its hash. Only the transactions
+// of the blocks deeper than the confirmations are cached, the others can still be reorganized
+func (c *CachedBitcoinClient) GetTransactionByHash(hash string) (*btc.Transaction, error) {
+	tx := &btc.Transaction{}
+	if c.cache.get(cacheTransaction, hash, tx) {
+		return tx, nil
+	}
+
+	tx, err := c.api.GetTransactionByHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	if tx != nil && c.depth.deep(tx.BlockHeight) {
+		c.cache.set(cacheTransaction, hash, tx)
+	}
+	return tx, nil
+}
+
+// GetRawTransaction get the raw serialization of a transaction from its hash. Its block is unknown, so
+// it is never cached
+func (c *CachedBitcoinClient) GetRawTransaction(hash string) ([]byte, error) {
+	raw, ok := c.api.(btc.RawTransactionAPI)
+	if !ok {
+		return nil, errUnsupported
+	}
+	return raw.GetRawTransaction(hash)
+}
+
+// GetFeeEstimates get the fee estimates of the provider, never cached
+func (c *CachedBitcoinClient) GetFeeEstimates() (map[int]float64, error) {
+	fe, ok := c.api.(btc.FeeEstimateAPI)
+	if !ok {
+		return nil, errUnsupported
+	}
+	return fe.GetFeeEstimates()
+}
@@ -0,0 +1,317 @@
+package api
+
+import (
+	"math/big"
+	"strconv"
+
+	ethinfura "github.com/INFURA/go-ethlibs/eth"
+	"github.com/SoteriaTech/blockchain-functions/eth"
+)
+
+// CachedEthereumClient eth.EthereumAPI serving the blocks, transactions and receipts deeper than the
+// confirmations of the chain from a response cache, and everything else from its provider
+type CachedEthereumClient struct {
+	api   eth.EthereumAPI
+	cache *ResponseCache
+	depth *cacheDepth
+}
+
+// NewCachedEthereumClient put a response cache in front of a provider
+func NewCachedEthereumClient(a eth.EthereumAPI, cache *ResponseCache, confirmations int) *CachedEthereumClient {
+	c := &CachedEthereumClient{
+		api:   a,
+		cache: cache,
+	}
+	c.depth = &cacheDepth{
+		confirmations: confirmations,
+		fetchHead: func() (int, error) {
+			head, err := a.GetBlockHeader()
+			return int(head), err
+		},
+	}
+	return c
+}
+
+// GetBlockHeader get the height of the latest block, never cached
+func (c *CachedEthereumClient) GetBlockHeader() (uint64, error) {
+	head, err := c.api.GetBlockHeader()
+	if err != nil {
+		return 0, err
+	}
+	c.depth.observe(int(head))
+	return head, nil
+}
+
+// GetTransactionsFromBlock get the transactions from the block body
+func (c *CachedEthereumClient) GetTransactionsFromBlock(h *big.Int) (*eth.BlockData, error) {
+	key := h.String()
+	bd := &eth.BlockData{}
+	if c.cache.get(cacheBlock, key, bd) {
+		return bd, nil
+	}
+
+	bd, err := c.api.GetTransactionsFromBlock(h)
+	if err != nil {
+		return nil, err
+	}
+	if c.depth.deep(int(h.Int64())) {
+		c.cache.set(cacheBlock, key, bd)
+	}
+	return bd, nil
+}
+
+// GetBlockHash get the hash of the block at the given height
+func (c *CachedEthereumClient) GetBlockHash(h uint64) (string, error) {
+	key := strconv.FormatUint(h, 10)
+	var hash string
+	if c.cache.get(cacheBlockHash, key, &hash) {
+		return hash, nil
+	}
+
+	hash, err := ethBlockHash(c.api, h)
+	if err != nil {
+		return "", err
+	}
+	if c.depth.deep(int(h)) {
+		c.cache.set(cacheBlockHash, key, hash)
+	}
+	return hash, nil
+}
+
+// GetTransactionByHash get a transaction from its hash
+func (c *CachedEthereumClient) GetTransactionByHash(hash string, b int) (*eth.Transaction, error) {
+	tx := &eth.Transaction{}
+	if c.cache.get(cacheTransaction, hash, tx) {
+		return tx, nil
+	}
+
+	tx, err := c.api.GetTransactionByHash(hash, b)
+	if err != nil {
+		return nil, err
+	}
+	if tx != nil && c.depth.deep(tx.BlockHeight) {
+		c.cache.set(cacheTransaction, hash, tx)
+	}
+	return tx, nil
+}
+
+// GetReceipt get the receipt of a transaction
+func (c *CachedEthereumClient) GetReceipt(hash string) (*ethinfura.TransactionReceipt, error) {
+	r := &ethinfura.TransactionReceipt{}
+	if c.cache.get(cacheReceipt, hash, r) {
+		return r, nil
+	}
+
+	r, err := c.api.GetReceipt(hash)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil && c.depth.deep(int(r.BlockNumber.Int64())) {
+		c.cache.set(cacheReceipt, hash, r)
+	}
+	return r, nil
+}
+
+// Call call a contract at the given block, never cached
+func (c *CachedEthereumClient) Call(to string, data string, block uint64) (string, error) {
+	caller, ok := c.api.(eth.CallAPI)
+	if !ok {
+		return "", errUnsupported
+	}
+	return caller.Call(to, data, block)
+}
+
+// GasPrice get the current gas price, never cached
+func (c *CachedEthereumClient) GasPrice() (*big.Int, error) {
+	g, ok := c.api.(eth.GasPriceAPI)
+	if !ok {
+		return nil, errUnsupported
+	}
+	return g.GasPrice()
+}
+
+// GetBlockHeaderByTag get the header of the finalized or safe block, never cached since they move
+func (c *CachedEthereumClient) GetBlockHeaderByTag(tag string) (*eth.Header, error) {
+	f, ok := c.api.(eth.FinalityAPI)
+	if !ok {
+		return nil, errUnsupported
+	}
+	return f.GetBlockHeaderByTag(tag)
+}
+
+// GetCode get the code of an address, never cached since a contract can be deployed at any time
+func (c *CachedEthereumClient) GetCode(addr string, block uint64) (string, error) {
+	g, ok := c.api.(eth.CodeAPI)
+	if !ok {
+		return "", errUnsupported
+	}
+	return g.GetCode(addr, block)
+}
+
+// ChainID get the chain id, never cached since the service keeps it
+func (c *CachedEthereumClient) ChainID() (*big.Int, error) {
+	t, ok := c.api.(eth.TxAPI)
+	if !ok {
+		return nil, errUnsupported
+	}
+	return t.ChainID()
+}
+
+// EstimateGas estimate the gas of a transaction, never cached
+func (c *CachedEthereumClient) EstimateGas(msg *eth.CallMsg) (uint64, error) {
+	t, ok := c.api.(eth.TxAPI)
+	if !ok {
+		return 0, errUnsupported
+	}
+	return t.EstimateGas(msg)
+}
+
+// FeeHistory get the fees of the recent blocks, never cached
+func (c *CachedEthereumClient) FeeHistory(blocks int, percentiles []float64) (*eth.FeeHistory, error) {
+	t, ok := c.api.(eth.TxAPI)
+	if !ok {
+		return nil, errUnsupported
+	}
+	return t.FeeHistory(blocks, percentiles)
+}
+
+// NonceAt get the nonce of an address, never cached
+func (c *CachedEthereumClient) NonceAt(addr string, pending bool) (uint64, error) {
+	t, ok := c.api.(eth.TxAPI)
+	if !ok {
+		return 0, errUnsupported
+	}
+	return t.NonceAt(addr, pending)
+}
+
+// SendRawTransaction broadcast a signed transaction
+func (c *CachedEthereumClient) SendRawTransaction(raw string) (string, error) {
+	t, ok := c.api.(eth.TxAPI)
+	if !ok {
+		return "", errUnsupported
+	}
+	return t.SendRawTransaction(raw)
+}
+
+// GetLogs get the logs matching a filter, never cached
+func (c *CachedEthereumClient) GetLogs(filter *eth.LogFilter) ([]*eth.Log, error) {
+	l, ok := c.api.(eth.LogsAPI)
+	if !ok {
+		return nil, errUnsupported
+	}
+	return l.GetLogs(filter)
+}
+
+// TraceBlock trace the calls of the block at the given height
+func (c *CachedEthereumClient) TraceBlock(h uint64, tracer string) ([]*eth.Trace, error) {
+	t, ok := c.api.(eth.TraceAPI)
+	if !ok {
+		return nil, errUnsupported
+	}
+
+	key := tracer + "/" + strconv.FormatUint(h, 10)
+	var traces []*eth.Trace
+	if c.cache.get(cacheTrace, key, &traces) {
+		return traces, nil
+	}
+
+	traces, err := t.TraceBlock(h, tracer)
+	if err != nil {
+		return nil, err
+	}
+	if c.depth.deep(int(h)) {
+		c.cache.set(cacheTrace, key, traces)
+	}
+	return traces, nil
+}
+
+// GetReceipts get the receipts of the given transactions, only the ones missing from the cache are requested
+func (c *CachedEthereumClient) GetReceipts(hashes []string) ([]*ethinfura.TransactionReceipt, []error, error) {
+	receipts := make([]*ethinfura.TransactionReceipt, len(hashes))
+	errs := make([]error, len(hashes))
+	var missing []int
+	var missingHashes []string
+	for i, h := range hashes {
+		r := &ethinfura.TransactionReceipt{}
+		if c.cache.get(cacheReceipt, h, r) {
+			receipts[i] = r
+			continue
+		}
+		missing = append(missing, i)
+		missingHashes = append(missingHashes, h)
+	}
+	if len(missing) == 0 {
+		return receipts, errs, nil
+	}
+
+	found, foundErrs, err := batchReceipts(c.api, missingHashes)
+	if err != nil {
+		return nil, nil, err
+	}
+	for n, i := range missing {
+		receipts[i], errs[i] = found[n], foundErrs[n]
+		if r := found[n]; r != nil && foundErrs[n] == nil && c.depth.deep(int(r.BlockNumber.Int64())) {
+			c.cache.set(cacheReceipt, hashes[i], r)
+		}
+	}
+	return receipts, errs, nil
+}
+
+// GetTransactionsByHash get the given transactions, only the ones missing from the cache are requested
+func (c *CachedEthereumClient) GetTransactionsByHash(hashes []string) ([]*eth.Transaction, []error, error) {
+	txs := make([]*eth.Transaction, len(hashes))
+	errs := make([]error, len(hashes))
+	var missing []int
+	var missingHashes []string
+	for i, h := range hashes {
+		tx := &eth.Transaction{}
+		if c.cache.get(cacheTransaction, h, tx) {
+			txs[i] = tx
+			continue
+		}
+		missing = append(missing, i)
+		missingHashes = append(missingHashes, h)
+	}
+	if len(missing) == 0 {
+		return txs, errs, nil
+	}
+
+	found, foundErrs, err := batchTransactions(c.api, missingHashes)
+	if err != nil {
+		return nil, nil, err
+	}
+	for n, i := range missing {
+		txs[i], errs[i] = found[n], foundErrs[n]
+		if tx := found[n]; tx != nil && foundErrs[n] == nil && c.depth.deep(tx.BlockHeight) {
+			c.cache.set(cacheTransaction, hashes[i], tx)
+		}
+	}
+	return txs, errs, nil
+}
+
+// Calls call the given contracts at the given block, never cached
+func (c *CachedEthereumClient) Calls(calls []*eth.ContractCall, block uint64) ([]string, []error, error) {
+	b, ok := c.api.(eth.BatchAPI)
+	if !ok {
+		return nil, nil, errUnsupported
+	}
+	return b.Calls(calls, block)
+}
+
+// GetL1Fees get the L1 data fees of the given transactions, never cached
+func (c *CachedEthereumClient) GetL1Fees(hashes []string) ([]*big.Int, []error, error) {
+	l, ok := c.api.(eth.L1FeeAPI)
+	if !ok {
+		return nil, nil, errUnsupported
+	}
+	return l.GetL1Fees(hashes)
+}
+
+// GetBalances get the balances of the given addresses, never cached
+func (c *CachedEthereumClient) GetBalances(addresses []string, block uint64) ([]*big.Int, []error, error) {
+	b, ok := c.api.(eth.BatchAPI)
+	if !ok {
+		return nil, nil, errUnsupported
+	}
+	return b.GetBalances(addresses, block)
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testBackend checks the LRU bound shared by the memory and disk caches, for a cache of 10 bytes
+func testBackend(t *testing.T, c CacheBackend) {
+	for _, key := range []string{"a", "b", "c"} {
+		if err := c.Set(key, []byte("123")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a is used, so b is the least recently used entry when d does not fit
+	if v, ok := c.Get("a"); !ok || string(v) != "123" {
+		t.Fatalf("Get(a) = %s %v", v, ok)
+	}
+	if err := c.Set("d", []byte("1234")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("b should be evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s should be cached", key)
+		}
+	}
+
+	// replacing an entry accounts for its new size only
+	if err := c.Set("d", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("e", []byte("123")); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "c", "d", "e"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s should be cached", key)
+		}
+	}
+
+	if err := c.Set("f", []byte("12345678901")); err == nil {
+		t.Errorf("a value larger than the cache should be rejected")
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	m := newMemoryCache(10)
+	testBackend(t, m)
+	if m.size > m.maxSize || m.size != 10 {
+		t.Errorf("size %d for a max size of %d", m.size, m.maxSize)
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := newDiskCache(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBackend(t, d)
+
+	files, _ := ioutil.ReadDir(dir)
+	var size int64
+	for _, f := range files {
+		size += f.Size()
+	}
+	if len(files) != 4 || size != 10 {
+		t.Errorf("%d files of %d bytes left on disk, want 4 of 10 bytes", len(files), size)
+	}
+}
+
+func TestDiskCacheReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := newDiskCache(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range []string{"block/1", "block/2", "block/3"} {
+		if err = d.Set(key, []byte("123")); err != nil {
+			t.Fatal(err)
+		}
+		// distinct modification times, the order of the entries once reopened
+		at := time.Now().Add(time.Duration(i-3) * time.Minute)
+		if err = os.Chtimes(filepath.Join(dir, d.name(key)), at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "tmp-123"), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a smaller instance removes the interrupted write and the oldest entries
+	d, err = newDiskCache(dir, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "tmp-123")); !os.IsNotExist(err) {
+		t.Errorf("temporary file should be removed: %v", err)
+	}
+	if d.size != 6 || len(d.entries) != 2 {
+		t.Errorf("reopened with %d entries of %d bytes, want 2 of 6 bytes", len(d.entries), d.size)
+	}
+	if _, ok := d.Get("block/3"); !ok {
+		t.Errorf("the most recent entry should be kept")
+	}
+	files, _ := ioutil.ReadDir(dir)
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), "tmp-") {
+			t.Errorf("file %s left in the cache", f.Name())
+		}
+	}
+}
+
+func TestResponseCacheStats(t *testing.T) {
+	c := &ResponseCache{backend: newMemoryCache(1 << 10), namespace: "test", stats: make(map[string]*CacheStats)}
+
+	var v map[string]int
+	if c.get(cacheBlock, "1", &v) {
+		t.Errorf("empty cache should miss")
+	}
+	c.set(cacheBlock, "1", map[string]int{"height": 1})
+	if !c.get(cacheBlock, "1", &v) || v["height"] != 1 {
+		t.Errorf("cached block = %v", v)
+	}
+
+	s := c.Stats()[cacheBlock]
+	if s.Hits != 1 || s.Misses != 1 || s.Writes != 1 || s.HitRatio != 0.5 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestCacheDepth(t *testing.T) {
+	fetches := 0
+	d := &cacheDepth{confirmations: 2, fetchHead: func() (int, error) {
+		fetches++
+		return 100, nil
+	}}
+	if !d.deep(98) || d.deep(99) || d.deep(0) {
+		t.Errorf("blocks up to 98 are deep below a head of 100 with 2 confirmations")
+	}
+	if fetches != 1 {
+		t.Errorf("head fetched %d times, want once within its ttl", fetches)
+	}
+
+	d.observe(101)
+	if !d.deep(99) {
+		t.Errorf("an observed head should be used")
+	}
+
+	failing := &cacheDepth{confirmations: 2, fetchHead: func() (int, error) { return 0, errors.New("down") }}
+	if failing.deep(1) {
+		t.Errorf("nothing is deep when the head cannot be fetched")
+	}
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+)
+
+// CompositeBitcoinClient btc.BitcoinAPI that fails over between several providers by priority.
+// When quorum is greater than 1, the head and the hash of every fetched block must be agreed on
+// by at least quorum providers before they are returned. The chain names the providers in the errors
+type CompositeBitcoinClient struct {
+	chain     string
+	providers []btc.BitcoinAPI
+	health    []*providerHealth
+	quorum    int
+}
+
+// NewCompositeBitcoinClient create a new CompositeBitcoinClient of the utxo chain of the given name, with
+// the given quorum
+func NewCompositeBitcoinClient(chain string, quorum int) *CompositeBitcoinClient {
+	return &CompositeBitcoinClient{chain: chain, quorum: quorum}
+}
+
+// Add add a provider to the composite client, providers added first have the highest priority
+func (c *CompositeBitcoinClient) Add(name string, a btc.BitcoinAPI) {
+	c.health = append(c.health, newProviderHealth(name, len(c.providers)))
+	c.providers = append(c.providers, a)
+}
+
+// GetBalance get the balance of the account corresponding to the given address
+func (c *CompositeBitcoinClient) GetBalance(address string) (balance *big.Int, err error) {
+	err = c.failover(func(a btc.BitcoinAPI) (errCall error) {
+		balance, errCall = a.GetBalance(address)
+		return
+	})
+	return
+}
+
+// GetHeadBlock get the head block basic info. In quorum mode, the head returned is the highest
+// block reached by quorum providers and whose hash they agree on
+func (c *CompositeBitcoinClient) GetHeadBlock() (head *btc.HeadBlock, err error) {
+	if c.quorum <= 1 {
+		err = c.failover(func(a btc.BitcoinAPI) (errCall error) {
+			head, errCall = a.GetHeadBlock()
+			return
+		})
+		return
+	}
+
+	heads := make(map[int]*btc.HeadBlock)
+	var heights []int
+	for _, i := range availableProviders(c.health) {
+		h, errHead := c.providers[i].GetHeadBlock()
+		if errHead != nil {
+			c.health[i].failure()
+			continue
+		}
+		c.health[i].success()
+		heads[i] = h
+		heights = append(heights, h.Height)
+	}
+	if len(heights) < c.quorum {
+		return nil, reportProviders(fmt.Errorf("only %d %s providers answered for the head block, quorum is %d", len(heights), c.chain, c.quorum))
+	}
+
+	height := quorumHeight(heights, c.quorum)
+	known := make(map[int]string)
+	for i, h := range heads {
+		if h.Height == height {
+			known[i] = h.Hash
+			head = h
+		}
+	}
+
+	hash, errHash := c.agreeOnHash(height, known)
+	if errHash != nil {
+		return nil, errHash
+	}
+	if head.Hash != hash {
+		head = &btc.HeadBlock{Hash: hash, Height: height}
+	}
+	return head, nil
+}
+
+// GetBlock get the block at the given height. In quorum mode, the hash of the block must be
+// agreed on by quorum providers
+func (c *CompositeBitcoinClient) GetBlock(height int) (block *btc.Block, err error) {
+	var from int
+	err = c.failoverFrom(&from, func(a btc.BitcoinAPI) (errCall error) {
+		block, errCall = a.GetBlock(height)
+		return
+	})
+	if err != nil || c.quorum <= 1 {
+		return
+	}
+
+	hash, errHash := c.agreeOnHash(height, map[int]string{from: block.Hash})
+	if errHash != nil {
+		return nil, errHash
+	}
+	if hash != block.Hash {
+		return nil, reportProviders(fmt.Errorf("block %s at height %d is not the one agreed on by the providers (%s)", block.Hash, height, hash))
+	}
+	return block, nil
+}
+
+// GetBlockHash get the hash of the block at the given height
+func (c *CompositeBitcoinClient) GetBlockHash(height int) (hash string, err error) {
+	var from int
+	err = c.failoverFrom(&from, func(a btc.BitcoinAPI) (errCall error) {
+		hash, errCall = blockHash(a, height)
+		return
+	})
+	if err != nil || c.quorum <= 1 {
+		return
+	}
+	return c.agreeOnHash(height, map[int]string{from: hash})
+}
+
+// GetRawBlock get the raw serialization of the block at the given height from the providers able
+// to return it. In quorum mode, the hash of the raw block must be agreed on by quorum providers
+func (c *CompositeBitcoinClient) GetRawBlock(height int) (data []byte, err error) {
+	var from int
+	err = c.failoverFrom(&from, func(a btc.BitcoinAPI) (errCall error) {
+		raw, ok := a.(btc.RawBlockAPI)
+		if !ok {
+			return errUnsupported
+		}
+		data, errCall = raw.GetRawBlock(height)
+		return
+	})
+	if err != nil || c.quorum <= 1 {
+		return
+	}
+
+	block, errDecode := btc.DecodeBlock(data)
+	if errDecode != nil {
+		return nil, errDecode
+	}
+	hash, errHash := c.agreeOnHash(height, map[int]string{from: block.Hash})
+	if errHash != nil {
+		return nil, errHash
+	}
+	if hash != block.Hash {
+		return nil, reportProviders(fmt.Errorf("raw block %s at height %d is not the one agreed on by the providers (%s)", block.Hash, height, hash))
+	}
+	return data, nil
+}
+
+// GetTransactionsFromBlock extract and parse transactions from a given block
+func (c *CompositeBitcoinClient) GetTransactionsFromBlock(block *btc.Block) (txs []*btc.Transaction, errs []error) {
+	err := c.failover(func(a btc.BitcoinAPI) error {
+		txs, errs = a.GetTransactionsFromBlock(block)
+		if len(errs) > 0 {
+			return errs[0]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, []error{err}
+	}
+	return
+}
+
+// GetTransactionByHash get the detail of a transaction from its hash
+func (c *CompositeBitcoinClient) GetTransactionByHash(hash string) (tx *btc.Transaction, err error) {
+	err = c.failover(func(a btc.BitcoinAPI) (errCall error) {
+		tx, errCall = a.GetTransactionByHash(hash)
+		return
+	})
+	return
+}
+
+// GetRawTransaction get the raw serialization of a transaction from the providers able to return it
+func (c *CompositeBitcoinClient) GetRawTransaction(hash string) (data []byte, err error) {
+	err = c.failover(func(a btc.BitcoinAPI) (errCall error) {
+		raw, ok := a.(btc.RawTransactionAPI)
+		if !ok {
+			return errUnsupported
+		}
+		data, errCall = raw.GetRawTransaction(hash)
+		return
+	})
+	return
+}
+
+// GetFeeEstimates get the fee estimates from the providers able to return them
+func (c *CompositeBitcoinClient) GetFeeEstimates() (estimates map[int]float64, err error) {
+	err = c.failover(func(a btc.BitcoinAPI) (errCall error) {
+		fe, ok := a.(btc.FeeEstimateAPI)
+		if !ok {
+			return errUnsupported
+		}
+		estimates, errCall = fe.GetFeeEstimates()
+		return
+	})
+	return
+}
+
+func (c *CompositeBitcoinClient) failover(call func(a btc.BitcoinAPI) error) error {
+	var from int
+	return c.failoverFrom(&from, call)
+}
+
+// failoverFrom call the providers in order until one succeeds and set from to its index
+func (c *CompositeBitcoinClient) failoverFrom(from *int, call func(a btc.BitcoinAPI) error) error {
+	var msgs []string
+	for _, i := range orderProviders(c.health) {
+		err := call(c.providers[i])
+		if err == nil {
+			c.health[i].success()
+			*from = i
+			return nil
+		}
+		if err != errUnsupported {
+			c.health[i].failure()
+		}
+		msgs = append(msgs, c.health[i].name+": "+err.Error())
+	}
+	return fmt.Errorf("all %s providers failed: %s", c.chain, strings.Join(msgs, "; "))
+}
+
+// agreeOnHash ask the providers for the hash of the block at the given height until quorum of them agree
+func (c *CompositeBitcoinClient) agreeOnHash(height int, known map[int]string) (string, error) {
+	return agreeOnHash(c.chain, height, c.quorum, availableProviders(c.health), known, func(i int) (string, error) {
+		h, err := blockHash(c.providers[i], height)
+		if err != nil {
+			c.health[i].failure()
+			return "", err
+		}
+		c.health[i].success()
+		return h, nil
+	})
+}
+
+// blockHash get the hash of the block at the given height, without its transactions when the provider allows it
+func blockHash(a btc.BitcoinAPI, height int) (string, error) {
+	if bh, ok := a.(btc.BlockHashAPI); ok {
+		return bh.GetBlockHash(height)
+	}
+	block, err := a.GetBlock(height)
+	if err != nil {
+		return "", err
+	}
+	return block.Hash, nil
+}
@@ -0,0 +1,390 @@
+package api
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	ethinfura "github.com/INFURA/go-ethlibs/eth"
+	"github.com/SoteriaTech/blockchain-functions/eth"
+)
+
+// CompositeEthereumClient eth.EthereumAPI that fails over between several providers by priority.
+// When quorum is greater than 1, the head height and the hash of every fetched block must be
+// agreed on by at least quorum providers before they are returned
+type CompositeEthereumClient struct {
+	providers []eth.EthereumAPI
+	health    []*providerHealth
+	quorum    int
+}
+
+// NewCompositeEthereumClient create a new CompositeEthereumClient with the given quorum
+func NewCompositeEthereumClient(quorum int) *CompositeEthereumClient {
+	return &CompositeEthereumClient{quorum: quorum}
+}
+
+// Add add a provider to the composite client, providers added first have the highest priority
+func (c *CompositeEthereumClient) Add(name string, a eth.EthereumAPI) {
+	c.health = append(c.health, newProviderHealth(name, len(c.providers)))
+	c.providers = append(c.providers, a)
+}
+
+// GetBlockHeader get the height of the latest block. In quorum mode, it is the highest block
+// reached by quorum providers
+func (c *CompositeEthereumClient) GetBlockHeader() (head uint64, err error) {
+	if c.quorum <= 1 {
+		err = c.failover(func(a eth.EthereumAPI) (errCall error) {
+			head, errCall = a.GetBlockHeader()
+			return
+		})
+		return
+	}
+
+	var heights []int
+	for _, i := range availableProviders(c.health) {
+		h, errHead := c.providers[i].GetBlockHeader()
+		if errHead != nil {
+			c.health[i].failure()
+			continue
+		}
+		c.health[i].success()
+		heights = append(heights, int(h))
+	}
+	if len(heights) < c.quorum {
+		return 0, reportProviders(fmt.Errorf("only %d ethereum providers answered for the head block, quorum is %d", len(heights), c.quorum))
+	}
+
+	height := quorumHeight(heights, c.quorum)
+	if _, errHash := c.agreeOnHash(uint64(height), map[int]string{}); errHash != nil {
+		return 0, errHash
+	}
+	return uint64(height), nil
+}
+
+// GetTransactionsFromBlock get the transactions from the block body. In quorum mode, the hash
+// of the block must be agreed on by quorum providers
+func (c *CompositeEthereumClient) GetTransactionsFromBlock(h *big.Int) (bd *eth.BlockData, err error) {
+	var from int
+	err = c.failoverFrom(&from, func(a eth.EthereumAPI) (errCall error) {
+		bd, errCall = a.GetTransactionsFromBlock(h)
+		return
+	})
+	if err != nil || c.quorum <= 1 {
+		return
+	}
+
+	hash, errHash := c.agreeOnHash(h.Uint64(), map[int]string{from: bd.Meta.Hash})
+	if errHash != nil {
+		return nil, errHash
+	}
+	if hash != bd.Meta.Hash {
+		return nil, reportProviders(fmt.Errorf("block %s at height %d is not the one agreed on by the providers (%s)", bd.Meta.Hash, h.Uint64(), hash))
+	}
+	return bd, nil
+}
+
+// GetBlockHash get the hash of the block at the given height
+func (c *CompositeEthereumClient) GetBlockHash(h uint64) (hash string, err error) {
+	var from int
+	err = c.failoverFrom(&from, func(a eth.EthereumAPI) (errCall error) {
+		hash, errCall = ethBlockHash(a, h)
+		return
+	})
+	if err != nil || c.quorum <= 1 {
+		return
+	}
+	return c.agreeOnHash(h, map[int]string{from: hash})
+}
+
+// GetTransactionByHash get a transaction from its hash
+func (c *CompositeEthereumClient) GetTransactionByHash(hash string, b int) (tx *eth.Transaction, err error) {
+	err = c.failover(func(a eth.EthereumAPI) (errCall error) {
+		tx, errCall = a.GetTransactionByHash(hash, b)
+		return
+	})
+	return
+}
+
+// GetReceipt get the receipt of a transaction
+func (c *CompositeEthereumClient) GetReceipt(hash string) (r *ethinfura.TransactionReceipt, err error) {
+	err = c.failover(func(a eth.EthereumAPI) (errCall error) {
+		r, errCall = a.GetReceipt(hash)
+		return
+	})
+	return
+}
+
+func (c *CompositeEthereumClient) failover(call func(a eth.EthereumAPI) error) error {
+	var from int
+	return c.failoverFrom(&from, call)
+}
+
+// failoverFrom call the providers in order until one succeeds and set from to its index
+func (c *CompositeEthereumClient) failoverFrom(from *int, call func(a eth.EthereumAPI) error) error {
+	var msgs []string
+	for _, i := range orderProviders(c.health) {
+		err := call(c.providers[i])
+		if err == nil {
+			c.health[i].success()
+			*from = i
+			return nil
+		}
+		if err != errUnsupported {
+			c.health[i].failure()
+		}
+		msgs = append(msgs, c.health[i].name+": "+err.Error())
+	}
+	return fmt.Errorf("all ethereum providers failed: %s", strings.Join(msgs, "; "))
+}
+
+// agreeOnHash ask the providers for the hash of the block at the given height until quorum of them agree
+func (c *CompositeEthereumClient) agreeOnHash(h uint64, known map[int]string) (string, error) {
+	return agreeOnHash("ethereum", int(h), c.quorum, availableProviders(c.health), known, func(i int) (string, error) {
+		hash, err := ethBlockHash(c.providers[i], h)
+		if err != nil {
+			c.health[i].failure()
+			return "", err
+		}
+		c.health[i].success()
+		return hash, nil
+	})
+}
+
+// ethBlockHash get the hash of the block at the given height, without its transactions when the provider allows it
+func ethBlockHash(a eth.EthereumAPI, h uint64) (string, error) {
+	if bh, ok := a.(eth.BlockHashAPI); ok {
+		return bh.GetBlockHash(h)
+	}
+	bd, err := a.GetTransactionsFromBlock(new(big.Int).SetUint64(h))
+	if err != nil {
+		return "", err
+	}
+	return bd.Meta.Hash, nil
+}
+
+// GetLogs get the logs matching a filter from the providers able to return them
+func (c *CompositeEthereumClient) GetLogs(filter *eth.LogFilter) (logs []*eth.Log, err error) {
+	err = c.failover(func(a eth.EthereumAPI) (errCall error) {
+		l, ok := a.(eth.LogsAPI)
+		if !ok {
+			return errUnsupported
+		}
+		logs, errCall = l.GetLogs(filter)
+		return
+	})
+	return
+}
+
+// Call call a contract with the providers able to call contracts
+func (c *CompositeEthereumClient) Call(to string, data string, block uint64) (res string, err error) {
+	err = c.failover(func(a eth.EthereumAPI) (errCall error) {
+		caller, ok := a.(eth.CallAPI)
+		if !ok {
+			return errUnsupported
+		}
+		res, errCall = caller.Call(to, data, block)
+		return
+	})
+	return
+}
+
+// GasPrice get the current gas price from the providers able to return it
+func (c *CompositeEthereumClient) GasPrice() (price *big.Int, err error) {
+	err = c.failover(func(a eth.EthereumAPI) (errCall error) {
+		g, ok := a.(eth.GasPriceAPI)
+		if !ok {
+			return errUnsupported
+		}
+		price, errCall = g.GasPrice()
+		return
+	})
+	return
+}
+
+// GetBlockHeaderByTag get the header of the finalized or safe block from the providers able to return it
+func (c *CompositeEthereumClient) GetBlockHeaderByTag(tag string) (header *eth.Header, err error) {
+	err = c.failover(func(a eth.EthereumAPI) (errCall error) {
+		f, ok := a.(eth.FinalityAPI)
+		if !ok {
+			return errUnsupported
+		}
+		header, errCall = f.GetBlockHeaderByTag(tag)
+		return
+	})
+	return
+}
+
+// GetCode get the code of an address from the providers able to return it
+func (c *CompositeEthereumClient) GetCode(addr string, block uint64) (code string, err error) {
+	err = c.failover(func(a eth.EthereumAPI) (errCall error) {
+		g, ok := a.(eth.CodeAPI)
+		if !ok {
+			return errUnsupported
+		}
+		code, errCall = g.GetCode(addr, block)
+		return
+	})
+	return
+}
+
+// ChainID get the chain id from the providers able to build transactions
+func (c *CompositeEthereumClient) ChainID() (id *big.Int, err error) {
+	err = c.failover(func(a eth.EthereumAPI) (errCall error) {
+		t, ok := a.(eth.TxAPI)
+		if !ok {
+			return errUnsupported
+		}
+		id, errCall = t.ChainID()
+		return
+	})
+	return
+}
+
+// EstimateGas estimate the gas of a transaction with the providers able to build transactions
+func (c *CompositeEthereumClient) EstimateGas(msg *eth.CallMsg) (gas uint64, err error) {
+	err = c.failover(func(a eth.EthereumAPI) (errCall error) {
+		t, ok := a.(eth.TxAPI)
+		if !ok {
+			return errUnsupported
+		}
+		gas, errCall = t.EstimateGas(msg)
+		return
+	})
+	return
+}
+
+// FeeHistory get the fees of the recent blocks from the providers able to build transactions
+func (c *CompositeEthereumClient) FeeHistory(blocks int, percentiles []float64) (history *eth.FeeHistory, err error) {
+	err = c.failover(func(a eth.EthereumAPI) (errCall error) {
+		t, ok := a.(eth.TxAPI)
+		if !ok {
+			return errUnsupported
+		}
+		history, errCall = t.FeeHistory(blocks, percentiles)
+		return
+	})
+	return
+}
+
+// NonceAt get the nonce of an address from the providers able to build transactions
+func (c *CompositeEthereumClient) NonceAt(addr string, pending bool) (nonce uint64, err error) {
+	err = c.failover(func(a eth.EthereumAPI) (errCall error) {
+		t, ok := a.(eth.TxAPI)
+		if !ok {
+			return errUnsupported
+		}
+		nonce, errCall = t.NonceAt(addr, pending)
+		return
+	})
+	return
+}
+
+// SendRawTransaction broadcast a signed transaction with the providers able to build transactions. A
+// provider that failed can have broadcast it, the next one then answers that it already knows it
+func (c *CompositeEthereumClient) SendRawTransaction(raw string) (hash string, err error) {
+	err = c.failover(func(a eth.EthereumAPI) (errCall error) {
+		t, ok := a.(eth.TxAPI)
+		if !ok {
+			return errUnsupported
+		}
+		hash, errCall = t.SendRawTransaction(raw)
+		return
+	})
+	return
+}
+
+// TraceBlock trace the calls of a block with the providers able to trace them
+func (c *CompositeEthereumClient) TraceBlock(h uint64, tracer string) (traces []*eth.Trace, err error) {
+	err = c.failover(func(a eth.EthereumAPI) (errCall error) {
+		t, ok := a.(eth.TraceAPI)
+		if !ok {
+			return errUnsupported
+		}
+		traces, errCall = t.TraceBlock(h, tracer)
+		return
+	})
+	return
+}
+
+// GetReceipts get the receipts of the given transactions, in batches when the provider allows it
+func (c *CompositeEthereumClient) GetReceipts(hashes []string) (receipts []*ethinfura.TransactionReceipt, errs []error, err error) {
+	err = c.failover(func(a eth.EthereumAPI) (errCall error) {
+		receipts, errs, errCall = batchReceipts(a, hashes)
+		return
+	})
+	return
+}
+
+// GetTransactionsByHash get the given transactions, in batches when the provider allows it
+func (c *CompositeEthereumClient) GetTransactionsByHash(hashes []string) (txs []*eth.Transaction, errs []error, err error) {
+	err = c.failover(func(a eth.EthereumAPI) (errCall error) {
+		txs, errs, errCall = batchTransactions(a, hashes)
+		return
+	})
+	return
+}
+
+// Calls call the given contracts at the given block from the providers able to batch them
+func (c *CompositeEthereumClient) Calls(calls []*eth.ContractCall, block uint64) (results []string, errs []error, err error) {
+	err = c.failover(func(a eth.EthereumAPI) (errCall error) {
+		b, ok := a.(eth.BatchAPI)
+		if !ok {
+			return errUnsupported
+		}
+		results, errs, errCall = b.Calls(calls, block)
+		return
+	})
+	return
+}
+
+// GetL1Fees get the L1 data fees of the given transactions from the providers able to return them
+func (c *CompositeEthereumClient) GetL1Fees(hashes []string) (fees []*big.Int, errs []error, err error) {
+	err = c.failover(func(a eth.EthereumAPI) (errCall error) {
+		l, ok := a.(eth.L1FeeAPI)
+		if !ok {
+			return errUnsupported
+		}
+		fees, errs, errCall = l.GetL1Fees(hashes)
+		return
+	})
+	return
+}
+
+// GetBalances get the balances of the given addresses from the providers able to batch them
+func (c *CompositeEthereumClient) GetBalances(addresses []string, block uint64) (balances []*big.Int, errs []error, err error) {
+	err = c.failover(func(a eth.EthereumAPI) (errCall error) {
+		b, ok := a.(eth.BatchAPI)
+		if !ok {
+			return errUnsupported
+		}
+		balances, errs, errCall = b.GetBalances(addresses, block)
+		return
+	})
+	return
+}
+
+// batchReceipts get the receipts of the given transactions in batches, or one by one when the provider cannot batch them
+func batchReceipts(a eth.EthereumAPI, hashes []string) ([]*ethinfura.TransactionReceipt, []error, error) {
+	if b, ok := a.(eth.BatchAPI); ok {
+		return b.GetReceipts(hashes)
+	}
+	receipts := make([]*ethinfura.TransactionReceipt, len(hashes))
+	errs := make([]error, len(hashes))
+	for i, h := range hashes {
+		receipts[i], errs[i] = a.GetReceipt(h)
+	}
+	return receipts, errs, nil
+}
+
+// batchTransactions get the given transactions in batches, or one by one when the provider cannot batch them
+func batchTransactions(a eth.EthereumAPI, hashes []string) ([]*eth.Transaction, []error, error) {
+	if b, ok := a.(eth.BatchAPI); ok {
+		return b.GetTransactionsByHash(hashes)
+	}
+	txs := make([]*eth.Transaction, len(hashes))
+	errs := make([]error, len(hashes))
+	for i, h := range hashes {
+		txs[i], errs[i] = a.GetTransactionByHash(h, 0)
+	}
+	return txs, errs, nil
+}
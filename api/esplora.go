@@ -0,0 +1,291 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+)
+
+// esploraPageSize number of transactions returned by esplora for each page of /block/:hash/txs
+const esploraPageSize int = 25
+
+// EsploraClient structure of the Esplora (Blockstream/electrs) REST api client
+type EsploraClient struct {
+	transport *Transport
+	endpoint  string
+}
+
+type esploraBlock struct {
+	ID                string `json:"id"`
+	Height            int    `json:"height"`
+	Version           int    `json:"version"`
+	Timestamp         int    `json:"timestamp"`
+	TxCount           int    `json:"tx_count"`
+	MerkleRoot        string `json:"merkle_root"`
+	PreviousBlockHash string `json:"previousblockhash"`
+	Nonce             int    `json:"nonce"`
+}
+
+type esploraTxStatus struct {
+	Confirmed   bool   `json:"confirmed"`
+	BlockHeight int    `json:"block_height"`
+	BlockHash   string `json:"block_hash"`
+	BlockTime   int    `json:"block_time"`
+}
+
+type esploraOutput struct {
+	ScriptPubKey        string  `json:"scriptpubkey"`
+	ScriptPubKeyType    string  `json:"scriptpubkey_type"`
+	ScriptPubKeyAddress string  `json:"scriptpubkey_address"`
+	Value               big.Int `json:"value"`
+}
+
+type esploraInput struct {
+	TxID       string         `json:"txid"`
+	Vout       int            `json:"vout"`
+	PrevOut    *esploraOutput `json:"prevout"`
+	ScriptSig  string         `json:"scriptsig"`
+	IsCoinbase bool           `json:"is_coinbase"`
+	Sequence   int            `json:"sequence"`
+}
+
+type esploraTx struct {
+	TxID    string           `json:"txid"`
+	Version int              `json:"version"`
+	Vin     []*esploraInput  `json:"vin"`
+	Vout    []*esploraOutput `json:"vout"`
+	Size    int              `json:"size"`
+	Weight  int              `json:"weight"`
+	Fee     big.Int          `json:"fee"`
+	Status  esploraTxStatus  `json:"status"`
+}
+
+type esploraStats struct {
+	FundedTxoSum big.Int `json:"funded_txo_sum"`
+	SpentTxoSum  big.Int `json:"spent_txo_sum"`
+}
+
+type esploraAddress struct {
+	Address    string       `json:"address"`
+	ChainStats esploraStats `json:"chain_stats"`
+}
+
+// Esplora instance of the EsploraClient api
+var Esplora *EsploraClient
+
+// InitEsploraClient initialize an instance of Esplora
+func InitEsploraClient(endpoint string) {
+	Esplora = NewEsploraClient(endpoint)
+}
+
+// NewEsploraClient create a new EsploraClient for the given endpoint
+func NewEsploraClient(endpoint string) *EsploraClient {
+	return &EsploraClient{
+		transport: ProviderTransport,
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+	}
+}
+
+// GetBalance get the confirmed balance of the account corresponding to the given address
+func (e *EsploraClient) GetBalance(address string) (*big.Int, error) {
+	acc := &esploraAddress{}
+	if err := e.request("/address/"+address, acc); err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).Sub(&acc.ChainStats.FundedTxoSum, &acc.ChainStats.SpentTxoSum), nil
+}
+
+// GetHeadBlock get the head block basic info
+func (e *EsploraClient) GetHeadBlock() (*btc.HeadBlock, error) {
+	hash, err := e.requestText("/blocks/tip/hash")
+	if err != nil {
+		return nil, err
+	}
+
+	eb := &esploraBlock{}
+	if err = e.request("/block/"+hash, eb); err != nil {
+		return nil, err
+	}
+
+	return &btc.HeadBlock{
+		Hash:   eb.ID,
+		Time:   eb.Timestamp,
+		Height: eb.Height,
+	}, nil
+}
+
+// GetBlock get the block at the given height along with all of its transactions
+func (e *EsploraClient) GetBlock(height int) (*btc.Block, error) {
+	hash, err := e.GetBlockHash(height)
+	if err != nil {
+		return nil, err
+	}
+
+	eb := &esploraBlock{}
+	if err = e.request("/block/"+hash, eb); err != nil {
+		return nil, err
+	}
+
+	block := &btc.Block{
+		Hash:      eb.ID,
+		Ver:       eb.Version,
+		PrevBlock: eb.PreviousBlockHash,
+		MrklRoot:  eb.MerkleRoot,
+		Time:      eb.Timestamp,
+		Nonce:     eb.Nonce,
+		NTx:       eb.TxCount,
+		MainChain: true,
+		Height:    eb.Height,
+	}
+
+	// esplora only returns a page of 25 transactions at a time, so we walk the pages until
+	// every transaction of the block has been fetched
+	for start := 0; start < eb.TxCount; start += esploraPageSize {
+		var page []*esploraTx
+		if err = e.request("/block/"+hash+"/txs/"+strconv.Itoa(start), &page); err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			return nil, fmt.Errorf("esplora returned an empty page at index %d for block %s", start, hash)
+		}
+		for _, t := range page {
+			block.Txs = append(block.Txs, *formatEsploraTx(t))
+		}
+	}
+
+	return block, nil
+}
+
+// GetBlockHash get the hash of the block at the given height
+func (e *EsploraClient) GetBlockHash(height int) (string, error) {
+	return e.requestText("/block-height/" + strconv.Itoa(height))
+}
+
+// GetRawBlock get the raw serialization of the block at the given height
+func (e *EsploraClient) GetRawBlock(height int) ([]byte, error) {
+	hash, err := e.GetBlockHash(height)
+	if err != nil {
+		return nil, err
+	}
+	return e.get("/block/" + hash + "/raw")
+}
+
+// GetTransactionsFromBlock extract and parse transactions from a given block
+func (e *EsploraClient) GetTransactionsFromBlock(block *btc.Block) ([]*btc.Transaction, []error) {
+	var txs []*btc.Transaction
+	var errs []error
+	for _, tx := range block.Txs {
+		txs = append(txs, parseTx(&tx, block.Height)...)
+	}
+	return txs, errs
+}
+
+// GetTransactionByHash get the detail of a confirmed transaction from its hash
+func (e *EsploraClient) GetTransactionByHash(hash string) (*btc.Transaction, error) {
+	t := &esploraTx{}
+	if err := e.request("/tx/"+hash, t); err != nil {
+		return nil, err
+	}
+	if !t.Status.Confirmed {
+		return nil, fmt.Errorf("transaction %s is not confirmed yet", hash)
+	}
+
+	return &btc.Transaction{
+		Hash:        t.TxID,
+		BlockHeight: t.Status.BlockHeight,
+	}, nil
+}
+
+// GetFeeEstimates get the fee rates in satoshis per vbyte by confirmation target in blocks
+func (e *EsploraClient) GetFeeEstimates() (map[int]float64, error) {
+	raw := make(map[string]float64)
+	if err := e.request("/fee-estimates", &raw); err != nil {
+		return nil, err
+	}
+
+	estimates := make(map[int]float64, len(raw))
+	for k, v := range raw {
+		target, err := strconv.Atoi(k)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fee estimate target %s", k)
+		}
+		estimates[target] = v
+	}
+	return estimates, nil
+}
+
+// GetRawTransaction get the raw serialization of a transaction from its hash
+func (e *EsploraClient) GetRawTransaction(hash string) ([]byte, error) {
+	return e.get("/tx/" + hash + "/raw")
+}
+
+func (e *EsploraClient) request(query string, i interface{}) error {
+	data, err := e.get(query)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &i)
+}
+
+func (e *EsploraClient) requestText(query string) (string, error) {
+	data, err := e.get(query)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (e *EsploraClient) get(query string) ([]byte, error) {
+	return e.transport.Get(context.Background(), e.endpoint+query)
+}
+
+func formatEsploraTx(t *esploraTx) *btc.Tx {
+	tx := &btc.Tx{
+		Ver:         t.Version,
+		Size:        t.Size,
+		Weight:      t.Weight,
+		Time:        t.Status.BlockTime,
+		BlockHeight: t.Status.BlockHeight,
+		Fee:         t.Fee,
+		Hash:        t.TxID,
+		VinSz:       len(t.Vin),
+		VoutSz:      len(t.Vout),
+	}
+
+	for _, in := range t.Vin {
+		i := &btc.Inputs{
+			Sequence: in.Sequence,
+			Script:   in.ScriptSig,
+		}
+		if in.PrevOut != nil {
+			i.PrevOut = btc.PrevOut{
+				Hash:   in.TxID,
+				Spent:  true,
+				Addr:   in.PrevOut.ScriptPubKeyAddress,
+				Value:  in.PrevOut.Value,
+				N:      in.Vout,
+				Script: in.PrevOut.ScriptPubKey,
+			}
+		}
+		tx.Inputs = append(tx.Inputs, i)
+	}
+
+	for n, out := range t.Vout {
+		tx.Out = append(tx.Out, &btc.Out{
+			Addr:   out.ScriptPubKeyAddress,
+			Value:  out.Value,
+			N:      n,
+			Script: out.ScriptPubKey,
+		})
+	}
+
+	return tx
+}
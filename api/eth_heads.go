@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	ethinfura "github.com/INFURA/go-ethlibs/eth"
+	"github.com/INFURA/go-ethlibs/node"
+)
+
+// WebsocketHeads eth.NewHeadsAPI subscribing to the newHeads of a websocket endpoint. Each
+// subscription dials its own connection, so that subscribing again after a disconnection reconnects.
+// A subscription without new head for longer than staleAfter is closed as if the connection was lost
+type WebsocketHeads struct {
+	endpoint   string
+	staleAfter time.Duration
+}
+
+// newHeadNotification params of a newHeads notification, only the height of the head is used
+type newHeadNotification struct {
+	Subscription string `json:"subscription"`
+	Result       struct {
+		Number ethinfura.Quantity `json:"number"`
+	} `json:"result"`
+}
+
+// NewWebsocketHeads create a new WebsocketHeads for the given websocket endpoint, never stale when
+// staleAfter is 0
+func NewWebsocketHeads(endpoint string, staleAfter time.Duration) *WebsocketHeads {
+	return &WebsocketHeads{endpoint: endpoint, staleAfter: staleAfter}
+}
+
+// SubscribeNewHeads subscribe to the new heads with eth_subscribe. The connection is closed and the
+// channel with it when the context is done, when the connection is lost or when it is stale: a
+// subscription can stay open while the node stops pushing heads
+func (w *WebsocketHeads) SubscribeNewHeads(ctx context.Context) (<-chan uint64, error) {
+	connCtx, cancel := context.WithCancel(ctx)
+	client, err := node.NewClient(connCtx, w.endpoint)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	sub, err := client.SubscribeNewHeads(connCtx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	heads := make(chan uint64)
+	go func() {
+		defer close(heads)
+		defer cancel()
+
+		var stale <-chan time.Time
+		var timer *time.Timer
+		if w.staleAfter > 0 {
+			timer = time.NewTimer(w.staleAfter)
+			defer timer.Stop()
+			stale = timer.C
+		}
+		for {
+			select {
+			case n, ok := <-sub.Ch():
+				if !ok {
+					return
+				}
+				head := &newHeadNotification{}
+				if err := json.Unmarshal(n.Params, head); err != nil {
+					continue
+				}
+				if timer != nil {
+					if !timer.Stop() {
+						<-timer.C
+					}
+					timer.Reset(w.staleAfter)
+				}
+				select {
+				case heads <- head.Result.Number.UInt64():
+				case <-connCtx.Done():
+					return
+				}
+			case <-stale:
+				return
+			case <-connCtx.Done():
+				return
+			}
+		}
+	}()
+	return heads, nil
+}
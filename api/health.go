@@ -0,0 +1,172 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+const (
+	// breakerThreshold number of consecutive failures after which a provider circuit is opened
+	breakerThreshold int = 3
+	// breakerCooldown time during which a provider with an open circuit is skipped
+	breakerCooldown time.Duration = 30 * time.Second
+	// healthWeight weight of the latest call in the health score of a provider
+	healthWeight float64 = 0.2
+	// healthyScore score under which a provider is demoted behind the healthy ones
+	healthyScore float64 = 0.5
+)
+
+// errUnsupported error returned by a composite client for providers that do not support a call,
+// it does not count as a failure of the provider
+var errUnsupported = errors.New("not supported by the provider")
+
+// providerHealth health score and circuit breaker of a single provider
+type providerHealth struct {
+	mu        sync.Mutex
+	name      string
+	priority  int
+	score     float64
+	failures  int
+	openUntil time.Time
+}
+
+func newProviderHealth(name string, priority int) *providerHealth {
+	return &providerHealth{
+		name:     name,
+		priority: priority,
+		score:    1,
+	}
+}
+
+// isOpen returns true if the circuit of the provider is open and it should not be called
+func (h *providerHealth) isOpen(now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return now.Before(h.openUntil)
+}
+
+func (h *providerHealth) healthy() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.score >= healthyScore
+}
+
+func (h *providerHealth) success() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.score = h.score*(1-healthWeight) + healthWeight
+	h.failures = 0
+	h.openUntil = time.Time{}
+}
+
+func (h *providerHealth) failure() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.score = h.score * (1 - healthWeight)
+	h.failures++
+	if h.failures >= breakerThreshold {
+		h.openUntil = time.Now().Add(breakerCooldown)
+	}
+}
+
+// orderProviders returns the indexes of the providers in the order they should be called:
+// healthy providers with a closed circuit by priority, then unhealthy ones, then the ones
+// with an open circuit as a last resort so that a call is always attempted
+func orderProviders(hs []*providerHealth) []int {
+	now := time.Now()
+	rank := func(h *providerHealth) int {
+		switch {
+		case h.isOpen(now):
+			return 2
+		case !h.healthy():
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	idx := make([]int, len(hs))
+	for i := range hs {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		ra, rb := rank(hs[idx[a]]), rank(hs[idx[b]])
+		if ra != rb {
+			return ra < rb
+		}
+		return hs[idx[a]].priority < hs[idx[b]].priority
+	})
+	return idx
+}
+
+// quorumHeight returns the highest height reached by at least quorum providers
+func quorumHeight(heights []int, quorum int) int {
+	sorted := append([]int(nil), heights...)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	return sorted[quorum-1]
+}
+
+// availableProviders returns the providers with a closed circuit in the order they should be called
+func availableProviders(hs []*providerHealth) (idx []int) {
+	now := time.Now()
+	for _, i := range orderProviders(hs) {
+		if !hs[i].isOpen(now) {
+			idx = append(idx, i)
+		}
+	}
+	return
+}
+
+// agreeOnHash ask the available providers for the hash of the block at the given height until quorum
+// of them agree. known holds the hashes already returned by some of the providers. Any disagreement
+// between providers is reported even when the quorum is reached
+func agreeOnHash(chain string, height int, quorum int, available []int, known map[int]string, lookup func(i int) (string, error)) (string, error) {
+	votes := make(map[string]int)
+	for _, h := range known {
+		votes[h]++
+	}
+
+	for _, i := range available {
+		if _, n := topVote(votes); n >= quorum {
+			break
+		}
+		if _, ok := known[i]; ok {
+			continue
+		}
+		h, err := lookup(i)
+		if err != nil {
+			continue
+		}
+		votes[h]++
+	}
+
+	best, n := topVote(votes)
+	if n < quorum {
+		return "", reportProviders(fmt.Errorf("no quorum of %d %s providers on the block at height %d: %v", quorum, chain, height, votes))
+	}
+	if len(votes) > 1 {
+		reportProviders(fmt.Errorf("%s providers disagree on the block at height %d: %v", chain, height, votes))
+	}
+	return best, nil
+}
+
+// topVote returns the value with the most votes and its number of votes
+func topVote(votes map[string]int) (best string, n int) {
+	for v, c := range votes {
+		if c > n {
+			best, n = v, c
+		}
+	}
+	return
+}
+
+// reportProviders report an inconsistency between providers through the error reporter
+func reportProviders(err error) error {
+	utils.ErrorReport.LogAndPrintError(err)
+	return err
+}
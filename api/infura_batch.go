@@ -0,0 +1,241 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	ethinfura "github.com/INFURA/go-ethlibs/eth"
+	"github.com/INFURA/go-ethlibs/jsonrpc"
+	"github.com/INFURA/go-ethlibs/node"
+	"github.com/SoteriaTech/blockchain-functions/eth"
+)
+
+// infuraDefaultBatchSize number of calls of each JSON-RPC batch when the config does not set one
+const infuraDefaultBatchSize int = 100
+
+// GetReceipts get the receipts of the given transactions, in batches
+func (i *InfuraClient) GetReceipts(hashes []string) ([]*ethinfura.TransactionReceipt, []error, error) {
+	receipts := make([]*ethinfura.TransactionReceipt, len(hashes))
+	results := make([]interface{}, len(hashes))
+	for n := range hashes {
+		receipts[n] = &ethinfura.TransactionReceipt{}
+		results[n] = receipts[n]
+	}
+
+	errs, err := i.batch("eth_getTransactionReceipt", hashParams(hashes), results)
+	if err != nil {
+		return nil, nil, err
+	}
+	for n := range receipts {
+		if errs[n] != nil {
+			receipts[n] = nil
+		}
+	}
+	return receipts, errs, nil
+}
+
+// GetL1Fees get the L1 data fees of the given transactions from their receipts, in batches
+func (i *InfuraClient) GetL1Fees(hashes []string) ([]*big.Int, []error, error) {
+	found := make([]*struct {
+		L1Fee *ethinfura.Quantity `json:"l1Fee"`
+	}, len(hashes))
+	results := make([]interface{}, len(hashes))
+	for n := range hashes {
+		found[n] = &struct {
+			L1Fee *ethinfura.Quantity `json:"l1Fee"`
+		}{}
+		results[n] = found[n]
+	}
+
+	errs, err := i.batch("eth_getTransactionReceipt", hashParams(hashes), results)
+	if err != nil {
+		return nil, nil, err
+	}
+	fees := make([]*big.Int, len(hashes))
+	for n, r := range found {
+		if errs[n] == nil && r.L1Fee != nil {
+			fees[n] = r.L1Fee.Big()
+		}
+	}
+	return fees, errs, nil
+}
+
+// GetTransactionsByHash get the given transactions, in batches
+func (i *InfuraClient) GetTransactionsByHash(hashes []string) ([]*eth.Transaction, []error, error) {
+	found := make([]*ethinfura.Transaction, len(hashes))
+	results := make([]interface{}, len(hashes))
+	for n := range hashes {
+		found[n] = &ethinfura.Transaction{}
+		results[n] = found[n]
+	}
+
+	errs, err := i.batch("eth_getTransactionByHash", hashParams(hashes), results)
+	if err != nil {
+		return nil, nil, err
+	}
+	txs := make([]*eth.Transaction, len(hashes))
+	for n, t := range found {
+		if errs[n] == nil {
+			txs[n] = formatEthTransaction(t)
+		}
+	}
+	return txs, errs, nil
+}
+
+// GetBalances get the balances in wei of the given addresses at the given block, in batches
+func (i *InfuraClient) GetBalances(addresses []string, block uint64) ([]*big.Int, []error, error) {
+	found := make([]*ethinfura.Quantity, len(addresses))
+	results := make([]interface{}, len(addresses))
+	params := make([][]interface{}, len(addresses))
+	for n, a := range addresses {
+		found[n] = &ethinfura.Quantity{}
+		results[n] = found[n]
+		params[n] = []interface{}{a, blockTag(block)}
+	}
+
+	errs, err := i.batch("eth_getBalance", params, results)
+	if err != nil {
+		return nil, nil, err
+	}
+	balances := make([]*big.Int, len(addresses))
+	for n, q := range found {
+		if errs[n] == nil {
+			balances[n] = q.Big()
+		}
+	}
+	return balances, errs, nil
+}
+
+// Calls call the given contracts with eth_call at the given block, in batches
+func (i *InfuraClient) Calls(calls []*eth.ContractCall, block uint64) ([]string, []error, error) {
+	found := make([]*string, len(calls))
+	results := make([]interface{}, len(calls))
+	params := make([][]interface{}, len(calls))
+	for n, c := range calls {
+		found[n] = new(string)
+		results[n] = found[n]
+		params[n] = []interface{}{map[string]string{"to": c.To, "data": c.Data}, blockTag(block)}
+	}
+
+	errs, err := i.batch("eth_call", params, results)
+	if err != nil {
+		return nil, nil, err
+	}
+	data := make([]string, len(calls))
+	for n, d := range found {
+		if errs[n] == nil {
+			data[n] = *d
+		}
+	}
+	return data, errs, nil
+}
+
+// batch call the method with each of the given params and decode each result into the result at the
+// same index. Http endpoints receive the calls in batches of the batch size, websocket ones one by one.
+// An item without result has its own error, the error returned is set only when no batch was answered
+func (i *InfuraClient) batch(method string, params [][]interface{}, results []interface{}) ([]error, error) {
+	errs := make([]error, len(params))
+	answered := len(params) == 0
+	for start := 0; start < len(params); start += i.batchSize {
+		end := start + i.batchSize
+		if end > len(params) {
+			end = len(params)
+		}
+
+		var reqs jsonrpc.BatchRequest
+		for n := start; n < end; n++ {
+			req, err := jsonrpc.MakeRequest(n-start+1, method, params[n]...)
+			if err != nil {
+				return nil, err
+			}
+			reqs = append(reqs, req)
+		}
+
+		rsps, err := i.send(reqs)
+		if err != nil {
+			for n := start; n < end; n++ {
+				errs[n] = err
+			}
+			continue
+		}
+		answered = true
+
+		byID := make(map[uint64]*jsonrpc.RawResponse, len(rsps))
+		for _, rsp := range rsps {
+			byID[rsp.ID.Num] = rsp
+		}
+		for n := start; n < end; n++ {
+			errs[n] = decodeBatchResult(method, params[n], byID[uint64(n-start+1)], results[n])
+		}
+	}
+
+	if !answered {
+		return nil, fmt.Errorf("%s batch failed: %v", method, errs[0])
+	}
+	return errs, nil
+}
+
+// send send the requests of a batch, as a JSON-RPC batch through the transport of an http endpoint or
+// one by one through the client of a websocket endpoint
+func (i *InfuraClient) send(reqs jsonrpc.BatchRequest) ([]*jsonrpc.RawResponse, error) {
+	ctx, cancel := i.context()
+	defer cancel()
+
+	if i.requester == nil {
+		var rsps []*jsonrpc.RawResponse
+		for _, req := range reqs {
+			rsp, err := i.client.Request(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			rsps = append(rsps, rsp)
+		}
+		return rsps, nil
+	}
+
+	body, err := json.Marshal(reqs)
+	if err != nil {
+		return nil, err
+	}
+	data, err := i.requester.transport.Post(ctx, i.requester.endpoint, "application/json", body)
+	if err != nil {
+		return nil, err
+	}
+
+	// a batch that is rejected as a whole is answered with a single error response
+	var rsps []*jsonrpc.RawResponse
+	if err = json.Unmarshal(data, &rsps); err != nil {
+		rsp := &jsonrpc.RawResponse{}
+		if json.Unmarshal(data, rsp) == nil && rsp.Error != nil {
+			return nil, fmt.Errorf("batch rejected: %s", string(*rsp.Error))
+		}
+		return nil, err
+	}
+	return rsps, nil
+}
+
+func decodeBatchResult(method string, params []interface{}, rsp *jsonrpc.RawResponse, result interface{}) error {
+	if rsp == nil {
+		return fmt.Errorf("%s %v missing from the batch response", method, params)
+	}
+	if rsp.Error != nil {
+		return fmt.Errorf("%s %v failed: %s", method, params, string(*rsp.Error))
+	}
+	if len(rsp.Result) == 0 || bytes.Equal(rsp.Result, []byte("null")) {
+		if method == "eth_getTransactionByHash" {
+			return node.ErrTransactionNotFound
+		}
+		return fmt.Errorf("%s %v not found", method, params)
+	}
+	return json.Unmarshal(rsp.Result, result)
+}
+
+func hashParams(hashes []string) [][]interface{} {
+	params := make([][]interface{}, len(hashes))
+	for n, h := range hashes {
+		params[n] = []interface{}{h}
+	}
+	return params
+}
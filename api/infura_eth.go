@@ -2,40 +2,88 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"math/big"
-	"net/http"
+	"strings"
 	"time"
 
 	ethinfura "github.com/INFURA/go-ethlibs/eth"
+	"github.com/INFURA/go-ethlibs/jsonrpc"
 	"github.com/INFURA/go-ethlibs/node"
 	"github.com/SoteriaTech/blockchain-functions/eth"
 )
 
-// InfuraClient structure of the InfuraClient
+// infuraCallTimeout deadline of each call to the node, retries included
+const infuraCallTimeout time.Duration = 60 * time.Second
+
+// InfuraClient structure of the InfuraClient. The requester of an http endpoint also sends its batches
 type InfuraClient struct {
-	client node.Client
-	ctx    context.Context
-	*http.Client
+	client    node.Client
+	requester *transportRequester
+	batchSize int
+}
+
+// transportRequester JSON-RPC requester sending the requests of an http endpoint through a Transport
+type transportRequester struct {
+	transport *Transport
+	endpoint  string
+}
+
+// Request send a JSON-RPC request and decode its response
+func (r *transportRequester) Request(ctx context.Context, req *jsonrpc.Request) (*jsonrpc.RawResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.transport.Post(ctx, r.endpoint, "application/json", body)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp := &jsonrpc.RawResponse{}
+	if err = json.Unmarshal(data, rsp); err != nil {
+		return nil, err
+	}
+	return rsp, nil
 }
 
 // Infura instance of the infura client
 var Infura *InfuraClient
 
 // InitInfuraClient initialize an instance of InfuraClient
-func InitInfuraClient(endpoint string) {
-	ctx := context.Background()
-	client, _ := node.NewClient(ctx, endpoint)
-	Infura = &InfuraClient{
-		client: client,
-		ctx:    ctx,
-		Client: &http.Client{},
+func InitInfuraClient(endpoint string, batchSize int) {
+	Infura = NewInfuraClient(endpoint, batchSize)
+}
+
+// NewInfuraClient create a new InfuraClient for the given JSON-RPC endpoint, sending batches of the
+// given size. Http endpoints go through the provider transport, websocket ones keep the connection
+// of the node library
+func NewInfuraClient(endpoint string, batchSize int) *InfuraClient {
+	if batchSize <= 0 {
+		batchSize = infuraDefaultBatchSize
+	}
+	i := &InfuraClient{batchSize: batchSize}
+	if strings.HasPrefix(endpoint, "http") {
+		i.requester = &transportRequester{transport: ProviderTransport, endpoint: endpoint}
+		i.client, _ = node.NewCustomClient(i.requester, nil)
+	} else {
+		i.client, _ = node.NewClient(context.Background(), endpoint)
 	}
+	return i
+}
+
+// context returns the context of a call to the node, with its deadline
+func (i *InfuraClient) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), infuraCallTimeout)
 }
 
 // GetBlockHeader get the height of the latest block
 func (i *InfuraClient) GetBlockHeader() (uint64, error) {
+	ctx, cancel := i.context()
+	defer cancel()
 
-	bh, err := i.client.BlockNumber(i.ctx)
+	bh, err := i.client.BlockNumber(ctx)
 	if err != nil {
 		return 0, err
 	}
@@ -44,27 +92,39 @@ func (i *InfuraClient) GetBlockHeader() (uint64, error) {
 
 // GetTransactionByHash get a transaction from its hash
 func (i *InfuraClient) GetTransactionByHash(hash string, b int) (*eth.Transaction, error) {
-	t, err := i.client.TransactionByHash(i.ctx, hash)
+	ctx, cancel := i.context()
+	defer cancel()
+
+	t, err := i.client.TransactionByHash(ctx, hash)
 	if err != nil {
 		return nil, err
 	}
+	return formatEthTransaction(t), nil
+}
+
+func formatEthTransaction(t *ethinfura.Transaction) *eth.Transaction {
 	tx := &eth.Transaction{
-		Hash:        t.Hash.String(),
-		From:        t.From.String(),
-		To:          t.To.String(),
-		Value:       t.Value.Big(),
-		BlockHeight: int(t.BlockNumber.UInt64()),
-		Receiver:    t.To.String(),
-		Currency:    "ETH",
+		Hash:     t.Hash.String(),
+		From:     eth.Address(t.From.String()),
+		Value:    t.Value.Big(),
+		Currency: "ETH",
+		Type:     uint8(t.TransactionType()),
+		GasPrice: t.GasPrice.Big(),
 	}
-
-	return tx, nil
+	if t.To != nil {
+		tx.To = eth.Address(t.To.String())
+		tx.Receiver = tx.To
+	}
+	// pending transactions have no block
+	if t.BlockNumber != nil {
+		tx.BlockHeight = int(t.BlockNumber.UInt64())
+	}
+	return tx
 }
 
 // GetTransactionsFromBlock get the transactions from the block body
 func (i *InfuraClient) GetTransactionsFromBlock(h *big.Int) (*eth.BlockData, error) {
-
-	block, err := i.client.BlockByNumber(i.ctx, h.Uint64(), true)
+	block, header, err := i.getBlock(ethinfura.QuantityFromBigInt(h).String(), true)
 	if err != nil {
 		return nil, err
 	}
@@ -73,40 +133,259 @@ func (i *InfuraClient) GetTransactionsFromBlock(h *big.Int) (*eth.BlockData, err
 	for _, t := range block.Transactions {
 		tx := &eth.Transaction{
 			Hash:        t.Hash.String(),
-			From:        t.From.String(),
+			From:        eth.Address(t.From.String()),
 			To:          to(t),
 			Value:       t.Value.Big(),
 			BlockHeight: int(t.BlockNumber.UInt64()),
 			Receiver:    to(t),
+			Type:        uint8(t.TransactionType()),
+			GasPrice:    t.GasPrice.Big(),
 		}
 		txs = append(txs, tx)
 	}
-	bd := &eth.BlockData{
-		Txs: txs,
-		Meta: eth.Header{
-			Hash:        block.Hash.String(),
-			Height:      int(block.Number.Int64()),
-			LastUpdated: time.Now(),
-			Time:        int(block.Timestamp.UInt64()),
-			Nonce:       block.Nonce.String(),
-		},
+	return &eth.BlockData{Txs: txs, Meta: *header}, nil
+}
+
+// GetBlockHeaderByTag get the header of the block of a tag, finalized or safe
+func (i *InfuraClient) GetBlockHeaderByTag(tag string) (*eth.Header, error) {
+	_, header, err := i.getBlock(tag, false)
+	return header, err
+}
+
+// getBlock get a block by number or tag with eth_getBlockByNumber, and its header with the fields
+// go-ethlibs does not decode, such as the base fee of london
+func (i *InfuraClient) getBlock(tag string, full bool) (*ethinfura.Block, *eth.Header, error) {
+	var raw json.RawMessage
+	if err := i.call(&raw, "eth_getBlockByNumber", tag, full); err != nil {
+		return nil, nil, err
+	}
+	if string(raw) == "null" {
+		return nil, nil, fmt.Errorf("block %s not found", tag)
+	}
+	block := &ethinfura.Block{}
+	if err := json.Unmarshal(raw, block); err != nil {
+		return nil, nil, err
+	}
+	var london struct {
+		BaseFeePerGas *ethinfura.Quantity `json:"baseFeePerGas"`
+	}
+	if err := json.Unmarshal(raw, &london); err != nil {
+		return nil, nil, err
 	}
 
-	return bd, nil
+	header := &eth.Header{
+		Hash:        block.Hash.String(),
+		ParentHash:  block.ParentHash.String(),
+		Height:      int(block.Number.Int64()),
+		LastUpdated: time.Now(),
+		Time:        int(block.Timestamp.UInt64()),
+		BaseFee:     quantityBig(london.BaseFeePerGas),
+		GasUsed:     block.GasUsed.UInt64(),
+		GasLimit:    block.GasLimit.UInt64(),
+		Miner:       eth.Address(block.Miner.String()),
+	}
+	return block, header, nil
+}
+
+// GetBlockHash get the hash of the block at the given height
+func (i *InfuraClient) GetBlockHash(h uint64) (string, error) {
+	ctx, cancel := i.context()
+	defer cancel()
+
+	block, err := i.client.BlockByNumber(ctx, h, false)
+	if err != nil {
+		return "", err
+	}
+	return block.Hash.String(), nil
 }
 
 // GetReceipt get the receipt of a transaction
 func (i *InfuraClient) GetReceipt(hash string) (*ethinfura.TransactionReceipt, error) {
-	r, err := i.client.TransactionReceipt(i.ctx, hash)
+	ctx, cancel := i.context()
+	defer cancel()
+
+	r, err := i.client.TransactionReceipt(ctx, hash)
 	if err != nil {
 		return nil, err
 	}
 	return r, nil
 }
 
-func to(t ethinfura.TxOrHash) string {
+// to returns the recipient of a transaction, go-ethlibs addresses being checksummed when they are decoded
+func to(t ethinfura.TxOrHash) eth.Address {
 	if t.To == nil {
 		return ""
 	}
-	return t.To.String()
+	return eth.Address(t.To.String())
+}
+
+// Call call a contract with eth_call at the given block and returns the data it returned
+func (i *InfuraClient) Call(to string, data string, block uint64) (string, error) {
+	var res string
+	msg := map[string]string{"to": to, "data": data}
+	if err := i.call(&res, "eth_call", msg, blockTag(block)); err != nil {
+		return "", err
+	}
+	return res, nil
+}
+
+// GasPrice get the current gas price with eth_gasPrice
+func (i *InfuraClient) GasPrice() (*big.Int, error) {
+	var q ethinfura.Quantity
+	if err := i.call(&q, "eth_gasPrice"); err != nil {
+		return nil, err
+	}
+	return q.Big(), nil
+}
+
+// GetCode get the code of an address at the given block with eth_getCode
+func (i *InfuraClient) GetCode(addr string, block uint64) (string, error) {
+	var code string
+	if err := i.call(&code, "eth_getCode", addr, blockTag(block)); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ChainID get the chain id with eth_chainId
+func (i *InfuraClient) ChainID() (*big.Int, error) {
+	var q ethinfura.Quantity
+	if err := i.call(&q, "eth_chainId"); err != nil {
+		return nil, err
+	}
+	return q.Big(), nil
+}
+
+// EstimateGas estimate the gas of a transaction with eth_estimateGas
+func (i *InfuraClient) EstimateGas(msg *eth.CallMsg) (uint64, error) {
+	params := map[string]string{"from": msg.From.String(), "to": msg.To.String()}
+	if msg.Value != nil && msg.Value.Sign() > 0 {
+		params["value"] = ethinfura.QuantityFromBigInt(msg.Value).String()
+	}
+	if msg.Data != "" {
+		params["data"] = msg.Data
+	}
+	var q ethinfura.Quantity
+	if err := i.call(&q, "eth_estimateGas", params); err != nil {
+		return 0, err
+	}
+	return q.UInt64(), nil
+}
+
+// FeeHistory get the base fees and the priority fees at the given percentiles of the recent blocks
+// with eth_feeHistory
+func (i *InfuraClient) FeeHistory(blocks int, percentiles []float64) (*eth.FeeHistory, error) {
+	var res struct {
+		BaseFeePerGas []*ethinfura.Quantity   `json:"baseFeePerGas"`
+		Reward        [][]*ethinfura.Quantity `json:"reward"`
+	}
+	if err := i.call(&res, "eth_feeHistory", ethinfura.QuantityFromInt64(int64(blocks)).String(), "latest", percentiles); err != nil {
+		return nil, err
+	}
+	history := &eth.FeeHistory{}
+	for _, b := range res.BaseFeePerGas {
+		history.BaseFees = append(history.BaseFees, quantityBig(b))
+	}
+	for _, r := range res.Reward {
+		var rewards []*big.Int
+		for _, q := range r {
+			rewards = append(rewards, quantityBig(q))
+		}
+		history.Rewards = append(history.Rewards, rewards)
+	}
+	return history, nil
+}
+
+// NonceAt get the number of transactions sent by an address with eth_getTransactionCount, the mined
+// ones or the pending ones too
+func (i *InfuraClient) NonceAt(addr string, pending bool) (uint64, error) {
+	tag := "latest"
+	if pending {
+		tag = "pending"
+	}
+	var q ethinfura.Quantity
+	if err := i.call(&q, "eth_getTransactionCount", addr, tag); err != nil {
+		return 0, err
+	}
+	return q.UInt64(), nil
+}
+
+// SendRawTransaction broadcast a signed transaction with eth_sendRawTransaction and returns its hash
+func (i *InfuraClient) SendRawTransaction(raw string) (string, error) {
+	var hash string
+	if err := i.call(&hash, "eth_sendRawTransaction", raw); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// blockTag block parameter of the calls at the given block, the latest one when it is 0
+func blockTag(block uint64) string {
+	if block == 0 {
+		return "latest"
+	}
+	return ethinfura.QuantityFromUInt64(block).String()
+}
+
+// GetLogs get the logs matching a filter with eth_getLogs
+func (i *InfuraClient) GetLogs(filter *eth.LogFilter) ([]*eth.Log, error) {
+	ctx, cancel := i.context()
+	defer cancel()
+
+	f := ethinfura.LogFilter{
+		FromBlock: ethinfura.MustBlockNumberOrTag(ethinfura.QuantityFromUInt64(filter.FromBlock).String()),
+		ToBlock:   ethinfura.MustBlockNumberOrTag(ethinfura.QuantityFromUInt64(filter.ToBlock).String()),
+	}
+	for _, a := range filter.Addresses {
+		addr, err := ethinfura.NewAddress(a)
+		if err != nil {
+			return nil, err
+		}
+		f.Address = append(f.Address, *addr)
+	}
+	for _, position := range filter.Topics {
+		var topics []ethinfura.Topic
+		for _, t := range position {
+			topic, err := ethinfura.NewTopic(t)
+			if err != nil {
+				return nil, err
+			}
+			topics = append(topics, *topic)
+		}
+		f.Topics = append(f.Topics, topics)
+	}
+
+	found, err := i.client.Logs(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	logs := make([]*eth.Log, 0, len(found))
+	for _, l := range found {
+		entry := &eth.Log{
+			Address: l.Address.String(),
+			Data:    l.Data.String(),
+			Removed: l.Removed,
+		}
+		for _, t := range l.Topics {
+			entry.Topics = append(entry.Topics, t.String())
+		}
+		if l.TxHash != nil {
+			entry.TxHash = l.TxHash.String()
+		}
+		if l.BlockHash != nil {
+			entry.BlockHash = l.BlockHash.String()
+		}
+		if l.BlockNumber != nil {
+			entry.BlockNumber = l.BlockNumber.UInt64()
+		}
+		if l.TxIndex != nil {
+			entry.TxIndex = l.TxIndex.UInt64()
+		}
+		if l.LogIndex != nil {
+			entry.LogIndex = l.LogIndex.UInt64()
+		}
+		logs = append(logs, entry)
+	}
+	return logs, nil
 }
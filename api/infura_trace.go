@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	ethinfura "github.com/INFURA/go-ethlibs/eth"
+	"github.com/INFURA/go-ethlibs/jsonrpc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/eth"
+)
+
+// parityTrace trace of trace_block. Calls and creations have the value in their action, the recipient
+// of a creation is in its result, self-destructs move the balance to the refund address. Addresses
+// are checksummed when decoded, like the ones of the blocks
+type parityTrace struct {
+	Action struct {
+		CallType      string              `json:"callType"`
+		From          ethinfura.Address   `json:"from"`
+		To            ethinfura.Address   `json:"to"`
+		Value         *ethinfura.Quantity `json:"value"`
+		Address       ethinfura.Address   `json:"address"`
+		RefundAddress ethinfura.Address   `json:"refundAddress"`
+		Balance       *ethinfura.Quantity `json:"balance"`
+	} `json:"action"`
+	Result *struct {
+		Address ethinfura.Address `json:"address"`
+	} `json:"result"`
+	Error           string `json:"error"`
+	TraceAddress    []int  `json:"traceAddress"`
+	TransactionHash string `json:"transactionHash"`
+	Type            string `json:"type"`
+}
+
+// callFrame call of the callTracer of debug_traceBlockByNumber, with its sub calls
+type callFrame struct {
+	Type  string              `json:"type"`
+	From  ethinfura.Address   `json:"from"`
+	To    ethinfura.Address   `json:"to"`
+	Value *ethinfura.Quantity `json:"value"`
+	Error string              `json:"error"`
+	Calls []*callFrame        `json:"calls"`
+}
+
+// TraceBlock trace the calls of the transactions of a block with the given tracer
+func (i *InfuraClient) TraceBlock(h uint64, tracer string) ([]*eth.Trace, error) {
+	switch tracer {
+	case env.TracerParity:
+		return i.traceBlockParity(h)
+	case env.TracerCallTracer:
+		return i.traceBlockCallTracer(h)
+	default:
+		return nil, fmt.Errorf("unknown tracer %s", tracer)
+	}
+}
+
+func (i *InfuraClient) traceBlockParity(h uint64) ([]*eth.Trace, error) {
+	var found []*parityTrace
+	if err := i.call(&found, "trace_block", ethinfura.QuantityFromUInt64(h).String()); err != nil {
+		return nil, err
+	}
+
+	traces := make([]*eth.Trace, 0, len(found))
+	for _, t := range found {
+		// block and uncle rewards are not part of a transaction
+		if t.TransactionHash == "" {
+			continue
+		}
+		trace := &eth.Trace{
+			TxHash: t.TransactionHash,
+			Path:   t.TraceAddress,
+			Type:   t.Action.CallType,
+			From:   eth.Address(t.Action.From.String()),
+			To:     eth.Address(t.Action.To.String()),
+			Value:  quantityBig(t.Action.Value),
+			Error:  t.Error,
+		}
+		switch t.Type {
+		case "create":
+			trace.Type = "create"
+			if t.Result != nil {
+				trace.To = eth.Address(t.Result.Address.String())
+			}
+		case "suicide":
+			trace.Type = "selfdestruct"
+			trace.From = eth.Address(t.Action.Address.String())
+			trace.To = eth.Address(t.Action.RefundAddress.String())
+			trace.Value = quantityBig(t.Action.Balance)
+		}
+		traces = append(traces, trace)
+	}
+	return traces, nil
+}
+
+// traceBlockCallTracer trace a block with the callTracer. Its results are in the order of the
+// transactions of the block, and each call tree is flattened with the parents first
+func (i *InfuraClient) traceBlockCallTracer(h uint64) ([]*eth.Trace, error) {
+	ctx, cancel := i.context()
+	block, err := i.client.BlockByNumber(ctx, h, false)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []struct {
+		Result *callFrame `json:"result"`
+		Error  string     `json:"error"`
+	}
+	params := map[string]string{"tracer": "callTracer"}
+	if err = i.call(&found, "debug_traceBlockByNumber", ethinfura.QuantityFromUInt64(h).String(), params); err != nil {
+		return nil, err
+	}
+	if len(found) != len(block.Transactions) {
+		return nil, fmt.Errorf("block %d has %d transactions but %d traces", h, len(block.Transactions), len(found))
+	}
+
+	var traces []*eth.Trace
+	for n, f := range found {
+		hash := block.Transactions[n].Hash.String()
+		if f.Result == nil {
+			return nil, fmt.Errorf("transaction %s could not be traced: %s", hash, f.Error)
+		}
+		traces = flattenCallFrame(traces, hash, nil, f.Result)
+	}
+	return traces, nil
+}
+
+func flattenCallFrame(traces []*eth.Trace, hash string, path []int, c *callFrame) []*eth.Trace {
+	traces = append(traces, &eth.Trace{
+		TxHash: hash,
+		Path:   path,
+		Type:   c.Type,
+		From:   eth.Address(c.From.String()),
+		To:     eth.Address(c.To.String()),
+		Value:  quantityBig(c.Value),
+		Error:  c.Error,
+	})
+	for n, sub := range c.Calls {
+		subPath := append(append([]int{}, path...), n)
+		traces = flattenCallFrame(traces, hash, subPath, sub)
+	}
+	return traces
+}
+
+// call send a JSON-RPC request without a method in the node library and decode its result
+func (i *InfuraClient) call(result interface{}, method string, params ...interface{}) error {
+	ctx, cancel := i.context()
+	defer cancel()
+
+	req, err := jsonrpc.MakeRequest(1, method, params...)
+	if err != nil {
+		return err
+	}
+	rsp, err := i.client.Request(ctx, req)
+	if err != nil {
+		return err
+	}
+	if rsp.Error != nil {
+		return fmt.Errorf("%s failed: %s", method, string(*rsp.Error))
+	}
+	return json.Unmarshal(rsp.Result, result)
+}
+
+func quantityBig(q *ethinfura.Quantity) *big.Int {
+	if q == nil {
+		return nil
+	}
+	return q.Big()
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/eth"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// InitBitcoinProvider initialize the client of the provider selected in the chain config
+// and returns it as a btc.BitcoinAPI. Defaults to blockchain.info when no provider is set.
+// When several providers are configured, they are wrapped in a CompositeBitcoinClient, and
+// the client is put behind a response cache when the chain config has one
+func InitBitcoinProvider(config *env.ChainConfig) btc.BitcoinAPI {
+	a := initBitcoinProvider(config)
+	if cache := newChainCache(config); cache != nil {
+		return NewCachedBitcoinClient(a, cache, config.Confirmations)
+	}
+	return a
+}
+
+func initBitcoinProvider(config *env.ChainConfig) btc.BitcoinAPI {
+	if len(config.Providers) == 0 {
+		setHostRateLimit(config.Provider, config.Endpoint, config.RateLimit)
+		switch config.Provider {
+		case env.ProviderEsplora:
+			InitEsploraClient(config.Endpoint)
+			return Esplora
+		case env.ProviderBlockCypher:
+			InitBlockCypherClient(config.Endpoint, config.Token, config.RateLimit)
+			return BlockCypher
+		default:
+			InitBlockInfoClient(config.Endpoint)
+			return BlockInfo
+		}
+	}
+
+	c := NewCompositeBitcoinClient(config.Chain, config.Quorum)
+	for _, p := range config.Providers {
+		c.Add(p.Provider+" "+p.Endpoint, newBitcoinProvider(p))
+	}
+	return c
+}
+
+// InitEthereumProvider initialize the client of the ethereum chain and returns it as an eth.EthereumAPI.
+// When several providers are configured, they are wrapped in a CompositeEthereumClient, and
+// the client is put behind a response cache when the chain config has one
+func InitEthereumProvider(config *env.ChainConfig) eth.EthereumAPI {
+	a := initEthereumProvider(config)
+	if cache := newChainCache(config); cache != nil {
+		return NewCachedEthereumClient(a, cache, config.Confirmations)
+	}
+	return a
+}
+
+func initEthereumProvider(config *env.ChainConfig) eth.EthereumAPI {
+	if len(config.Providers) == 0 {
+		setHostRateLimit(config.Provider, config.Endpoint, config.RateLimit)
+		InitInfuraClient(config.Endpoint, config.BatchSize)
+		return Infura
+	}
+
+	c := NewCompositeEthereumClient(config.Quorum)
+	for i, p := range config.Providers {
+		// endpoints of ethereum providers are secrets, so they are identified by their position only
+		setHostRateLimit(p.Provider, p.Endpoint, p.RateLimit)
+		c.Add(p.Provider+" #"+strconv.Itoa(i), NewInfuraClient(p.Endpoint, p.BatchSize))
+	}
+	return c
+}
+
+func newBitcoinProvider(p *env.ProviderConfig) btc.BitcoinAPI {
+	setHostRateLimit(p.Provider, p.Endpoint, p.RateLimit)
+	switch p.Provider {
+	case env.ProviderEsplora:
+		return NewEsploraClient(p.Endpoint)
+	case env.ProviderBlockCypher:
+		return NewBlockCypherClient(p.Endpoint, p.Token, p.RateLimit)
+	default:
+		return NewBlockInfoClient(p.Endpoint)
+	}
+}
+
+// setHostRateLimit limit the requests of the provider transport to the host of a provider. BlockCypher
+// counts the transactions of its batches against its quotas, so its client has its own limiter instead
+func setHostRateLimit(provider string, endpoint string, limit *env.RateLimitConfig) {
+	if provider == env.ProviderBlockCypher {
+		return
+	}
+	ProviderTransport.SetRateLimit(endpoint, limit)
+}
+
+// newChainCache create the response cache of a chain, or returns nil when it has none. A cache that
+// cannot be created is reported and the chain runs without it
+func newChainCache(config *env.ChainConfig) *ResponseCache {
+	if config.Cache == nil {
+		return nil
+	}
+	cache, err := NewResponseCache(config.Cache, config.Chain)
+	if err != nil {
+		utils.ErrorReport.LogAndPrintError(err)
+		return nil
+	}
+	return cache
+}
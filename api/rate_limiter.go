@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// rateLimitMaxWait longest time a call waits for the quotas of a provider, past it the call fails instead
+// of outliving the function that made it
+const rateLimitMaxWait time.Duration = 30 * time.Second
+
+// tokenBucket bucket refilled continuously up to its capacity over the given window
+type tokenBucket struct {
+	capacity float64
+	tokens   float64
+	rate     float64 // tokens per second
+}
+
+func newTokenBucket(capacity int, window time.Duration) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(capacity),
+		tokens:   float64(capacity),
+		rate:     float64(capacity) / window.Seconds(),
+	}
+}
+
+func (b *tokenBucket) refill(elapsed time.Duration) {
+	b.tokens += elapsed.Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+}
+
+// wait time until n tokens are available
+func (b *tokenBucket) wait(n float64) time.Duration {
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// RateLimiter token bucket limiter enforcing the per-second and per-hour quotas of a provider.
+// Each request takes one token from every bucket, and a batch of requests one token per element
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets []*tokenBucket
+	last    time.Time
+	maxWait time.Duration
+	now     func() time.Time
+	sleep   func(context.Context, time.Duration) error
+}
+
+// NewRateLimiter create a limiter with the given quotas, a quota of 0 is not limited
+func NewRateLimiter(perSecond int, perHour int) *RateLimiter {
+	l := &RateLimiter{
+		maxWait: rateLimitMaxWait,
+		now:     time.Now,
+		sleep:   sleepContext,
+	}
+	if perSecond > 0 {
+		l.buckets = append(l.buckets, newTokenBucket(perSecond, time.Second))
+	}
+	if perHour > 0 {
+		l.buckets = append(l.buckets, newTokenBucket(perHour, time.Hour))
+	}
+	l.last = l.now()
+	return l
+}
+
+// Burst largest number of tokens that can be taken at once, 0 when unlimited
+func (l *RateLimiter) Burst() int {
+	burst := 0
+	for _, b := range l.buckets {
+		if burst == 0 || int(b.capacity) < burst {
+			burst = int(b.capacity)
+		}
+	}
+	return burst
+}
+
+// Wait block until n tokens are available in every bucket and take them. It fails without taking
+// any token when the wait would exceed the max wait of the limiter, e.g. when the hourly quota is spent,
+// or the deadline of the context, and gives the tokens back when the context is done while it waits
+func (l *RateLimiter) Wait(ctx context.Context, n int) error {
+	if l == nil || len(l.buckets) == 0 {
+		return nil
+	}
+
+	wait, err := l.take(ctx, n)
+	if err != nil || wait == 0 {
+		return err
+	}
+	if err = l.sleep(ctx, wait); err != nil {
+		l.mu.Lock()
+		for _, b := range l.buckets {
+			b.tokens += float64(n)
+		}
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// take take n tokens from every bucket and returns the time to wait until they are available. The lock
+// is only held while taking them: the tokens of the waiting calls are already taken, so the next calls
+// wait for them to be refilled too, without waiting for the lock
+func (l *RateLimiter) take(ctx context.Context, n int) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for _, b := range l.buckets {
+		b.refill(now.Sub(l.last))
+	}
+	l.last = now
+
+	var wait time.Duration
+	for _, b := range l.buckets {
+		if float64(n) > b.capacity {
+			return 0, fmt.Errorf("%d requests exceed the rate limit of %.0f", n, b.capacity)
+		}
+		if w := b.wait(float64(n)); w > wait {
+			wait = w
+		}
+	}
+	if wait > l.maxWait {
+		return 0, fmt.Errorf("rate limit reached, next request allowed in %s", wait.Round(time.Second))
+	}
+	if deadline, ok := ctx.Deadline(); ok && now.Add(wait).After(deadline) {
+		return 0, fmt.Errorf("rate limit reached, next request allowed in %s after the deadline", wait.Round(time.Second))
+	}
+
+	for _, b := range l.buckets {
+		b.tokens -= float64(n)
+	}
+	return wait, nil
+}
@@ -0,0 +1,284 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+)
+
+const (
+	// transportTimeout timeout of each attempt of a request
+	transportTimeout time.Duration = 20 * time.Second
+	// transportRetries number of retries of a request after its first attempt
+	transportRetries int = 3
+	// transportBaseBackoff backoff before the first retry, doubled at each retry
+	transportBaseBackoff time.Duration = 500 * time.Millisecond
+	// transportMaxBackoff longest backoff, and longest Retry-After honored before giving up
+	transportMaxBackoff time.Duration = 30 * time.Second
+)
+
+// StatusError error of a response with a non 2xx status
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+	retryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("expected status 2xx, got %s: %s", e.Status, e.Body)
+}
+
+// retryable returns true for the statuses worth retrying: rate limits and server errors
+func (e *StatusError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500 && e.StatusCode != http.StatusNotImplemented
+}
+
+// HostStats request metrics of a provider host. Requests counts every attempt, Failures the
+// requests that failed after their retries
+type HostStats struct {
+	Requests     int64   `json:"requests"`
+	Retries      int64   `json:"retries"`
+	Failures     int64   `json:"failures"`
+	RateLimited  int64   `json:"rate_limited"`
+	ServerErrors int64   `json:"server_errors"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	latency      time.Duration
+}
+
+// Transport http transport shared by the chain provider clients. Each attempt of a request has a
+// timeout, rate limits, server errors and network errors are retried with a jittered exponential
+// backoff or after the Retry-After of the response, and the requests to each host can be rate limited
+type Transport struct {
+	client      *http.Client
+	timeout     time.Duration
+	retries     int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	sleep       func(ctx context.Context, d time.Duration) error
+
+	mu       sync.Mutex
+	limiters map[string]*RateLimiter
+	stats    map[string]*HostStats
+}
+
+// ProviderTransport transport of the provider clients of the api package
+var ProviderTransport = NewTransport()
+
+// NewTransport create a transport with the default timeout and retries
+func NewTransport() *Transport {
+	return &Transport{
+		client:      &http.Client{},
+		timeout:     transportTimeout,
+		retries:     transportRetries,
+		baseBackoff: transportBaseBackoff,
+		maxBackoff:  transportMaxBackoff,
+		sleep:       sleepContext,
+		limiters:    make(map[string]*RateLimiter),
+		stats:       make(map[string]*HostStats),
+	}
+}
+
+// SetRateLimit limit the requests to the host of the given endpoint. Without limit config, the
+// requests to the host are not limited
+func (t *Transport) SetRateLimit(endpoint string, limit *env.RateLimitConfig) {
+	u, err := url.Parse(endpoint)
+	if err != nil || limit == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.limiters[u.Host] = NewRateLimiter(limit.PerSecond, limit.PerHour)
+}
+
+// Metrics returns a snapshot of the request metrics by host
+func (t *Transport) Metrics() map[string]HostStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	metrics := make(map[string]HostStats, len(t.stats))
+	for host, s := range t.stats {
+		m := *s
+		if m.Requests > 0 {
+			m.AvgLatencyMs = m.latency.Seconds() * 1000 / float64(m.Requests)
+		}
+		metrics[host] = m
+	}
+	return metrics
+}
+
+// Get send a GET request and returns the body of the response
+func (t *Transport) Get(ctx context.Context, rawURL string) ([]byte, error) {
+	return t.Do(ctx, http.MethodGet, rawURL, "", nil)
+}
+
+// Post send a POST request with the given body and returns the body of the response
+func (t *Transport) Post(ctx context.Context, rawURL string, contentType string, body []byte) ([]byte, error) {
+	return t.Do(ctx, http.MethodPost, rawURL, contentType, body)
+}
+
+// Do send a request, retrying it until it succeeds, fails with an error that is not worth
+// retrying, runs out of retries or the context is done
+func (t *Transport) Do(ctx context.Context, method string, rawURL string, contentType string, body []byte) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	limiter, stats := t.host(u.Host)
+
+	for attempt := 0; ; attempt++ {
+		if err = limiter.Wait(ctx, 1); err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		data, errAttempt := t.attempt(ctx, method, u, contentType, body)
+		t.record(stats, start, errAttempt)
+		if errAttempt == nil {
+			return data, nil
+		}
+
+		retryable, wait := t.retry(ctx, errAttempt, attempt)
+		if !retryable || attempt >= t.retries || wait > t.maxBackoff {
+			t.mu.Lock()
+			stats.Failures++
+			t.mu.Unlock()
+			return nil, errAttempt
+		}
+		if err = t.sleep(ctx, wait); err != nil {
+			return nil, errAttempt
+		}
+		t.mu.Lock()
+		stats.Retries++
+		t.mu.Unlock()
+	}
+}
+
+// attempt send a single attempt of a request with the timeout of the transport
+func (t *Transport) attempt(ctx context.Context, method string, u *url.URL, contentType string, body []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	rsp, err := t.client.Do(req)
+	if err != nil {
+		// the url error holds the query, where some providers take their token, so only the
+		// host and path of the request are kept
+		if urlErr, ok := err.(*url.Error); ok {
+			return nil, fmt.Errorf("%s %s%s: %v", method, u.Host, u.Path, urlErr.Err)
+		}
+		return nil, err
+	}
+
+	defer rsp.Body.Close()
+	data, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.Status[0] != '2' {
+		return nil, &StatusError{
+			StatusCode: rsp.StatusCode,
+			Status:     rsp.Status,
+			Body:       string(data),
+			retryAfter: parseRetryAfter(rsp.Header.Get("Retry-After")),
+		}
+	}
+	return data, nil
+}
+
+// retry returns whether the error of an attempt is worth retrying and the time to wait before the retry
+func (t *Transport) retry(ctx context.Context, err error, attempt int) (bool, time.Duration) {
+	if ctx.Err() != nil {
+		return false, 0
+	}
+
+	backoff := t.baseBackoff << uint(attempt)
+	if backoff > t.maxBackoff || backoff <= 0 {
+		backoff = t.maxBackoff
+	}
+	// full jitter, so that the clients hitting the same provider do not retry in lockstep
+	wait := time.Duration(rand.Int63n(int64(backoff) + 1))
+
+	if statusErr, ok := err.(*StatusError); ok {
+		if !statusErr.retryable() {
+			return false, 0
+		}
+		if statusErr.retryAfter > wait {
+			wait = statusErr.retryAfter
+		}
+	}
+	return true, wait
+}
+
+// host returns the rate limiter and the stats of a host
+func (t *Transport) host(host string) (*RateLimiter, *HostStats) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.stats[host]
+	if !ok {
+		s = &HostStats{}
+		t.stats[host] = s
+	}
+	return t.limiters[host], s
+}
+
+func (t *Transport) record(s *HostStats, start time.Time, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s.Requests++
+	s.latency += time.Since(start)
+	if statusErr, ok := err.(*StatusError); ok {
+		if statusErr.StatusCode == http.StatusTooManyRequests {
+			s.RateLimited++
+		} else if statusErr.StatusCode >= 500 {
+			s.ServerErrors++
+		}
+	}
+}
+
+// parseRetryAfter parse a Retry-After header, either a number of seconds or an http date
+func parseRetryAfter(h string) time.Duration {
+	if h == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(h); err == nil {
+		return time.Duration(s) * time.Second
+	}
+	if date, err := http.ParseTime(h); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
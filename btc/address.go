@@ -0,0 +1,53 @@
+package btc
+
+import "strings"
+
+// CanonicalAddress returns the canonical form of an address of the given network, the one its outputs
+// are extracted with: lowercase bech32, lowercase cashaddr with its prefix on the networks having one,
+// and base58 as is since base58 is case sensitive
+func CanonicalAddress(addr string, net *Network) (string, error) {
+	script, err := AddressToScript(addr, net)
+	if err != nil {
+		return "", err
+	}
+	return ExtractAddress(script, net)
+}
+
+// ToCanonicalAddress returns the canonical form of an address of the given network, or the address as
+// is when it is invalid so that it still matches itself
+func ToCanonicalAddress(addr string, net *Network) string {
+	canonical, err := CanonicalAddress(addr, net)
+	if err != nil {
+		return addr
+	}
+	return canonical
+}
+
+// AddressForms returns the forms an address of the given network can be saved with by the clients:
+// its canonical form, the uppercase form allowed by bech32 and cashaddr, and for cashaddr its form
+// without prefix and its legacy base58 form
+func AddressForms(addr string, net *Network) []string {
+	script, err := AddressToScript(addr, net)
+	if err != nil {
+		return []string{addr}
+	}
+	canonical, err := ExtractAddress(script, net)
+	if err != nil {
+		return []string{addr}
+	}
+
+	forms := []string{canonical}
+	if strings.ToLower(canonical) == canonical && strings.ToUpper(canonical) != canonical {
+		forms = append(forms, strings.ToUpper(canonical))
+	}
+	if net.CashAddrPrefix != "" && strings.HasPrefix(canonical, net.CashAddrPrefix+":") {
+		payload := strings.TrimPrefix(canonical, net.CashAddrPrefix+":")
+		forms = append(forms, payload, strings.ToUpper(payload))
+		legacy := *net
+		legacy.CashAddrPrefix = ""
+		if l, errLegacy := ExtractAddress(script, &legacy); errLegacy == nil {
+			forms = append(forms, l)
+		}
+	}
+	return forms
+}
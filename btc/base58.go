@@ -0,0 +1,93 @@
+package btc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// Errors of the base58 encoding
+var (
+	ErrBase58Char     = errors.New("invalid base58 character")
+	ErrBase58Checksum = errors.New("invalid base58 checksum")
+	ErrBase58Length   = errors.New("base58 payload too short")
+)
+
+var base58Radix = big.NewInt(58)
+
+// Base58Encode encode bytes in base58, leading zero bytes are encoded as '1'
+func Base58Encode(b []byte) string {
+	x := new(big.Int).SetBytes(b)
+	mod := new(big.Int)
+	var out []byte
+	for x.Sign() > 0 {
+		x.DivMod(x, base58Radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// Base58Decode decode a base58 string
+func Base58Decode(s string) ([]byte, error) {
+	x := new(big.Int)
+	for i := 0; i < len(s); i++ {
+		idx := bytes.IndexByte([]byte(base58Alphabet), s[i])
+		if idx < 0 {
+			return nil, ErrBase58Char
+		}
+		x.Mul(x, base58Radix)
+		x.Add(x, big.NewInt(int64(idx)))
+	}
+
+	var zeros int
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), x.Bytes()...), nil
+}
+
+// Base58CheckEncode encode a payload prefixed with the given version bytes, followed by its 4 bytes checksum
+func Base58CheckEncode(version []byte, payload []byte) string {
+	b := append(append([]byte{}, version...), payload...)
+	return Base58Encode(append(b, checksum(b)...))
+}
+
+// Base58CheckDecode decode a base58check string and verify its checksum. It returns the
+// data without the checksum, version bytes included
+func Base58CheckDecode(s string) ([]byte, error) {
+	b, err := Base58Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 5 {
+		return nil, ErrBase58Length
+	}
+	data, sum := b[:len(b)-4], b[len(b)-4:]
+	if !bytes.Equal(checksum(data), sum) {
+		return nil, ErrBase58Checksum
+	}
+	return data, nil
+}
+
+func checksum(b []byte) []byte {
+	return DoubleSha256(b)[:4]
+}
+
+// DoubleSha256 sha256(sha256(b)), used for checksums, transaction ids and block hashes
+func DoubleSha256(b []byte) []byte {
+	first := sha256.Sum256(b)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
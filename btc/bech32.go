@@ -0,0 +1,195 @@
+package btc
+
+import (
+	"errors"
+	"strings"
+)
+
+// implementation of BIP173 (bech32) and BIP350 (bech32m) for segwit addresses
+// https://github.com/bitcoin/bips/blob/master/bip-0173.mediawiki
+// https://github.com/bitcoin/bips/blob/master/bip-0350.mediawiki
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+const (
+	bech32Const  uint32 = 1
+	bech32mConst uint32 = 0x2bc830a3
+)
+
+// Errors of the bech32 encoding
+var (
+	ErrBech32Case      = errors.New("bech32 string has mixed case")
+	ErrBech32Char      = errors.New("invalid bech32 character")
+	ErrBech32Length    = errors.New("invalid bech32 length")
+	ErrBech32Checksum  = errors.New("invalid bech32 checksum")
+	ErrBech32HRP       = errors.New("bech32 human readable part does not match the network")
+	ErrWitnessVersion  = errors.New("invalid witness version")
+	ErrWitnessProgram  = errors.New("invalid witness program")
+	ErrWitnessEncoding = errors.New("witness version does not match bech32 variant")
+)
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		b := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (b>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+// bech32Encode encode 5-bit data with the given checksum constant (bech32 or bech32m)
+func bech32Encode(hrp string, data []byte, spec uint32) string {
+	values := append(bech32HRPExpand(hrp), data...)
+	polymod := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ spec
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, d := range data {
+		sb.WriteByte(bech32Charset[d])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+	}
+	return sb.String()
+}
+
+// bech32Decode decode a bech32 or bech32m string and returns its hrp, 5-bit data and checksum constant
+func bech32Decode(s string) (hrp string, data []byte, spec uint32, err error) {
+	if len(s) < 8 || len(s) > 90 {
+		return "", nil, 0, ErrBech32Length
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, 0, ErrBech32Case
+	}
+	s = strings.ToLower(s)
+
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, 0, ErrBech32Length
+	}
+	hrp = s[:pos]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, 0, ErrBech32Char
+		}
+	}
+	for i := pos + 1; i < len(s); i++ {
+		idx := strings.IndexByte(bech32Charset, s[i])
+		if idx < 0 {
+			return "", nil, 0, ErrBech32Char
+		}
+		data = append(data, byte(idx))
+	}
+
+	switch bech32Polymod(append(bech32HRPExpand(hrp), data...)) {
+	case bech32Const:
+		spec = bech32Const
+	case bech32mConst:
+		spec = bech32mConst
+	default:
+		return "", nil, 0, ErrBech32Checksum
+	}
+	return hrp, data[:len(data)-6], spec, nil
+}
+
+// convertBits regroup bits from groups of fromBits into groups of toBits
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	var out []byte
+	maxv := uint32(1)<<toBits - 1
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, ErrWitnessProgram
+		}
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte((acc>>bits)&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte((acc<<(toBits-bits))&maxv))
+		}
+	} else if bits >= fromBits || (acc<<(toBits-bits))&maxv != 0 {
+		return nil, ErrWitnessProgram
+	}
+	return out, nil
+}
+
+// EncodeSegwitAddress encode a witness program into a segwit address, bech32 for version 0
+// and bech32m for versions 1 to 16
+func EncodeSegwitAddress(hrp string, version byte, program []byte) (string, error) {
+	if version > 16 {
+		return "", ErrWitnessVersion
+	}
+	if err := checkWitnessProgram(version, program); err != nil {
+		return "", err
+	}
+	data, err := convertBits(program, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	spec := bech32Const
+	if version > 0 {
+		spec = bech32mConst
+	}
+	return bech32Encode(hrp, append([]byte{version}, data...), spec), nil
+}
+
+// DecodeSegwitAddress decode a segwit address of the given hrp into its witness version and program
+func DecodeSegwitAddress(hrp string, addr string) (version byte, program []byte, err error) {
+	h, data, spec, err := bech32Decode(addr)
+	if err != nil {
+		return 0, nil, err
+	}
+	if h != hrp {
+		return 0, nil, ErrBech32HRP
+	}
+	if len(data) < 1 || data[0] > 16 {
+		return 0, nil, ErrWitnessVersion
+	}
+	version = data[0]
+	if (version == 0 && spec != bech32Const) || (version > 0 && spec != bech32mConst) {
+		return 0, nil, ErrWitnessEncoding
+	}
+	program, err = convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err = checkWitnessProgram(version, program); err != nil {
+		return 0, nil, err
+	}
+	return version, program, nil
+}
+
+func checkWitnessProgram(version byte, program []byte) error {
+	if len(program) < 2 || len(program) > 40 {
+		return ErrWitnessProgram
+	}
+	if version == 0 && len(program) != 20 && len(program) != 32 {
+		return ErrWitnessProgram
+	}
+	return nil
+}
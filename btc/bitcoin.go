@@ -1,8 +1,11 @@
 package btc
 
 import (
+	"encoding/hex"
+	"fmt"
 	"math/big"
 
+	"github.com/SoteriaTech/blockchain-functions/env"
 	"github.com/blockcypher/gobcy"
 )
 
@@ -21,19 +24,89 @@ type BitcoinAPI interface {
 	GetBalance(address string) (*big.Int, error)
 }
 
-//Btc structure of the Btc service
+// BlockHashAPI interface of the providers able to return the hash of a block without its transactions
+type BlockHashAPI interface {
+	GetBlockHash(height int) (string, error)
+}
+
+// RawBlockAPI interface of the providers able to return the raw serialization of a block
+type RawBlockAPI interface {
+	GetRawBlock(height int) ([]byte, error)
+}
+
+// RawTransactionAPI interface of the providers able to return the raw serialization of a transaction
+type RawTransactionAPI interface {
+	GetRawTransaction(hash string) ([]byte, error)
+}
+
+//Btc structure of the Btc service. One service runs for each configured utxo chain
 type Btc struct {
-	api BitcoinAPI
+	api      BitcoinAPI
+	network  *Network
+	native   bool
+	currency string
+	decimals int
 }
 
 // BtcService instance of the btc service
 var BtcService *Btc
 
+// services instances of the services of the utxo chains, by chain name
+var services = make(map[string]*Btc)
+
 // InitBtcService initialize the instance of the btc service
-func InitBtcService(a BitcoinAPI) {
-	BtcService = &Btc{
-		api: a,
+func InitBtcService(a BitcoinAPI, config *env.ChainConfig) (err error) {
+	BtcService, err = InitService(a, config)
+	return
+}
+
+// InitService initialize the service of a utxo chain and register it under the chain name. When the
+// native decoder is selected in the config, blocks are decoded from their raw serialization instead
+// of the provider's json
+func InitService(a BitcoinAPI, config *env.ChainConfig) (*Btc, error) {
+	network, err := NetworkFromChain(config.Chain)
+	if err != nil {
+		return nil, err
 	}
+	native := config.Decoder == env.DecoderNative
+	if native && network.AuxPow {
+		return nil, fmt.Errorf("native decoder does not support the merge mined blocks of %s", config.Chain)
+	}
+	if _, ok := a.(RawBlockAPI); native && !ok {
+		return nil, fmt.Errorf("native decoder needs a provider of %s able to return raw blocks", config.Chain)
+	}
+	if len(config.Currencies) == 0 {
+		return nil, fmt.Errorf("no currency configured for %s", config.Chain)
+	}
+
+	s := &Btc{
+		api:      a,
+		network:  network,
+		native:   native,
+		currency: config.Currencies[0].Name,
+		decimals: config.Currencies[0].Decimals,
+	}
+	services[config.Chain] = s
+	return s, nil
+}
+
+// Service returns the service of the given utxo chain
+func Service(chain string) (*Btc, error) {
+	s, ok := services[chain]
+	if !ok {
+		return nil, fmt.Errorf("no service initialized for chain %s", chain)
+	}
+	return s, nil
+}
+
+// Network returns the network of the btc service
+func (b *Btc) Network() *Network {
+	return b.network
+}
+
+// Currency returns the name of the native currency of the chain and its decimals in the balances
+func (b *Btc) Currency() (string, int) {
+	return b.currency, b.decimals
 }
 
 // FetchBlock fetch block with given height. If height is 0, then fetch head block
@@ -56,8 +129,35 @@ func (b *Btc) GetAccountBalance(address string) (*big.Int, error) {
 	return balance, nil
 }
 
+// ScannedBlock transactions of a scanned block with the previous outputs spent by its inputs and the fee
+// rates of its transactions in satoshis per vbyte. Fee rates are only known from the providers' json
+type ScannedBlock struct {
+	Height       int
+	Transactions []*Transaction
+	Spends       []*Spend
+	FeeRates     []float64
+}
+
 // ScanBlock scan a btc Block, extract and parse its transactions
 func (b *Btc) ScanBlock(height int) ([]*Transaction, error) {
+	block, err := b.ScanBlockDetails(height)
+	if err != nil {
+		return nil, err
+	}
+	return block.Transactions, nil
+}
+
+// ScanBlockDetails scan a btc Block, extract and parse its transactions, the previous outputs spent
+// by its inputs and the fee rates of its transactions
+func (b *Btc) ScanBlockDetails(height int) (*ScannedBlock, error) {
+	if b.native {
+		raw, ok := b.api.(RawBlockAPI)
+		if !ok {
+			return nil, fmt.Errorf("native decoder needs a provider able to return raw blocks")
+		}
+		return b.scanRawBlock(raw, height)
+	}
+
 	block, err := b.FetchBlock(height)
 	if err != nil {
 		return nil, err
@@ -66,8 +166,41 @@ func (b *Btc) ScanBlock(height int) ([]*Transaction, error) {
 	if len(errs) > 0 {
 		return nil, errs[0]
 	}
+	// providers write the addresses their own way, the decoded outputs are already canonical. The outputs
+	// they do not label, e.g. taproot ones for some of them, get the address of their script
+	for _, t := range txs {
+		if t.Address == "" && t.Script != "" {
+			if script, errHex := hex.DecodeString(t.Script); errHex == nil {
+				t.Address, _ = ExtractAddress(script, b.network)
+			}
+		}
+		t.Address = ToCanonicalAddress(t.Address, b.network)
+	}
+
+	return &ScannedBlock{
+		Height:       height,
+		Transactions: txs,
+		Spends:       SpendsFromBlock(block),
+		FeeRates:     FeeRatesFromBlock(block),
+	}, nil
+}
+
+// scanRawBlock fetch the raw serialization of a block and decode its transactions
+func (b *Btc) scanRawBlock(raw RawBlockAPI, height int) (*ScannedBlock, error) {
+	data, err := raw.GetRawBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	block, err := DecodeBlock(data)
+	if err != nil {
+		return nil, err
+	}
 
-	return txs, nil
+	return &ScannedBlock{
+		Height:       height,
+		Transactions: TransactionsFromRawBlock(block, height, b.network),
+		Spends:       SpendsFromRawBlock(block, height),
+	}, nil
 }
 
 // GetHeadInfo get the info of the head block of the blockchain
@@ -0,0 +1,121 @@
+package btc
+
+import (
+	"errors"
+	"strings"
+)
+
+// implementation of the CashAddr format of the bitcoin cash addresses
+// https://github.com/bitcoincashorg/bitcoincash.org/blob/master/spec/cashaddr.md
+
+// CashAddr types of the hash
+const (
+	CashAddrP2PKH byte = 0
+	CashAddrP2SH  byte = 1
+)
+
+// Errors of the CashAddr encoding
+var (
+	ErrCashAddrPrefix   = errors.New("cashaddr prefix does not match the network")
+	ErrCashAddrChecksum = errors.New("invalid cashaddr checksum")
+	ErrCashAddrPayload  = errors.New("invalid cashaddr payload")
+)
+
+func cashAddrPolymod(values []byte) uint64 {
+	c := uint64(1)
+	for _, d := range values {
+		c0 := byte(c >> 35)
+		c = ((c & 0x07ffffffff) << 5) ^ uint64(d)
+		if c0&0x01 != 0 {
+			c ^= 0x98f2bc8e61
+		}
+		if c0&0x02 != 0 {
+			c ^= 0x79b76d99e2
+		}
+		if c0&0x04 != 0 {
+			c ^= 0xf33e5fb3c4
+		}
+		if c0&0x08 != 0 {
+			c ^= 0xae2eabe2a8
+		}
+		if c0&0x10 != 0 {
+			c ^= 0x1e4f43e470
+		}
+	}
+	return c ^ 1
+}
+
+func cashAddrPrefixExpand(prefix string) []byte {
+	out := make([]byte, 0, len(prefix)+1)
+	for i := 0; i < len(prefix); i++ {
+		out = append(out, prefix[i]&0x1f)
+	}
+	return append(out, 0)
+}
+
+// EncodeCashAddr encode a 20 bytes hash of the given type into a cashaddr with its prefix
+func EncodeCashAddr(prefix string, hashType byte, hash []byte) (string, error) {
+	if len(hash) != 20 {
+		return "", ErrCashAddrPayload
+	}
+	// the version byte holds the type and the size of the hash, 0 for 160 bits
+	data, err := convertBits(append([]byte{hashType << 3}, hash...), 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	values := append(cashAddrPrefixExpand(prefix), data...)
+	polymod := cashAddrPolymod(append(values, 0, 0, 0, 0, 0, 0, 0, 0))
+
+	var sb strings.Builder
+	sb.WriteString(prefix + ":")
+	for _, d := range data {
+		sb.WriteByte(bech32Charset[d])
+	}
+	for i := 0; i < 8; i++ {
+		sb.WriteByte(bech32Charset[(polymod>>uint(5*(7-i)))&0x1f])
+	}
+	return sb.String(), nil
+}
+
+// DecodeCashAddr decode a cashaddr of the given prefix, written with or without its prefix, into
+// the type and the hash it pays to
+func DecodeCashAddr(prefix string, addr string) (hashType byte, hash []byte, err error) {
+	if strings.ToLower(addr) != addr && strings.ToUpper(addr) != addr {
+		return 0, nil, ErrBech32Case
+	}
+	addr = strings.ToLower(addr)
+	if i := strings.IndexByte(addr, ':'); i >= 0 {
+		if addr[:i] != prefix {
+			return 0, nil, ErrCashAddrPrefix
+		}
+		addr = addr[i+1:]
+	}
+	if len(addr) < 9 {
+		return 0, nil, ErrCashAddrPayload
+	}
+
+	var data []byte
+	for i := 0; i < len(addr); i++ {
+		idx := strings.IndexByte(bech32Charset, addr[i])
+		if idx < 0 {
+			return 0, nil, ErrBech32Char
+		}
+		data = append(data, byte(idx))
+	}
+	if cashAddrPolymod(append(cashAddrPrefixExpand(prefix), data...)) != 0 {
+		return 0, nil, ErrCashAddrChecksum
+	}
+
+	payload, err := convertBits(data[:len(data)-8], 5, 8, false)
+	if err != nil {
+		return 0, nil, ErrCashAddrPayload
+	}
+	if len(payload) != 21 || payload[0]&0x07 != 0 {
+		return 0, nil, ErrCashAddrPayload
+	}
+	hashType = payload[0] >> 3
+	if hashType != CashAddrP2PKH && hashType != CashAddrP2SH {
+		return 0, nil, ErrCashAddrPayload
+	}
+	return hashType, payload[1:], nil
+}
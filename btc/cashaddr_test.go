@@ -0,0 +1,95 @@
+package btc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// legacy and cashaddr vectors of the cashaddr specification
+func TestCashAddrVectors(t *testing.T) {
+	tests := []struct {
+		legacy   string
+		cashAddr string
+	}{
+		{"1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu", "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a"},
+		{"1KXrWXciRDZUpQwQmuM1DbwsKDLYAYsVLR", "bitcoincash:qr95sy3j9xwd2ap32xkykttr4cvcu7as4y0qverfuy"},
+		{"16w1D5WRVKJuZUsSRzdLp9w3YGcgoxDXb", "bitcoincash:qqq3728yw0y47sqn6l2na30mcw6zm78dzqre909m2r"},
+		{"3CWFddi6m4ndiGyKqzYvsFYagqDLPVMTzC", "bitcoincash:ppm2qsznhks23z7629mms6s4cwef74vcwvn0h829pq"},
+		{"3LDsS579y7sruadqu11beEJoTjdFiFCdX4", "bitcoincash:pr95sy3j9xwd2ap32xkykttr4cvcu7as4yc93ky28e"},
+		{"31nwvkZwyPdgzjBJZXfDmSWsC4ZLKpYyUw", "bitcoincash:pqq3728yw0y47sqn6l2na30mcw6zm78dzq5ucqzc37"},
+	}
+	for _, tt := range tests {
+		b, err := Base58CheckDecode(tt.legacy)
+		if err != nil {
+			t.Fatalf("Base58CheckDecode(%s): %v", tt.legacy, err)
+		}
+		hashType := CashAddrP2PKH
+		if b[0] == BitcoinCashMainNet.ScriptHashPrefix {
+			hashType = CashAddrP2SH
+		}
+
+		addr, err := EncodeCashAddr("bitcoincash", hashType, b[1:])
+		if err != nil {
+			t.Errorf("EncodeCashAddr(%s): %v", tt.legacy, err)
+			continue
+		}
+		if addr != tt.cashAddr {
+			t.Errorf("EncodeCashAddr(%s) = %s, want %s", tt.legacy, addr, tt.cashAddr)
+		}
+
+		// decoded with or without prefix, in upper case as well
+		for _, s := range []string{tt.cashAddr, strings.TrimPrefix(tt.cashAddr, "bitcoincash:"), strings.ToUpper(tt.cashAddr)} {
+			gotType, hash, errDecode := DecodeCashAddr("bitcoincash", s)
+			if errDecode != nil {
+				t.Errorf("DecodeCashAddr(%s): %v", s, errDecode)
+				continue
+			}
+			if gotType != hashType || !bytes.Equal(hash, b[1:]) {
+				t.Errorf("DecodeCashAddr(%s) = %d %x, want %d %x", s, gotType, hash, hashType, b[1:])
+			}
+		}
+
+		// the legacy and cashaddr forms pay the same script, which is written back as cashaddr
+		legacyScript, err := AddressToScript(tt.legacy, BitcoinCashMainNet)
+		if err != nil {
+			t.Errorf("AddressToScript(%s): %v", tt.legacy, err)
+			continue
+		}
+		cashScript, err := AddressToScript(tt.cashAddr, BitcoinCashMainNet)
+		if err != nil {
+			t.Errorf("AddressToScript(%s): %v", tt.cashAddr, err)
+			continue
+		}
+		if !bytes.Equal(legacyScript, cashScript) {
+			t.Errorf("scripts of %s and %s differ: %x %x", tt.legacy, tt.cashAddr, legacyScript, cashScript)
+		}
+		if got, _ := ExtractAddress(cashScript, BitcoinCashMainNet); got != tt.cashAddr {
+			t.Errorf("ExtractAddress(%x) = %s, want %s", cashScript, got, tt.cashAddr)
+		}
+	}
+}
+
+func TestInvalidCashAddr(t *testing.T) {
+	hash, _ := hex.DecodeString("76a04053bda0a88bda5177b86a15c3b29f559873")
+	if _, err := EncodeCashAddr("bitcoincash", CashAddrP2PKH, hash[:19]); err != ErrCashAddrPayload {
+		t.Errorf("EncodeCashAddr of 19 bytes = %v, want %v", err, ErrCashAddrPayload)
+	}
+
+	tests := []struct {
+		addr string
+		err  error
+	}{
+		{"bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6q", ErrCashAddrChecksum},
+		{"bchtest:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a", ErrCashAddrPrefix},
+		{"bitcoincash:Qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a", ErrBech32Case},
+		{"bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6o", ErrBech32Char},
+		{"bitcoincash:qpm2", ErrCashAddrPayload},
+	}
+	for _, tt := range tests {
+		if _, _, err := DecodeCashAddr("bitcoincash", tt.addr); err != tt.err {
+			t.Errorf("DecodeCashAddr(%s) = %v, want %v", tt.addr, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package btc
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// Coin selection strategies
+const (
+	SelectBranchAndBound string = "bnb"
+	SelectLargestFirst   string = "largest_first"
+)
+
+// bnbMaxTries number of branches explored by the branch and bound search before giving up
+const bnbMaxTries int = 100000
+
+// Errors of the coin selection
+var (
+	ErrInsufficientFunds = errors.New("insufficient funds to pay the amount and the fee")
+	ErrSelectionStrategy = errors.New("unknown coin selection strategy, expected bnb or largest_first")
+	ErrUnsupportedInput  = errors.New("unsupported input script, expected p2pkh, p2sh-p2wpkh, p2wpkh or p2tr")
+)
+
+// Coin output of a tracked address that can be spent by a withdrawal
+type Coin struct {
+	Hash     string     `json:"hash"`
+	N        int        `json:"n"`
+	Value    int64      `json:"value"`
+	Address  string     `json:"address"`
+	PkScript []byte     `json:"-"`
+	Origin   *KeyOrigin `json:"-"` // set when the address is derived from a watched wallet
+}
+
+// Selection coins selected to pay a target, with the change left after the fee or 0 without change
+type Selection struct {
+	Coins  []*Coin
+	Fee    int64
+	Change int64
+	VSize  int
+}
+
+// Weights in weight units of the parts of a transaction, with a 72 bytes signature and compressed keys
+const (
+	txOverheadWeight  int = 4 * (4 + 1 + 1 + 4) // version, input and output counts, lock time
+	segwitFlagWeight  int = 2                   // marker and flag
+	inputBaseWeight   int = 4 * (32 + 4 + 4)    // previous output and sequence
+	p2pkhInputWeight  int = inputBaseWeight + 4*(1+107)
+	p2shInputWeight   int = inputBaseWeight + 4*(1+23) + 1 + 1 + 72 + 1 + 33
+	p2wpkhInputWeight int = inputBaseWeight + 4 + 1 + 1 + 72 + 1 + 33
+	p2trInputWeight   int = inputBaseWeight + 4 + 1 + 1 + 64
+)
+
+// InputWeight estimated weight of an input spending the given script pubkey once signed. P2SH
+// outputs are assumed to be nested P2WPKH, the only P2SH addresses derived by the wallets
+func InputWeight(script []byte) (int, error) {
+	switch ScriptType(script) {
+	case ScriptP2PKH:
+		return p2pkhInputWeight, nil
+	case ScriptP2SH:
+		return p2shInputWeight, nil
+	case ScriptP2WPKH:
+		return p2wpkhInputWeight, nil
+	case ScriptP2TR:
+		return p2trInputWeight, nil
+	default:
+		return 0, ErrUnsupportedInput
+	}
+}
+
+// OutputWeight weight of an output paying the given script pubkey
+func OutputWeight(script []byte) int {
+	return 4 * (8 + 1 + len(script))
+}
+
+// EstimateVSize estimated virtual size of a signed transaction spending the given scripts to the given outputs
+func EstimateVSize(inputs [][]byte, outputs [][]byte) (int, error) {
+	weight := txOverheadWeight
+	segwit := false
+	for _, in := range inputs {
+		w, err := InputWeight(in)
+		if err != nil {
+			return 0, err
+		}
+		weight += w
+		if t := ScriptType(in); t != ScriptP2PKH {
+			segwit = true
+		}
+	}
+	if segwit {
+		// the marker and flag, and an empty witness for each legacy input
+		weight += segwitFlagWeight
+		for _, in := range inputs {
+			if ScriptType(in) == ScriptP2PKH {
+				weight++
+			}
+		}
+	}
+	for _, out := range outputs {
+		weight += OutputWeight(out)
+	}
+	return (weight + 3) / 4, nil
+}
+
+// DustLimit smallest value of an output paying the given script that is relayed by the nodes
+func DustLimit(script []byte) int64 {
+	switch ScriptType(script) {
+	case ScriptP2WPKH, ScriptP2WSH, ScriptP2TR, ScriptWitness:
+		return 294
+	default:
+		return 546
+	}
+}
+
+// feeFor fee of the given virtual size at a rate in satoshis per vbyte, rounded up
+func feeFor(vsize int, feeRate float64) int64 {
+	return int64(math.Ceil(float64(vsize) * feeRate))
+}
+
+// SelectCoins select coins paying amount to the outputs at the given fee rate in satoshis per vbyte.
+// Branch and bound looks for a set of coins matching the target closely enough to avoid a change output
+// and falls back to largest first, which adds a change output unless it would be dust
+func SelectCoins(coins []*Coin, outputs [][]byte, amount int64, feeRate float64, change []byte, strategy string) (*Selection, error) {
+	if strategy != SelectBranchAndBound && strategy != SelectLargestFirst {
+		return nil, ErrSelectionStrategy
+	}
+
+	// coins sorted by effective value, their value minus the fee of spending them
+	type candidate struct {
+		coin      *Coin
+		effective int64
+	}
+	var candidates []candidate
+	for _, c := range coins {
+		w, err := InputWeight(c.PkScript)
+		if err != nil {
+			return nil, err
+		}
+		if ScriptType(c.PkScript) == ScriptP2PKH {
+			w++ // empty witness when spent along segwit inputs
+		}
+		if eff := c.Value - feeFor((w+3)/4, feeRate); eff > 0 {
+			candidates = append(candidates, candidate{coin: c, effective: eff})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].effective > candidates[j].effective })
+
+	// the segwit marker and flag are counted in the target so that the rounded sizes of the
+	// parts never add up to less than the size of the transaction
+	baseWeight := txOverheadWeight + segwitFlagWeight
+	for _, out := range outputs {
+		baseWeight += OutputWeight(out)
+	}
+	target := amount + feeFor((baseWeight+3)/4, feeRate)
+
+	if strategy == SelectBranchAndBound {
+		changeVSize := (OutputWeight(change) + 3) / 4
+		changeSpend, _ := InputWeight(change)
+		costOfChange := feeFor(changeVSize, feeRate) + feeFor((changeSpend+3)/4, feeRate)
+
+		values := make([]int64, len(candidates))
+		for i, c := range candidates {
+			values[i] = c.effective
+		}
+		if picked := branchAndBound(values, target, costOfChange); picked != nil {
+			var selected []*Coin
+			for _, i := range picked {
+				selected = append(selected, candidates[i].coin)
+			}
+			return finalizeSelection(selected, outputs, amount, feeRate, nil)
+		}
+	}
+
+	var selected []*Coin
+	var total int64
+	withChange := target + feeFor((OutputWeight(change)+3)/4, feeRate)
+	for _, c := range candidates {
+		selected = append(selected, c.coin)
+		total += c.effective
+		if total >= withChange {
+			return finalizeSelection(selected, outputs, amount, feeRate, change)
+		}
+	}
+	if total >= target {
+		return finalizeSelection(selected, outputs, amount, feeRate, nil)
+	}
+	return nil, ErrInsufficientFunds
+}
+
+// finalizeSelection compute the fee and change of the selected coins from the size of the final transaction.
+// The change is dropped into the fee when it would be dust
+func finalizeSelection(selected []*Coin, outputs [][]byte, amount int64, feeRate float64, change []byte) (*Selection, error) {
+	var inputs [][]byte
+	var total int64
+	for _, c := range selected {
+		inputs = append(inputs, c.PkScript)
+		total += c.Value
+	}
+
+	if change != nil {
+		vsize, err := EstimateVSize(inputs, append(append([][]byte{}, outputs...), change))
+		if err != nil {
+			return nil, err
+		}
+		fee := feeFor(vsize, feeRate)
+		if left := total - amount - fee; left >= DustLimit(change) {
+			return &Selection{Coins: selected, Fee: fee, Change: left, VSize: vsize}, nil
+		}
+	}
+
+	vsize, err := EstimateVSize(inputs, outputs)
+	if err != nil {
+		return nil, err
+	}
+	if total-amount < feeFor(vsize, feeRate) {
+		return nil, ErrInsufficientFunds
+	}
+	return &Selection{Coins: selected, Fee: total - amount, VSize: vsize}, nil
+}
+
+// branchAndBound depth first search of the subset of values, sorted in descending order, whose sum is
+// between target and target plus the cost of change with the least excess. Returns the picked indexes
+func branchAndBound(values []int64, target int64, costOfChange int64) []int {
+	var available int64
+	for _, v := range values {
+		available += v
+	}
+	if available < target {
+		return nil
+	}
+
+	var best, picked []int
+	bestExcess := int64(-1)
+	tries := 0
+	var search func(i int, value int64, remaining int64)
+	search = func(i int, value int64, remaining int64) {
+		if tries >= bnbMaxTries || value > target+costOfChange || value+remaining < target {
+			return
+		}
+		tries++
+		if value >= target {
+			if excess := value - target; bestExcess < 0 || excess < bestExcess {
+				best, bestExcess = append([]int{}, picked...), excess
+			}
+			return
+		}
+		if i == len(values) {
+			return
+		}
+		picked = append(picked, i)
+		search(i+1, value+values[i], remaining-values[i])
+		picked = picked[:len(picked)-1]
+		// skip the coins of the same value as the excluded one, they lead to the same sums
+		j := i + 1
+		for j < len(values) && values[j] == values[i] {
+			remaining -= values[j]
+			j++
+		}
+		search(j, value, remaining-values[i])
+	}
+	search(0, 0, available)
+	return best
+}
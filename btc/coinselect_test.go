@@ -0,0 +1,141 @@
+package btc
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testScript p2wpkh script paying to a hash filled with the given byte
+func testScript(b byte) []byte {
+	return append([]byte{opFalse, 20}, bytes.Repeat([]byte{b}, 20)...)
+}
+
+func testCoins(values ...int64) (coins []*Coin) {
+	for i, v := range values {
+		coins = append(coins, &Coin{Hash: string(rune('a'+i)) + "0", N: i, Value: v, PkScript: testScript(byte(i + 1))})
+	}
+	return
+}
+
+func selectedValues(sel *Selection) (values []int64) {
+	for _, c := range sel.Coins {
+		values = append(values, c.Value)
+	}
+	return
+}
+
+func TestSelectCoinsBranchAndBoundExactMatch(t *testing.T) {
+	to, change := testScript(0xaa), testScript(0xcc)
+	coins := testCoins(10000, 20000, 50000)
+
+	// effective values of 19932 and 9932 at 1 sat/vbyte, less the 42 vbytes of the transaction and its output
+	sel, err := SelectCoins(coins, [][]byte{to}, 29822, 1, change, SelectBranchAndBound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := selectedValues(sel); len(got) != 2 || got[0] != 20000 || got[1] != 10000 {
+		t.Errorf("selected %v, want [20000 10000]", got)
+	}
+	if sel.Change != 0 {
+		t.Errorf("change = %d, want none", sel.Change)
+	}
+	if sel.Fee != 30000-29822 || sel.Fee < int64(sel.VSize) {
+		t.Errorf("fee = %d for %d vbytes", sel.Fee, sel.VSize)
+	}
+}
+
+func TestSelectCoinsLargestFirstWithChange(t *testing.T) {
+	to, change := testScript(0xaa), testScript(0xcc)
+	coins := testCoins(10000, 20000, 50000)
+
+	sel, err := SelectCoins(coins, [][]byte{to}, 30000, 2, change, SelectLargestFirst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := selectedValues(sel); len(got) != 1 || got[0] != 50000 {
+		t.Errorf("selected %v, want [50000]", got)
+	}
+	vsize, _ := EstimateVSize([][]byte{coins[2].PkScript}, [][]byte{to, change})
+	if sel.VSize != vsize || sel.Fee != int64(2*vsize) {
+		t.Errorf("fee = %d for %d vbytes, want %d for %d", sel.Fee, sel.VSize, 2*vsize, vsize)
+	}
+	if sel.Change != 50000-30000-sel.Fee {
+		t.Errorf("change = %d, want %d", sel.Change, 50000-30000-sel.Fee)
+	}
+}
+
+func TestSelectCoinsBranchAndBoundFallback(t *testing.T) {
+	to, change := testScript(0xaa), testScript(0xcc)
+	coins := testCoins(10000, 20000, 50000)
+
+	// no subset matches 45000, the search falls back to largest first
+	sel, err := SelectCoins(coins, [][]byte{to}, 45000, 1, change, SelectBranchAndBound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel.Change == 0 {
+		t.Errorf("expected a change output, got fee %d", sel.Fee)
+	}
+	var total int64
+	for _, c := range sel.Coins {
+		total += c.Value
+	}
+	if total != 45000+sel.Fee+sel.Change {
+		t.Errorf("selected %d for 45000, fee %d and change %d", total, sel.Fee, sel.Change)
+	}
+}
+
+func TestSelectCoinsDustChange(t *testing.T) {
+	to, change := testScript(0xaa), testScript(0xcc)
+	coins := testCoins(50000)
+
+	// the 50000 coin leaves less than the dust limit after the fee, which goes to the miners
+	sel, err := SelectCoins(coins, [][]byte{to}, 49700, 1, change, SelectLargestFirst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel.Change != 0 || sel.Fee != 300 {
+		t.Errorf("change %d and fee %d, want no change and a fee of 300", sel.Change, sel.Fee)
+	}
+}
+
+func TestSelectCoinsInsufficientFunds(t *testing.T) {
+	to, change := testScript(0xaa), testScript(0xcc)
+	coins := testCoins(10000, 20000)
+
+	for _, strategy := range []string{SelectBranchAndBound, SelectLargestFirst} {
+		if _, err := SelectCoins(coins, [][]byte{to}, 30000, 1, change, strategy); err != ErrInsufficientFunds {
+			t.Errorf("%s: err = %v, want %v", strategy, err, ErrInsufficientFunds)
+		}
+	}
+	if _, err := SelectCoins(coins, [][]byte{to}, 1000, 1, change, "random"); err != ErrSelectionStrategy {
+		t.Errorf("err = %v, want %v", err, ErrSelectionStrategy)
+	}
+	if _, err := SelectCoins([]*Coin{{Value: 1000, PkScript: []byte{0x6a}}}, [][]byte{to}, 100, 1, change, SelectLargestFirst); err != ErrUnsupportedInput {
+		t.Errorf("err = %v, want %v", err, ErrUnsupportedInput)
+	}
+}
+
+func TestEstimateVSize(t *testing.T) {
+	p2pkh := append(append([]byte{opDup, opHash160, 20}, bytes.Repeat([]byte{1}, 20)...), opEqualVerify, opCheckSig)
+	tests := []struct {
+		name    string
+		inputs  [][]byte
+		outputs [][]byte
+		vsize   int
+	}{
+		{"p2wpkh", [][]byte{testScript(1)}, [][]byte{testScript(2), testScript(3)}, 141},
+		{"p2pkh", [][]byte{p2pkh}, [][]byte{p2pkh}, 192},
+		{"mixed", [][]byte{p2pkh, testScript(1)}, [][]byte{testScript(2)}, 258},
+	}
+	for _, tt := range tests {
+		got, err := EstimateVSize(tt.inputs, tt.outputs)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.vsize {
+			t.Errorf("%s: vsize = %d, want %d", tt.name, got, tt.vsize)
+		}
+	}
+}
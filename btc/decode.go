@@ -0,0 +1,271 @@
+package btc
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// RawBlock block decoded from its raw serialization
+type RawBlock struct {
+	Hash       string
+	Version    int32
+	PrevBlock  string
+	MerkleRoot string
+	Time       uint32
+	Bits       uint32
+	Nonce      uint32
+	Txs        []*RawTx
+}
+
+// RawTx transaction decoded from its raw serialization
+type RawTx struct {
+	Hash     string
+	Version  int32
+	Inputs   []*RawInput
+	Outputs  []*RawOutput
+	LockTime uint32
+	Size     int
+	Weight   int
+}
+
+// RawInput input of a raw transaction
+type RawInput struct {
+	PrevHash  string
+	PrevIndex uint32
+	Script    []byte
+	Witness   [][]byte
+	Sequence  uint32
+}
+
+// RawOutput output of a raw transaction
+type RawOutput struct {
+	Value    int64
+	PkScript []byte
+}
+
+// ErrUnexpectedEnd error returned when the raw data ends before the structure is fully decoded
+var ErrUnexpectedEnd = errors.New("unexpected end of raw data")
+
+// maxItems upper bound of any count read from raw data, to avoid huge allocations on corrupted input
+const maxItems uint64 = 1 << 20
+
+// DecodeBlockHex decode a hex encoded block, as returned by rawblock?format=hex or getblock with verbosity 0
+func DecodeBlockHex(s string) (*RawBlock, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeBlock(b)
+}
+
+// DecodeBlock decode a raw serialized block
+func DecodeBlock(b []byte) (*RawBlock, error) {
+	r := &reader{b: b}
+	header := r.bytes(80)
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	block := &RawBlock{Hash: hashToString(DoubleSha256(header))}
+	hr := &reader{b: header}
+	block.Version = int32(hr.uint32())
+	block.PrevBlock = hashToString(hr.bytes(32))
+	block.MerkleRoot = hashToString(hr.bytes(32))
+	block.Time = hr.uint32()
+	block.Bits = hr.uint32()
+	block.Nonce = hr.uint32()
+
+	n := r.varInt()
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		block.Txs = append(block.Txs, r.tx())
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.pos != len(b) {
+		return nil, fmt.Errorf("%d trailing bytes after block %s", len(b)-r.pos, block.Hash)
+	}
+	return block, nil
+}
+
+// DecodeTransactionHex decode a hex encoded transaction
+func DecodeTransactionHex(s string) (*RawTx, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	r := &reader{b: b}
+	tx := r.tx()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return tx, nil
+}
+
+// TransactionsFromRawBlock extract the outputs of a raw block as transactions, deriving the
+// address paid by each output from its script. Outputs without an address are skipped
+func TransactionsFromRawBlock(block *RawBlock, height int, net *Network) (txs []*Transaction) {
+	for _, tx := range block.Txs {
+		for n, out := range tx.Outputs {
+			addr, err := ExtractAddress(out.PkScript, net)
+			if err != nil {
+				continue
+			}
+			txs = append(txs, &Transaction{
+				Address:     addr,
+				Value:       *big.NewInt(out.Value),
+				BlockHeight: height,
+				Hash:        tx.Hash,
+				N:           n,
+			})
+		}
+	}
+	return
+}
+
+// VSize virtual size of the transaction in vbytes
+func (t *RawTx) VSize() int {
+	return (t.Weight + 3) / 4
+}
+
+// IsCoinbase returns true if the transaction is the coinbase of its block
+func (t *RawTx) IsCoinbase() bool {
+	return len(t.Inputs) == 1 && t.Inputs[0].PrevIndex == 0xffffffff &&
+		t.Inputs[0].PrevHash == hashToString(make([]byte, 32))
+}
+
+// reader sequential reader over raw data that keeps the first error encountered
+type reader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.b) {
+		r.err = ErrUnexpectedEnd
+		return nil
+	}
+	out := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return out
+}
+
+func (r *reader) byte() byte {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *reader) uint32() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (r *reader) uint64() uint64 {
+	b := r.bytes(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (r *reader) varInt() uint64 {
+	var n uint64
+	switch d := r.byte(); d {
+	case 0xfd:
+		b := r.bytes(2)
+		if b != nil {
+			n = uint64(binary.LittleEndian.Uint16(b))
+		}
+	case 0xfe:
+		n = uint64(r.uint32())
+	case 0xff:
+		n = r.uint64()
+	default:
+		n = uint64(d)
+	}
+	if n > maxItems && r.err == nil {
+		r.err = fmt.Errorf("count %d is too large", n)
+	}
+	return n
+}
+
+func (r *reader) varBytes() []byte {
+	return r.bytes(int(r.varInt()))
+}
+
+// tx decode a transaction, with or without witness data
+func (r *reader) tx() *RawTx {
+	start := r.pos
+	tx := &RawTx{Version: int32(r.uint32())}
+
+	segwit := false
+	if r.err == nil && r.pos+2 <= len(r.b) && r.b[r.pos] == 0x00 && r.b[r.pos+1] == 0x01 {
+		segwit = true
+		r.pos += 2
+	}
+
+	// the transaction id is the hash of the serialization without the marker, flag and witnesses
+	bodyStart := r.pos
+	nIn := r.varInt()
+	for i := uint64(0); i < nIn && r.err == nil; i++ {
+		in := &RawInput{}
+		in.PrevHash = hashToString(r.bytes(32))
+		in.PrevIndex = r.uint32()
+		in.Script = r.varBytes()
+		in.Sequence = r.uint32()
+		tx.Inputs = append(tx.Inputs, in)
+	}
+	nOut := r.varInt()
+	for i := uint64(0); i < nOut && r.err == nil; i++ {
+		out := &RawOutput{Value: int64(r.uint64())}
+		out.PkScript = r.varBytes()
+		tx.Outputs = append(tx.Outputs, out)
+	}
+	bodyEnd := r.pos
+
+	if segwit {
+		for _, in := range tx.Inputs {
+			n := r.varInt()
+			for i := uint64(0); i < n && r.err == nil; i++ {
+				in.Witness = append(in.Witness, r.varBytes())
+			}
+		}
+	}
+	lockTime := r.bytes(4)
+	if r.err != nil {
+		return tx
+	}
+	tx.LockTime = binary.LittleEndian.Uint32(lockTime)
+
+	stripped := make([]byte, 0, 8+bodyEnd-bodyStart)
+	stripped = append(stripped, r.b[start:start+4]...)
+	stripped = append(stripped, r.b[bodyStart:bodyEnd]...)
+	stripped = append(stripped, lockTime...)
+
+	tx.Hash = hashToString(DoubleSha256(stripped))
+	tx.Size = r.pos - start
+	tx.Weight = len(stripped)*3 + tx.Size
+	return tx
+}
+
+// hashToString format a hash in the reversed byte order used to display bitcoin hashes
+func hashToString(h []byte) string {
+	rev := make([]byte, len(h))
+	for i := range h {
+		rev[i] = h[len(h)-1-i]
+	}
+	return hex.EncodeToString(rev)
+}
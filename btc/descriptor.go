@@ -0,0 +1,277 @@
+package btc
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// implementation of the single key output descriptors used to watch HD wallets
+// https://github.com/bitcoin/bitcoin/blob/master/doc/descriptors.md
+
+// Output descriptor script types
+const (
+	DescriptorPKH     string = "pkh"
+	DescriptorSHWPKH  string = "sh(wpkh)"
+	DescriptorWPKH    string = "wpkh"
+	DescriptorTR      string = "tr"
+	descriptorInput   string = "0123456789()[],'/*abcdefgh@:$%{}IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+	descriptorCharset string = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+)
+
+// purposes BIP44/49/84/86 purpose of each descriptor script type
+var purposes = map[uint32]string{
+	44: DescriptorPKH,
+	49: DescriptorSHWPKH,
+	84: DescriptorWPKH,
+	86: DescriptorTR,
+}
+
+// Errors of the output descriptors
+var (
+	ErrDescriptorChecksum = errors.New("invalid descriptor checksum")
+	ErrDescriptorFormat   = errors.New("unsupported descriptor, expected pkh, sh(wpkh), wpkh or tr of a ranged extended public key")
+	ErrDescriptorPurpose  = errors.New("unsupported purpose, expected 44, 49, 84 or 86")
+	ErrDescriptorNetwork  = errors.New("the network has no segwit addresses, use a pkh descriptor")
+)
+
+// Descriptor ranged output descriptor of a single extended public key
+type Descriptor struct {
+	Type   string
+	Key    *ExtendedKey
+	XPub   string
+	Origin string
+	Path   []uint32
+}
+
+// ParseDescriptor parse a ranged descriptor such as wpkh([d34db33f/84'/0'/0']xpub.../0/*)#checksum.
+// The checksum is optional but verified when present
+func ParseDescriptor(s string) (*Descriptor, error) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '#'); i >= 0 {
+		sum, err := DescriptorChecksum(s[:i])
+		if err != nil {
+			return nil, err
+		}
+		if sum != s[i+1:] {
+			return nil, ErrDescriptorChecksum
+		}
+		s = s[:i]
+	}
+
+	d := &Descriptor{}
+	var expr string
+	switch {
+	case strings.HasPrefix(s, "sh(wpkh(") && strings.HasSuffix(s, "))"):
+		d.Type, expr = DescriptorSHWPKH, s[len("sh(wpkh("):len(s)-2]
+	case strings.HasPrefix(s, "wpkh(") && strings.HasSuffix(s, ")"):
+		d.Type, expr = DescriptorWPKH, s[len("wpkh("):len(s)-1]
+	case strings.HasPrefix(s, "pkh(") && strings.HasSuffix(s, ")"):
+		d.Type, expr = DescriptorPKH, s[len("pkh("):len(s)-1]
+	case strings.HasPrefix(s, "tr(") && strings.HasSuffix(s, ")"):
+		d.Type, expr = DescriptorTR, s[len("tr("):len(s)-1]
+	default:
+		return nil, ErrDescriptorFormat
+	}
+
+	if strings.HasPrefix(expr, "[") {
+		end := strings.IndexByte(expr, ']')
+		if end < 0 {
+			return nil, ErrDescriptorFormat
+		}
+		d.Origin, expr = expr[1:end], expr[end+1:]
+	}
+
+	parts := strings.Split(expr, "/")
+	if len(parts) < 2 || parts[len(parts)-1] != "*" {
+		return nil, ErrDescriptorFormat
+	}
+	key, err := ParseExtendedKey(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	d.Key, d.XPub = key, parts[0]
+
+	for _, p := range parts[1 : len(parts)-1] {
+		i, errConv := strconv.ParseUint(p, 10, 32)
+		if errConv != nil {
+			return nil, fmt.Errorf("invalid derivation step %s: %v", p, ErrHardenedDerivation)
+		}
+		d.Path = append(d.Path, uint32(i))
+	}
+	return d, nil
+}
+
+// NewDescriptorFromKey build the descriptor of the receiving addresses of an extended public key.
+// When purpose is 0, it is deduced from the version of the key (xpub 44, ypub 49, zpub 84)
+func NewDescriptorFromKey(xpub string, purpose uint32) (*Descriptor, error) {
+	key, err := ParseExtendedKey(xpub)
+	if err != nil {
+		return nil, err
+	}
+	if purpose == 0 {
+		purpose = key.Purpose
+	}
+	t, ok := purposes[purpose]
+	if !ok {
+		return nil, ErrDescriptorPurpose
+	}
+
+	return &Descriptor{
+		Type: t,
+		Key:  key,
+		XPub: xpub,
+		Path: []uint32{0},
+	}, nil
+}
+
+// String returns the descriptor with its checksum
+func (d *Descriptor) String() string {
+	var sb strings.Builder
+	if d.Origin != "" {
+		sb.WriteString("[" + d.Origin + "]")
+	}
+	sb.WriteString(d.XPub)
+	for _, p := range d.Path {
+		sb.WriteString("/" + strconv.FormatUint(uint64(p), 10))
+	}
+	sb.WriteString("/*")
+
+	var s string
+	switch d.Type {
+	case DescriptorSHWPKH:
+		s = "sh(wpkh(" + sb.String() + "))"
+	default:
+		s = d.Type + "(" + sb.String() + ")"
+	}
+	sum, _ := DescriptorChecksum(s)
+	return s + "#" + sum
+}
+
+// Address derive the address at the given index of the descriptor and returns it with its
+// derivation path relative to the extended key
+func (d *Descriptor) Address(index uint32, net *Network) (addr string, path string, err error) {
+	if err = d.Key.CheckNetwork(net); err != nil {
+		return
+	}
+	full := append(append([]uint32{}, d.Path...), index)
+	child, err := d.Key.Derive(full)
+	if err != nil {
+		return
+	}
+
+	var steps []string
+	for _, p := range full {
+		steps = append(steps, strconv.FormatUint(uint64(p), 10))
+	}
+	path = strings.Join(steps, "/")
+
+	if net.Bech32HRP == "" && d.Type != DescriptorPKH {
+		err = ErrDescriptorNetwork
+		return
+	}
+
+	switch d.Type {
+	case DescriptorPKH:
+		script := append(append([]byte{opDup, opHash160, 20}, Hash160(child.Key)...), opEqualVerify, opCheckSig)
+		addr, err = ExtractAddress(script, net)
+	case DescriptorSHWPKH:
+		redeem := append([]byte{opFalse, 20}, Hash160(child.Key)...)
+		addr = Base58CheckEncode([]byte{net.ScriptHashPrefix}, Hash160(redeem))
+	case DescriptorWPKH:
+		addr, err = EncodeSegwitAddress(net.Bech32HRP, 0, Hash160(child.Key))
+	case DescriptorTR:
+		var outputKey []byte
+		if outputKey, err = TaprootOutputKey(child.Key); err != nil {
+			return
+		}
+		addr, err = EncodeSegwitAddress(net.Bech32HRP, 1, outputKey)
+	default:
+		err = ErrDescriptorFormat
+	}
+	return
+}
+
+// KeyOrigin derive the public key at the given index of the descriptor with its origin, the fingerprint
+// and path from the master key when the descriptor has an origin, or from the extended key otherwise
+func (d *Descriptor) KeyOrigin(index uint32) (*KeyOrigin, error) {
+	full := append(append([]uint32{}, d.Path...), index)
+	child, err := d.Key.Derive(full)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &KeyOrigin{PubKey: child.Key, Fingerprint: Hash160(d.Key.Key)[:4], Path: full}
+	if d.Origin != "" {
+		steps := strings.Split(d.Origin, "/")
+		fp, errHex := hex.DecodeString(steps[0])
+		if errHex != nil || len(fp) != 4 {
+			return nil, ErrDescriptorFormat
+		}
+		var path []uint32
+		for _, step := range steps[1:] {
+			hardened := strings.HasSuffix(step, "'") || strings.HasSuffix(step, "h")
+			i, errConv := strconv.ParseUint(strings.TrimRight(step, "'h"), 10, 31)
+			if errConv != nil {
+				return nil, ErrDescriptorFormat
+			}
+			if hardened {
+				i += uint64(HardenedKeyStart)
+			}
+			path = append(path, uint32(i))
+		}
+		o.Fingerprint, o.Path = fp, append(path, full...)
+	}
+	if d.Type == DescriptorTR {
+		o.PubKey, o.Taproot = child.Key[1:], true
+	}
+	return o, nil
+}
+
+// DescriptorChecksum compute the 8 characters checksum of a descriptor
+func DescriptorChecksum(s string) (string, error) {
+	gen := [5]uint64{0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd}
+	polymod := func(chk uint64, v uint64) uint64 {
+		top := chk >> 35
+		chk = (chk&0x7ffffffff)<<5 ^ v
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+		return chk
+	}
+
+	chk := uint64(1)
+	var groups []uint64
+	for i := 0; i < len(s); i++ {
+		pos := strings.IndexByte(descriptorInput, s[i])
+		if pos < 0 {
+			return "", ErrDescriptorFormat
+		}
+		chk = polymod(chk, uint64(pos&31))
+		groups = append(groups, uint64(pos>>5))
+		if len(groups) == 3 {
+			chk = polymod(chk, groups[0]*9+groups[1]*3+groups[2])
+			groups = groups[:0]
+		}
+	}
+	switch len(groups) {
+	case 1:
+		chk = polymod(chk, groups[0])
+	case 2:
+		chk = polymod(chk, groups[0]*3+groups[1])
+	}
+	for i := 0; i < 8; i++ {
+		chk = polymod(chk, 0)
+	}
+	chk ^= 1
+
+	out := make([]byte, 8)
+	for i := 0; i < 8; i++ {
+		out[i] = descriptorCharset[(chk>>uint(5*(7-i)))&31]
+	}
+	return string(out), nil
+}
@@ -0,0 +1,81 @@
+package btc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// Serialize serialize the transaction without its witnesses, as in the unsigned transaction of a psbt
+func (t *RawTx) Serialize() []byte {
+	var buf bytes.Buffer
+	writeUint32(&buf, uint32(t.Version))
+	writeVarInt(&buf, uint64(len(t.Inputs)))
+	for _, in := range t.Inputs {
+		buf.Write(stringToHash(in.PrevHash))
+		writeUint32(&buf, in.PrevIndex)
+		writeVarBytes(&buf, in.Script)
+		writeUint32(&buf, in.Sequence)
+	}
+	writeVarInt(&buf, uint64(len(t.Outputs)))
+	for _, out := range t.Outputs {
+		writeOutput(&buf, out)
+	}
+	writeUint32(&buf, t.LockTime)
+	return buf.Bytes()
+}
+
+// TxID compute the id of the transaction from its serialization without witnesses
+func (t *RawTx) TxID() string {
+	return hashToString(DoubleSha256(t.Serialize()))
+}
+
+func writeOutput(buf *bytes.Buffer, out *RawOutput) {
+	var v [8]byte
+	binary.LittleEndian.PutUint64(v[:], uint64(out.Value))
+	buf.Write(v[:])
+	writeVarBytes(buf, out.PkScript)
+}
+
+func writeUint32(buf *bytes.Buffer, n uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], n)
+	buf.Write(b[:])
+}
+
+func writeVarInt(buf *bytes.Buffer, n uint64) {
+	switch {
+	case n < 0xfd:
+		buf.WriteByte(byte(n))
+	case n <= 0xffff:
+		var b [2]byte
+		binary.LittleEndian.PutUint16(b[:], uint16(n))
+		buf.WriteByte(0xfd)
+		buf.Write(b[:])
+	case n <= 0xffffffff:
+		buf.WriteByte(0xfe)
+		writeUint32(buf, uint32(n))
+	default:
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], n)
+		buf.WriteByte(0xff)
+		buf.Write(b[:])
+	}
+}
+
+func writeVarBytes(buf *bytes.Buffer, b []byte) {
+	writeVarInt(buf, uint64(len(b)))
+	buf.Write(b)
+}
+
+// stringToHash parse a hash displayed in reversed byte order back into its internal byte order
+func stringToHash(s string) []byte {
+	h, err := hex.DecodeString(s)
+	if err != nil || len(h) != 32 {
+		return make([]byte, 32)
+	}
+	for i, j := 0, len(h)-1; i < j; i, j = i+1, j-1 {
+		h[i], h[j] = h[j], h[i]
+	}
+	return h
+}
@@ -0,0 +1,185 @@
+package btc
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Confirmation speeds of the fee estimates
+const (
+	FeeFast    string = "fast"
+	FeeMedium  string = "medium"
+	FeeSlow    string = "slow"
+	FeeEconomy string = "economy"
+)
+
+// feeSpeeds target in blocks of each speed and percentile of the recent blocks' fee rates used for it
+var feeSpeeds = map[string]struct {
+	blocks     int
+	percentile int
+}{
+	FeeFast:    {blocks: 1, percentile: 75},
+	FeeMedium:  {blocks: 3, percentile: 50},
+	FeeSlow:    {blocks: 6, percentile: 25},
+	FeeEconomy: {blocks: 144, percentile: 10},
+}
+
+// FeePercentiles percentiles of the fee rates kept for each scanned block
+var FeePercentiles = []int{10, 25, 50, 75, 90}
+
+// Errors of the fee estimation
+var (
+	ErrFeeEstimateAPI = errors.New("provider does not return fee estimates")
+	ErrNoFeeEstimate  = errors.New("no fee estimate available from the provider nor from the scanned blocks")
+	ErrFeeSpeed       = errors.New("unknown fee speed, expected fast, medium, slow or economy")
+)
+
+// FeeEstimateAPI interface of the providers able to estimate fee rates, in satoshis per vbyte by
+// confirmation target in blocks
+type FeeEstimateAPI interface {
+	GetFeeEstimates() (map[int]float64, error)
+}
+
+// FeeEstimate fee rates in satoshis per vbyte by confirmation speed
+type FeeEstimate struct {
+	Fast      float64   `json:"fast"`    // next block
+	Medium    float64   `json:"medium"`  // within 3 blocks
+	Slow      float64   `json:"slow"`    // within 6 blocks
+	Economy   float64   `json:"economy"` // within a day
+	Sources   []string  `json:"sources"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Rate returns the fee rate of the given speed
+func (f *FeeEstimate) Rate(speed string) (float64, error) {
+	switch speed {
+	case FeeFast:
+		return f.Fast, nil
+	case FeeMedium:
+		return f.Medium, nil
+	case FeeSlow:
+		return f.Slow, nil
+	case FeeEconomy:
+		return f.Economy, nil
+	default:
+		return 0, ErrFeeSpeed
+	}
+}
+
+// GetFeeEstimates get the fee estimates of the provider by confirmation target
+func (b *Btc) GetFeeEstimates() (map[int]float64, error) {
+	fe, ok := b.api.(FeeEstimateAPI)
+	if !ok {
+		return nil, ErrFeeEstimateAPI
+	}
+	return fe.GetFeeEstimates()
+}
+
+// FeeRatesFromBlock compute the fee rate of each transaction of a block in satoshis per vbyte, from the
+// fee and weight returned by the provider. Coinbase transactions are skipped
+func FeeRatesFromBlock(block *Block) (rates []float64) {
+	for _, tx := range block.Txs {
+		if len(tx.Inputs) == 0 || (tx.Inputs[0].PrevOut.Hash == "" && tx.Inputs[0].PrevOut.TxIndex.Sign() == 0) {
+			continue
+		}
+		vsize := tx.Size
+		if tx.Weight > 0 {
+			vsize = (tx.Weight + 3) / 4
+		}
+		if vsize == 0 {
+			continue
+		}
+		fee, _ := new(big.Float).SetInt(&tx.Fee).Float64()
+		rates = append(rates, fee/float64(vsize))
+	}
+	return
+}
+
+// FeeRatePercentiles compute the percentiles of the given fee rates, keyed by percentile
+func FeeRatePercentiles(rates []float64) map[string]float64 {
+	sorted := append([]float64{}, rates...)
+	sort.Float64s(sorted)
+	out := make(map[string]float64, len(FeePercentiles))
+	for _, p := range FeePercentiles {
+		out[strconv.Itoa(p)] = percentile(sorted, p)
+	}
+	return out
+}
+
+// percentile nearest rank percentile of sorted values
+func percentile(sorted []float64, p int) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(float64(p)/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// CombineFeeEstimates combine the provider estimates by target with the fee rate percentiles of the
+// recently scanned blocks. Each speed is the average of the available sources, bounded by min and
+// max, and never higher than a faster speed
+func CombineFeeEstimates(provider map[int]float64, blocks []map[string]float64, min float64, max float64) (*FeeEstimate, error) {
+	rates := make(map[string]float64, len(feeSpeeds))
+	sources := make(map[string]bool)
+	for speed, s := range feeSpeeds {
+		var values []float64
+		if v, ok := providerEstimate(provider, s.blocks); ok {
+			values = append(values, v)
+			sources["provider"] = true
+		}
+		var local []float64
+		for _, b := range blocks {
+			if v, ok := b[strconv.Itoa(s.percentile)]; ok && v > 0 {
+				local = append(local, v)
+			}
+		}
+		if len(local) > 0 {
+			sort.Float64s(local)
+			values = append(values, local[len(local)/2])
+			sources["blocks"] = true
+		}
+		if len(values) == 0 {
+			return nil, ErrNoFeeEstimate
+		}
+
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		rates[speed] = math.Min(math.Max(sum/float64(len(values)), min), max)
+	}
+
+	f := &FeeEstimate{
+		Fast:      rates[FeeFast],
+		Medium:    math.Min(rates[FeeMedium], rates[FeeFast]),
+		UpdatedAt: time.Now(),
+	}
+	f.Slow = math.Min(rates[FeeSlow], f.Medium)
+	f.Economy = math.Min(rates[FeeEconomy], f.Slow)
+	for s := range sources {
+		f.Sources = append(f.Sources, s)
+	}
+	sort.Strings(f.Sources)
+	return f, nil
+}
+
+// providerEstimate returns the provider estimate of the largest target not above the given one
+func providerEstimate(estimates map[int]float64, target int) (float64, bool) {
+	best := 0
+	for t := range estimates {
+		if t <= target && t > best && estimates[t] > 0 {
+			best = t
+		}
+	}
+	if best == 0 {
+		return 0, false
+	}
+	return estimates[best], true
+}
@@ -0,0 +1,211 @@
+package btc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// implementation of the public derivation of BIP32 extended keys
+// https://github.com/bitcoin/bips/blob/master/bip-0032.mediawiki
+
+// HardenedKeyStart index of the first hardened child key
+const HardenedKeyStart uint32 = 0x80000000
+
+// Errors of the extended keys
+var (
+	ErrExtendedKeyLength  = errors.New("invalid extended key length")
+	ErrExtendedKeyVersion = errors.New("unknown extended key version")
+	ErrPrivateKeyVersion  = errors.New("extended private keys are not accepted, use the public key")
+	ErrHardenedDerivation = errors.New("cannot derive a hardened child from a public key")
+	ErrInvalidChild       = errors.New("invalid child key, use the next index")
+	ErrKeyNetwork         = errors.New("extended key does not belong to the network")
+)
+
+// keyVersion network and default BIP purpose of an extended public key version
+type keyVersion struct {
+	testnet bool
+	purpose uint32
+}
+
+// versions of the extended public keys (xpub, ypub, zpub and their testnet counterparts)
+var keyVersions = map[string]keyVersion{
+	"0488b21e": {testnet: false, purpose: 44},
+	"049d7cb2": {testnet: false, purpose: 49},
+	"04b24746": {testnet: false, purpose: 84},
+	"043587cf": {testnet: true, purpose: 44},
+	"044a5262": {testnet: true, purpose: 49},
+	"045f1cf6": {testnet: true, purpose: 84},
+}
+
+// versions of the extended private keys, rejected since keys never touch the functions
+var privateKeyVersions = map[string]bool{
+	"0488ade4": true, "049d7878": true, "04b2430c": true,
+	"04358394": true, "044a4e28": true, "045f18bc": true,
+}
+
+// ExtendedKey BIP32 extended public key
+type ExtendedKey struct {
+	Version     string
+	Depth       byte
+	Fingerprint []byte
+	ChildNumber uint32
+	ChainCode   []byte
+	Key         []byte
+	Testnet     bool
+	Purpose     uint32
+}
+
+// ParseExtendedKey parse a base58 extended public key (xpub, ypub, zpub, tpub, upub, vpub)
+func ParseExtendedKey(s string) (*ExtendedKey, error) {
+	b, err := Base58CheckDecode(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 78 {
+		return nil, ErrExtendedKeyLength
+	}
+
+	version := hex.EncodeToString(b[:4])
+	if privateKeyVersions[version] {
+		return nil, ErrPrivateKeyVersion
+	}
+	kv, ok := keyVersions[version]
+	if !ok {
+		return nil, ErrExtendedKeyVersion
+	}
+	if _, err = btcec.ParsePubKey(b[45:78], btcec.S256()); err != nil {
+		return nil, err
+	}
+
+	return &ExtendedKey{
+		Version:     version,
+		Depth:       b[4],
+		Fingerprint: b[5:9],
+		ChildNumber: binary.BigEndian.Uint32(b[9:13]),
+		ChainCode:   b[13:45],
+		Key:         b[45:78],
+		Testnet:     kv.testnet,
+		Purpose:     kv.purpose,
+	}, nil
+}
+
+// CheckNetwork returns an error if the extended key does not belong to the given network
+func (k *ExtendedKey) CheckNetwork(net *Network) error {
+	if k.Testnet != net.Testnet {
+		return ErrKeyNetwork
+	}
+	return nil
+}
+
+// Child derive the non-hardened public child key at the given index
+func (k *ExtendedKey) Child(i uint32) (*ExtendedKey, error) {
+	if i >= HardenedKeyStart {
+		return nil, ErrHardenedDerivation
+	}
+
+	data := make([]byte, 37)
+	copy(data, k.Key)
+	binary.BigEndian.PutUint32(data[33:], i)
+
+	mac := hmac.New(sha512.New, k.ChainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+	il, ir := sum[:32], sum[32:]
+
+	curve := btcec.S256()
+	ilNum := new(big.Int).SetBytes(il)
+	if ilNum.Cmp(curve.N) >= 0 {
+		return nil, ErrInvalidChild
+	}
+
+	parent, err := btcec.ParsePubKey(k.Key, curve)
+	if err != nil {
+		return nil, err
+	}
+	x, y := curve.ScalarBaseMult(il)
+	cx, cy := curve.Add(x, y, parent.X, parent.Y)
+	if cx.Sign() == 0 && cy.Sign() == 0 {
+		return nil, ErrInvalidChild
+	}
+	child := &btcec.PublicKey{Curve: curve, X: cx, Y: cy}
+
+	return &ExtendedKey{
+		Version:     k.Version,
+		Depth:       k.Depth + 1,
+		Fingerprint: Hash160(k.Key)[:4],
+		ChildNumber: i,
+		ChainCode:   ir,
+		Key:         child.SerializeCompressed(),
+		Testnet:     k.Testnet,
+		Purpose:     k.Purpose,
+	}, nil
+}
+
+// Derive derive the public key at the given path of non-hardened indexes
+func (k *ExtendedKey) Derive(path []uint32) (child *ExtendedKey, err error) {
+	child = k
+	for _, i := range path {
+		if child, err = child.Child(i); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// Hash160 ripemd160(sha256(b)), hash of public keys and scripts used in addresses
+func Hash160(b []byte) []byte {
+	s := sha256.Sum256(b)
+	r := ripemd160.New()
+	r.Write(s[:])
+	return r.Sum(nil)
+}
+
+// taggedHash BIP340 tagged hash sha256(sha256(tag) || sha256(tag) || msg)
+func taggedHash(tag string, msg []byte) []byte {
+	t := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(t[:])
+	h.Write(t[:])
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+// TaprootOutputKey compute the BIP86 output key of an internal public key without script path
+// https://github.com/bitcoin/bips/blob/master/bip-0341.mediawiki
+func TaprootOutputKey(pubKey []byte) ([]byte, error) {
+	curve := btcec.S256()
+	p, err := btcec.ParsePubKey(pubKey, curve)
+	if err != nil {
+		return nil, err
+	}
+	// the internal key is the point with an even y coordinate for the x coordinate of the key
+	py := new(big.Int).Set(p.Y)
+	if py.Bit(0) == 1 {
+		py.Sub(curve.P, py)
+	}
+	px := padTo32(p.X.Bytes())
+
+	t := taggedHash("TapTweak", px)
+	if new(big.Int).SetBytes(t).Cmp(curve.N) >= 0 {
+		return nil, fmt.Errorf("invalid taproot tweak for key %x", pubKey)
+	}
+	tx, ty := curve.ScalarBaseMult(t)
+	qx, _ := curve.Add(p.X, py, tx, ty)
+	return padTo32(qx.Bytes()), nil
+}
+
+func padTo32(b []byte) []byte {
+	if len(b) >= 32 {
+		return b
+	}
+	return append(make([]byte, 32-len(b)), b...)
+}
@@ -0,0 +1,233 @@
+package btc
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// testPrivateKey BIP32 extended private key, only derived in the tests since the functions
+// never see private keys
+type testPrivateKey struct {
+	depth       byte
+	fingerprint []byte
+	childNumber uint32
+	chainCode   []byte
+	key         []byte
+}
+
+func testMasterKey(seed []byte) *testPrivateKey {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	return &testPrivateKey{fingerprint: make([]byte, 4), key: sum[:32], chainCode: sum[32:]}
+}
+
+func testMnemonicSeed(mnemonic string) []byte {
+	return pbkdf2.Key([]byte(mnemonic), []byte("mnemonic"), 2048, 64, sha512.New)
+}
+
+func (k *testPrivateKey) pubKey() []byte {
+	_, pub := btcec.PrivKeyFromBytes(btcec.S256(), k.key)
+	return pub.SerializeCompressed()
+}
+
+func (k *testPrivateKey) derive(path ...uint32) *testPrivateKey {
+	child := k
+	for _, i := range path {
+		data := make([]byte, 37)
+		if i >= HardenedKeyStart {
+			copy(data[1:], child.key)
+		} else {
+			copy(data, child.pubKey())
+		}
+		binary.BigEndian.PutUint32(data[33:], i)
+
+		mac := hmac.New(sha512.New, child.chainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		n := new(big.Int).SetBytes(sum[:32])
+		n.Add(n, new(big.Int).SetBytes(child.key))
+		n.Mod(n, btcec.S256().N)
+
+		child = &testPrivateKey{
+			depth:       child.depth + 1,
+			fingerprint: Hash160(child.pubKey())[:4],
+			childNumber: i,
+			chainCode:   sum[32:],
+			key:         padTo32(n.Bytes()),
+		}
+	}
+	return child
+}
+
+// neuter serialize the extended public key with the given version
+func (k *testPrivateKey) neuter(version string) string {
+	return serializeTestKey(version, k.depth, k.fingerprint, k.childNumber, k.chainCode, k.pubKey())
+}
+
+func serializeTestKey(version string, depth byte, fingerprint []byte, childNumber uint32, chainCode, key []byte) string {
+	v, _ := hex.DecodeString(version)
+	b := append(v, depth)
+	b = append(b, fingerprint...)
+	b = append(b, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(b[len(b)-4:], childNumber)
+	b = append(b, chainCode...)
+	return Base58CheckEncode(b[:4], append(b[4:], key...))
+}
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+// BIP32 test vector 1
+func TestBIP32Vector1(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master := testMasterKey(seed)
+
+	tests := []struct {
+		path []uint32
+		xpub string
+	}{
+		{nil, "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"},
+		{[]uint32{HardenedKeyStart}, "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw"},
+		{[]uint32{HardenedKeyStart, 1}, "xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ"},
+	}
+	for _, tt := range tests {
+		if got := master.derive(tt.path...).neuter("0488b21e"); got != tt.xpub {
+			t.Errorf("xpub of %v = %s, want %s", tt.path, got, tt.xpub)
+		}
+	}
+
+	// public derivation of m/0H/1 from the xpub of m/0H
+	parent, err := ParseExtendedKey(tests[1].xpub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := parent.Child(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := serializeTestKey(child.Version, child.Depth, child.Fingerprint, child.ChildNumber, child.ChainCode, child.Key)
+	if got != tests[2].xpub {
+		t.Errorf("Child(1) = %s, want %s", got, tests[2].xpub)
+	}
+
+	if _, err = parent.Child(HardenedKeyStart); err != ErrHardenedDerivation {
+		t.Errorf("hardened Child = %v, want %v", err, ErrHardenedDerivation)
+	}
+}
+
+func TestParseExtendedKeyRejectsPrivateKeys(t *testing.T) {
+	master := testMasterKey(testMnemonicSeed(testMnemonic))
+	xprv := serializeTestKey("0488ade4", 0, make([]byte, 4), 0, master.chainCode, append([]byte{0}, master.key...))
+	if _, err := ParseExtendedKey(xprv); err != ErrPrivateKeyVersion {
+		t.Errorf("ParseExtendedKey(xprv) = %v, want %v", err, ErrPrivateKeyVersion)
+	}
+}
+
+// BIP44, BIP49, BIP84 and BIP86 test vectors of the mnemonic "abandon ... about"
+func TestDescriptorAddressVectors(t *testing.T) {
+	master := testMasterKey(testMnemonicSeed(testMnemonic))
+	h := func(i uint32) uint32 { return i + HardenedKeyStart }
+
+	tests := []struct {
+		name    string
+		account []uint32
+		version string
+		xpub    string
+		purpose uint32
+		net     *Network
+		change  uint32
+		index   uint32
+		addr    string
+	}{
+		{"bip44", []uint32{h(44), h(0), h(0)}, "0488b21e", "", 0, MainNet, 0, 0, "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"},
+		{"bip49 testnet", []uint32{h(49), h(1), h(0)}, "044a5262", "", 0, TestNet3, 0, 0, "2Mww8dCYPUpKHofjgcXcBCEGmniw9CoaiD2"},
+		{"bip84", []uint32{h(84), h(0), h(0)}, "04b24746", "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs", 0, MainNet, 0, 0, "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"},
+		{"bip84 second", []uint32{h(84), h(0), h(0)}, "04b24746", "", 0, MainNet, 0, 1, "bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g"},
+		{"bip84 change", []uint32{h(84), h(0), h(0)}, "04b24746", "", 0, MainNet, 1, 0, "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el"},
+		{"bip86", []uint32{h(86), h(0), h(0)}, "0488b21e", "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ", 86, MainNet, 0, 0, "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"},
+		{"bip86 second", []uint32{h(86), h(0), h(0)}, "0488b21e", "", 86, MainNet, 0, 1, "bc1p4qhjn9zdvkux4e44uhx8tc55attvtyu358kutcqkudyccelu0was9fqzwh"},
+		{"bip86 change", []uint32{h(86), h(0), h(0)}, "0488b21e", "", 86, MainNet, 1, 0, "bc1p3qkhfews2uk44qtvauqyr2ttdsw7svhkl9nkm9s9c3x4ax5h60wqwruhk7"},
+	}
+	for _, tt := range tests {
+		xpub := master.derive(tt.account...).neuter(tt.version)
+		if tt.xpub != "" && xpub != tt.xpub {
+			t.Errorf("%s: account key = %s, want %s", tt.name, xpub, tt.xpub)
+		}
+
+		d, err := NewDescriptorFromKey(xpub, tt.purpose)
+		if err != nil {
+			t.Errorf("%s: NewDescriptorFromKey: %v", tt.name, err)
+			continue
+		}
+		d.Path = []uint32{tt.change}
+		addr, path, err := d.Address(tt.index, tt.net)
+		if err != nil {
+			t.Errorf("%s: Address: %v", tt.name, err)
+			continue
+		}
+		if addr != tt.addr {
+			t.Errorf("%s: Address(%d) = %s, want %s", tt.name, tt.index, addr, tt.addr)
+		}
+		if want := fmt.Sprintf("%d/%d", tt.change, tt.index); path != want {
+			t.Errorf("%s: path = %s, want %s", tt.name, path, want)
+		}
+	}
+}
+
+func TestDescriptorNetwork(t *testing.T) {
+	master := testMasterKey(testMnemonicSeed(testMnemonic))
+	zpub := master.derive(84+HardenedKeyStart, HardenedKeyStart, HardenedKeyStart).neuter("04b24746")
+	d, err := NewDescriptorFromKey(zpub, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Type != DescriptorWPKH {
+		t.Errorf("type of a zpub = %s, want %s", d.Type, DescriptorWPKH)
+	}
+	if _, _, err = d.Address(0, TestNet3); err != ErrKeyNetwork {
+		t.Errorf("Address on testnet = %v, want %v", err, ErrKeyNetwork)
+	}
+	if _, _, err = d.Address(0, DogecoinMainNet); err != ErrDescriptorNetwork {
+		t.Errorf("Address on a network without segwit = %v, want %v", err, ErrDescriptorNetwork)
+	}
+	if _, err = NewDescriptorFromKey(zpub, 45); err != ErrDescriptorPurpose {
+		t.Errorf("NewDescriptorFromKey(45) = %v, want %v", err, ErrDescriptorPurpose)
+	}
+
+	// the descriptor is parsed back from its string form, checksum included
+	parsed, err := ParseDescriptor(d.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Type != d.Type || parsed.XPub != d.XPub {
+		t.Errorf("ParseDescriptor(%s) = %s %s", d.String(), parsed.Type, parsed.XPub)
+	}
+	s := d.String()
+	if _, err = ParseDescriptor(s[:len(s)-1] + "x"); err != ErrDescriptorChecksum {
+		t.Errorf("ParseDescriptor with a bad checksum = %v, want %v", err, ErrDescriptorChecksum)
+	}
+}
+
+// BIP341 key path spending vector without scripts
+func TestTaprootOutputKey(t *testing.T) {
+	internal, _ := hex.DecodeString("02d6889cb081036e0faefa3a35157ad71086b123b2b144b649798b494c300a961d")
+	out, err := TaprootOutputKey(internal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(out); got != "53a1f6e454df1aa2776a2814a721372d6258050de330b3c6d10ee8f4e0dda343" {
+		t.Errorf("TaprootOutputKey = %s", got)
+	}
+	addr, _ := EncodeSegwitAddress("bc", 1, out)
+	if addr != "bc1p2wsldez5mud2yam29q22wgfh9439spgduvct83k3pm50fcxa5dps59h4z5" {
+		t.Errorf("taproot address = %s", addr)
+	}
+}
@@ -50,6 +50,7 @@ type Transaction struct {
 	Hash        string  `json:"hash"`
 	TxIndex     big.Int `json:"tx_index"`
 	N           int     `json:"n"`
+	Script      string  `json:"script,omitempty"` // hex script pubkey of the output, when the provider returns it
 }
 
 // Tx structure of a BTC transaction
@@ -57,6 +58,7 @@ type Tx struct {
 	Result      int       `json:"result"`
 	Ver         int       `json:"ver"`
 	Size        int       `json:"size"`
+	Weight      int       `json:"weight"`
 	Inputs      []*Inputs `json:"inputs"`
 	Time        int       `json:"time"`
 	BlockHeight int       `json:"block_height"`
@@ -78,6 +80,7 @@ type Inputs struct {
 
 // PrevOut PrevOut of a btc Input
 type PrevOut struct {
+	Hash    string  `json:"hash,omitempty"` // not returned by blockchain.info, which only gives the tx_index
 	Spent   bool    `json:"spent"`
 	TxIndex big.Int `json:"tx_index"`
 	Type    int     `json:"type"`
@@ -0,0 +1,113 @@
+package btc
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Network address parameters of a bitcoin network or of a network of a chain derived from bitcoin.
+// Segwit addresses are only supported when the bech32 hrp is set, and the outputs of the networks
+// with a cashaddr prefix are written as cashaddr
+type Network struct {
+	Name             string
+	PubKeyHashPrefix byte
+	ScriptHashPrefix byte
+	Bech32HRP        string
+	CashAddrPrefix   string
+	Testnet          bool
+	AuxPow           bool // merge mined blocks have an auxiliary proof of work after their header
+}
+
+// Supported bitcoin networks
+var (
+	MainNet = &Network{
+		Name:             "mainnet",
+		PubKeyHashPrefix: 0x00,
+		ScriptHashPrefix: 0x05,
+		Bech32HRP:        "bc",
+	}
+	TestNet3 = &Network{
+		Name:             "testnet3",
+		PubKeyHashPrefix: 0x6f,
+		ScriptHashPrefix: 0xc4,
+		Bech32HRP:        "tb",
+		Testnet:          true,
+	}
+	RegTest = &Network{
+		Name:             "regtest",
+		PubKeyHashPrefix: 0x6f,
+		ScriptHashPrefix: 0xc4,
+		Bech32HRP:        "bcrt",
+		Testnet:          true,
+	}
+	LitecoinMainNet = &Network{
+		Name:             "litecoin",
+		PubKeyHashPrefix: 0x30,
+		ScriptHashPrefix: 0x32,
+		Bech32HRP:        "ltc",
+	}
+	LitecoinTestNet = &Network{
+		Name:             "litecoin_testnet",
+		PubKeyHashPrefix: 0x6f,
+		ScriptHashPrefix: 0x3a,
+		Bech32HRP:        "tltc",
+		Testnet:          true,
+	}
+	DogecoinMainNet = &Network{
+		Name:             "dogecoin",
+		PubKeyHashPrefix: 0x1e,
+		ScriptHashPrefix: 0x16,
+		AuxPow:           true,
+	}
+	DogecoinTestNet = &Network{
+		Name:             "dogecoin_testnet",
+		PubKeyHashPrefix: 0x71,
+		ScriptHashPrefix: 0xc4,
+		Testnet:          true,
+		AuxPow:           true,
+	}
+	BitcoinCashMainNet = &Network{
+		Name:             "bitcoin_cash",
+		PubKeyHashPrefix: 0x00,
+		ScriptHashPrefix: 0x05,
+		CashAddrPrefix:   "bitcoincash",
+	}
+	BitcoinCashTestNet = &Network{
+		Name:             "bitcoin_cash_testnet",
+		PubKeyHashPrefix: 0x6f,
+		ScriptHashPrefix: 0xc4,
+		CashAddrPrefix:   "bchtest",
+		Testnet:          true,
+	}
+)
+
+// networks networks by chain name, as set in the chain field of the chain config
+var networks = map[string]*Network{
+	"btc_main":    MainNet,
+	"btc_test3":   TestNet3,
+	"btc_regtest": RegTest,
+	"ltc_main":    LitecoinMainNet,
+	"ltc_test":    LitecoinTestNet,
+	"doge_main":   DogecoinMainNet,
+	"doge_test":   DogecoinTestNet,
+	"bch_main":    BitcoinCashMainNet,
+	"bch_test":    BitcoinCashTestNet,
+}
+
+// NetworkFromChain returns the network of the given chain name
+func NetworkFromChain(chain string) (*Network, error) {
+	n, ok := networks[chain]
+	if !ok {
+		return nil, fmt.Errorf("unknown utxo chain %s", chain)
+	}
+	return n, nil
+}
+
+// Chains returns the names of the supported chains
+func Chains() (chains []string) {
+	for c := range networks {
+		chains = append(chains, c)
+	}
+	sort.Strings(chains)
+	return
+}
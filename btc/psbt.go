@@ -0,0 +1,336 @@
+package btc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// implementation of the partially signed bitcoin transactions (version 0)
+// https://github.com/bitcoin/bips/blob/master/bip-0174.mediawiki
+// https://github.com/bitcoin/bips/blob/master/bip-0371.mediawiki
+
+var psbtMagic = []byte{0x70, 0x73, 0x62, 0x74, 0xff}
+
+// Key types of the psbt maps
+const (
+	psbtGlobalUnsignedTx byte = 0x00
+
+	psbtInNonWitnessUtxo     byte = 0x00
+	psbtInWitnessUtxo        byte = 0x01
+	psbtInRedeemScript       byte = 0x04
+	psbtInBip32Derivation    byte = 0x06
+	psbtInTapBip32Derivation byte = 0x16
+	psbtInTapInternalKey     byte = 0x17
+
+	psbtOutRedeemScript       byte = 0x00
+	psbtOutBip32Derivation    byte = 0x02
+	psbtOutTapInternalKey     byte = 0x05
+	psbtOutTapBip32Derivation byte = 0x07
+)
+
+// Errors of the psbt encoding
+var (
+	ErrPsbtMagic      = errors.New("invalid psbt magic bytes")
+	ErrPsbtUnsignedTx = errors.New("psbt unsigned transaction is missing or has scripts")
+	ErrPsbtDuplicate  = errors.New("duplicate key in psbt map")
+	ErrPsbtValue      = errors.New("invalid psbt value")
+)
+
+// Psbt partially signed bitcoin transaction, handed to an external signer
+type Psbt struct {
+	Tx      *RawTx
+	Inputs  []*PsbtInput
+	Outputs []*PsbtOutput
+	Unknown map[string][]byte
+}
+
+// PsbtInput data of an input needed by the signer. Legacy inputs need the whole previous
+// transaction, segwit inputs only the spent output
+type PsbtInput struct {
+	NonWitnessUtxo []byte
+	WitnessUtxo    *RawOutput
+	RedeemScript   []byte
+	Derivations    []*KeyOrigin
+	TapInternalKey []byte
+	Unknown        map[string][]byte
+}
+
+// PsbtOutput data of an output, set on the change so that the signer can recognize it
+type PsbtOutput struct {
+	RedeemScript   []byte
+	Derivations    []*KeyOrigin
+	TapInternalKey []byte
+	Unknown        map[string][]byte
+}
+
+// KeyOrigin public key with the fingerprint of its master key and its derivation path from it.
+// Taproot keys are x-only and serialized as taproot derivations
+type KeyOrigin struct {
+	PubKey      []byte
+	Fingerprint []byte
+	Path        []uint32
+	Taproot     bool
+}
+
+// psbtPair key-value pair of a psbt map
+type psbtPair struct {
+	key   []byte
+	value []byte
+}
+
+// NewPsbt create a psbt for an unsigned transaction, with empty input and output maps
+func NewPsbt(tx *RawTx) (*Psbt, error) {
+	for _, in := range tx.Inputs {
+		if len(in.Script) > 0 || len(in.Witness) > 0 {
+			return nil, ErrPsbtUnsignedTx
+		}
+	}
+	p := &Psbt{Tx: tx}
+	for range tx.Inputs {
+		p.Inputs = append(p.Inputs, &PsbtInput{})
+	}
+	for range tx.Outputs {
+		p.Outputs = append(p.Outputs, &PsbtOutput{})
+	}
+	return p, nil
+}
+
+// Serialize serialize the psbt in its binary format
+func (p *Psbt) Serialize() []byte {
+	var buf bytes.Buffer
+	buf.Write(psbtMagic)
+
+	global := []psbtPair{{key: []byte{psbtGlobalUnsignedTx}, value: p.Tx.Serialize()}}
+	writePsbtMap(&buf, append(global, unknownPairs(p.Unknown)...))
+
+	for _, in := range p.Inputs {
+		var pairs []psbtPair
+		if in.NonWitnessUtxo != nil {
+			pairs = append(pairs, psbtPair{key: []byte{psbtInNonWitnessUtxo}, value: in.NonWitnessUtxo})
+		}
+		if in.WitnessUtxo != nil {
+			var out bytes.Buffer
+			writeOutput(&out, in.WitnessUtxo)
+			pairs = append(pairs, psbtPair{key: []byte{psbtInWitnessUtxo}, value: out.Bytes()})
+		}
+		if in.RedeemScript != nil {
+			pairs = append(pairs, psbtPair{key: []byte{psbtInRedeemScript}, value: in.RedeemScript})
+		}
+		pairs = append(pairs, derivationPairs(in.Derivations, psbtInBip32Derivation, psbtInTapBip32Derivation)...)
+		if in.TapInternalKey != nil {
+			pairs = append(pairs, psbtPair{key: []byte{psbtInTapInternalKey}, value: in.TapInternalKey})
+		}
+		writePsbtMap(&buf, append(pairs, unknownPairs(in.Unknown)...))
+	}
+
+	for _, out := range p.Outputs {
+		var pairs []psbtPair
+		if out.RedeemScript != nil {
+			pairs = append(pairs, psbtPair{key: []byte{psbtOutRedeemScript}, value: out.RedeemScript})
+		}
+		pairs = append(pairs, derivationPairs(out.Derivations, psbtOutBip32Derivation, psbtOutTapBip32Derivation)...)
+		if out.TapInternalKey != nil {
+			pairs = append(pairs, psbtPair{key: []byte{psbtOutTapInternalKey}, value: out.TapInternalKey})
+		}
+		writePsbtMap(&buf, append(pairs, unknownPairs(out.Unknown)...))
+	}
+	return buf.Bytes()
+}
+
+// Base64 serialize the psbt in its base64 format, as exchanged with the signers
+func (p *Psbt) Base64() string {
+	return base64.StdEncoding.EncodeToString(p.Serialize())
+}
+
+// DecodePsbtBase64 decode a base64 encoded psbt
+func DecodePsbtBase64(s string) (*Psbt, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return DecodePsbt(b)
+}
+
+// DecodePsbt decode a binary psbt. Key types that are not used by the withdrawals are kept as unknown
+func DecodePsbt(b []byte) (*Psbt, error) {
+	if !bytes.HasPrefix(b, psbtMagic) {
+		return nil, ErrPsbtMagic
+	}
+	r := &reader{b: b, pos: len(psbtMagic)}
+
+	global, err := readPsbtMap(r)
+	if err != nil {
+		return nil, err
+	}
+	var tx *RawTx
+	for _, pair := range global {
+		if len(pair.key) == 1 && pair.key[0] == psbtGlobalUnsignedTx {
+			tr := &reader{b: pair.value}
+			if tx = tr.tx(); tr.err != nil || tr.pos != len(pair.value) {
+				return nil, ErrPsbtUnsignedTx
+			}
+		}
+	}
+	if tx == nil {
+		return nil, ErrPsbtUnsignedTx
+	}
+	p, err := NewPsbt(tx)
+	if err != nil {
+		return nil, err
+	}
+	p.Unknown = unknownFrom(global, psbtGlobalUnsignedTx)
+
+	for _, in := range p.Inputs {
+		pairs, errMap := readPsbtMap(r)
+		if errMap != nil {
+			return nil, errMap
+		}
+		for _, pair := range pairs {
+			switch pair.key[0] {
+			case psbtInNonWitnessUtxo:
+				in.NonWitnessUtxo = pair.value
+			case psbtInWitnessUtxo:
+				vr := &reader{b: pair.value}
+				in.WitnessUtxo = &RawOutput{Value: int64(vr.uint64()), PkScript: vr.varBytes()}
+				if vr.err != nil || vr.pos != len(pair.value) {
+					return nil, ErrPsbtValue
+				}
+			case psbtInRedeemScript:
+				in.RedeemScript = pair.value
+			case psbtInBip32Derivation, psbtInTapBip32Derivation:
+				o, errOrigin := decodeKeyOrigin(pair, pair.key[0] == psbtInTapBip32Derivation)
+				if errOrigin != nil {
+					return nil, errOrigin
+				}
+				in.Derivations = append(in.Derivations, o)
+			case psbtInTapInternalKey:
+				in.TapInternalKey = pair.value
+			default:
+				in.Unknown = setUnknown(in.Unknown, pair)
+			}
+		}
+	}
+
+	for _, out := range p.Outputs {
+		pairs, errMap := readPsbtMap(r)
+		if errMap != nil {
+			return nil, errMap
+		}
+		for _, pair := range pairs {
+			switch pair.key[0] {
+			case psbtOutRedeemScript:
+				out.RedeemScript = pair.value
+			case psbtOutBip32Derivation, psbtOutTapBip32Derivation:
+				o, errOrigin := decodeKeyOrigin(pair, pair.key[0] == psbtOutTapBip32Derivation)
+				if errOrigin != nil {
+					return nil, errOrigin
+				}
+				out.Derivations = append(out.Derivations, o)
+			case psbtOutTapInternalKey:
+				out.TapInternalKey = pair.value
+			default:
+				out.Unknown = setUnknown(out.Unknown, pair)
+			}
+		}
+	}
+
+	if r.pos != len(b) {
+		return nil, fmt.Errorf("%d trailing bytes after psbt", len(b)-r.pos)
+	}
+	return p, nil
+}
+
+// derivationPairs serialize the key origins, as bip32 or taproot bip32 derivations without leaf hashes
+func derivationPairs(origins []*KeyOrigin, keyType byte, tapKeyType byte) (pairs []psbtPair) {
+	for _, o := range origins {
+		var v bytes.Buffer
+		key := append([]byte{keyType}, o.PubKey...)
+		if o.Taproot {
+			key[0] = tapKeyType
+			writeVarInt(&v, 0)
+		}
+		v.Write(o.Fingerprint)
+		for _, i := range o.Path {
+			writeUint32(&v, i)
+		}
+		pairs = append(pairs, psbtPair{key: key, value: v.Bytes()})
+	}
+	return
+}
+
+func decodeKeyOrigin(pair psbtPair, taproot bool) (*KeyOrigin, error) {
+	vr := &reader{b: pair.value}
+	if taproot {
+		// the leaf hashes of the script path spends are not used by the withdrawals
+		vr.bytes(int(vr.varInt()) * 32)
+	}
+	o := &KeyOrigin{PubKey: pair.key[1:], Fingerprint: vr.bytes(4), Taproot: taproot}
+	if vr.err != nil || (len(pair.value)-vr.pos)%4 != 0 {
+		return nil, ErrPsbtValue
+	}
+	for vr.pos < len(pair.value) {
+		o.Path = append(o.Path, vr.uint32())
+	}
+	return o, nil
+}
+
+func unknownPairs(m map[string][]byte) (pairs []psbtPair) {
+	for k, v := range m {
+		pairs = append(pairs, psbtPair{key: []byte(k), value: v})
+	}
+	return
+}
+
+func setUnknown(m map[string][]byte, pair psbtPair) map[string][]byte {
+	if m == nil {
+		m = make(map[string][]byte)
+	}
+	m[string(pair.key)] = pair.value
+	return m
+}
+
+func unknownFrom(pairs []psbtPair, known byte) (m map[string][]byte) {
+	for _, pair := range pairs {
+		if len(pair.key) == 1 && pair.key[0] == known {
+			continue
+		}
+		m = setUnknown(m, pair)
+	}
+	return
+}
+
+// writePsbtMap write the pairs of a map sorted by key, followed by the separator
+func writePsbtMap(buf *bytes.Buffer, pairs []psbtPair) {
+	sort.Slice(pairs, func(i, j int) bool { return bytes.Compare(pairs[i].key, pairs[j].key) < 0 })
+	for _, pair := range pairs {
+		writeVarBytes(buf, pair.key)
+		writeVarBytes(buf, pair.value)
+	}
+	buf.WriteByte(0x00)
+}
+
+// readPsbtMap read the pairs of a map up to its separator, rejecting duplicate keys
+func readPsbtMap(r *reader) (pairs []psbtPair, err error) {
+	seen := make(map[string]bool)
+	for {
+		key := r.varBytes()
+		if r.err != nil {
+			return nil, r.err
+		}
+		if len(key) == 0 {
+			return pairs, nil
+		}
+		value := r.varBytes()
+		if r.err != nil {
+			return nil, r.err
+		}
+		if seen[string(key)] {
+			return nil, ErrPsbtDuplicate
+		}
+		seen[string(key)] = true
+		pairs = append(pairs, psbtPair{key: key, value: value})
+	}
+}
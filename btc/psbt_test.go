@@ -0,0 +1,100 @@
+package btc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// BIP174 vector of the creator, two inputs and two outputs
+func TestPsbtCreatorVector(t *testing.T) {
+	tx := &RawTx{
+		Version: 2,
+		Inputs: []*RawInput{
+			{PrevHash: "75ddabb27b8845f5247975c8a5ba7c6f336c4570708ebe230caf6db5217ae858", PrevIndex: 0, Sequence: 0xffffffff},
+			{PrevHash: "1dea7cd05979072a3578cab271c02244ea8a090bbb46aa680a65ecd027048d83", PrevIndex: 1, Sequence: 0xffffffff},
+		},
+		Outputs: []*RawOutput{
+			{Value: 149990000, PkScript: mustHex("0014d85c2b71d0060b09c9886aeb815e50991dda124d")},
+			{Value: 100000000, PkScript: mustHex("001400aea9a2e5f0f876a588df5546e8742d1d87008f")},
+		},
+	}
+	p, err := NewPsbt(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// magic, the unsigned tx of the global map, and the empty maps of the inputs and outputs
+	want := "70736274ff01009a" +
+		"020000000258e87a21b56daf0c23be8e7070456c336f7cbaa5c8757924f545887bb2abdd750000000000ffffffff" +
+		"838d0427d0ec650a68aa46bb0b098aea4422c071b2ca78352a077959d07cea1d0100000000ffffffff" +
+		"0270aaf00800000000160014d85c2b71d0060b09c9886aeb815e50991dda124d" +
+		"00e1f5050000000016001400aea9a2e5f0f876a588df5546e8742d1d87008f00000000" +
+		"0000000000"
+	if got := hex.EncodeToString(p.Serialize()); got != want {
+		t.Errorf("Serialize() = %s, want %s", got, want)
+	}
+
+	decoded, err := DecodePsbtBase64(p.Base64())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Tx.TxID() != tx.TxID() || len(decoded.Inputs) != 2 || len(decoded.Outputs) != 2 {
+		t.Errorf("decoded psbt of tx %s with %d inputs and %d outputs", decoded.Tx.TxID(), len(decoded.Inputs), len(decoded.Outputs))
+	}
+	if decoded.Tx.Inputs[1].PrevHash != tx.Inputs[1].PrevHash || decoded.Tx.Inputs[1].PrevIndex != 1 {
+		t.Errorf("decoded input %s:%d", decoded.Tx.Inputs[1].PrevHash, decoded.Tx.Inputs[1].PrevIndex)
+	}
+}
+
+func TestPsbtRoundTrip(t *testing.T) {
+	tx := &RawTx{
+		Version: 2,
+		Inputs: []*RawInput{
+			{PrevHash: "75ddabb27b8845f5247975c8a5ba7c6f336c4570708ebe230caf6db5217ae858", PrevIndex: 0, Sequence: withdrawalSequence},
+			{PrevHash: "1dea7cd05979072a3578cab271c02244ea8a090bbb46aa680a65ecd027048d83", PrevIndex: 1, Sequence: withdrawalSequence},
+		},
+		Outputs: []*RawOutput{{Value: 5000, PkScript: testScript(1)}},
+	}
+	p, err := NewPsbt(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey := mustHex("0330d54fd0dd420a6e5f8d3624f5f3482cae350f79d5f0753bf5beef9c2d91af3c")
+	p.Inputs[0].WitnessUtxo = &RawOutput{Value: 3000, PkScript: testScript(2)}
+	p.Inputs[0].Derivations = []*KeyOrigin{{PubKey: pubKey, Fingerprint: mustHex("d34db33f"), Path: []uint32{84 + HardenedKeyStart, HardenedKeyStart, HardenedKeyStart, 0, 7}}}
+	p.Inputs[1].WitnessUtxo = &RawOutput{Value: 4000, PkScript: append([]byte{op1, 32}, pubKey[1:]...)}
+	p.Inputs[1].TapInternalKey = pubKey[1:]
+	p.Inputs[1].Derivations = []*KeyOrigin{{PubKey: pubKey[1:], Fingerprint: mustHex("d34db33f"), Path: []uint32{86 + HardenedKeyStart, HardenedKeyStart, HardenedKeyStart, 1, 2}, Taproot: true}}
+	p.Outputs[0].Unknown = map[string][]byte{string([]byte{0xfc, 1}): {2}}
+
+	decoded, err := DecodePsbt(p.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Serialize(), p.Serialize()) {
+		t.Errorf("round trip of %s gives %s", p.Base64(), decoded.Base64())
+	}
+	o := decoded.Inputs[1].Derivations[0]
+	if !o.Taproot || len(o.Path) != 5 || o.Path[3] != 1 || !bytes.Equal(o.PubKey, pubKey[1:]) {
+		t.Errorf("decoded taproot derivation %x %v", o.PubKey, o.Path)
+	}
+	if decoded.Inputs[0].WitnessUtxo.Value != 3000 {
+		t.Errorf("decoded witness utxo of %d", decoded.Inputs[0].WitnessUtxo.Value)
+	}
+
+	if _, err = DecodePsbt([]byte("psbt")); err != ErrPsbtMagic {
+		t.Errorf("DecodePsbt without magic = %v, want %v", err, ErrPsbtMagic)
+	}
+	tx.Inputs[0].Script = []byte{0}
+	if _, err = NewPsbt(tx); err != ErrPsbtUnsignedTx {
+		t.Errorf("NewPsbt of a signed tx = %v, want %v", err, ErrPsbtUnsignedTx)
+	}
+}
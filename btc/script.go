@@ -0,0 +1,142 @@
+package btc
+
+import (
+	"errors"
+	"strings"
+)
+
+// Script opcodes used by the standard output scripts
+const (
+	opFalse       byte = 0x00
+	op1           byte = 0x51
+	op16          byte = 0x60
+	opDup         byte = 0x76
+	opEqual       byte = 0x87
+	opEqualVerify byte = 0x88
+	opHash160     byte = 0xa9
+	opCheckSig    byte = 0xac
+)
+
+// Types of the standard output scripts
+const (
+	ScriptP2PKH       string = "p2pkh"
+	ScriptP2SH        string = "p2sh"
+	ScriptP2WPKH      string = "p2wpkh"
+	ScriptP2WSH       string = "p2wsh"
+	ScriptP2TR        string = "p2tr"
+	ScriptWitness     string = "witness_unknown"
+	ScriptNonStandard string = "nonstandard"
+)
+
+// Errors of the addresses and scripts
+var (
+	ErrNoAddress      = errors.New("script does not correspond to an address")
+	ErrAddressVersion = errors.New("address version does not match the network")
+	ErrAddressLength  = errors.New("invalid address length")
+)
+
+// ScriptType returns the type of a script pubkey
+func ScriptType(script []byte) string {
+	switch {
+	case len(script) == 25 && script[0] == opDup && script[1] == opHash160 && script[2] == 20 &&
+		script[23] == opEqualVerify && script[24] == opCheckSig:
+		return ScriptP2PKH
+	case len(script) == 23 && script[0] == opHash160 && script[1] == 20 && script[22] == opEqual:
+		return ScriptP2SH
+	case len(script) == 22 && script[0] == opFalse && script[1] == 20:
+		return ScriptP2WPKH
+	case len(script) == 34 && script[0] == opFalse && script[1] == 32:
+		return ScriptP2WSH
+	case len(script) == 34 && script[0] == op1 && script[1] == 32:
+		return ScriptP2TR
+	case isWitnessProgram(script):
+		return ScriptWitness
+	default:
+		return ScriptNonStandard
+	}
+}
+
+// isWitnessProgram returns true for a version byte followed by a single push of 2 to 40 bytes
+func isWitnessProgram(script []byte) bool {
+	if len(script) < 4 || len(script) > 42 {
+		return false
+	}
+	if script[0] != opFalse && (script[0] < op1 || script[0] > op16) {
+		return false
+	}
+	return int(script[1])+2 == len(script)
+}
+
+// ExtractAddress derive the address paid by a script pubkey on the given network
+func ExtractAddress(script []byte, net *Network) (string, error) {
+	t := ScriptType(script)
+	switch {
+	case t == ScriptP2PKH && net.CashAddrPrefix != "":
+		return EncodeCashAddr(net.CashAddrPrefix, CashAddrP2PKH, script[3:23])
+	case t == ScriptP2SH && net.CashAddrPrefix != "":
+		return EncodeCashAddr(net.CashAddrPrefix, CashAddrP2SH, script[2:22])
+	case t == ScriptP2PKH:
+		return Base58CheckEncode([]byte{net.PubKeyHashPrefix}, script[3:23]), nil
+	case t == ScriptP2SH:
+		return Base58CheckEncode([]byte{net.ScriptHashPrefix}, script[2:22]), nil
+	case net.Bech32HRP != "" && (t == ScriptP2WPKH || t == ScriptP2WSH || t == ScriptP2TR || t == ScriptWitness):
+		version := script[0]
+		if version != opFalse {
+			version = version - op1 + 1
+		}
+		return EncodeSegwitAddress(net.Bech32HRP, version, script[2:])
+	default:
+		return "", ErrNoAddress
+	}
+}
+
+// AddressToScript decode an address of the given network into the script pubkey it pays to.
+// Base58Check addresses must use the network prefixes, segwit addresses its bech32 hrp with
+// bech32 for version 0 and bech32m for the higher versions. The networks with a cashaddr prefix
+// accept both cashaddr and legacy addresses
+func AddressToScript(addr string, net *Network) ([]byte, error) {
+	if net.CashAddrPrefix != "" && isCashAddr(addr) {
+		hashType, hash, err := DecodeCashAddr(net.CashAddrPrefix, addr)
+		if err != nil {
+			return nil, err
+		}
+		if hashType == CashAddrP2SH {
+			return append(append([]byte{opHash160, 20}, hash...), opEqual), nil
+		}
+		return append(append([]byte{opDup, opHash160, 20}, hash...), opEqualVerify, opCheckSig), nil
+	}
+	if net.Bech32HRP != "" && strings.HasPrefix(strings.ToLower(addr), net.Bech32HRP+"1") {
+		version, program, err := DecodeSegwitAddress(net.Bech32HRP, addr)
+		if err != nil {
+			return nil, err
+		}
+		op := opFalse
+		if version > 0 {
+			op = op1 + version - 1
+		}
+		return append([]byte{op, byte(len(program))}, program...), nil
+	}
+
+	b, err := Base58CheckDecode(addr)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 21 {
+		return nil, ErrAddressLength
+	}
+	switch b[0] {
+	case net.PubKeyHashPrefix:
+		return append(append([]byte{opDup, opHash160, 20}, b[1:]...), opEqualVerify, opCheckSig), nil
+	case net.ScriptHashPrefix:
+		return append(append([]byte{opHash160, 20}, b[1:]...), opEqual), nil
+	default:
+		return nil, ErrAddressVersion
+	}
+}
+
+// isCashAddr returns true for an address written with a cashaddr prefix, or without prefix and starting
+// with the q or p of the cashaddr version byte of the 160 bits hashes
+func isCashAddr(addr string) bool {
+	lower := strings.ToLower(addr)
+	return strings.Contains(lower, ":") || (len(lower) == 42 && (lower[0] == 'q' || lower[0] == 'p'))
+}
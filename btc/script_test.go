@@ -0,0 +1,135 @@
+package btc
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// BIP173 and BIP350 test vectors
+func TestSegwitAddressVectors(t *testing.T) {
+	tests := []struct {
+		addr   string
+		net    *Network
+		script string
+	}{
+		{"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", MainNet, "0014751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", TestNet3, "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+		{"bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", MainNet, "5128751e76e8199196d454941c45d1b3a323f1433bd6751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"BC1SW50QGDZ25J", MainNet, "6002751e"},
+		{"bc1zw508d6qejxtdg4y5r3zarvaryvaxxpcs", MainNet, "5210751e76e8199196d454941c45d1b3a323"},
+		{"tb1pqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesf3hn0c", TestNet3, "5120000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", MainNet, "512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+	}
+	for _, tt := range tests {
+		script, err := AddressToScript(tt.addr, tt.net)
+		if err != nil {
+			t.Errorf("AddressToScript(%s): %v", tt.addr, err)
+			continue
+		}
+		if got := hex.EncodeToString(script); got != tt.script {
+			t.Errorf("AddressToScript(%s) = %s, want %s", tt.addr, got, tt.script)
+		}
+		addr, err := ExtractAddress(script, tt.net)
+		if err != nil {
+			t.Errorf("ExtractAddress(%s): %v", tt.script, err)
+			continue
+		}
+		if addr != strings.ToLower(tt.addr) {
+			t.Errorf("ExtractAddress(%s) = %s, want %s", tt.script, addr, strings.ToLower(tt.addr))
+		}
+	}
+}
+
+func TestInvalidSegwitAddressVectors(t *testing.T) {
+	tests := []struct {
+		addr string
+		net  *Network
+	}{
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd", MainNet}, // bech32 instead of bech32m
+		{"tb1z0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqglt7rf", TestNet3},
+		{"BC1S0XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ54WELL", MainNet},
+		{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh", MainNet},                     // bech32m instead of bech32
+		{"bc1p38j9r5y49hruaue7wxjce0updqjuyyx0kh56v8s25huc6995vvpql3jow4", MainNet}, // invalid character
+		{"bc1gmk9yu", MainNet}, // empty data
+		{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5", MainNet},                      // checksum
+		{"tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", MainNet},                      // hrp of testnet
+		{"BC1QR508D6QEJXTDG4Y5R3ZARVARYV98GJ9P", MainNet},                            // program length of v0
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3Q0sL5k7", TestNet3}, // mixed case
+	}
+	for _, tt := range tests {
+		if _, err := AddressToScript(tt.addr, tt.net); err == nil {
+			t.Errorf("AddressToScript(%s) should fail", tt.addr)
+		}
+	}
+}
+
+// base58 vectors of bitcoin core
+func TestBase58Vectors(t *testing.T) {
+	tests := []struct {
+		hex string
+		enc string
+	}{
+		{"", ""},
+		{"61", "2g"},
+		{"626262", "a3gV"},
+		{"636363", "aPEr"},
+		{"73696d706c792061206c6f6e6720737472696e67", "2cFupjhnEsSn59qHXstmK2ffpLv2"},
+		{"00eb15231dfceb60925886b67d065299925915aeb172c06647", "1NS17iag9jJgTHD1VXjvLCEnZuQ3rJDE9L"},
+		{"516b6fcd0f", "ABnLTmg"},
+		{"bf4f89001e670274dd", "3SEo3LWLoPntC"},
+		{"572e4794", "3EFU7m"},
+		{"ecac89cad93923c02321", "EJDM8drfXA6uyA"},
+		{"10c8511e", "Rt5zm"},
+		{"00000000000000000000", "1111111111"},
+	}
+	for _, tt := range tests {
+		b, _ := hex.DecodeString(tt.hex)
+		if got := Base58Encode(b); got != tt.enc {
+			t.Errorf("Base58Encode(%s) = %s, want %s", tt.hex, got, tt.enc)
+		}
+		dec, err := Base58Decode(tt.enc)
+		if err != nil {
+			t.Errorf("Base58Decode(%s): %v", tt.enc, err)
+			continue
+		}
+		if got := hex.EncodeToString(dec); got != tt.hex {
+			t.Errorf("Base58Decode(%s) = %s, want %s", tt.enc, got, tt.hex)
+		}
+	}
+	if _, err := Base58Decode("0OIl"); err != ErrBase58Char {
+		t.Errorf("Base58Decode of invalid characters = %v, want %v", err, ErrBase58Char)
+	}
+}
+
+func TestBase58AddressVectors(t *testing.T) {
+	tests := []struct {
+		addr   string
+		net    *Network
+		script string
+	}{
+		{"1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu", MainNet, "76a91476a04053bda0a88bda5177b86a15c3b29f55987388ac"},
+		{"3CWFddi6m4ndiGyKqzYvsFYagqDLPVMTzC", MainNet, "a91476a04053bda0a88bda5177b86a15c3b29f55987387"},
+		{"1KXrWXciRDZUpQwQmuM1DbwsKDLYAYsVLR", MainNet, "76a914cb481232299cd5743151ac4b2d63ae198e7bb0a988ac"},
+	}
+	for _, tt := range tests {
+		script, err := AddressToScript(tt.addr, tt.net)
+		if err != nil {
+			t.Errorf("AddressToScript(%s): %v", tt.addr, err)
+			continue
+		}
+		if got := hex.EncodeToString(script); got != tt.script {
+			t.Errorf("AddressToScript(%s) = %s, want %s", tt.addr, got, tt.script)
+		}
+		if addr, _ := ExtractAddress(script, tt.net); addr != tt.addr {
+			t.Errorf("ExtractAddress(%s) = %s, want %s", tt.script, addr, tt.addr)
+		}
+	}
+
+	if _, err := AddressToScript("1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu", TestNet3); err != ErrAddressVersion {
+		t.Errorf("AddressToScript of a mainnet address on testnet = %v, want %v", err, ErrAddressVersion)
+	}
+	if _, err := AddressToScript("1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggv", MainNet); err != ErrBase58Checksum {
+		t.Errorf("AddressToScript with a bad checksum = %v, want %v", err, ErrBase58Checksum)
+	}
+}
@@ -0,0 +1,53 @@
+package btc
+
+import "math/big"
+
+// Spend input of a transaction spending a previous output
+type Spend struct {
+	Hash        string  // hash of the spending transaction
+	BlockHeight int     // height of the block of the spending transaction
+	PrevHash    string  // hash of the transaction of the spent output, empty when the provider only returns its tx index
+	PrevTxIndex big.Int // provider index of the transaction of the spent output
+	PrevN       int     // index of the spent output in its transaction
+	Address     string  // address of the spent output, empty for raw blocks
+}
+
+// SpendsFromBlock extract the inputs of the transactions of a block as spends of previous outputs.
+// Coinbase inputs are skipped
+func SpendsFromBlock(block *Block) (spends []*Spend) {
+	for _, tx := range block.Txs {
+		for _, in := range tx.Inputs {
+			if in.PrevOut.Hash == "" && in.PrevOut.TxIndex.Sign() == 0 {
+				continue
+			}
+			spends = append(spends, &Spend{
+				Hash:        tx.Hash,
+				BlockHeight: block.Height,
+				PrevHash:    in.PrevOut.Hash,
+				PrevTxIndex: in.PrevOut.TxIndex,
+				PrevN:       in.PrevOut.N,
+				Address:     in.PrevOut.Addr,
+			})
+		}
+	}
+	return
+}
+
+// SpendsFromRawBlock extract the inputs of the transactions of a raw block as spends of previous outputs.
+// Coinbase inputs are skipped
+func SpendsFromRawBlock(block *RawBlock, height int) (spends []*Spend) {
+	for _, tx := range block.Txs {
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Inputs {
+			spends = append(spends, &Spend{
+				Hash:        tx.Hash,
+				BlockHeight: height,
+				PrevHash:    in.PrevHash,
+				PrevN:       int(in.PrevIndex),
+			})
+		}
+	}
+	return
+}
@@ -0,0 +1,178 @@
+package btc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// withdrawalSequence sequence of the withdrawal inputs, signals replace by fee to bump the fee if needed
+const withdrawalSequence uint32 = 0xfffffffd
+
+// ErrRawTransactionAPI error returned when a legacy input is selected and the provider cannot return raw transactions
+var ErrRawTransactionAPI = errors.New("legacy inputs need a provider that returns raw transactions")
+
+// UtxoSource source of the coins that a withdrawal can spend
+type UtxoSource interface {
+	SpendableCoins() ([]*Coin, error)
+}
+
+// WithdrawalRequest parameters of a withdrawal, amount in satoshis and fee rate in satoshis per vbyte
+type WithdrawalRequest struct {
+	To            string
+	Amount        int64
+	FeeRate       float64
+	Strategy      string
+	ChangeAddress string
+	ChangeOrigin  *KeyOrigin // derivation of the change address in its wallet, when known
+}
+
+// Withdrawal unsigned withdrawal, to be signed by an external signer from its psbt
+type Withdrawal struct {
+	Psbt          string  `json:"psbt"`
+	TxID          string  `json:"txid"`
+	To            string  `json:"to"`
+	Amount        int64   `json:"amount"`
+	Fee           int64   `json:"fee"`
+	FeeRate       float64 `json:"fee_rate"`
+	VSize         int     `json:"vsize"`
+	Change        int64   `json:"change"`
+	ChangeAddress string  `json:"change_address,omitempty"`
+	Inputs        []*Coin `json:"inputs"`
+}
+
+// BuildWithdrawal select coins of the source to pay the request and build the unsigned transaction as a psbt.
+// Inputs and outputs are sorted as in BIP69 so that the change cannot be told apart by its position
+func (b *Btc) BuildWithdrawal(src UtxoSource, req *WithdrawalRequest) (*Withdrawal, error) {
+	to, err := AddressToScript(req.To, b.network)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination %s: %v", req.To, err)
+	}
+	if req.Amount < DustLimit(to) {
+		return nil, fmt.Errorf("amount %d is below the dust limit of %d satoshis", req.Amount, DustLimit(to))
+	}
+	if req.FeeRate < 1 {
+		return nil, fmt.Errorf("fee rate %v is below the minimum relay fee of 1 satoshi per vbyte", req.FeeRate)
+	}
+	change, err := AddressToScript(req.ChangeAddress, b.network)
+	if err != nil {
+		return nil, fmt.Errorf("invalid change address %s: %v", req.ChangeAddress, err)
+	}
+
+	coins, err := src.SpendableCoins()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range coins {
+		if h, errHex := hex.DecodeString(c.Hash); errHex != nil || len(h) != 32 {
+			return nil, fmt.Errorf("invalid coin hash %s", c.Hash)
+		}
+	}
+	sel, err := SelectCoins(coins, [][]byte{to}, req.Amount, req.FeeRate, change, req.Strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	// BIP69 sorts the inputs by the txid as displayed, then by output index
+	inputs := append([]*Coin{}, sel.Coins...)
+	sort.Slice(inputs, func(i, j int) bool {
+		hi, hj := strings.ToLower(inputs[i].Hash), strings.ToLower(inputs[j].Hash)
+		if hi != hj {
+			return hi < hj
+		}
+		return inputs[i].N < inputs[j].N
+	})
+	outputs := []*RawOutput{{Value: req.Amount, PkScript: to}}
+	if sel.Change > 0 {
+		outputs = append(outputs, &RawOutput{Value: sel.Change, PkScript: change})
+	}
+	sort.SliceStable(outputs, func(i, j int) bool {
+		if outputs[i].Value != outputs[j].Value {
+			return outputs[i].Value < outputs[j].Value
+		}
+		return bytes.Compare(outputs[i].PkScript, outputs[j].PkScript) < 0
+	})
+
+	tx := &RawTx{Version: 2, Outputs: outputs}
+	for _, c := range inputs {
+		tx.Inputs = append(tx.Inputs, &RawInput{PrevHash: c.Hash, PrevIndex: uint32(c.N), Sequence: withdrawalSequence})
+	}
+	p, err := NewPsbt(tx)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range inputs {
+		if err = b.fillPsbtInput(p.Inputs[i], c); err != nil {
+			return nil, err
+		}
+	}
+	for i, out := range outputs {
+		if sel.Change > 0 && req.ChangeOrigin != nil && out.Value == sel.Change && bytes.Equal(out.PkScript, change) {
+			fillPsbtOutput(p.Outputs[i], change, req.ChangeOrigin)
+		}
+	}
+
+	w := &Withdrawal{
+		Psbt:    p.Base64(),
+		TxID:    tx.TxID(),
+		To:      req.To,
+		Amount:  req.Amount,
+		Fee:     sel.Fee,
+		FeeRate: req.FeeRate,
+		VSize:   sel.VSize,
+		Change:  sel.Change,
+		Inputs:  inputs,
+	}
+	if sel.Change > 0 {
+		w.ChangeAddress = req.ChangeAddress
+	}
+	return w, nil
+}
+
+// fillPsbtInput set the previous output spent by an input and the derivation of its key when known.
+// Legacy inputs need the whole previous transaction, which is also given to the segwit v0 inputs when
+// the provider can return it
+func (b *Btc) fillPsbtInput(in *PsbtInput, c *Coin) error {
+	t := ScriptType(c.PkScript)
+	if t != ScriptP2TR {
+		if raw, ok := b.api.(RawTransactionAPI); ok {
+			prev, err := raw.GetRawTransaction(c.Hash)
+			if err != nil && t == ScriptP2PKH {
+				return err
+			}
+			in.NonWitnessUtxo = prev
+		}
+		if in.NonWitnessUtxo == nil && t == ScriptP2PKH {
+			return ErrRawTransactionAPI
+		}
+	}
+	if t != ScriptP2PKH {
+		in.WitnessUtxo = &RawOutput{Value: c.Value, PkScript: c.PkScript}
+	}
+
+	if c.Origin == nil {
+		return nil
+	}
+	in.Derivations = []*KeyOrigin{c.Origin}
+	switch t {
+	case ScriptP2SH:
+		in.RedeemScript = append([]byte{opFalse, 20}, Hash160(c.Origin.PubKey)...)
+	case ScriptP2TR:
+		in.TapInternalKey = c.Origin.PubKey
+	}
+	return nil
+}
+
+// fillPsbtOutput set the derivation of the key of the change output
+func fillPsbtOutput(out *PsbtOutput, script []byte, origin *KeyOrigin) {
+	out.Derivations = []*KeyOrigin{origin}
+	switch ScriptType(script) {
+	case ScriptP2SH:
+		out.RedeemScript = append([]byte{opFalse, 20}, Hash160(origin.PubKey)...)
+	case ScriptP2TR:
+		out.TapInternalKey = origin.PubKey
+	}
+}
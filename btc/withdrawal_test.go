@@ -0,0 +1,91 @@
+package btc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type testUtxoSource []*Coin
+
+func (s testUtxoSource) SpendableCoins() ([]*Coin, error) {
+	return s, nil
+}
+
+func TestBuildWithdrawalOrdering(t *testing.T) {
+	b := &Btc{network: MainNet}
+	taproot := func(fill byte) []byte {
+		return append([]byte{op1, 32}, bytes.Repeat([]byte{fill}, 32)...)
+	}
+	// sorted by the txid as displayed, the reverse of the byte order of the serialization
+	low := "01" + strings.Repeat("00", 30) + "ff"
+	high := "ff" + strings.Repeat("00", 30) + "01"
+	src := testUtxoSource{
+		{Hash: high, N: 0, Value: 30000, PkScript: taproot(1)},
+		{Hash: strings.ToUpper(low), N: 1, Value: 30000, PkScript: taproot(2)},
+		{Hash: low, N: 0, Value: 30000, PkScript: taproot(3)},
+	}
+	req := &WithdrawalRequest{
+		To:            "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+		Amount:        80000,
+		FeeRate:       2,
+		Strategy:      SelectLargestFirst,
+		ChangeAddress: "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0",
+	}
+	w, err := b.BuildWithdrawal(src, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+	for _, c := range w.Inputs {
+		order = append(order, strings.ToLower(c.Hash[:2])+":"+string(rune('0'+c.N)))
+	}
+	if got := strings.Join(order, " "); got != "01:0 01:1 ff:0" {
+		t.Errorf("inputs ordered %s, want 01:0 01:1 ff:0", got)
+	}
+
+	p, err := DecodePsbtBase64(w.Psbt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Tx.TxID() != w.TxID {
+		t.Errorf("txid %s, want %s", p.Tx.TxID(), w.TxID)
+	}
+	for i, in := range p.Inputs {
+		if in.WitnessUtxo == nil || in.WitnessUtxo.Value != 30000 {
+			t.Errorf("input %d without its witness utxo", i)
+		}
+	}
+	outs := p.Tx.Outputs
+	if len(outs) != 2 || outs[0].Value != w.Change || outs[1].Value != req.Amount {
+		t.Fatalf("outputs not sorted by value: %d outputs, change %d", len(outs), w.Change)
+	}
+	if w.Change+w.Amount+w.Fee != 90000 {
+		t.Errorf("change %d and fee %d do not add up", w.Change, w.Fee)
+	}
+}
+
+func TestBuildWithdrawalRequest(t *testing.T) {
+	b := &Btc{network: MainNet}
+	src := testUtxoSource{}
+	req := &WithdrawalRequest{
+		To:            "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+		Amount:        100,
+		FeeRate:       2,
+		Strategy:      SelectBranchAndBound,
+		ChangeAddress: "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0",
+	}
+	if _, err := b.BuildWithdrawal(src, req); err == nil || !strings.Contains(err.Error(), "dust") {
+		t.Errorf("withdrawal below the dust limit: %v", err)
+	}
+	req.Amount = 10000
+	req.To = "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx"
+	if _, err := b.BuildWithdrawal(src, req); err == nil {
+		t.Errorf("withdrawal to a testnet address should fail")
+	}
+	req.To = "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	if _, err := b.BuildWithdrawal(src, req); err != ErrInsufficientFunds {
+		t.Errorf("withdrawal without coins = %v, want %v", err, ErrInsufficientFunds)
+	}
+}
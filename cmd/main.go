@@ -13,14 +13,31 @@ import (
 func main() {
 	ctx := context.Background()
 	funcframework.RegisterHTTPFunctionContext(ctx, "/sync_btc_balance", functions.SyncBtcBalance)
+	funcframework.RegisterHTTPFunctionContext(ctx, "/btc_balance", functions.GetBtcBalance)
+	funcframework.RegisterHTTPFunctionContext(ctx, "/build_btc_withdrawal", functions.BuildBtcWithdrawal)
+	funcframework.RegisterHTTPFunctionContext(ctx, "/estimate_btc_fees", functions.EstimateBtcFees)
 	funcframework.RegisterHTTPFunctionContext(ctx, "/scan_btc_block", functions.ScanBtcBlock)
 	funcframework.RegisterHTTPFunctionContext(ctx, "/scan_btc_head", functions.ScanBtcHead)
+	funcframework.RegisterHTTPFunctionContext(ctx, "/register_btc_wallet", functions.RegisterBtcWallet)
 
 	funcframework.RegisterHTTPFunctionContext(ctx, "/scan_eth_block", functions.ScanEthBlock)
 	funcframework.RegisterHTTPFunctionContext(ctx, "/scan_eth_head", functions.ScanEthHead)
+	funcframework.RegisterHTTPFunctionContext(ctx, "/plan_eth_sweep", functions.PlanEthSweep)
+	funcframework.RegisterHTTPFunctionContext(ctx, "/register_eth_forwarder", functions.RegisterEthForwarder)
+
+	funcframework.RegisterHTTPFunctionContext(ctx, "/validate_address", functions.ValidateAddress)
+	funcframework.RegisterHTTPFunctionContext(ctx, "/sweep_account_addresses", functions.SweepAccountAddresses)
+
+	funcframework.RegisterHTTPFunctionContext(ctx, "/provider_metrics", functions.ProviderMetrics)
+	funcframework.RegisterHTTPFunctionContext(ctx, "/provider_cache_stats", functions.ProviderCacheStats)
 
 	funcframework.RegisterHTTPFunctionContext(ctx, "/update_histories", functions.UpdateInterestHistories)
 
+	// long running servers follow the heads of the evm chains instead of waiting for the pub/sub scans
+	if os.Getenv("FOLLOW_HEADS") != "" {
+		functions.FollowEvmHeads(ctx)
+	}
+
 	port := "8080"
 	if envPort := os.Getenv("PORT"); envPort != "" {
 		port = envPort
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/SoteriaTech/blockchain-functions/api"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/eth"
+)
+
+// tokens verify the tokens configured for an evm chain against their contracts and print their metadata,
+// followed by the metadata of the contract addresses given as arguments, e.g. to add a new token
+//
+//	go run ./cmd/tokens -chain eth_ropsten 0x5329DF8fD2a83fDD88c43b03754517fA169D961F
+func main() {
+	chain := flag.String("chain", "", "evm chain of the tokens, the ethereum chain of the config by default")
+	flag.Parse()
+
+	config := env.InitConfig()
+	chainConfig := &config.Ethereum
+	if *chain != "" {
+		if chainConfig = config.EvmChain(*chain); chainConfig == nil {
+			log.Fatalf("unknown evm chain %s", *chain)
+		}
+	}
+
+	svc, err := eth.InitEthService(api.InitEthereumProvider(chainConfig), chainConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	unverified, err := svc.VerifyCurrencies()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(unverified) > 0 {
+		log.Fatal(unverified[0])
+	}
+
+	var addresses []string
+	for _, c := range chainConfig.Currencies {
+		if c.Address != "" {
+			addresses = append(addresses, c.Address)
+		}
+	}
+	addresses = append(addresses, flag.Args()...)
+
+	var tokens []*eth.TokenMetadata
+	for _, a := range addresses {
+		m, errMeta := svc.TokenMetadata(a)
+		if errMeta != nil {
+			log.Fatal(errMeta)
+		}
+		tokens = append(tokens, m)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(tokens); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"os"
+	"strings"
 
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"github.com/spf13/viper"
@@ -12,21 +13,92 @@ import (
 
 // Config structure of the app configuration
 type Config struct {
-	ProjectID string `mapstructure:"project_id"`
-	KeyPath   string `mapstructure:"keyPath"`
-	Ethereum  ChainConfig
-	Bitcoin   ChainConfig
+	ProjectID   string `mapstructure:"project_id"`
+	KeyPath     string `mapstructure:"keyPath"`
+	Ethereum    ChainConfig
+	Polygon     ChainConfig
+	Arbitrum    ChainConfig
+	BSC         ChainConfig `mapstructure:"bsc"`
+	Base        ChainConfig
+	Bitcoin     ChainConfig
+	Litecoin    ChainConfig
+	Dogecoin    ChainConfig
+	BitcoinCash ChainConfig `mapstructure:"bitcoin_cash"`
 }
 
-// ChainConfig configuration of each chain with its name and the supported currencies
+// ChainConfig configuration of each chain with its name and the supported currencies. The endpoint is
+// either set directly or fetched from the GCP secret with the given name, and so is the websocket
+// endpoint whose new heads are followed by the standalone server. The prefix of an evm chain
+// is the one of its firestore collections, eth by default, and the names of its currencies are the
+// fields of the balances they are credited to
 type ChainConfig struct {
 	Chain         string `mapstructure:"chain"`
 	Endpoint      string `mapstructure:"endpoint,omitempty"`
+	Secret        string `mapstructure:"secret,omitempty"`
+	Prefix        string `mapstructure:"prefix,omitempty"`
+	Websocket     string `mapstructure:"websocket,omitempty"`
+	WsSecret      string `mapstructure:"websocket_secret,omitempty"`
+	PollInterval  int    `mapstructure:"poll_interval,omitempty"` // in seconds
+	BatchSize     int    `mapstructure:"batch_size,omitempty"`
+	Provider      string `mapstructure:"provider,omitempty"`
+	Decoder       string `mapstructure:"decoder,omitempty"`
 	Confirmations int    `mapstructure:"confirmations"`
 	GasStation    string `mapstructure:"gas_station,omitempty"`
+	LogRange      int    `mapstructure:"log_range,omitempty"`
+	WatchedLogs   bool   `mapstructure:"watched_logs,omitempty"`
+	L1Fees        bool   `mapstructure:"l1_fees,omitempty"` // OP-stack rollups, the receipts report the L1 data fee
+	Tracer        string `mapstructure:"tracer,omitempty"`
+	GapLimit      int    `mapstructure:"gap_limit,omitempty"`
+	Quorum        int    `mapstructure:"quorum,omitempty"`
+	CoinSelection string `mapstructure:"coin_selection,omitempty"`
+	TokenSecret   string `mapstructure:"token_secret,omitempty"`
+	Token         string
+	RateLimit     *RateLimitConfig `mapstructure:"rate_limit,omitempty"`
+	Fees          *FeeConfig
+	Cache         *CacheConfig
+	Nfts          *NftConfig
+	Sweep         *SweepConfig
+	Transactions  *TransactionConfig
+	Forwarders    *ForwarderConfig
+	Providers     []*ProviderConfig
 	Currencies    []*CurrencyConfig
 }
 
+// ProviderConfig configuration of one of the providers of a chain, in order of priority.
+// The endpoint is either set directly or fetched from the GCP secret with the given name,
+// and so is the api token of the providers that require one
+type ProviderConfig struct {
+	Provider    string `mapstructure:"provider"`
+	Endpoint    string `mapstructure:"endpoint,omitempty"`
+	Secret      string `mapstructure:"secret,omitempty"`
+	TokenSecret string `mapstructure:"token_secret,omitempty"`
+	Token       string
+	RateLimit   *RateLimitConfig `mapstructure:"rate_limit,omitempty"`
+	BatchSize   int              `mapstructure:"batch_size,omitempty"`
+}
+
+// RateLimitConfig quotas of the api plan of a provider, 0 for no limit
+type RateLimitConfig struct {
+	PerSecond int `mapstructure:"per_second"`
+	PerHour   int `mapstructure:"per_hour"`
+}
+
+// FeeConfig configuration of the fee rate estimation of a chain, rates in satoshis per vbyte
+type FeeConfig struct {
+	MinRate  float64 `mapstructure:"min_rate"`
+	MaxRate  float64 `mapstructure:"max_rate"`
+	CacheTTL int     `mapstructure:"cache_ttl"` // in seconds
+	Blocks   int     `mapstructure:"blocks"`    // number of recent scanned blocks used for the percentiles
+}
+
+// CacheConfig configuration of the response cache of the providers of a chain. The memory backend
+// is an LRU bounded by its size, the disk backend keeps its entries under the path until they are removed
+type CacheConfig struct {
+	Backend   string `mapstructure:"backend"`
+	MaxSizeMB int    `mapstructure:"max_size_mb,omitempty"`
+	Path      string `mapstructure:"path,omitempty"`
+}
+
 // CurrencyConfig structure of the configuration of each supported currency
 type CurrencyConfig struct {
 	Name              string `mapstructure:"name"`
@@ -35,12 +107,88 @@ type CurrencyConfig struct {
 	TransferSignature string `mapstructure:"transfer_signature,omitempty"`
 }
 
+// NftConfig configuration of the detection of the ERC-721 and ERC-1155 tokens sent to the accounts, of
+// the configured collections or of any collection when none is configured
+type NftConfig struct {
+	Collections []*CollectionConfig
+}
+
+// CollectionConfig configuration of a watched NFT collection
+type CollectionConfig struct {
+	Name    string `mapstructure:"name"`
+	Address string `mapstructure:"address"`
+}
+
+// SweepConfig configuration of the sweeps of the deposit addresses to the hot wallet. The thresholds are
+// the minimum balances swept, in units of each currency by lowercase name, the currencies without one are
+// not swept. The gas of the token sweeps is funded by the gas station
+type SweepConfig struct {
+	HotWallet     string             `mapstructure:"hot_wallet"`
+	Thresholds    map[string]float64 `mapstructure:"thresholds"`
+	TokenGasLimit int                `mapstructure:"token_gas_limit,omitempty"`
+}
+
+// TransactionConfig configuration of the transactions sent on an evm chain. The keys of their senders are
+// the encrypted keystore files of the directory, whose passphrase is either set directly or fetched from
+// the GCP secret with the given name. A pending transaction stuck for the given time is replaced with
+// higher fees
+type TransactionConfig struct {
+	Keystore         string `mapstructure:"keystore"`
+	PassphraseSecret string `mapstructure:"passphrase_secret,omitempty"`
+	Passphrase       string
+	StuckAfter       int `mapstructure:"stuck_after,omitempty"` // in seconds
+}
+
+// ForwarderConfig configuration of the forwarder contracts used as deposit addresses. The forwarder of an
+// account is deployed with CREATE2 by the factory, with the keccak256 of the uid of the account as salt, so
+// its address is known from the init code hash before it is deployed. The signatures are the ones of the
+// functions of the factory and of the forwarders that deploy and flush them
+type ForwarderConfig struct {
+	Factory             string `mapstructure:"factory"`
+	InitCodeHash        string `mapstructure:"init_code_hash"`
+	DeploySignature     string `mapstructure:"deploy_signature,omitempty"`
+	FlushSignature      string `mapstructure:"flush_signature,omitempty"`
+	FlushEtherSignature string `mapstructure:"flush_ether_signature,omitempty"`
+	DeployGasLimit      int    `mapstructure:"deploy_gas_limit,omitempty"`
+	FlushGasLimit       int    `mapstructure:"flush_gas_limit,omitempty"`
+}
+
 // Constants for project ids
 const (
 	DEVELOP    string = "black-stream-292507"
 	PRODUCTION string = "soteria-production"
 )
 
+// Names of the supported chain data providers, set in the provider field of a chain config
+const (
+	ProviderBlockInfo   string = "blockchain_info"
+	ProviderEsplora     string = "esplora"
+	ProviderInfura      string = "infura"
+	ProviderBlockCypher string = "blockcypher"
+)
+
+// Backends of the response cache, set in the backend field of a cache config
+const (
+	CacheMemory string = "memory"
+	CacheDisk   string = "disk"
+)
+
+// Tracers of the internal transfers of an ethereum chain, set in the tracer field of its config.
+// No tracer disables the internal transfers
+const (
+	TracerParity     string = "trace_block"
+	TracerCallTracer string = "call_tracer"
+)
+
+// DecoderNative decoder of a bitcoin chain config that parses raw blocks instead of the provider's json
+const DecoderNative string = "native"
+
+// ethEndpointSecret name of the GCP secret that holds the ethereum endpoint when no secret is set
+const ethEndpointSecret string = "eth_endpoint_watcher"
+
+// blockCypherTokenSecret name of the GCP secret that holds the BlockCypher token when no token_secret is set
+const blockCypherTokenSecret string = "blockcypher_token"
+
 // InitEnvVars initialize env variables
 func InitConfig() *Config {
 
@@ -57,12 +205,86 @@ func InitConfig() *Config {
 	}
 
 	config.KeyPath = keyPath
-	config.Ethereum.Endpoint = requestGCPEndpointSecret(config.ProjectID)
+	if config.Ethereum.Secret == "" {
+		config.Ethereum.Secret = ethEndpointSecret
+	}
+	for _, chain := range append(config.UtxoChains(), config.EvmChains()...) {
+		if chain.Secret != "" {
+			chain.Endpoint = requestGCPSecret(config.ProjectID, chain.Secret)
+		}
+		if chain.WsSecret != "" {
+			chain.Websocket = requestGCPSecret(config.ProjectID, chain.WsSecret)
+		}
+		if tx := chain.Transactions; tx != nil && tx.PassphraseSecret != "" && tx.Passphrase == "" {
+			tx.Passphrase = requestGCPSecret(config.ProjectID, tx.PassphraseSecret)
+		}
+		if chain.Token == "" {
+			if name := tokenSecret(chain.Provider, chain.TokenSecret); name != "" {
+				chain.Token = requestGCPSecret(config.ProjectID, name)
+			}
+		}
+		for _, p := range chain.Providers {
+			if p.Secret != "" {
+				p.Endpoint = requestGCPSecret(config.ProjectID, p.Secret)
+			}
+			if name := tokenSecret(p.Provider, p.TokenSecret); name != "" && p.Token == "" {
+				p.Token = requestGCPSecret(config.ProjectID, name)
+			}
+		}
+	}
 
 	return &config
 
 }
 
+// UtxoChains returns the configs of the utxo chains that are configured, bitcoin first
+func (c *Config) UtxoChains() (chains []*ChainConfig) {
+	for _, chain := range []*ChainConfig{&c.Bitcoin, &c.Litecoin, &c.Dogecoin, &c.BitcoinCash} {
+		if chain.Chain != "" {
+			chains = append(chains, chain)
+		}
+	}
+	return
+}
+
+// UtxoChain returns the config of the utxo chain of the given name, or nil if it is not configured
+func (c *Config) UtxoChain(name string) *ChainConfig {
+	for _, chain := range c.UtxoChains() {
+		if chain.Chain == name {
+			return chain
+		}
+	}
+	return nil
+}
+
+// EvmChains returns the configs of the evm chains that are configured, ethereum first
+func (c *Config) EvmChains() (chains []*ChainConfig) {
+	for _, chain := range []*ChainConfig{&c.Ethereum, &c.Polygon, &c.Arbitrum, &c.BSC, &c.Base} {
+		if chain.Chain != "" {
+			chains = append(chains, chain)
+		}
+	}
+	return
+}
+
+// EvmChain returns the config of the evm chain of the given name, or nil if it is not configured
+func (c *Config) EvmChain(name string) *ChainConfig {
+	for _, chain := range c.EvmChains() {
+		if chain.Chain == name {
+			return chain
+		}
+	}
+	return nil
+}
+
+// tokenSecret name of the GCP secret of the api token of a provider, if it needs one
+func tokenSecret(provider string, name string) string {
+	if name == "" && provider == ProviderBlockCypher {
+		return blockCypherTokenSecret
+	}
+	return name
+}
+
 func loadConfig(file string) (config Config, err error) {
 	viper.AddConfigPath("./config/")
 	viper.SetConfigName(file)
@@ -78,7 +300,7 @@ func loadConfig(file string) (config Config, err error) {
 	return
 }
 
-func requestGCPEndpointSecret(projectID string) (endpoint string) {
+func requestGCPSecret(projectID string, name string) (secret string) {
 	// Create the client.
 	ctx := context.Background()
 	client, err := secretmanager.NewClient(ctx)
@@ -86,11 +308,11 @@ func requestGCPEndpointSecret(projectID string) (endpoint string) {
 		log.Fatalf("failed to setup client: %v", err)
 	}
 	// Build the request.
-	ethAccessRequest := &secretmanagerpb.AccessSecretVersionRequest{
-		Name: "projects/" + projectID + "/secrets/eth_endpoint_watcher/versions/latest",
+	accessRequest := &secretmanagerpb.AccessSecretVersionRequest{
+		Name: "projects/" + projectID + "/secrets/" + name + "/versions/latest",
 	}
 	// Call the API.
-	res, err := client.AccessSecretVersion(ctx, ethAccessRequest)
+	res, err := client.AccessSecretVersion(ctx, accessRequest)
 	if err != nil {
 		log.Fatalf("failed to access secret version: %v", err)
 		return
@@ -99,9 +321,10 @@ func requestGCPEndpointSecret(projectID string) (endpoint string) {
 	return string(res.Payload.Data)
 }
 
+// FindCurrency find the currency of a token contract address, whatever the case of the addresses
 func FindCurrency(addr string, currencies []*CurrencyConfig) *CurrencyConfig {
 	for _, c := range currencies {
-		if addr == c.Address {
+		if c.Address != "" && strings.EqualFold(addr, c.Address) {
 			return c
 		}
 	}
@@ -0,0 +1,114 @@
+package eth
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Errors of the ethereum addresses
+var (
+	ErrAddressFormat   = errors.New("address must be 0x followed by 40 hexadecimal characters")
+	ErrAddressChecksum = errors.New("address does not match its EIP-55 checksum")
+)
+
+// from ethereum-go library  https://github.com/ethereum/go-ethereum/blob/991384a7f6719e1125ca0be7fb27d0c4d1c5d2d3/common/types.go#L235
+// That's how they transform a 20 bytes address into an EIP55 compliant address
+
+// ToChecksumAddress format a 20 bytes address into its EIP55 checksummed representation
+func ToChecksumAddress(b []byte) string {
+	var a [20]byte
+	copy(a[:], b)
+	var buf [len(a)*2 + 2]byte
+	copy(buf[:2], "0x")
+	hex.Encode(buf[2:], a[:])
+
+	// compute checksum
+	sha := sha3.NewLegacyKeccak256()
+	sha.Write(buf[2:])
+	hash := sha.Sum(nil)
+	for i := 2; i < len(buf); i++ {
+		hashByte := hash[(i-2)/2]
+		if i%2 == 0 {
+			hashByte = hashByte >> 4
+		} else {
+			hashByte &= 0xf
+		}
+		if buf[i] > '9' && hashByte > 7 {
+			buf[i] -= 32
+		}
+	}
+	return string(buf[:])
+}
+
+// ValidateAddress check the format of an address and, when it is mixed case, its EIP55 checksum.
+// All lowercase or all uppercase addresses carry no checksum and are accepted as is
+func ValidateAddress(addr string) error {
+	if len(addr) != 42 || !has0xPrefix(addr) {
+		return ErrAddressFormat
+	}
+	b, err := hex.DecodeString(addr[2:])
+	if err != nil {
+		return ErrAddressFormat
+	}
+
+	body := addr[2:]
+	if body == strings.ToLower(body) || body == strings.ToUpper(body) {
+		return nil
+	}
+	if ToChecksumAddress(b) != "0x"+body {
+		return ErrAddressChecksum
+	}
+	return nil
+}
+
+// Address ethereum address in its canonical EIP55 checksummed form. Addresses are case insensitive,
+// the canonical form is the one they are compared and recorded with
+type Address string
+
+// ParseAddress validate an address and returns its canonical form
+func ParseAddress(addr string) (Address, error) {
+	if err := ValidateAddress(addr); err != nil {
+		return "", err
+	}
+	b, _ := hex.DecodeString(addr[2:])
+	return Address(ToChecksumAddress(b)), nil
+}
+
+// ToAddress returns the canonical form of an address, or the address as is when it is invalid so that
+// it still matches itself
+func ToAddress(addr string) Address {
+	a, err := ParseAddress(addr)
+	if err != nil {
+		return Address(addr)
+	}
+	return a
+}
+
+// String returns the checksummed address
+func (a Address) String() string {
+	return string(a)
+}
+
+// Equal returns true when the given address is the same address, whatever its case
+func (a Address) Equal(addr string) bool {
+	return a == ToAddress(addr)
+}
+
+// Forms returns the checksummed, lowercase and uppercase forms of the address, the ones it can be
+// saved with by the clients
+func (a Address) Forms() []string {
+	s := string(a)
+	if !has0xPrefix(s) {
+		return []string{s}
+	}
+	forms := []string{s}
+	for _, f := range []string{"0x" + strings.ToLower(s[2:]), "0x" + strings.ToUpper(s[2:])} {
+		if f != s {
+			forms = append(forms, f)
+		}
+	}
+	return forms
+}
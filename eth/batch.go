@@ -0,0 +1,203 @@
+package eth
+
+import (
+	"fmt"
+	"math/big"
+
+	ethinfura "github.com/INFURA/go-ethlibs/eth"
+)
+
+// BatchAPI interface of the providers able to send several calls in a single JSON-RPC batch. The
+// results and errors are in the order of the requested items, an item that failed has a nil result
+// and its own error, and the error of the batch is set when none of the items could be answered
+type BatchAPI interface {
+	GetReceipts(hashes []string) ([]*ethinfura.TransactionReceipt, []error, error)
+	GetTransactionsByHash(hashes []string) ([]*Transaction, []error, error)
+	GetBalances(addresses []string, block uint64) ([]*big.Int, []error, error)
+	Calls(calls []*ContractCall, block uint64) ([]string, []error, error)
+}
+
+// ContractCall eth_call of a contract with the given data
+type ContractCall struct {
+	To   string
+	Data string
+}
+
+// L1FeeAPI interface of the providers able to return the L1 data fees of the transactions of a rollup, that
+// the OP-stack chains report in the l1Fee field of their receipts. A receipt without it has a nil fee
+type L1FeeAPI interface {
+	GetL1Fees(hashes []string) ([]*big.Int, []error, error)
+}
+
+// receipts get the receipts of the given transactions, in a batch when the provider allows it
+func (e *Eth) receipts(hashes []string) ([]*ethinfura.TransactionReceipt, []error, error) {
+	if b, ok := e.api.(BatchAPI); ok {
+		return b.GetReceipts(hashes)
+	}
+
+	receipts := make([]*ethinfura.TransactionReceipt, len(hashes))
+	errs := make([]error, len(hashes))
+	for i, h := range hashes {
+		receipts[i], errs[i] = e.api.GetReceipt(h)
+	}
+	return receipts, errs, nil
+}
+
+// transactions get the given transactions, in a batch when the provider allows it
+func (e *Eth) transactions(hashes []string, b int) ([]*Transaction, []error, error) {
+	if batch, ok := e.api.(BatchAPI); ok {
+		return batch.GetTransactionsByHash(hashes)
+	}
+
+	txs := make([]*Transaction, len(hashes))
+	errs := make([]error, len(hashes))
+	for i, h := range hashes {
+		txs[i], errs[i] = e.api.GetTransactionByHash(h, b)
+	}
+	return txs, errs, nil
+}
+
+// TransactionsSucceeded returns for each transaction whether its receipt has a success status, with
+// the receipts of all the transactions requested at once. Receipts without status predate byzantium,
+// when failed transactions could not be told apart, they are considered successful
+func (e *Eth) TransactionsSucceeded(hashes []string) ([]bool, []error, error) {
+	receipts, errs, err := e.receipts(hashes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	succeeded := make([]bool, len(hashes))
+	for i, r := range receipts {
+		if errs[i] != nil {
+			continue
+		}
+		if r == nil {
+			errs[i] = fmt.Errorf("no receipt for transaction %s", hashes[i])
+			continue
+		}
+		succeeded[i] = r.Status == nil || r.Status.UInt64() == 1
+	}
+	return succeeded, errs, nil
+}
+
+// TransactionsMinedAt returns for each transaction whether it is mined with a success status in the block
+// of the given height, from the receipts of all the transactions requested at once. A transaction without
+// receipt was dropped by a reorg, one mined in another block was moved by it
+func (e *Eth) TransactionsMinedAt(hashes []string, height uint64) ([]bool, []error, error) {
+	receipts, errs, err := e.receipts(hashes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mined := make([]bool, len(hashes))
+	for i, r := range receipts {
+		if errs[i] != nil || r == nil {
+			continue
+		}
+		mined[i] = r.BlockNumber.UInt64() == height && (r.Status == nil || r.Status.UInt64() == 1)
+	}
+	return mined, errs, nil
+}
+
+// TxCost type, status and fee of a mined transaction. The fee is the gas used at the effective gas price,
+// plus the L1 data fee of the rollups charging it apart
+type TxCost struct {
+	Type              uint8
+	Succeeded         bool
+	GasUsed           uint64
+	EffectiveGasPrice *big.Int
+	L1Fee             *big.Int
+	Fee               *big.Int
+}
+
+// TransactionCosts returns the costs of mined transactions, from their receipts and from the transactions
+// requested at once. The gas price of a mined transaction is the effective one, the base fee plus the tip
+// it paid for the dynamic fee ones. The L1 data fees are added for the chains configured with them, the
+// OP-stack ones, the gas used on arbitrum already counts the L1 component
+func (e *Eth) TransactionCosts(hashes []string) ([]*TxCost, []error, error) {
+	receipts, errs, err := e.receipts(hashes)
+	if err != nil {
+		return nil, nil, err
+	}
+	txs, txErrs, err := e.transactions(hashes, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	costs := make([]*TxCost, len(hashes))
+	for i, r := range receipts {
+		if errs[i] == nil {
+			errs[i] = txErrs[i]
+		}
+		if errs[i] != nil {
+			continue
+		}
+		if r == nil || txs[i] == nil || txs[i].GasPrice == nil {
+			errs[i] = fmt.Errorf("no receipt for transaction %s", hashes[i])
+			continue
+		}
+		c := &TxCost{
+			Type:              txs[i].Type,
+			Succeeded:         r.Status == nil || r.Status.UInt64() == 1,
+			GasUsed:           r.GasUsed.UInt64(),
+			EffectiveGasPrice: txs[i].GasPrice,
+		}
+		c.Fee = new(big.Int).Mul(new(big.Int).SetUint64(c.GasUsed), c.EffectiveGasPrice)
+		costs[i] = c
+	}
+	if !e.config.L1Fees {
+		return costs, errs, nil
+	}
+
+	l, ok := e.api.(L1FeeAPI)
+	if !ok {
+		return nil, nil, fmt.Errorf("the provider of %s cannot return L1 fees", e.config.Chain)
+	}
+	l1Fees, l1Errs, err := l.GetL1Fees(hashes)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, c := range costs {
+		if c == nil {
+			continue
+		}
+		if l1Errs[i] != nil {
+			errs[i], costs[i] = l1Errs[i], nil
+			continue
+		}
+		if l1Fees[i] != nil {
+			c.L1Fee = l1Fees[i]
+			c.Fee.Add(c.Fee, c.L1Fee)
+		}
+	}
+	return costs, errs, nil
+}
+
+// GetBalances get the balances in wei of the given addresses at the given block, the latest one when it
+// is 0, in a batch when the provider allows it
+func (e *Eth) GetBalances(addresses []string, block uint64) ([]*big.Int, []error, error) {
+	b, ok := e.api.(BatchAPI)
+	if !ok {
+		return nil, nil, fmt.Errorf("the provider of %s cannot return balances", e.config.Chain)
+	}
+	return b.GetBalances(addresses, block)
+}
+
+// Calls call the given contracts at the given block and returns the data they returned, in a batch when the
+// provider allows it
+func (e *Eth) Calls(calls []*ContractCall, block uint64) ([]string, []error, error) {
+	if b, ok := e.api.(BatchAPI); ok {
+		return b.Calls(calls, block)
+	}
+	caller, ok := e.api.(CallAPI)
+	if !ok {
+		return nil, nil, fmt.Errorf("the provider of %s cannot call contracts", e.config.Chain)
+	}
+
+	results := make([]string, len(calls))
+	errs := make([]error, len(calls))
+	for i, c := range calls {
+		results[i], errs[i] = caller.Call(c.To, c.Data, block)
+	}
+	return results, errs, nil
+}
@@ -1,11 +1,15 @@
 package eth
 
 import (
+	"context"
+	"encoding/hex"
+	"fmt"
 	"math/big"
+	"strings"
+	"sync"
 
 	ethinfura "github.com/INFURA/go-ethlibs/eth"
 	"github.com/SoteriaTech/blockchain-functions/env"
-	"github.com/SoteriaTech/blockchain-functions/utils"
 )
 
 // EthereumAPI interface that Eth service implements
@@ -16,61 +20,191 @@ type EthereumAPI interface {
 	GetReceipt(hash string) (*ethinfura.TransactionReceipt, error)
 }
 
-// Eth stucture of the Eth service
+// BlockHashAPI interface of the providers able to return the hash of a block without its transactions
+type BlockHashAPI interface {
+	GetBlockHash(h uint64) (string, error)
+}
+
+// NewHeadsAPI interface of the providers able to push the heights of the new heads of the chain. The
+// channel is closed when the subscription ends, e.g. when the connection is lost. Heads can arrive
+// out of order or be skipped, so they are only used as the target of a scan from the chain state
+type NewHeadsAPI interface {
+	SubscribeNewHeads(ctx context.Context) (<-chan uint64, error)
+}
+
+// FinalityAPI interface of the providers able to return the header of the block of the finalized or
+// safe tags, on the chains that have them
+type FinalityAPI interface {
+	GetBlockHeaderByTag(tag string) (*Header, error)
+}
+
+// Tags of the checkpoints of the chains with a finality
+const (
+	TagFinalized string = "finalized"
+	TagSafe      string = "safe"
+)
+
+// Eth stucture of the Eth service. One service runs for each configured evm chain
 type Eth struct {
-	api    EthereumAPI
-	config *env.ChainConfig
+	api      EthereumAPI
+	config   *env.ChainConfig
+	tokens   map[Address]*TokenMetadata
+	tokensMu sync.Mutex
+	chainID  *big.Int
+	txMu     sync.Mutex
 }
 
-// EthService instance of the EthService
-var ethService *Eth
+// services instances of the services of the evm chains, by chain name
+var services = make(map[string]*Eth)
 
-// InitEthService initialize the instance of EthService
-func InitEthService(api EthereumAPI, config *env.ChainConfig) {
-	ethService = &Eth{
+// InitEthService initialize the service of an evm chain and register it under the chain name
+func InitEthService(api EthereumAPI, config *env.ChainConfig) (*Eth, error) {
+	if len(config.Currencies) == 0 {
+		return nil, fmt.Errorf("no currency configured for %s", config.Chain)
+	}
+	// the transfers of any collection are only requested to the accounts, the others are too many
+	if config.Nfts != nil && len(config.Nfts.Collections) == 0 && !config.WatchedLogs {
+		return nil, fmt.Errorf("the NFTs of any collection of %s can only be detected with watched_logs", config.Chain)
+	}
+	if config.Forwarders != nil {
+		if _, err := ParseAddress(config.Forwarders.Factory); err != nil {
+			return nil, fmt.Errorf("invalid forwarder factory %s of %s: %v", config.Forwarders.Factory, config.Chain, err)
+		}
+		if h, err := hex.DecodeString(strings.TrimPrefix(config.Forwarders.InitCodeHash, "0x")); err != nil || len(h) != 32 {
+			return nil, fmt.Errorf("invalid forwarder init code hash %s of %s", config.Forwarders.InitCodeHash, config.Chain)
+		}
+	}
+	e := &Eth{
 		api:    api,
 		config: config,
+		tokens: make(map[Address]*TokenMetadata),
 	}
+	services[config.Chain] = e
+	return e, nil
+}
+
+// Service returns the service of the given evm chain
+func Service(chain string) (*Eth, error) {
+	e, ok := services[chain]
+	if !ok {
+		return nil, fmt.Errorf("no service initialized for chain %s", chain)
+	}
+	return e, nil
 }
 
 // GetHeadBlock get the head block number of the chain
-func GetHeadBlock() (uint64, error) {
-	return ethService.api.GetBlockHeader()
+func (e *Eth) GetHeadBlock() (uint64, error) {
+	return e.api.GetBlockHeader()
 }
 
-// ScanBlock scan a block to retrieve its transactions
-func ScanBlock(h uint64) (*BlockData, error) {
+// Checkpoints get the latest finalized and safe blocks, which the chains without finality or the providers
+// that do not know the tags do not have
+func (e *Eth) Checkpoints() (*Checkpoints, error) {
+	f, ok := e.api.(FinalityAPI)
+	if !ok {
+		return nil, fmt.Errorf("the provider of %s cannot return the finalized blocks", e.config.Chain)
+	}
+	finalized, err := f.GetBlockHeaderByTag(TagFinalized)
+	if err != nil {
+		return nil, err
+	}
+	safe, err := f.GetBlockHeaderByTag(TagSafe)
+	if err != nil {
+		return nil, err
+	}
+	return &Checkpoints{Finalized: finalized, Safe: safe}, nil
+}
+
+// ScanBlock scan a block to retrieve its transactions and token transfers
+func (e *Eth) ScanBlock(h uint64, receivers []string) (*BlockData, error) {
+	blocks, err := e.ScanBlocks(h, h, receivers)
+	if err != nil {
+		return nil, err
+	}
+	return blocks[0], nil
+}
 
-	bd, errT := ethService.api.GetTransactionsFromBlock(new(big.Int).SetUint64(h))
-	if errT != nil {
-		return nil, errT
+// ScanBlocks scan an inclusive range of blocks to retrieve their transactions. The ether transfers come
+// from the bodies of the blocks and the token transfers from their logs, one transaction per log. When
+// the chain has a tracer, the ether transferred by internal calls comes from the traces of the blocks,
+// and when it detects NFTs, their transfers come from the logs too
+func (e *Eth) ScanBlocks(from uint64, to uint64, receivers []string) ([]*BlockData, error) {
+	transfers, err := e.TokenTransfers(from, to, receivers)
+	if err != nil {
+		return nil, err
+	}
+	byHeight := make(map[int][]*Transaction)
+	for _, t := range transfers {
+		byHeight[t.BlockHeight] = append(byHeight[t.BlockHeight], t)
+	}
+	nftsByHeight := make(map[int][]*NftTransfer)
+	if e.config.Nfts != nil {
+		nfts, errNft := e.NftTransfers(from, to, receivers)
+		if errNft != nil {
+			return nil, errNft
+		}
+		for _, t := range nfts {
+			nftsByHeight[t.BlockHeight] = append(nftsByHeight[t.BlockHeight], t)
+		}
 	}
-	for idx, tx := range bd.Txs {
-		currency := env.FindCurrency(tx.To, ethService.config.Currencies)
-		tx.Currency = currency.Name
 
-		if currency.Address != "" {
-			tf, err := parseTokenTransfer(tx, currency)
-			if err != nil {
-				utils.ErrorReport.LogAndPrintError(err)
-				continue
+	var blocks []*BlockData
+	for h := from; h <= to; h++ {
+		bd, errT := e.api.GetTransactionsFromBlock(new(big.Int).SetUint64(h))
+		if errT != nil {
+			return nil, errT
+		}
+		for _, tx := range bd.Txs {
+			tx.Currency = e.config.Currencies[0].Name
+		}
+		bd.Txs = append(bd.Txs, byHeight[bd.Meta.Height]...)
+		bd.Nfts = nftsByHeight[bd.Meta.Height]
+		if tracesEnabled(e.config) {
+			internal, errTrace := e.InternalTransfers(h)
+			if errTrace != nil {
+				return nil, errTrace
 			}
-			bd.Txs[idx] = tf
+			bd.Txs = append(bd.Txs, internal...)
 		}
+		blocks = append(blocks, bd)
 	}
-	return bd, nil
+	return blocks, nil
 }
 
-// ConfirmTransactions ask the blockchain for confirmed transactions
-func ConfirmTransactions(hashes []string, b int) (confirmed []string, errs []error) {
-	for _, h := range hashes {
-		tx, err := ethService.api.GetTransactionByHash(h, b)
+// ConfirmTransactions ask the blockchain for confirmed transactions. The receipt of each transaction is
+// checked again, it can have been reorganized into a block where it reverted. The transactions and
+// their receipts are each requested at once
+func (e *Eth) ConfirmTransactions(hashes []string, b int) (confirmed []string, reverted []string, errs []error) {
+	txs, txErrs, err := e.transactions(hashes, b)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
 
-		if err != nil {
-			errs = append(errs, err)
+	var found []string
+	for i, tx := range txs {
+		if txErrs[i] != nil {
+			errs = append(errs, txErrs[i])
 			continue
 		}
-		confirmed = append(confirmed, tx.Hash)
+		found = append(found, tx.Hash)
+	}
+	if len(found) == 0 {
+		return
+	}
+
+	succeeded, statusErrs, err := e.TransactionsSucceeded(found)
+	if err != nil {
+		return nil, nil, append(errs, err)
+	}
+	for i, h := range found {
+		switch {
+		case statusErrs[i] != nil:
+			errs = append(errs, statusErrs[i])
+		case succeeded[i]:
+			confirmed = append(confirmed, h)
+		default:
+			reverted = append(reverted, h)
+		}
 	}
 	return
 }
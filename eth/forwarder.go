@@ -0,0 +1,172 @@
+package eth
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Functions and gas of the forwarders and of their factory when the config does not set them
+const (
+	defaultDeploySignature     string = "createForwarder(bytes32)"
+	defaultFlushSignature      string = "flushTokens(address)"
+	defaultFlushEtherSignature string = "flush()"
+	defaultDeployGasLimit      uint64 = 200000
+	defaultFlushGasLimit       uint64 = 100000
+)
+
+// CodeAPI interface of the providers able to return the code of an address at the given block, the latest
+// one when it is 0
+type CodeAPI interface {
+	GetCode(addr string, block uint64) (string, error)
+}
+
+// Create2Address address of the contract deployed with CREATE2 by a deployer, from the salt and the
+// keccak256 of the init code: the last 20 bytes of keccak256(0xff ++ deployer ++ salt ++ initCodeHash)
+func Create2Address(deployer Address, salt []byte, initCodeHash []byte) (Address, error) {
+	d, err := hex.DecodeString(strings.TrimPrefix(deployer.String(), "0x"))
+	if err != nil || len(d) != 20 {
+		return "", fmt.Errorf("invalid deployer %s", deployer)
+	}
+	if len(salt) != 32 || len(initCodeHash) != 32 {
+		return "", fmt.Errorf("salt and init code hash must be 32 bytes")
+	}
+	sha := sha3.NewLegacyKeccak256()
+	sha.Write([]byte{0xff})
+	sha.Write(d)
+	sha.Write(salt)
+	sha.Write(initCodeHash)
+	return ToAddress("0x" + hex.EncodeToString(sha.Sum(nil)[12:])), nil
+}
+
+// ForwarderSalt salt of the forwarder of an account, the keccak256 of its uid
+func ForwarderSalt(uid string) []byte {
+	sha := sha3.NewLegacyKeccak256()
+	sha.Write([]byte(uid))
+	return sha.Sum(nil)
+}
+
+// Selector selector of a function from its signature, e.g. transfer(address,uint256)
+func Selector(signature string) string {
+	sha := sha3.NewLegacyKeccak256()
+	sha.Write([]byte(signature))
+	return "0x" + hex.EncodeToString(sha.Sum(nil)[:4])
+}
+
+// ForwarderAddress counterfactual address of the forwarder of an account, known before it is deployed
+func (e *Eth) ForwarderAddress(uid string) (Address, error) {
+	fc := e.config.Forwarders
+	if fc == nil {
+		return "", fmt.Errorf("no forwarders configured for %s", e.config.Chain)
+	}
+	factory, err := ParseAddress(fc.Factory)
+	if err != nil {
+		return "", fmt.Errorf("invalid forwarder factory %s: %v", fc.Factory, err)
+	}
+	hash, err := hex.DecodeString(strings.TrimPrefix(fc.InitCodeHash, "0x"))
+	if err != nil {
+		return "", fmt.Errorf("invalid forwarder init code hash %s", fc.InitCodeHash)
+	}
+	return Create2Address(factory, ForwarderSalt(uid), hash)
+}
+
+// IsForwarder whether an address is the forwarder of an account
+func (e *Eth) IsForwarder(uid string, addr Address) bool {
+	if e.config.Forwarders == nil {
+		return false
+	}
+	f, err := e.ForwarderAddress(uid)
+	return err == nil && f == addr
+}
+
+// ForwarderDeployed whether the forwarder at an address has been deployed, in the latest block
+func (e *Eth) ForwarderDeployed(addr Address) (bool, error) {
+	c, ok := e.api.(CodeAPI)
+	if !ok {
+		return false, fmt.Errorf("the provider of %s cannot return the code of contracts", e.config.Chain)
+	}
+	code, err := c.GetCode(addr.String(), 0)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimPrefix(code, "0x") != "", nil
+}
+
+// planForwarder plan the flushes of the balances of a forwarder above the thresholds to the address it
+// forwards to, after its deployment when it is not deployed yet. The gas station sends them, a forwarder
+// holds no ether to pay gas with
+func (e *Eth) planForwarder(a *SweepAccount, station Address, gasPrice *big.Int) (deploy *SweepStep, flushes []*SweepStep, err error) {
+	fc := e.config.Forwarders
+	flushGas := defaultFlushGasLimit
+	if fc.FlushGasLimit > 0 {
+		flushGas = uint64(fc.FlushGasLimit)
+	}
+	flushSignature := defaultFlushSignature
+	if fc.FlushSignature != "" {
+		flushSignature = fc.FlushSignature
+	}
+	flushEtherSignature := defaultFlushEtherSignature
+	if fc.FlushEtherSignature != "" {
+		flushEtherSignature = fc.FlushEtherSignature
+	}
+
+	for i, c := range e.config.Currencies {
+		threshold, ok := e.sweepThreshold(c.Name, c.Decimals)
+		amount := a.Balances[c.Name]
+		if (i > 0 && c.Address == "") || !ok || amount == nil || amount.Sign() <= 0 || amount.Cmp(threshold) < 0 {
+			continue
+		}
+		step := &SweepStep{
+			ID:       sweepStepID(SweepFlush, a.Address, c.Name),
+			Kind:     SweepFlush,
+			UID:      a.UID,
+			From:     station,
+			To:       a.Address,
+			Currency: c.Name,
+			Amount:   amount,
+			Data:     Selector(flushEtherSignature),
+			GasLimit: flushGas,
+			GasPrice: gasPrice,
+		}
+		if i > 0 {
+			step.Contract = ToAddress(c.Address)
+			step.Data = Selector(flushSignature) + addressTopic(c.Address)[2:]
+		}
+		flushes = append(flushes, step)
+	}
+	if len(flushes) == 0 || a.Deployed {
+		return nil, flushes, nil
+	}
+
+	factory, err := ParseAddress(fc.Factory)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid forwarder factory %s: %v", fc.Factory, err)
+	}
+	deployGas := defaultDeployGasLimit
+	if fc.DeployGasLimit > 0 {
+		deployGas = uint64(fc.DeployGasLimit)
+	}
+	deploySignature := defaultDeploySignature
+	if fc.DeploySignature != "" {
+		deploySignature = fc.DeploySignature
+	}
+	deploy = &SweepStep{
+		ID:       sweepStepID(SweepDeploy, a.Address, e.config.Currencies[0].Name),
+		Kind:     SweepDeploy,
+		UID:      a.UID,
+		From:     station,
+		To:       factory,
+		Currency: e.config.Currencies[0].Name,
+		Amount:   new(big.Int),
+		Data:     Selector(deploySignature) + hex.EncodeToString(ForwarderSalt(a.UID)),
+		GasLimit: deployGas,
+		GasPrice: gasPrice,
+	}
+	for _, f := range flushes {
+		f.DependsOn = []string{deploy.ID}
+	}
+	return deploy, flushes, nil
+}
@@ -0,0 +1,139 @@
+package eth
+
+import (
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"golang.org/x/crypto/sha3"
+)
+
+// EIP-1014 examples, the init code is hashed since the address is derived from its keccak256
+func TestCreate2AddressVectors(t *testing.T) {
+	tests := []struct {
+		deployer string
+		salt     string
+		initCode string
+		addr     string
+	}{
+		{"0x0000000000000000000000000000000000000000", "0000000000000000000000000000000000000000000000000000000000000000", "00", "0x4D1A2e2bB4F88F0250f26Ffff098B0b30B26BF38"},
+		{"0xdeadbeef00000000000000000000000000000000", "0000000000000000000000000000000000000000000000000000000000000000", "00", "0xB928f69Bb1D91Cd65274e3c79d8986362984fDA3"},
+		{"0xdeadbeef00000000000000000000000000000000", "000000000000000000000000feed000000000000000000000000000000000000", "00", "0xD04116cDd17beBE565EB2422F2497E06cC1C9833"},
+		{"0x0000000000000000000000000000000000000000", "0000000000000000000000000000000000000000000000000000000000000000", "deadbeef", "0x70f2b2914A2a4b783FaEFb75f459A580616Fcb5e"},
+		{"0x00000000000000000000000000000000deadbeef", "00000000000000000000000000000000000000000000000000000000cafebabe", "deadbeef", "0x60f3f640a8508fC6a86d45DF051962668E1e8AC7"},
+		{"0x0000000000000000000000000000000000000000", "0000000000000000000000000000000000000000000000000000000000000000", "", "0xE33C0C7F7df4809055C3ebA6c09CFe4BaF1BD9e0"},
+	}
+	for _, tt := range tests {
+		salt, _ := hex.DecodeString(tt.salt)
+		code, _ := hex.DecodeString(tt.initCode)
+		sha := sha3.NewLegacyKeccak256()
+		sha.Write(code)
+
+		addr, err := Create2Address(ToAddress(tt.deployer), salt, sha.Sum(nil))
+		if err != nil {
+			t.Errorf("Create2Address(%s, %s): %v", tt.deployer, tt.salt, err)
+			continue
+		}
+		if addr.String() != tt.addr {
+			t.Errorf("Create2Address(%s, %s, %s) = %s, want %s", tt.deployer, tt.salt, tt.initCode, addr, tt.addr)
+		}
+	}
+
+	if _, err := Create2Address(ToAddress("0x00"), make([]byte, 32), make([]byte, 32)); err == nil {
+		t.Errorf("an invalid deployer should be rejected")
+	}
+	if _, err := Create2Address(testAddress("1"), make([]byte, 31), make([]byte, 32)); err == nil {
+		t.Errorf("a salt of 31 bytes should be rejected")
+	}
+}
+
+func TestSelector(t *testing.T) {
+	tests := []struct {
+		signature string
+		selector  string
+	}{
+		{"transfer(address,uint256)", transferSelector},
+		{"transfer(address,uint256)", "0xa9059cbb"},
+		{"balanceOf(address)", balanceOfSelector},
+		{"flush()", "0x6b9f96ea"},
+	}
+	for _, tt := range tests {
+		if got := Selector(tt.signature); got != tt.selector {
+			t.Errorf("Selector(%s) = %s, want %s", tt.signature, got, tt.selector)
+		}
+	}
+}
+
+func testForwarderService() *Eth {
+	e := testSweepService()
+	e.config.Forwarders = &env.ForwarderConfig{
+		Factory:      testAddress("9").String(),
+		InitCodeHash: "0x" + strings.Repeat("ab", 32),
+	}
+	return e
+}
+
+func TestForwarderAddress(t *testing.T) {
+	e := testForwarderService()
+	addr, err := e.ForwarderAddress("uid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, _ := hex.DecodeString(strings.Repeat("ab", 32))
+	want, _ := Create2Address(testAddress("9"), ForwarderSalt("uid"), hash)
+	if addr != want {
+		t.Errorf("ForwarderAddress = %s, want %s", addr, want)
+	}
+	if !e.IsForwarder("uid", addr) || e.IsForwarder("other", addr) {
+		t.Errorf("the forwarder of uid should only match its account")
+	}
+
+	e.config.Forwarders = nil
+	if e.IsForwarder("uid", addr) {
+		t.Errorf("no address is a forwarder without config")
+	}
+}
+
+func TestPlanSweepForwarders(t *testing.T) {
+	e := testForwarderService()
+	gasPrice := big.NewInt(100)
+	fwd, _ := e.ForwarderAddress("fwd")
+	deployed, _ := e.ForwarderAddress("deployed")
+	accounts := []*SweepAccount{
+		{UID: "fwd", Address: fwd, Forwarder: true, Balances: map[string]*big.Int{"ETH": ether(1), "USDC": big.NewInt(200000000)}},
+		{UID: "deployed", Address: deployed, Forwarder: true, Deployed: true, Balances: map[string]*big.Int{"USDC": big.NewInt(200000000)}},
+	}
+	plan, err := e.PlanSweep(accounts, 100, gasPrice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := make(map[string]*SweepStep)
+	for _, s := range plan.Steps {
+		steps[s.ID] = s
+		if s.From != testAddress("5") {
+			t.Errorf("%s sent from %s, want the gas station", s.ID, s.From)
+		}
+	}
+	if len(plan.Steps) != 4 || plan.Steps[0].Kind != SweepDeploy {
+		t.Fatalf("%d steps starting with %s, want the deployment and 3 flushes", len(plan.Steps), plan.Steps[0].Kind)
+	}
+
+	deploy := steps[sweepStepID(SweepDeploy, fwd, "ETH")]
+	if deploy.To != testAddress("9") || deploy.Data != Selector(defaultDeploySignature)+hex.EncodeToString(ForwarderSalt("fwd")) {
+		t.Errorf("deployment %+v", deploy)
+	}
+	flushEther := steps[sweepStepID(SweepFlush, fwd, "ETH")]
+	if flushEther.Data != "0x6b9f96ea" || len(flushEther.DependsOn) != 1 || flushEther.DependsOn[0] != deploy.ID {
+		t.Errorf("ether flush %+v", flushEther)
+	}
+	flushToken := steps[sweepStepID(SweepFlush, fwd, "USDC")]
+	if flushToken.Data != Selector(defaultFlushSignature)+addressTopic(testAddress("c").String())[2:] || flushToken.Contract != testAddress("c") {
+		t.Errorf("token flush %+v", flushToken)
+	}
+	if s := steps[sweepStepID(SweepFlush, deployed, "USDC")]; s == nil || len(s.DependsOn) != 0 {
+		t.Errorf("the flush of a deployed forwarder should not wait for a deployment: %+v", s)
+	}
+}
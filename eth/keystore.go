@@ -0,0 +1,106 @@
+package eth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/sha3"
+)
+
+// keystoreFile encrypted key of the Web3 Secret Storage format, version 3, as written by geth
+type keystoreFile struct {
+	Address string `json:"address"`
+	Crypto  struct {
+		Cipher       string `json:"cipher"`
+		CipherText   string `json:"ciphertext"`
+		CipherParams struct {
+			IV string `json:"iv"`
+		} `json:"cipherparams"`
+		KDF       string `json:"kdf"`
+		KDFParams struct {
+			DKLen int    `json:"dklen"`
+			Salt  string `json:"salt"`
+			N     int    `json:"n"`
+			R     int    `json:"r"`
+			P     int    `json:"p"`
+			C     int    `json:"c"`
+			PRF   string `json:"prf"`
+		} `json:"kdfparams"`
+		MAC string `json:"mac"`
+	} `json:"crypto"`
+	Version int `json:"version"`
+}
+
+// DecryptKeystore decrypt the private key of a keystore file with its passphrase. The key is derived with
+// scrypt or pbkdf2 and checked against the mac before the aes-128-ctr cipher text is decrypted
+func DecryptKeystore(data []byte, passphrase string) (*btcec.PrivateKey, error) {
+	var k keystoreFile
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, err
+	}
+	if k.Version != 3 {
+		return nil, fmt.Errorf("keystore version %d is not supported", k.Version)
+	}
+	if k.Crypto.Cipher != "aes-128-ctr" {
+		return nil, fmt.Errorf("keystore cipher %s is not supported", k.Crypto.Cipher)
+	}
+	salt, errSalt := hex.DecodeString(k.Crypto.KDFParams.Salt)
+	iv, errIV := hex.DecodeString(k.Crypto.CipherParams.IV)
+	text, errText := hex.DecodeString(k.Crypto.CipherText)
+	mac, errMAC := hex.DecodeString(k.Crypto.MAC)
+	if errSalt != nil || errIV != nil || errText != nil || errMAC != nil {
+		return nil, fmt.Errorf("keystore of %s is not hexadecimal", k.Address)
+	}
+
+	params := k.Crypto.KDFParams
+	if params.DKLen < 32 {
+		return nil, fmt.Errorf("keystore derived key of %d bytes is too short", params.DKLen)
+	}
+	var derived []byte
+	switch k.Crypto.KDF {
+	case "scrypt":
+		var err error
+		if derived, err = scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, params.DKLen); err != nil {
+			return nil, err
+		}
+	case "pbkdf2":
+		if params.PRF != "hmac-sha256" {
+			return nil, fmt.Errorf("keystore prf %s is not supported", params.PRF)
+		}
+		derived = pbkdf2.Key([]byte(passphrase), salt, params.C, params.DKLen, sha256.New)
+	default:
+		return nil, fmt.Errorf("keystore kdf %s is not supported", k.Crypto.KDF)
+	}
+
+	sha := sha3.NewLegacyKeccak256()
+	sha.Write(derived[16:32])
+	sha.Write(text)
+	if subtle.ConstantTimeCompare(sha.Sum(nil), mac) != 1 {
+		return nil, fmt.Errorf("wrong passphrase for the keystore of %s", k.Address)
+	}
+
+	block, err := aes.NewCipher(derived[:16])
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, len(text))
+	cipher.NewCTR(block, iv).XORKeyStream(key, text)
+	priv, _ := btcec.PrivKeyFromBytes(btcec.S256(), key)
+	return priv, nil
+}
+
+// KeyAddress address of the public key of a private key, the last 20 bytes of the keccak256 of its
+// uncompressed point
+func KeyAddress(key *btcec.PrivateKey) Address {
+	sha := sha3.NewLegacyKeccak256()
+	sha.Write(key.PubKey().SerializeUncompressed()[1:])
+	return ToAddress("0x" + hex.EncodeToString(sha.Sum(nil)[12:]))
+}
@@ -0,0 +1,49 @@
+package eth
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// test vectors of the Web3 Secret Storage definition, both encrypting the same key
+const (
+	testKeystorePbkdf2 = `{"crypto":{"cipher":"aes-128-ctr","cipherparams":{"iv":"6087dab2f9fdbbfaddc31a909735c1e6"},"ciphertext":"5318b4d5bcd28de64ee5559e671353e16f075ecae9f99c7a79a38af5f869aa46","kdf":"pbkdf2","kdfparams":{"c":262144,"dklen":32,"prf":"hmac-sha256","salt":"ae3cd4e7013836a3df6bd7241b12db061dbe2c6785853cce422d148a624ce0bd"},"mac":"517ead924a9d0dc3124507e3393d175ce3ff7c1e96529c6c555ce9e51205e9b2"},"id":"3198bc9c-6672-5ab3-d995-4942343ae5b6","version":3}`
+	testKeystoreScrypt = `{"crypto":{"cipher":"aes-128-ctr","cipherparams":{"iv":"83dbcc02d8ccb40e466191a123791e0e"},"ciphertext":"d172bf743a674da9cdad04534d56926ef8358534d458fffccd4e6ad2fbde479c","kdf":"scrypt","kdfparams":{"dklen":32,"n":262144,"r":1,"p":8,"salt":"ab0c7876052600dd703518d6fc3fe8984592145b591fc8fb5c6d43190334ba19"},"mac":"2103ac29920d71da29f15d75b4a16dbe95cfd7ff8faea1056c33131d846e3097"},"id":"3198bc9c-6672-5ab3-d995-4942343ae5b6","version":3}`
+	testKeystoreKey    = "7a28b5ba57c53603b0b07b56bba752f7784bf506fa95edc395f5cf6c7514fe9d"
+)
+
+func TestDecryptKeystoreVectors(t *testing.T) {
+	for _, data := range []string{testKeystorePbkdf2, testKeystoreScrypt} {
+		key, err := DecryptKeystore([]byte(data), "testpassword")
+		if err != nil {
+			t.Errorf("DecryptKeystore: %v", err)
+			continue
+		}
+		if got := hex.EncodeToString(key.Serialize()); got != testKeystoreKey {
+			t.Errorf("decrypted key %s, want %s", got, testKeystoreKey)
+		}
+	}
+}
+
+func TestDecryptKeystoreErrors(t *testing.T) {
+	if _, err := DecryptKeystore([]byte(testKeystorePbkdf2), "wrongpassword"); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("wrong passphrase: %v", err)
+	}
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"version", strings.Replace(testKeystorePbkdf2, `"version":3`, `"version":1`, 1)},
+		{"cipher", strings.Replace(testKeystorePbkdf2, "aes-128-ctr", "aes-128-cbc", 1)},
+		{"kdf", strings.Replace(testKeystorePbkdf2, `"kdf":"pbkdf2"`, `"kdf":"argon2"`, 1)},
+		{"prf", strings.Replace(testKeystorePbkdf2, "hmac-sha256", "hmac-sha512", 1)},
+		{"dklen", strings.Replace(testKeystorePbkdf2, `"dklen":32`, `"dklen":16`, 1)},
+		{"hex", strings.Replace(testKeystorePbkdf2, `"iv":"6087`, `"iv":"zz87`, 1)},
+	}
+	for _, tt := range tests {
+		if _, err := DecryptKeystore([]byte(tt.data), "testpassword"); err == nil {
+			t.Errorf("%s: keystore should be rejected", tt.name)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package eth
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+)
+
+const (
+	// defaultLogRange number of blocks of each eth_getLogs request when the config does not set one
+	defaultLogRange uint64 = 100
+	// maxTopicReceivers number of receivers of each eth_getLogs request filtering on the receivers
+	maxTopicReceivers int = 100
+)
+
+// LogsAPI interface of the providers able to return the logs matching a filter
+type LogsAPI interface {
+	GetLogs(filter *LogFilter) ([]*Log, error)
+}
+
+// LogFilter filter of eth_getLogs over an inclusive range of blocks. Each position of the topics
+// matches any of its values, and an empty position matches any topic
+type LogFilter struct {
+	FromBlock uint64
+	ToBlock   uint64
+	Addresses []string
+	Topics    [][]string
+}
+
+// Log event log of a transaction
+type Log struct {
+	Address     string
+	Topics      []string
+	Data        string
+	BlockNumber uint64
+	BlockHash   string
+	TxHash      string
+	TxIndex     uint64
+	LogIndex    uint64
+	Removed     bool
+}
+
+// TokenTransfers find the ERC-20 transfers of the configured tokens in the given range of blocks, with
+// eth_getLogs over ranges of the configured log range. When receivers are given, only the transfers
+// to them are requested
+func (e *Eth) TokenTransfers(from uint64, to uint64, receivers []string) ([]*Transaction, error) {
+	logs, ok := e.api.(LogsAPI)
+	if !ok {
+		return nil, fmt.Errorf("the ethereum provider cannot return logs")
+	}
+
+	var contracts []string
+	var signatures []string
+	tokens := make(map[string]*env.CurrencyConfig)
+	for _, c := range e.config.Currencies {
+		if c.Address == "" {
+			continue
+		}
+		contracts = append(contracts, c.Address)
+		tokens[strings.ToLower(c.Address)] = c
+		if !contains(signatures, c.TransferSignature) {
+			signatures = append(signatures, c.TransferSignature)
+		}
+	}
+	if len(contracts) == 0 {
+		return nil, nil
+	}
+
+	chunks := receiverTopics(receivers)
+	step := e.logRange()
+
+	var transfers []*Transaction
+	for start := from; start <= to; start += step {
+		end := start + step - 1
+		if end > to {
+			end = to
+		}
+		for _, chunk := range chunks {
+			found, err := logs.GetLogs(&LogFilter{
+				FromBlock: start,
+				ToBlock:   end,
+				Addresses: contracts,
+				Topics:    [][]string{signatures, nil, chunk},
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, l := range found {
+				t, errParse := parseTransferLog(l, tokens[strings.ToLower(l.Address)])
+				if errParse != nil {
+					// ERC-721 transfers share the signature of ERC-20 transfers with an indexed token id, they are skipped
+					continue
+				}
+				transfers = append(transfers, t)
+			}
+		}
+	}
+	return transfers, nil
+}
+
+// parseTransferLog parse an ERC-20 Transfer(address indexed from, address indexed to, uint256 value) log
+func parseTransferLog(l *Log, c *env.CurrencyConfig) (*Transaction, error) {
+	if c == nil {
+		return nil, fmt.Errorf("log %s:%d of unknown contract %s", l.TxHash, l.LogIndex, l.Address)
+	}
+	if l.Removed {
+		return nil, fmt.Errorf("log %s:%d was removed by a reorganization", l.TxHash, l.LogIndex)
+	}
+	if len(l.Topics) != 3 || len(l.Data) != 66 {
+		return nil, fmt.Errorf("log %s:%d is not an ERC-20 transfer", l.TxHash, l.LogIndex)
+	}
+
+	sender, errFrom := hex.DecodeString(strings.TrimPrefix(l.Topics[1], "0x"))
+	receiver, errTo := hex.DecodeString(strings.TrimPrefix(l.Topics[2], "0x"))
+	if errFrom != nil || errTo != nil || len(sender) != 32 || len(receiver) != 32 {
+		return nil, fmt.Errorf("log %s:%d has invalid address topics", l.TxHash, l.LogIndex)
+	}
+	value, err := decodeBig(l.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transaction{
+		From:        parseDataAddr(sender),
+		To:          ToAddress(c.Address),
+		Hash:        l.TxHash,
+		Value:       value,
+		BlockHeight: int(l.BlockNumber),
+		Currency:    c.Name,
+		LogIdx:      strconv.FormatUint(l.LogIndex, 10),
+		Receiver:    parseDataAddr(receiver),
+	}, nil
+}
+
+// logRange number of blocks of each eth_getLogs request
+func (e *Eth) logRange() uint64 {
+	if e.config.LogRange > 0 {
+		return uint64(e.config.LogRange)
+	}
+	return defaultLogRange
+}
+
+// receiverTopics split the receivers into chunks of address topics, each chunk being its own request.
+// Without receivers, the single nil chunk requests the transfers to anyone
+func receiverTopics(receivers []string) [][]string {
+	if len(receivers) == 0 {
+		return [][]string{nil}
+	}
+	var chunks [][]string
+	for start := 0; start < len(receivers); start += maxTopicReceivers {
+		end := start + maxTopicReceivers
+		if end > len(receivers) {
+			end = len(receivers)
+		}
+		var topics []string
+		for _, r := range receivers[start:end] {
+			topics = append(topics, addressTopic(r))
+		}
+		chunks = append(chunks, topics)
+	}
+	return chunks
+}
+
+// addressTopic left pad an address to the 32 bytes of an indexed topic
+func addressTopic(addr string) string {
+	return "0x" + strings.Repeat("0", 24) + strings.ToLower(strings.TrimPrefix(addr, "0x"))
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
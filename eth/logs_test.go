@@ -0,0 +1,60 @@
+package eth
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+)
+
+// word ABI encoding of an unsigned integer
+func word(n int64) string {
+	return fmt.Sprintf("%064x", n)
+}
+
+func TestParseTransferLog(t *testing.T) {
+	usdc := &env.CurrencyConfig{Name: "USDC", Decimals: 6, Address: testAddress("c").String()}
+	from := addressTopic(testAddress("1").String())
+	to := addressTopic(testAddress("2").String())
+	tests := []struct {
+		name  string
+		log   *Log
+		c     *env.CurrencyConfig
+		value int64
+		valid bool
+	}{
+		{"transfer", &Log{Topics: []string{transferSignature, from, to}, Data: "0x" + word(1500000)}, usdc, 1500000, true},
+		{"zero amount", &Log{Topics: []string{transferSignature, from, to}, Data: "0x" + word(0)}, usdc, 0, true},
+		{"unknown contract", &Log{Topics: []string{transferSignature, from, to}, Data: "0x" + word(1)}, nil, 0, false},
+		{"removed by a reorg", &Log{Topics: []string{transferSignature, from, to}, Data: "0x" + word(1), Removed: true}, usdc, 0, false},
+		// the ERC-721 transfers share the signature, with the token id as a fourth topic and no data
+		{"erc-721 transfer", &Log{Topics: []string{transferSignature, from, to, "0x" + word(7)}, Data: "0x"}, usdc, 0, false},
+		{"two words of data", &Log{Topics: []string{transferSignature, from, to}, Data: "0x" + word(1) + word(2)}, usdc, 0, false},
+		{"short address topic", &Log{Topics: []string{transferSignature, from[:40], to}, Data: "0x" + word(1)}, usdc, 0, false},
+		{"invalid data", &Log{Topics: []string{transferSignature, from, to}, Data: "0x" + strings.Repeat("zz", 32)}, usdc, 0, false},
+	}
+	for _, tt := range tests {
+		tt.log.Address = usdc.Address
+		tt.log.TxHash = "0xabc"
+		tt.log.LogIndex = 3
+		tt.log.BlockNumber = 100
+		tx, err := parseTransferLog(tt.log, tt.c)
+		if !tt.valid {
+			if err == nil {
+				t.Errorf("%s: parsed %+v, want an error", tt.name, tx)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if tx.Value.Int64() != tt.value || tx.From != testAddress("1") || tx.Receiver != testAddress("2") || tx.To != testAddress("c") {
+			t.Errorf("%s: transfer of %s from %s to %s of %s", tt.name, tx.Value, tx.From, tx.Receiver, tx.To)
+		}
+		if tx.Currency != "USDC" || tx.LogIdx != "3" || tx.BlockHeight != 100 || tx.Hash != "0xabc" {
+			t.Errorf("%s: transfer %+v", tt.name, tx)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package eth
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Selectors of the ERC-20 metadata functions
+const (
+	nameSelector     string = "0x06fdde03"
+	symbolSelector   string = "0x95d89b41"
+	decimalsSelector string = "0x313ce567"
+)
+
+// CallAPI interface of the providers able to call a contract with eth_call at the given block, the
+// latest one when it is 0
+type CallAPI interface {
+	Call(to string, data string, block uint64) (string, error)
+}
+
+// TokenMetadata name, symbol and decimals of an ERC-20 token, as returned by its contract
+type TokenMetadata struct {
+	Address  Address `json:"address"`
+	Name     string  `json:"name"`
+	Symbol   string  `json:"symbol"`
+	Decimals int     `json:"decimals"`
+}
+
+// TokenMetadata read the name, symbol and decimals of an ERC-20 token from its contract. They never
+// change, so they are read once and cached by the service. Some tokens have no name or symbol, or
+// return them as bytes32, only the decimals are required
+func (e *Eth) TokenMetadata(addr string) (*TokenMetadata, error) {
+	a, err := ParseAddress(addr)
+	if err != nil {
+		return nil, fmt.Errorf("token %s: %v", addr, err)
+	}
+
+	e.tokensMu.Lock()
+	m, ok := e.tokens[a]
+	e.tokensMu.Unlock()
+	if ok {
+		return m, nil
+	}
+
+	caller, ok := e.api.(CallAPI)
+	if !ok {
+		return nil, fmt.Errorf("the provider of %s cannot call contracts", e.config.Chain)
+	}
+
+	res, err := caller.Call(a.String(), decimalsSelector, 0)
+	if err != nil {
+		return nil, fmt.Errorf("decimals of token %s: %v", a, err)
+	}
+	words, err := dataWords(res)
+	if err != nil || len(words) != 1 || !words[0].IsInt64() || words[0].Int64() > 255 {
+		return nil, fmt.Errorf("token %s returned invalid decimals %s", a, res)
+	}
+
+	m = &TokenMetadata{Address: a, Decimals: int(words[0].Int64())}
+	if res, err = caller.Call(a.String(), nameSelector, 0); err == nil {
+		m.Name = decodeABIString(res)
+	}
+	if res, err = caller.Call(a.String(), symbolSelector, 0); err == nil {
+		m.Symbol = decodeABIString(res)
+	}
+
+	e.tokensMu.Lock()
+	e.tokens[a] = m
+	e.tokensMu.Unlock()
+	return m, nil
+}
+
+// VerifyCurrencies check the decimals of the configured tokens against their contracts. A token configured
+// by its contract address alone gets its decimals, its symbol as name and the ERC-20 transfer signature,
+// any other mismatch of decimals is an error since it would scale every balance of the token. The tokens
+// whose contract could not be read, e.g. when the provider is down, are returned unverified: only the
+// ones configured by their address alone cannot be used without their metadata, they are an error
+func (e *Eth) VerifyCurrencies() (unverified []error, err error) {
+	for _, c := range e.config.Currencies {
+		if c.Address == "" {
+			continue
+		}
+		if c.TransferSignature == "" {
+			c.TransferSignature = transferSignature
+		}
+		m, errMeta := e.TokenMetadata(c.Address)
+		if errMeta != nil {
+			if c.Name == "" {
+				return unverified, errMeta
+			}
+			unverified = append(unverified, errMeta)
+			continue
+		}
+
+		if c.Name == "" {
+			if m.Symbol == "" {
+				return unverified, fmt.Errorf("token %s of %s has no symbol, its name must be configured", m.Address, e.config.Chain)
+			}
+			c.Name = m.Symbol
+			c.Decimals = m.Decimals
+		}
+		if c.Decimals != m.Decimals {
+			return unverified, fmt.Errorf("%s of %s is configured with %d decimals but its contract %s has %d", c.Name, e.config.Chain, c.Decimals, m.Address, m.Decimals)
+		}
+	}
+	return unverified, nil
+}
+
+// decodeABIString decode the string returned by a call, ABI encoded as a dynamic string or, for the
+// older tokens, as a bytes32 padded with zeros
+func decodeABIString(res string) string {
+	b, err := hex.DecodeString(strings.TrimPrefix(res, "0x"))
+	if err != nil {
+		return ""
+	}
+	if len(b) == 32 {
+		return strings.TrimRight(string(b), "\x00")
+	}
+	if len(b) < 64 {
+		return ""
+	}
+	offset := new(big.Int).SetBytes(b[:32])
+	if !offset.IsInt64() || offset.Int64() > int64(len(b)-32) {
+		return ""
+	}
+	start := int(offset.Int64())
+	length := new(big.Int).SetBytes(b[start : start+32])
+	if !length.IsInt64() || length.Int64() > int64(len(b)-start-32) {
+		return ""
+	}
+	return string(b[start+32 : start+32+int(length.Int64())])
+}
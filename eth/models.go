@@ -5,29 +5,44 @@ import (
 	"time"
 )
 
-// BlockData structure that contains the header of a block and its transactions
+// BlockData structure that contains the header of a block, its transactions and its NFT transfers
 type BlockData struct {
 	Txs  []*Transaction
+	Nfts []*NftTransfer
 	Meta Header
 }
 
-// Header structure with basic infos of a block
+// Header structure with basic infos of a block. The base fee is nil before london and on the chains
+// without EIP-1559, the miner is the fee recipient since the merge
 type Header struct {
 	Hash        string    `json:"hash"`
+	ParentHash  string    `json:"parent_hash"`
 	Height      int       `json:"height"`
 	LastUpdated time.Time `json:"last_updated"`
 	Time        int       `json:"time"`
-	Nonce       string    `json:"nonce"`
+	BaseFee     *big.Int  `json:"base_fee,omitempty"`
+	GasUsed     uint64    `json:"gas_used"`
+	GasLimit    uint64    `json:"gas_limit"`
+	Miner       Address   `json:"miner"`
 }
 
-// Transaction structure of an ethereum transaction
+// Checkpoints latest finalized and safe blocks of a chain, nil on the chains without them
+type Checkpoints struct {
+	Finalized *Header
+	Safe      *Header
+}
+
+// Transaction structure of an ethereum transaction. The gas price of a mined transaction is the
+// effective one it paid, whatever its type
 type Transaction struct {
-	From        string
-	To          string
+	From        Address
+	To          Address
 	Hash        string
 	Value       *big.Int
 	BlockHeight int
 	Currency    string
 	LogIdx      string
-	Receiver    string
+	Receiver    Address
+	Type        uint8
+	GasPrice    *big.Int
 }
@@ -0,0 +1,203 @@
+package eth
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Standards of the NFT collections
+const (
+	ERC721  string = "erc721"
+	ERC1155 string = "erc1155"
+)
+
+// Signatures of the NFT transfer events. ERC-721 transfers share the signature of ERC-20 transfers,
+// with the token id indexed as a fourth topic
+const (
+	transferSignature       string = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+	transferSingleSignature string = "0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62"
+	transferBatchSignature  string = "0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb"
+)
+
+// wordLength number of hexadecimal characters of a 32 bytes word of the data of a log
+const wordLength int = 64
+
+// NftTransfer transfer of an amount of a token of an ERC-721 or ERC-1155 collection. The amount of an
+// ERC-721 token is always 1. Each token of an ERC-1155 batch is its own transfer, its log index is
+// followed by its position in the batch
+type NftTransfer struct {
+	Contract    Address
+	Collection  string
+	Standard    string
+	TokenID     *big.Int
+	Amount      *big.Int
+	From        Address
+	To          Address
+	Hash        string
+	BlockHeight int
+	LogIdx      string
+}
+
+// NftTransfers find the ERC-721 and ERC-1155 transfers in the given range of blocks, of the configured
+// collections or of any collection when none is configured. When receivers are given, only the transfers
+// to them are requested
+func (e *Eth) NftTransfers(from uint64, to uint64, receivers []string) ([]*NftTransfer, error) {
+	logs, ok := e.api.(LogsAPI)
+	if !ok {
+		return nil, fmt.Errorf("the ethereum provider cannot return logs")
+	}
+
+	var contracts []string
+	collections := make(map[string]string)
+	for _, c := range e.config.Nfts.Collections {
+		contracts = append(contracts, c.Address)
+		collections[strings.ToLower(c.Address)] = c.Name
+	}
+
+	chunks := receiverTopics(receivers)
+	step := e.logRange()
+
+	var transfers []*NftTransfer
+	for start := from; start <= to; start += step {
+		end := start + step - 1
+		if end > to {
+			end = to
+		}
+		for _, chunk := range chunks {
+			// the receiver is the third topic of the ERC-721 transfers and the fourth of the ERC-1155 ones
+			filters := []*LogFilter{
+				{FromBlock: start, ToBlock: end, Addresses: contracts, Topics: [][]string{{transferSignature}, nil, chunk}},
+				{FromBlock: start, ToBlock: end, Addresses: contracts, Topics: [][]string{{transferSingleSignature, transferBatchSignature}, nil, nil, chunk}},
+			}
+			for _, filter := range filters {
+				found, err := logs.GetLogs(filter)
+				if err != nil {
+					return nil, err
+				}
+				for _, l := range found {
+					ts, errParse := parseNftLog(l)
+					if errParse != nil {
+						// ERC-20 transfers share the signature of ERC-721 transfers without the indexed token id, they are skipped
+						continue
+					}
+					for _, t := range ts {
+						t.Collection = collections[strings.ToLower(l.Address)]
+					}
+					transfers = append(transfers, ts...)
+				}
+			}
+		}
+	}
+	return transfers, nil
+}
+
+// parseNftLog parse an ERC-721 Transfer(address indexed from, address indexed to, uint256 indexed tokenId),
+// an ERC-1155 TransferSingle(address indexed operator, address indexed from, address indexed to, uint256 id,
+// uint256 value) or TransferBatch(address indexed operator, address indexed from, address indexed to,
+// uint256[] ids, uint256[] values) log. The transfers of a zero amount are skipped
+func parseNftLog(l *Log) ([]*NftTransfer, error) {
+	if l.Removed {
+		return nil, fmt.Errorf("log %s:%d was removed by a reorganization", l.TxHash, l.LogIndex)
+	}
+	if len(l.Topics) != 4 {
+		return nil, fmt.Errorf("log %s:%d is not an NFT transfer", l.TxHash, l.LogIndex)
+	}
+	topics := make([][]byte, len(l.Topics))
+	for i, t := range l.Topics {
+		b, err := hex.DecodeString(strings.TrimPrefix(t, "0x"))
+		if err != nil || len(b) != 32 {
+			return nil, fmt.Errorf("log %s:%d has invalid topics", l.TxHash, l.LogIndex)
+		}
+		topics[i] = b
+	}
+	words, err := dataWords(l.Data)
+	if err != nil {
+		return nil, fmt.Errorf("log %s:%d has invalid data: %v", l.TxHash, l.LogIndex, err)
+	}
+
+	transfer := func(standard string, from []byte, to []byte, id *big.Int, amount *big.Int, logIdx string) *NftTransfer {
+		return &NftTransfer{
+			Contract:    ToAddress(l.Address),
+			Standard:    standard,
+			TokenID:     id,
+			Amount:      amount,
+			From:        parseDataAddr(from),
+			To:          parseDataAddr(to),
+			Hash:        l.TxHash,
+			BlockHeight: int(l.BlockNumber),
+			LogIdx:      logIdx,
+		}
+	}
+	logIdx := strconv.FormatUint(l.LogIndex, 10)
+
+	switch strings.ToLower(l.Topics[0]) {
+	case transferSignature:
+		if len(words) != 0 {
+			return nil, fmt.Errorf("log %s:%d is not an ERC-721 transfer", l.TxHash, l.LogIndex)
+		}
+		id := new(big.Int).SetBytes(topics[3])
+		return []*NftTransfer{transfer(ERC721, topics[1], topics[2], id, big.NewInt(1), logIdx)}, nil
+
+	case transferSingleSignature:
+		if len(words) != 2 {
+			return nil, fmt.Errorf("log %s:%d is not an ERC-1155 single transfer", l.TxHash, l.LogIndex)
+		}
+		if words[1].Sign() == 0 {
+			return nil, nil
+		}
+		return []*NftTransfer{transfer(ERC1155, topics[2], topics[3], words[0], words[1], logIdx)}, nil
+
+	case transferBatchSignature:
+		ids, errIds := dataArray(words, 0)
+		amounts, errAmounts := dataArray(words, 1)
+		if errIds != nil || errAmounts != nil || len(ids) != len(amounts) {
+			return nil, fmt.Errorf("log %s:%d is not an ERC-1155 batch transfer", l.TxHash, l.LogIndex)
+		}
+		var transfers []*NftTransfer
+		for i := range ids {
+			if amounts[i].Sign() == 0 {
+				continue
+			}
+			transfers = append(transfers, transfer(ERC1155, topics[2], topics[3], ids[i], amounts[i], logIdx+":"+strconv.Itoa(i)))
+		}
+		return transfers, nil
+	}
+	return nil, fmt.Errorf("log %s:%d is not an NFT transfer", l.TxHash, l.LogIndex)
+}
+
+// dataWords split the data of a log into its 32 bytes words
+func dataWords(data string) ([]*big.Int, error) {
+	data = strings.TrimPrefix(data, "0x")
+	if len(data)%wordLength != 0 {
+		return nil, fmt.Errorf("data of %d characters is not made of 32 bytes words", len(data))
+	}
+	words := make([]*big.Int, 0, len(data)/wordLength)
+	for start := 0; start < len(data); start += wordLength {
+		w, ok := new(big.Int).SetString(data[start:start+wordLength], 16)
+		if !ok {
+			return nil, ErrSyntax
+		}
+		words = append(words, w)
+	}
+	return words, nil
+}
+
+// dataArray decode the dynamic uint256 array of the given parameter of ABI encoded words, its head
+// word being the offset in bytes of its length followed by its items
+func dataArray(words []*big.Int, param int) ([]*big.Int, error) {
+	if param >= len(words) || !words[param].IsInt64() || words[param].Int64()%32 != 0 {
+		return nil, ErrSyntax
+	}
+	offset := int(words[param].Int64() / 32)
+	if offset >= len(words) || !words[offset].IsInt64() {
+		return nil, ErrSyntax
+	}
+	length := int(words[offset].Int64())
+	if length < 0 || length > len(words)-offset-1 {
+		return nil, ErrSyntax
+	}
+	return words[offset+1 : offset+1+length], nil
+}
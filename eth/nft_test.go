@@ -0,0 +1,105 @@
+package eth
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestParseNftLog(t *testing.T) {
+	operator := addressTopic(testAddress("3").String())
+	from := addressTopic(testAddress("1").String())
+	to := addressTopic(testAddress("2").String())
+	// ids [7, 8] and values [1, 0] of a batch, at the offsets 0x40 and 0xa0
+	batch := "0x" + word(64) + word(160) + word(2) + word(7) + word(8) + word(2) + word(1) + word(0)
+
+	type transfer struct {
+		standard string
+		id       int64
+		amount   int64
+		logIdx   string
+	}
+	tests := []struct {
+		name      string
+		log       *Log
+		transfers []transfer
+		valid     bool
+	}{
+		{"erc-721", &Log{Topics: []string{transferSignature, from, to, "0x" + word(7)}, Data: "0x"}, []transfer{{ERC721, 7, 1, "5"}}, true},
+		// the ERC-20 transfers share the signature, without the token id topic
+		{"erc-20 transfer", &Log{Topics: []string{transferSignature, from, to}, Data: "0x" + word(7)}, nil, false},
+		{"erc-721 with data", &Log{Topics: []string{transferSignature, from, to, "0x" + word(7)}, Data: "0x" + word(1)}, nil, false},
+		{"single", &Log{Topics: []string{transferSingleSignature, operator, from, to}, Data: "0x" + word(9) + word(4)}, []transfer{{ERC1155, 9, 4, "5"}}, true},
+		{"single of zero", &Log{Topics: []string{transferSingleSignature, operator, from, to}, Data: "0x" + word(9) + word(0)}, nil, true},
+		{"batch skipping zero amounts", &Log{Topics: []string{transferBatchSignature, operator, from, to}, Data: batch}, []transfer{{ERC1155, 7, 1, "5:0"}}, true},
+		{"batch offset out of the data", &Log{Topics: []string{transferBatchSignature, operator, from, to}, Data: "0x" + word(64) + word(320) + word(0)}, nil, false},
+		{"batch offset not aligned", &Log{Topics: []string{transferBatchSignature, operator, from, to}, Data: "0x" + word(65) + word(96) + word(0) + word(0)}, nil, false},
+		{"batch length beyond the data", &Log{Topics: []string{transferBatchSignature, operator, from, to}, Data: "0x" + word(64) + word(96) + word(5) + word(0)}, nil, false},
+		{"batch of different lengths", &Log{Topics: []string{transferBatchSignature, operator, from, to}, Data: "0x" + word(64) + word(128) + word(1) + word(7) + word(0)}, nil, false},
+		{"removed by a reorg", &Log{Topics: []string{transferSignature, from, to, "0x" + word(7)}, Data: "0x", Removed: true}, nil, false},
+		{"invalid topic", &Log{Topics: []string{transferSignature, from, to, "0x07"}, Data: "0x"}, nil, false},
+		{"unknown event", &Log{Topics: []string{"0x" + word(1), from, to, "0x" + word(7)}, Data: "0x"}, nil, false},
+		{"data not made of words", &Log{Topics: []string{transferSingleSignature, operator, from, to}, Data: "0x" + word(9) + "01"}, nil, false},
+	}
+	for _, tt := range tests {
+		tt.log.Address = testAddress("d").String()
+		tt.log.TxHash = "0xabc"
+		tt.log.LogIndex = 5
+		ts, err := parseNftLog(tt.log)
+		if !tt.valid {
+			if err == nil {
+				t.Errorf("%s: parsed %d transfers, want an error", tt.name, len(ts))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(ts) != len(tt.transfers) {
+			t.Errorf("%s: %d transfers, want %d", tt.name, len(ts), len(tt.transfers))
+			continue
+		}
+		for i, want := range tt.transfers {
+			got := ts[i]
+			if got.Standard != want.standard || got.TokenID.Int64() != want.id || got.Amount.Int64() != want.amount || got.LogIdx != want.logIdx {
+				t.Errorf("%s: transfer %s of %s of token %s at %s, want %s of %d of token %d at %s", tt.name, got.Standard, got.Amount, got.TokenID, got.LogIdx, want.standard, want.amount, want.id, want.logIdx)
+			}
+			if got.From != testAddress("1") || got.To != testAddress("2") || got.Contract != testAddress("d") {
+				t.Errorf("%s: transfer from %s to %s of %s", tt.name, got.From, got.To, got.Contract)
+			}
+		}
+	}
+}
+
+func TestDataArray(t *testing.T) {
+	words := func(ns ...int64) []*big.Int {
+		var w []*big.Int
+		for _, n := range ns {
+			w = append(w, big.NewInt(n))
+		}
+		return w
+	}
+	huge, _ := new(big.Int).SetString(strings.Repeat("f", 64), 16)
+	tests := []struct {
+		name  string
+		words []*big.Int
+		param int
+		items int
+		valid bool
+	}{
+		{"empty array", words(32, 0), 0, 0, true},
+		{"two items", words(64, 0, 2, 5, 6), 0, 2, true},
+		{"missing parameter", words(32, 0), 2, 0, false},
+		{"offset past the end", words(96, 0), 0, 0, false},
+		{"length past the end", words(32, 3, 1), 0, 0, false},
+		{"huge offset", append([]*big.Int{huge}, words(0)...), 0, 0, false},
+		{"negative length", words(32, -1), 0, 0, false},
+	}
+	for _, tt := range tests {
+		items, err := dataArray(tt.words, tt.param)
+		if tt.valid != (err == nil) || len(items) != tt.items {
+			t.Errorf("%s: %d items, %v", tt.name, len(items), err)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package eth
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// replacementBump increase in percent of the fees of a replacement transaction
+	replacementBump int64 = 15
+	// minReplacementBump increase in percent below which the nodes refuse to replace a transaction
+	minReplacementBump int64 = 10
+)
+
+// PendingTx transaction broadcast by a sender and not mined yet. A stuck transaction is replaced by one of
+// the same nonce with higher fees, the hashes of all its versions are kept since any of them can be mined
+type PendingTx struct {
+	Tx     *UnsignedTx
+	Hashes []string
+	SentAt time.Time
+}
+
+// Hash hash of the latest version of the transaction
+func (p *PendingTx) Hash() string {
+	return p.Hashes[len(p.Hashes)-1]
+}
+
+// NonceState pending transactions of an address, by nonce
+type NonceState struct {
+	Address Address
+	Pending []*PendingTx
+}
+
+// NonceStore persistence of the pending transactions of the addresses, the state of an address without
+// any being empty. An update loads the state of an address and saves it once the update returns without
+// error, atomically: the senders of several processes never assign the same nonce twice
+type NonceStore interface {
+	UpdateNonces(addr Address, update func(state *NonceState) error) error
+}
+
+// TxSender sender of the transactions of the addresses of a signer. It assigns their nonces from the
+// pending transactions it keeps for each address and from the nonces of the node, and replaces the ones
+// that are stuck. The transactions of an address must all go through the same sender
+type TxSender struct {
+	mu     sync.Mutex
+	eth    *Eth
+	signer Signer
+	nonces NonceStore
+}
+
+// NewTxSender create a sender of the transactions of the chain signed by the signer
+func (e *Eth) NewTxSender(signer Signer, nonces NonceStore) *TxSender {
+	return &TxSender{eth: e, signer: signer, nonces: nonces}
+}
+
+// HasKey returns whether the signer of the sender holds the key of an address
+func (s *TxSender) HasKey(addr Address) bool {
+	if k, ok := s.signer.(KeyHolderAPI); ok {
+		return k.HasKey(addr)
+	}
+	return true
+}
+
+// Send build a transaction, sign it with the next nonce of its sender and broadcast it. It is only kept
+// as pending once broadcast, the nonce of a transaction that could not be is reused by the next one
+func (s *TxSender) Send(req *TxRequest) (*PendingTx, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mined, pending, err := s.nodeNonces(req.From)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.eth.BuildTransaction(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var p *PendingTx
+	// a retried update broadcasts again, the same transaction with the same nonce is already known
+	err = s.nonces.UpdateNonces(req.From, func(state *NonceState) error {
+		p = nil
+		tx.Nonce = nextNonce(state, mined, pending)
+		signed, errSend := s.broadcast(req.From, tx)
+		if errSend != nil {
+			return errSend
+		}
+		p = &PendingTx{Tx: tx, Hashes: []string{signed.Hash}, SentAt: time.Now()}
+		state.Pending = append(state.Pending, p)
+		sort.Slice(state.Pending, func(i, j int) bool { return state.Pending[i].Tx.Nonce < state.Pending[j].Tx.Nonce })
+		return nil
+	})
+	if err != nil && p != nil {
+		return nil, fmt.Errorf("transaction %s of %s was sent but not saved: %v", p.Hash(), req.From, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ReplaceStuck replace the pending transactions of an address sent for longer than the given duration,
+// with the fees raised by the replacement bump and at least to the suggested ones, up to the max gas price
+// when it is set, e.g. to the price a sweep budgeted its gas at. A replacement needs the sender to afford
+// the higher fees, the transaction stays pending as it was when it cannot be sent or when the max gas price
+// leaves no room for the bump the nodes require
+func (s *TxSender) ReplaceStuck(addr Address, after time.Duration, maxGasPrice *big.Int) ([]*PendingTx, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mined, pending, err := s.nodeNonces(addr)
+	if err != nil {
+		return nil, err
+	}
+	var replaced []*PendingTx
+	var errReplace error
+	err = s.nonces.UpdateNonces(addr, func(state *NonceState) error {
+		replaced, errReplace = nil, nil
+		nextNonce(state, mined, pending)
+		var stuck []*PendingTx
+		for _, p := range state.Pending {
+			if time.Since(p.SentAt) >= after {
+				stuck = append(stuck, p)
+			}
+		}
+		if len(stuck) == 0 {
+			return nil
+		}
+		fees, errFees := s.eth.SuggestFees()
+		if errFees != nil {
+			return errFees
+		}
+
+		for _, p := range stuck {
+			tx := *p.Tx
+			if !bumpFees(&tx, fees, maxGasPrice) {
+				if errReplace == nil {
+					errReplace = fmt.Errorf("transaction %s of %s cannot be replaced below the max gas price %s", p.Hash(), addr, maxGasPrice)
+				}
+				continue
+			}
+			signed, errSend := s.broadcast(addr, &tx)
+			if errSend != nil {
+				if errReplace == nil {
+					errReplace = fmt.Errorf("replacement of transaction %s of %s: %v", p.Hash(), addr, errSend)
+				}
+				continue
+			}
+			p.Tx = &tx
+			p.Hashes = append(p.Hashes, signed.Hash)
+			p.SentAt = time.Now()
+			replaced = append(replaced, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return replaced, errReplace
+}
+
+// nodeNonces returns the nonce of the next transaction of an address to be mined and the pending nonce of
+// the node, which counts the transactions in its mempool up to the first gap
+func (s *TxSender) nodeNonces(addr Address) (uint64, uint64, error) {
+	t, err := s.eth.txAPI()
+	if err != nil {
+		return 0, 0, err
+	}
+	mined, err := t.NonceAt(addr.String(), false)
+	if err != nil {
+		return 0, 0, err
+	}
+	pending, err := t.NonceAt(addr.String(), true)
+	if err != nil {
+		return 0, 0, err
+	}
+	return mined, pending, nil
+}
+
+// nextNonce drop the mined transactions of the pending ones of an address and returns the next nonce. It is
+// the first one that is neither pending for the sender nor below the pending nonce of the node: a nonce of
+// a gap is reused, a nonce taken by a transaction sent by someone else is not
+func nextNonce(state *NonceState, mined uint64, pending uint64) uint64 {
+	used := make(map[uint64]bool)
+	var kept []*PendingTx
+	for _, p := range state.Pending {
+		if p.Tx.Nonce >= mined {
+			kept = append(kept, p)
+			used[p.Tx.Nonce] = true
+		}
+	}
+	state.Pending = kept
+
+	next := mined
+	if pending > next {
+		next = pending
+	}
+	for used[next] {
+		next++
+	}
+	return next
+}
+
+// broadcast sign and broadcast a transaction. A transaction the node already knows was broadcast before,
+// e.g. by a provider that failed to answer
+func (s *TxSender) broadcast(from Address, tx *UnsignedTx) (*SignedTx, error) {
+	signed, err := s.signer.SignTransaction(from, tx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = s.eth.SendRawTransaction(signed.Raw); err != nil {
+		msg := strings.ToLower(err.Error())
+		if !strings.Contains(msg, "already known") && !strings.Contains(msg, "known transaction") {
+			return nil, err
+		}
+	}
+	return signed, nil
+}
+
+// bumpFees raise the fees of a transaction by the replacement bump, and at least to the suggested ones, up
+// to the max gas price when it is set. It returns false, leaving the fees as they were, when the capped
+// fees are not raised enough for the nodes to accept the replacement
+func bumpFees(tx *UnsignedTx, suggested *Fees, max *big.Int) bool {
+	percent := func(fee *big.Int, p int64) *big.Int {
+		raised := new(big.Int).Mul(fee, big.NewInt(100+p))
+		return raised.Div(raised, big.NewInt(100))
+	}
+	bump := func(fee *big.Int, floor *big.Int) *big.Int {
+		raised := percent(fee, replacementBump)
+		if floor != nil && floor.Cmp(raised) > 0 {
+			raised = new(big.Int).Set(floor)
+		}
+		if max != nil && max.Sign() > 0 && raised.Cmp(max) > 0 {
+			raised = new(big.Int).Set(max)
+		}
+		return raised
+	}
+	enough := func(raised *big.Int, fee *big.Int) bool {
+		return raised.Cmp(percent(fee, minReplacementBump)) >= 0
+	}
+
+	if tx.Type == LegacyTxType {
+		price := bump(tx.GasPrice, suggested.Cap())
+		if !enough(price, tx.GasPrice) {
+			return false
+		}
+		tx.GasPrice = price
+		return true
+	}
+	maxFee := bump(tx.MaxFee, suggested.Cap())
+	priority := bump(tx.MaxPriorityFee, suggested.MaxPriorityFee)
+	if priority.Cmp(maxFee) > 0 {
+		priority = new(big.Int).Set(maxFee)
+	}
+	if !enough(maxFee, tx.MaxFee) || !enough(priority, tx.MaxPriorityFee) {
+		return false
+	}
+	tx.MaxFee = maxFee
+	tx.MaxPriorityFee = priority
+	return true
+}
@@ -0,0 +1,92 @@
+package eth
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestBumpFeesLegacy(t *testing.T) {
+	tests := []struct {
+		name      string
+		price     int64
+		suggested int64
+		max       int64
+		bumped    bool
+		want      int64
+	}{
+		{"replacement bump", 100, 50, 0, true, 115},
+		{"suggested price above the bump", 100, 200, 0, true, 200},
+		{"capped at the max", 100, 200, 150, true, 150},
+		{"cap leaving the minimum bump", 100, 50, 110, true, 110},
+		{"cap below the minimum bump", 100, 50, 109, false, 100},
+		{"already at the max", 132, 50, 132, false, 132},
+	}
+	for _, tt := range tests {
+		tx := &UnsignedTx{Type: LegacyTxType, Fees: Fees{GasPrice: big.NewInt(tt.price)}}
+		var max *big.Int
+		if tt.max > 0 {
+			max = big.NewInt(tt.max)
+		}
+		bumped := bumpFees(tx, &Fees{GasPrice: big.NewInt(tt.suggested)}, max)
+		if bumped != tt.bumped || tx.GasPrice.Int64() != tt.want {
+			t.Errorf("%s: bumped %v to %s, want %v to %d", tt.name, bumped, tx.GasPrice, tt.bumped, tt.want)
+		}
+	}
+}
+
+func TestBumpFeesDynamic(t *testing.T) {
+	tx := &UnsignedTx{Type: DynamicFeeTxType, Fees: Fees{MaxFee: big.NewInt(1000), MaxPriorityFee: big.NewInt(100)}}
+	if !bumpFees(tx, &Fees{MaxFee: big.NewInt(900), MaxPriorityFee: big.NewInt(200)}, nil) {
+		t.Fatal("fees should be bumped")
+	}
+	if tx.MaxFee.Int64() != 1150 || tx.MaxPriorityFee.Int64() != 200 {
+		t.Errorf("bumped to %s and %s, want 1150 and 200", tx.MaxFee, tx.MaxPriorityFee)
+	}
+
+	// the priority fee never exceeds the capped max fee
+	tx = &UnsignedTx{Type: DynamicFeeTxType, Fees: Fees{MaxFee: big.NewInt(1000), MaxPriorityFee: big.NewInt(1000)}}
+	if !bumpFees(tx, &Fees{MaxFee: big.NewInt(900), MaxPriorityFee: big.NewInt(2000)}, big.NewInt(1120)) {
+		t.Fatal("fees should be bumped")
+	}
+	if tx.MaxFee.Int64() != 1120 || tx.MaxPriorityFee.Int64() != 1120 {
+		t.Errorf("bumped to %s and %s, want 1120 and 1120", tx.MaxFee, tx.MaxPriorityFee)
+	}
+
+	// a cap leaving the max fee below the minimum bump leaves the transaction as it was
+	tx = &UnsignedTx{Type: DynamicFeeTxType, Fees: Fees{MaxFee: big.NewInt(1000), MaxPriorityFee: big.NewInt(100)}}
+	if bumpFees(tx, &Fees{MaxFee: big.NewInt(900), MaxPriorityFee: big.NewInt(100)}, big.NewInt(1050)) {
+		t.Errorf("fees bumped by 5%%")
+	}
+	if tx.MaxFee.Int64() != 1000 || tx.MaxPriorityFee.Int64() != 100 {
+		t.Errorf("fees changed to %s and %s", tx.MaxFee, tx.MaxPriorityFee)
+	}
+}
+
+func TestNextNonce(t *testing.T) {
+	pendingTx := func(nonce uint64) *PendingTx {
+		return &PendingTx{Tx: &UnsignedTx{Nonce: nonce}, Hashes: []string{"0x"}}
+	}
+	tests := []struct {
+		name    string
+		pending []uint64
+		mined   uint64
+		node    uint64
+		want    uint64
+		kept    int
+	}{
+		{"no pending transaction", nil, 5, 5, 5, 0},
+		{"mined ones dropped", []uint64{3, 4}, 5, 5, 5, 0},
+		{"after the pending ones", []uint64{5, 6}, 5, 5, 7, 2},
+		{"gap reused", []uint64{5, 7}, 5, 5, 6, 2},
+		{"nonce of the mempool of the node", []uint64{5}, 5, 8, 8, 1},
+	}
+	for _, tt := range tests {
+		state := &NonceState{}
+		for _, n := range tt.pending {
+			state.Pending = append(state.Pending, pendingTx(n))
+		}
+		if got := nextNonce(state, tt.mined, tt.node); got != tt.want || len(state.Pending) != tt.kept {
+			t.Errorf("%s: next nonce %d with %d pending, want %d with %d", tt.name, got, len(state.Pending), tt.want, tt.kept)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package eth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcec"
+	"golang.org/x/crypto/sha3"
+)
+
+// Signer holder of the keys of the addresses sending transactions, the deposit addresses and the gas
+// station. The keys never leave it, it only returns the signed transactions
+type Signer interface {
+	SignTransaction(from Address, tx *UnsignedTx) (*SignedTx, error)
+}
+
+// KeyHolderAPI interface of the signers able to tell the addresses they hold a key for. A signer without it
+// is assumed to sign for any address
+type KeyHolderAPI interface {
+	HasKey(addr Address) bool
+}
+
+// KeystoreSigner signer of the keys of a directory of encrypted keystore files sharing a passphrase. The
+// files are indexed by address when the signer is created and each key is decrypted the first time it
+// signs, its derivation being slow on purpose
+type KeystoreSigner struct {
+	mu         sync.Mutex
+	passphrase string
+	files      map[Address]string
+	keys       map[Address]*btcec.PrivateKey
+}
+
+// NewKeystoreSigner create a signer of the keystore files of a directory
+func NewKeystoreSigner(dir string, passphrase string) (*KeystoreSigner, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &KeystoreSigner{
+		passphrase: passphrase,
+		files:      make(map[Address]string),
+		keys:       make(map[Address]*btcec.PrivateKey),
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, errRead := ioutil.ReadFile(path)
+		if errRead != nil {
+			return nil, errRead
+		}
+		var k keystoreFile
+		if errJSON := json.Unmarshal(data, &k); errJSON != nil || k.Address == "" {
+			continue
+		}
+		addr, errAddr := ParseAddress("0x" + strings.TrimPrefix(k.Address, "0x"))
+		if errAddr != nil {
+			return nil, fmt.Errorf("keystore %s: %v", entry.Name(), errAddr)
+		}
+		s.files[addr] = path
+	}
+	return s, nil
+}
+
+// Addresses returns the addresses of the keys of the signer
+func (s *KeystoreSigner) Addresses() []Address {
+	var addresses []Address
+	for a := range s.files {
+		addresses = append(addresses, a)
+	}
+	return addresses
+}
+
+// HasKey returns whether the keystore holds a file for the address
+func (s *KeystoreSigner) HasKey(addr Address) bool {
+	_, ok := s.files[addr]
+	return ok
+}
+
+// SignTransaction sign a transaction with the key of its sender
+func (s *KeystoreSigner) SignTransaction(from Address, tx *UnsignedTx) (*SignedTx, error) {
+	key, err := s.key(from)
+	if err != nil {
+		return nil, err
+	}
+	return signTransaction(key, tx)
+}
+
+// key returns the key of an address, decrypted once. The address in the file is checked against the key,
+// the file could have been renamed or edited
+func (s *KeystoreSigner) key(addr Address) (*btcec.PrivateKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.keys[addr]; ok {
+		return key, nil
+	}
+	path, ok := s.files[addr]
+	if !ok {
+		return nil, fmt.Errorf("no key for %s in the keystore", addr)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := DecryptKeystore(data, s.passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if KeyAddress(key) != addr {
+		return nil, fmt.Errorf("the key of the keystore of %s belongs to %s", addr, KeyAddress(key))
+	}
+	s.keys[addr] = key
+	return key, nil
+}
+
+// LocalTestSigner signer of the tests and of the dry runs, with keys held in memory. It signs with the key
+// added for an address, or else with a key derived from the address so that any sweep can be dry run:
+// those transactions are well formed but their sender is not the address, no node would accept them.
+// It keeps the transactions it signs
+type LocalTestSigner struct {
+	mu     sync.Mutex
+	keys   map[Address]*btcec.PrivateKey
+	Signed []*UnsignedTx
+}
+
+// NewLocalTestSigner create a local test signer of the given keys
+func NewLocalTestSigner(keys ...*btcec.PrivateKey) *LocalTestSigner {
+	s := &LocalTestSigner{keys: make(map[Address]*btcec.PrivateKey)}
+	for _, k := range keys {
+		s.keys[KeyAddress(k)] = k
+	}
+	return s
+}
+
+// NewKey generate a key held by the signer and returns its address
+func (s *LocalTestSigner) NewKey() (Address, error) {
+	key, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addr := KeyAddress(key)
+	s.keys[addr] = key
+	return addr, nil
+}
+
+// SignTransaction sign a transaction with the key of its sender, or with the key derived from its address
+func (s *LocalTestSigner) SignTransaction(from Address, tx *UnsignedTx) (*SignedTx, error) {
+	s.mu.Lock()
+	key, ok := s.keys[from]
+	if !ok {
+		sha := sha3.NewLegacyKeccak256()
+		sha.Write([]byte(from.String()))
+		key, _ = btcec.PrivKeyFromBytes(btcec.S256(), sha.Sum(nil))
+	}
+	cp := *tx
+	s.Signed = append(s.Signed, &cp)
+	s.mu.Unlock()
+	return signTransaction(key, tx)
+}
+
+// signTransaction sign the hash of a transaction with a recoverable signature, whose S is the low one
+func signTransaction(key *btcec.PrivateKey, tx *UnsignedTx) (*SignedTx, error) {
+	hash, err := tx.SigningHash()
+	if err != nil {
+		return nil, err
+	}
+	compact, err := btcec.SignCompact(btcec.S256(), key, hash, false)
+	if err != nil {
+		return nil, err
+	}
+	// the compact signature is the recovery id plus 27 followed by r and s
+	sig := append(compact[1:], compact[0]-27)
+	return tx.Encode(sig)
+}
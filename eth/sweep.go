@@ -0,0 +1,320 @@
+package eth
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// Kinds of the steps of a sweep. The forwarders are deployed and flushed by the gas station
+const (
+	SweepTopUp  string = "top_up"
+	SweepToken  string = "token"
+	SweepEther  string = "ether"
+	SweepDeploy string = "deploy"
+	SweepFlush  string = "flush"
+)
+
+// Statuses of the steps of a sweep. A planned step is sent once the steps it depends on are mined, and
+// skipped when one of them failed
+const (
+	SweepPlanned string = "planned"
+	SweepSent    string = "sent"
+	SweepMined   string = "mined"
+	SweepFailed  string = "failed"
+	SweepSkipped string = "skipped"
+)
+
+// Statuses of the sweeps, running until each of their steps is mined, failed or skipped. A sweep with a
+// failed step is failed once the others are done
+const (
+	SweepRunning string = "running"
+	SweepDone    string = "done"
+)
+
+const (
+	// etherTransferGas gas of a transfer of ether to an address without code
+	etherTransferGas uint64 = 21000
+	// defaultTokenGasLimit gas of each token transfer when the config does not set one
+	defaultTokenGasLimit uint64 = 100000
+	// balanceOfSelector selector of the ERC-20 balanceOf(address) function
+	balanceOfSelector string = "0x70a08231"
+	// sweepReplacements number of replacements of a stuck transfer the gas of a sweep is budgeted for
+	sweepReplacements int = 2
+)
+
+// GasPriceAPI interface of the providers able to return the current gas price
+type GasPriceAPI interface {
+	GasPrice() (*big.Int, error)
+}
+
+// SweepAccount deposit address of an account, with its balances in base units by currency name. A
+// forwarder is flushed instead of swept, once it is deployed. An address without key in the signer is
+// not swept, e.g. a forwarder of another chain
+type SweepAccount struct {
+	UID       string
+	Address   Address
+	Balances  map[string]*big.Int
+	Forwarder bool
+	Deployed  bool
+	Keyless   bool
+}
+
+// SweepStep transfer of a sweep, from a deposit address to the hot wallet or, for a top-up, from the gas
+// station to a deposit address. The contract is set for the token transfers. The deployments and flushes
+// of the forwarders are calls of the gas station with their data, to the factory and to the forwarders
+type SweepStep struct {
+	ID        string
+	Kind      string
+	UID       string
+	From      Address
+	To        Address
+	Currency  string
+	Contract  Address
+	Amount    *big.Int
+	Data      string
+	GasLimit  uint64
+	GasPrice  *big.Int
+	DependsOn []string
+}
+
+// SweepPlan transfers of a sweep of the balances confirmed at its height: the top-ups of the gas station
+// and the deployments of the forwarders first, then the token transfers and the flushes waiting for them,
+// then the remaining ether of each address
+type SweepPlan struct {
+	Height   uint64
+	GasPrice *big.Int
+	Steps    []*SweepStep
+}
+
+// SweepBudgetPrice highest price per gas a sweep planned at a gas price can pay, once its stuck transfers
+// have been replaced as many times as budgeted. The top-ups and the ether left for the gas are budgeted at
+// this price, the transfers are sent at the planned one and only their replacements go above it
+func SweepBudgetPrice(gasPrice *big.Int) *big.Int {
+	budget := new(big.Int).Set(gasPrice)
+	for i := 0; i < sweepReplacements; i++ {
+		budget.Mul(budget, big.NewInt(100+replacementBump))
+		budget.Div(budget, big.NewInt(100))
+	}
+	return budget
+}
+
+// GasPrice get the current gas price in wei
+func (e *Eth) GasPrice() (*big.Int, error) {
+	g, ok := e.api.(GasPriceAPI)
+	if !ok {
+		return nil, fmt.Errorf("the provider of %s cannot return the gas price", e.config.Chain)
+	}
+	return g.GasPrice()
+}
+
+// LoadSweepBalances set the balances of the deposit addresses at the given height, in ether and in each
+// configured token
+func (e *Eth) LoadSweepBalances(accounts []*SweepAccount, height uint64) error {
+	addresses := make([]string, len(accounts))
+	for i, a := range accounts {
+		addresses[i] = a.Address.String()
+		a.Balances = make(map[string]*big.Int)
+	}
+	balances, errs, err := e.GetBalances(addresses, height)
+	if err != nil {
+		return err
+	}
+	native := e.config.Currencies[0].Name
+	for i, a := range accounts {
+		if errs[i] != nil {
+			return fmt.Errorf("balance of %s: %v", a.Address, errs[i])
+		}
+		a.Balances[native] = balances[i]
+	}
+
+	// the balanceOf calls of every token and account at once
+	type tokenBalance struct {
+		currency string
+		account  *SweepAccount
+	}
+	var calls []*ContractCall
+	var owners []tokenBalance
+	for _, c := range e.config.Currencies[1:] {
+		if c.Address == "" {
+			continue
+		}
+		for _, a := range accounts {
+			calls = append(calls, &ContractCall{To: c.Address, Data: balanceOfSelector + addressTopic(a.Address.String())[2:]})
+			owners = append(owners, tokenBalance{currency: c.Name, account: a})
+		}
+	}
+	if len(calls) > 0 {
+		results, callErrs, errCalls := e.Calls(calls, height)
+		if errCalls != nil {
+			return errCalls
+		}
+		for i, o := range owners {
+			if callErrs[i] != nil {
+				return fmt.Errorf("%s balance of %s: %v", o.currency, o.account.Address, callErrs[i])
+			}
+			words, errWords := dataWords(results[i])
+			if errWords != nil || len(words) != 1 {
+				return fmt.Errorf("%s balance of %s is invalid: %s", o.currency, o.account.Address, results[i])
+			}
+			o.account.Balances[o.currency] = words[0]
+		}
+	}
+
+	// a forwarder deployed after the height must not be deployed again
+	for _, a := range accounts {
+		if !a.Forwarder {
+			continue
+		}
+		if a.Deployed, err = e.ForwarderDeployed(a.Address); err != nil {
+			return fmt.Errorf("code of the forwarder %s: %v", a.Address, err)
+		}
+	}
+	return nil
+}
+
+// PlanSweep plan the transfers to the hot wallet of the balances above the thresholds of the config. Each
+// token transfer needs gas, the gas station tops up the addresses without enough ether to pay it, and the
+// ether left once the gas of all the transfers of an address is paid is swept last. The gas is budgeted
+// at the sweep budget price, so that the stuck transfers can still pay for their replacements
+func (e *Eth) PlanSweep(accounts []*SweepAccount, height uint64, gasPrice *big.Int) (*SweepPlan, error) {
+	sc := e.config.Sweep
+	if sc == nil {
+		return nil, fmt.Errorf("no sweep configured for %s", e.config.Chain)
+	}
+	hot, err := ParseAddress(sc.HotWallet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hot wallet %s: %v", sc.HotWallet, err)
+	}
+	station, errStation := ParseAddress(e.config.GasStation)
+	tokenGas := defaultTokenGasLimit
+	if sc.TokenGasLimit > 0 {
+		tokenGas = uint64(sc.TokenGasLimit)
+	}
+	budget := SweepBudgetPrice(gasPrice)
+	tokenFee := new(big.Int).Mul(new(big.Int).SetUint64(tokenGas), budget)
+	etherFee := new(big.Int).Mul(new(big.Int).SetUint64(etherTransferGas), budget)
+
+	sorted := append([]*SweepAccount{}, accounts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Address < sorted[j].Address })
+
+	plan := &SweepPlan{Height: height, GasPrice: gasPrice}
+	var topUps, tokens, ethers []*SweepStep
+	for _, a := range sorted {
+		if a.Address == hot || a.Address == station {
+			continue
+		}
+		if a.Forwarder {
+			if errStation != nil {
+				return nil, fmt.Errorf("the forwarder %s needs a valid gas station: %v", a.Address, errStation)
+			}
+			deploy, flushes, errFwd := e.planForwarder(a, station, gasPrice)
+			if errFwd != nil {
+				return nil, errFwd
+			}
+			if deploy != nil {
+				topUps = append(topUps, deploy)
+			}
+			tokens = append(tokens, flushes...)
+			continue
+		}
+		// its transfers could not be signed, a top-up would be lost
+		if a.Keyless {
+			continue
+		}
+
+		var transfers []*SweepStep
+		for _, c := range e.config.Currencies[1:] {
+			threshold, ok := e.sweepThreshold(c.Name, c.Decimals)
+			amount := a.Balances[c.Name]
+			if c.Address == "" || !ok || amount == nil || amount.Sign() <= 0 || amount.Cmp(threshold) < 0 {
+				continue
+			}
+			transfers = append(transfers, &SweepStep{
+				ID:       sweepStepID(SweepToken, a.Address, c.Name),
+				Kind:     SweepToken,
+				UID:      a.UID,
+				From:     a.Address,
+				To:       hot,
+				Currency: c.Name,
+				Contract: ToAddress(c.Address),
+				Amount:   amount,
+				GasLimit: tokenGas,
+				GasPrice: gasPrice,
+			})
+		}
+
+		native := e.config.Currencies[0].Name
+		ether := new(big.Int)
+		if a.Balances[native] != nil {
+			ether.Set(a.Balances[native])
+		}
+		fees := new(big.Int).Mul(tokenFee, big.NewInt(int64(len(transfers))))
+		if len(transfers) > 0 && ether.Cmp(fees) < 0 {
+			if errStation != nil {
+				return nil, fmt.Errorf("the gas of the token sweeps of %s needs a valid gas station: %v", a.Address, errStation)
+			}
+			topUp := &SweepStep{
+				ID:       sweepStepID(SweepTopUp, a.Address, native),
+				Kind:     SweepTopUp,
+				UID:      a.UID,
+				From:     station,
+				To:       a.Address,
+				Currency: native,
+				Amount:   new(big.Int).Sub(fees, ether),
+				GasLimit: etherTransferGas,
+				GasPrice: gasPrice,
+			}
+			topUps = append(topUps, topUp)
+			ether.Add(ether, topUp.Amount)
+			for _, t := range transfers {
+				t.DependsOn = []string{topUp.ID}
+			}
+		}
+		tokens = append(tokens, transfers...)
+
+		remaining := ether.Sub(ether, fees).Sub(ether, etherFee)
+		threshold, ok := e.sweepThreshold(native, e.config.Currencies[0].Decimals)
+		if !ok || remaining.Sign() <= 0 || remaining.Cmp(threshold) < 0 {
+			continue
+		}
+		step := &SweepStep{
+			ID:       sweepStepID(SweepEther, a.Address, native),
+			Kind:     SweepEther,
+			UID:      a.UID,
+			From:     a.Address,
+			To:       hot,
+			Currency: native,
+			Amount:   remaining,
+			GasLimit: etherTransferGas,
+			GasPrice: gasPrice,
+		}
+		// sent once the token transfers paid their gas, so that the ether left covers it
+		for _, t := range transfers {
+			step.DependsOn = append(step.DependsOn, t.ID)
+		}
+		ethers = append(ethers, step)
+	}
+
+	plan.Steps = append(plan.Steps, topUps...)
+	plan.Steps = append(plan.Steps, tokens...)
+	plan.Steps = append(plan.Steps, ethers...)
+	return plan, nil
+}
+
+// sweepThreshold minimum balance of a currency that is swept, in base units. Viper lowercases the keys of
+// the thresholds
+func (e *Eth) sweepThreshold(currency string, decimals int) (*big.Int, bool) {
+	t, ok := e.config.Sweep.Thresholds[strings.ToLower(currency)]
+	if !ok {
+		return nil, false
+	}
+	unit := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	threshold, _ := new(big.Float).Mul(big.NewFloat(t), unit).Int(nil)
+	return threshold, true
+}
+
+func sweepStepID(kind string, addr Address, currency string) string {
+	return kind + ":" + addr.String() + ":" + currency
+}
@@ -0,0 +1,177 @@
+package eth
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+)
+
+func testAddress(b string) Address {
+	return ToAddress("0x" + strings.Repeat(b, 40))
+}
+
+func testSweepService() *Eth {
+	return &Eth{
+		config: &env.ChainConfig{
+			Chain:      "eth_test",
+			GasStation: testAddress("5").String(),
+			Currencies: []*env.CurrencyConfig{
+				{Name: "ETH", Decimals: 18},
+				{Name: "USDC", Decimals: 6, Address: testAddress("c").String()},
+			},
+			Sweep: &env.SweepConfig{
+				HotWallet:  testAddress("f").String(),
+				Thresholds: map[string]float64{"eth": 0.05, "usdc": 100},
+			},
+		},
+		tokens: make(map[Address]*TokenMetadata),
+	}
+}
+
+func ether(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e18))
+}
+
+func TestSweepBudgetPrice(t *testing.T) {
+	tests := []struct {
+		price  int64
+		budget int64
+	}{
+		{100, 132}, // 115, then 132.25 truncated
+		{1000000000, 1322500000},
+		{0, 0},
+	}
+	for _, tt := range tests {
+		if got := SweepBudgetPrice(big.NewInt(tt.price)); got.Int64() != tt.budget {
+			t.Errorf("SweepBudgetPrice(%d) = %s, want %d", tt.price, got, tt.budget)
+		}
+	}
+}
+
+func TestPlanSweep(t *testing.T) {
+	e := testSweepService()
+	gasPrice := big.NewInt(10000000000)
+	budget := SweepBudgetPrice(gasPrice)
+	tokenFee := new(big.Int).Mul(big.NewInt(int64(defaultTokenGasLimit)), budget)
+	etherFee := new(big.Int).Mul(big.NewInt(int64(etherTransferGas)), budget)
+
+	accounts := []*SweepAccount{
+		// tokens and ether, the ether pays the gas of the token transfer
+		{UID: "3", Address: testAddress("3"), Balances: map[string]*big.Int{"ETH": ether(1), "USDC": big.NewInt(300000000)}},
+		// tokens without ether, topped up by the gas station
+		{UID: "1", Address: testAddress("1"), Balances: map[string]*big.Int{"ETH": new(big.Int), "USDC": big.NewInt(200000000)}},
+		// ether only
+		{UID: "2", Address: testAddress("2"), Balances: map[string]*big.Int{"ETH": ether(1)}},
+		// below the thresholds
+		{UID: "4", Address: testAddress("4"), Balances: map[string]*big.Int{"ETH": big.NewInt(10000000000000000), "USDC": big.NewInt(50000000)}},
+		// the hot wallet is never swept
+		{UID: "f", Address: testAddress("f"), Balances: map[string]*big.Int{"ETH": ether(5)}},
+	}
+	plan, err := e.PlanSweep(accounts, 100, gasPrice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	steps := make(map[string]*SweepStep)
+	for _, s := range plan.Steps {
+		ids = append(ids, s.ID)
+		steps[s.ID] = s
+		if s.GasPrice.Cmp(gasPrice) != 0 {
+			t.Errorf("%s sent at %s, want the planned price %s", s.ID, s.GasPrice, gasPrice)
+		}
+	}
+	topUp1 := sweepStepID(SweepTopUp, testAddress("1"), "ETH")
+	token1 := sweepStepID(SweepToken, testAddress("1"), "USDC")
+	token3 := sweepStepID(SweepToken, testAddress("3"), "USDC")
+	ether2 := sweepStepID(SweepEther, testAddress("2"), "ETH")
+	ether3 := sweepStepID(SweepEther, testAddress("3"), "ETH")
+	want := []string{topUp1, token1, token3, ether2, ether3}
+	if strings.Join(ids, " ") != strings.Join(want, " ") {
+		t.Fatalf("steps %v, want %v", ids, want)
+	}
+
+	if s := steps[topUp1]; s.From != testAddress("5") || s.Amount.Cmp(tokenFee) != 0 {
+		t.Errorf("top-up of %s from %s, want %s from the gas station", s.Amount, s.From, tokenFee)
+	}
+	if s := steps[token1]; len(s.DependsOn) != 1 || s.DependsOn[0] != topUp1 || s.Contract != testAddress("c") || s.To != testAddress("f") {
+		t.Errorf("token transfer %+v", s)
+	}
+	if s := steps[token3]; len(s.DependsOn) != 0 || s.Amount.Int64() != 300000000 {
+		t.Errorf("token transfer without top-up %+v", s)
+	}
+	if s := steps[ether2]; s.Amount.Cmp(new(big.Int).Sub(ether(1), etherFee)) != 0 || len(s.DependsOn) != 0 {
+		t.Errorf("ether sweep of %s, want the balance less %s of gas", s.Amount, etherFee)
+	}
+	left := new(big.Int).Sub(ether(1), tokenFee)
+	left.Sub(left, etherFee)
+	if s := steps[ether3]; s.Amount.Cmp(left) != 0 || len(s.DependsOn) != 1 || s.DependsOn[0] != token3 {
+		t.Errorf("ether sweep of %s depending on %v, want %s after %s", s.Amount, s.DependsOn, left, token3)
+	}
+}
+
+func TestPlanSweepConfig(t *testing.T) {
+	e := testSweepService()
+	e.config.Sweep.TokenGasLimit = 60000
+	accounts := []*SweepAccount{
+		{UID: "1", Address: testAddress("1"), Balances: map[string]*big.Int{"USDC": big.NewInt(200000000)}},
+	}
+	plan, err := e.PlanSweep(accounts, 100, big.NewInt(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Steps) != 2 || plan.Steps[0].Amount.Int64() != 60000*132 || plan.Steps[1].GasLimit != 60000 {
+		t.Errorf("plan with a token gas limit of 60000: %d steps", len(plan.Steps))
+	}
+
+	// an address without key is left out, its top-up would be lost
+	keyless := []*SweepAccount{{UID: "1", Address: testAddress("1"), Balances: accounts[0].Balances, Keyless: true}}
+	if plan, err = e.PlanSweep(keyless, 100, big.NewInt(100)); err != nil || len(plan.Steps) != 0 {
+		t.Errorf("plan of an address without key: %v", err)
+	}
+
+	// the top-up needs the gas station
+	e.config.GasStation = ""
+	if _, err = e.PlanSweep(accounts, 100, big.NewInt(100)); err == nil {
+		t.Errorf("a top-up without gas station should fail")
+	}
+	e.config.Sweep = nil
+	if _, err = e.PlanSweep(accounts, 100, big.NewInt(100)); err == nil {
+		t.Errorf("a sweep without config should fail")
+	}
+}
+
+func TestLocalTestSigner(t *testing.T) {
+	s := NewLocalTestSigner()
+	addr, err := s.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := &UnsignedTx{
+		Type:     LegacyTxType,
+		ChainID:  big.NewInt(1),
+		To:       testAddress("f"),
+		Value:    big.NewInt(1),
+		GasLimit: etherTransferGas,
+		Fees:     Fees{GasPrice: big.NewInt(100)},
+	}
+	signed, err := s.SignTransaction(addr, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Signed) != 1 || s.Signed[0] == tx || s.Signed[0].To != tx.To {
+		t.Errorf("signed transactions %v", s.Signed)
+	}
+
+	// an unknown sender is signed with the key derived from its address, always the same
+	first, err := s.SignTransaction(testAddress("a"), tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := s.SignTransaction(testAddress("a"), tx)
+	if first.Raw != second.Raw || first.Raw == signed.Raw {
+		t.Errorf("signatures of the derived key differ or match the one of %s", addr)
+	}
+}
@@ -1,69 +1,13 @@
 package eth
 
 import (
-	"encoding/hex"
 	"fmt"
-	"log"
 	"math/big"
-	"strconv"
-
-	"github.com/SoteriaTech/blockchain-functions/env"
-	"golang.org/x/crypto/sha3"
 )
 
-func parseTokenTransfer(tx *Transaction, c *env.CurrencyConfig) (*Transaction, error) {
-	receipt, err := ethService.api.GetReceipt(tx.Hash)
-	if err != nil {
-		return nil, err
-	}
-	for idx, l := range receipt.Logs {
-		if l.Topics[0].String() == c.TransferSignature {
-			r, _ := hex.DecodeString(l.Topics[2].String()[2:])
-			tx.Receiver = parseDataAddr(r)
-			tx.Value = parseDataValue(l.Data.String())
-			tx.LogIdx = strconv.Itoa(idx)
-		}
-	}
-	tx.Currency = c.Name
-	return tx, nil
-}
-
-func parseDataValue(hex string) *big.Int {
-	// v, _ := strconv.ParseUint(hex[2:], 16, 64)
-	// log.Fatal(v)
-	// return new(big.Int).SetUint64(v)
-	v, err := decodeBig(hex)
-	if err != nil {
-		log.Fatal("err", err)
-	}
-	return v
-}
-
-// from ethereum-go library  https://github.com/ethereum/go-ethereum/blob/991384a7f6719e1125ca0be7fb27d0c4d1c5d2d3/common/types.go#L235
-// That's how they transform the hex encoded data in the topics into an EIP55 compliant address
-func parseDataAddr(b []byte) string {
-	var a [20]byte
-	copy(a[:], b[len(b)-20:])
-	var buf [len(a)*2 + 2]byte
-	copy(buf[:2], "0x")
-	hex.Encode(buf[2:], a[:])
-
-	// compute checksum
-	sha := sha3.NewLegacyKeccak256()
-	sha.Write(buf[2:])
-	hash := sha.Sum(nil)
-	for i := 2; i < len(buf); i++ {
-		hashByte := hash[(i-2)/2]
-		if i%2 == 0 {
-			hashByte = hashByte >> 4
-		} else {
-			hashByte &= 0xf
-		}
-		if buf[i] > '9' && hashByte > 7 {
-			buf[i] -= 32
-		}
-	}
-	return string(buf[:])
+// parseDataAddr parse the address of a 32 bytes topic into its EIP55 representation
+func parseDataAddr(b []byte) Address {
+	return Address(ToChecksumAddress(b[len(b)-20:]))
 }
 
 /**
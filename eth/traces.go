@@ -0,0 +1,107 @@
+package eth
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+)
+
+// tracePathPrefix prefix of the log index of the internal transfers, so that their ids never collide
+// with the ones of the token transfers of the same transaction
+const tracePathPrefix string = "trace:"
+
+// TraceAPI interface of the providers able to trace the calls of the transactions of a block, with
+// trace_block or debug_traceBlockByNumber and the callTracer
+type TraceAPI interface {
+	TraceBlock(h uint64, tracer string) ([]*Trace, error)
+}
+
+// Trace call of a transaction. The path is the position of the call in the call tree of its
+// transaction, e.g. 0.2 for the third call of the first call, and is empty for the top-level call.
+// A failed call has an error, its sub calls are reverted with it
+type Trace struct {
+	TxHash string
+	Path   []int
+	Type   string
+	From   Address
+	To     Address
+	Value  *big.Int
+	Error  string
+}
+
+// InternalTransfers find the ether transferred by the internal calls of the transactions of a block.
+// The top-level calls are the transactions of the block body, and the calls reverted by themselves
+// or by a parent call transfer nothing, so both are skipped
+func (e *Eth) InternalTransfers(h uint64) ([]*Transaction, error) {
+	tracer, ok := e.api.(TraceAPI)
+	if !ok {
+		return nil, fmt.Errorf("the ethereum provider cannot trace blocks")
+	}
+
+	traces, err := tracer.TraceBlock(h, e.config.Tracer)
+	if err != nil {
+		return nil, err
+	}
+
+	var transfers []*Transaction
+	failed := make(map[string]bool)
+	for _, t := range traces {
+		path := tracePath(t.Path)
+		if t.Error != "" {
+			failed[t.TxHash+path] = true
+			continue
+		}
+		if len(t.Path) == 0 || t.Value == nil || t.Value.Sign() <= 0 || !transfersValue(t.Type) || revertedByParent(t, failed) {
+			continue
+		}
+		transfers = append(transfers, &Transaction{
+			From:        t.From,
+			To:          t.To,
+			Hash:        t.TxHash,
+			Value:       t.Value,
+			BlockHeight: int(h),
+			Currency:    e.config.Currencies[0].Name,
+			LogIdx:      tracePathPrefix + path,
+			Receiver:    t.To,
+		})
+	}
+	return transfers, nil
+}
+
+// transfersValue returns true for the types of calls that move their value to their recipient,
+// delegatecalls report the value of their parent and staticcalls cannot have any
+func transfersValue(callType string) bool {
+	switch strings.ToLower(callType) {
+	case "call", "create", "create2", "selfdestruct", "suicide":
+		return true
+	}
+	return false
+}
+
+// revertedByParent returns true if one of the parent calls of the trace failed. Parents come
+// before their sub calls in the traces of both tracers
+func revertedByParent(t *Trace, failed map[string]bool) bool {
+	for depth := range t.Path {
+		if failed[t.TxHash+tracePath(t.Path[:depth])] {
+			return true
+		}
+	}
+	return false
+}
+
+// tracePath identifier of a call in its transaction, e.g. 0.2
+func tracePath(path []int) string {
+	parts := make([]string, len(path))
+	for i, p := range path {
+		parts[i] = strconv.Itoa(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// tracesEnabled returns true if the config of the chain asks for the internal transfers
+func tracesEnabled(config *env.ChainConfig) bool {
+	return config.Tracer != ""
+}
@@ -0,0 +1,84 @@
+package eth
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+)
+
+// testTraceAPI TraceAPI returning the same traces for any block
+type testTraceAPI struct {
+	EthereumAPI
+	traces []*Trace
+}
+
+func (a *testTraceAPI) TraceBlock(h uint64, tracer string) ([]*Trace, error) {
+	return a.traces, nil
+}
+
+func TestInternalTransfers(t *testing.T) {
+	call := func(tx string, value int64, callType string, errCall string, path ...int) *Trace {
+		return &Trace{TxHash: tx, Path: path, Type: callType, From: testAddress("1"), To: testAddress("2"), Value: big.NewInt(value), Error: errCall}
+	}
+	api := &testTraceAPI{traces: []*Trace{
+		// the top-level call is the transaction itself
+		call("0xa", 5, "CALL", ""),
+		call("0xa", 1, "CALL", "", 0),
+		call("0xa", 0, "CALL", "", 1),
+		call("0xa", 2, "DELEGATECALL", "", 2),
+		call("0xa", 3, "STATICCALL", "", 3),
+		// a failed parent reverts its sub calls, and only the ones of its own transaction
+		call("0xa", 4, "CALL", "execution reverted", 4),
+		call("0xa", 6, "CALL", "", 4, 0),
+		call("0xa", 7, "CREATE2", "", 4, 0, 1),
+		call("0xb", 8, "CREATE", "", 4),
+		call("0xb", 9, "CALL", "", 4, 0),
+	}}
+	e := &Eth{
+		api:    api,
+		config: &env.ChainConfig{Chain: "eth_test", Tracer: "callTracer", Currencies: []*env.CurrencyConfig{{Name: "ETH", Decimals: 18}}},
+	}
+
+	transfers, err := e.InternalTransfers(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tr := range transfers {
+		got = append(got, tr.Hash+" "+tr.LogIdx+" "+tr.Value.String())
+		if tr.Currency != "ETH" || tr.BlockHeight != 100 || tr.Receiver != testAddress("2") {
+			t.Errorf("internal transfer %+v", tr)
+		}
+	}
+	want := []string{"0xa trace:0 1", "0xb trace:4 8", "0xb trace:4.0 9"}
+	if len(got) != len(want) {
+		t.Fatalf("internal transfers %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("internal transfer %s, want %s", got[i], want[i])
+		}
+	}
+}
+
+func TestRevertedByParent(t *testing.T) {
+	failed := map[string]bool{"0xa": false, "0xa1": true, "0xa2.0": true}
+	tests := []struct {
+		path     []int
+		reverted bool
+	}{
+		{nil, false},
+		{[]int{0}, false},
+		{[]int{1, 0}, true},
+		{[]int{1, 0, 3}, true},
+		{[]int{2, 0}, false},
+		{[]int{2, 0, 1}, true},
+		{[]int{2, 1, 0}, false},
+	}
+	for _, tt := range tests {
+		if got := revertedByParent(&Trace{TxHash: "0xa", Path: tt.path}, failed); got != tt.reverted {
+			t.Errorf("revertedByParent(%v) = %v, want %v", tt.path, got, tt.reverted)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package eth
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/INFURA/go-ethlibs/rlp"
+	"golang.org/x/crypto/sha3"
+)
+
+// Types of the transactions built, legacy ones on the chains without EIP-1559 fees
+const (
+	LegacyTxType     uint8 = 0
+	DynamicFeeTxType uint8 = 2
+)
+
+const (
+	// transferSelector selector of the ERC-20 transfer(address,uint256) function
+	transferSelector string = "0xa9059cbb"
+	// feeHistoryBlocks number of recent blocks whose priority fees are suggested from
+	feeHistoryBlocks int = 10
+	// priorityPercentile percentile of the priority fees paid in each of the recent blocks
+	priorityPercentile float64 = 50
+	// defaultPriorityFee priority fee in wei when the recent blocks paid none
+	defaultPriorityFee int64 = 1000000000
+)
+
+// TxAPI interface of the providers able to build and broadcast transactions. The nonce of an address
+// counts its mined transactions, or its pending ones too
+type TxAPI interface {
+	ChainID() (*big.Int, error)
+	EstimateGas(msg *CallMsg) (uint64, error)
+	FeeHistory(blocks int, percentiles []float64) (*FeeHistory, error)
+	NonceAt(addr string, pending bool) (uint64, error)
+	SendRawTransaction(raw string) (string, error)
+}
+
+// CallMsg transaction whose gas is estimated
+type CallMsg struct {
+	From  Address
+	To    Address
+	Value *big.Int
+	Data  string
+}
+
+// FeeHistory base fees of the recent blocks followed by the one of the next block, and the priority fees
+// paid in each of them at the requested percentiles. Chains without EIP-1559 have no base fees
+type FeeHistory struct {
+	BaseFees []*big.Int
+	Rewards  [][]*big.Int
+}
+
+// Fees fees per gas of a transaction, a gas price for the legacy ones and fee caps for the EIP-1559 ones
+type Fees struct {
+	GasPrice       *big.Int
+	MaxFee         *big.Int
+	MaxPriorityFee *big.Int
+}
+
+// Legacy whether the fees are the gas price of a legacy transaction
+func (f *Fees) Legacy() bool {
+	return f.MaxFee == nil
+}
+
+// Cap highest price per gas that can be paid with the fees
+func (f *Fees) Cap() *big.Int {
+	if f.Legacy() {
+		return f.GasPrice
+	}
+	return f.MaxFee
+}
+
+// TxRequest transaction to build. The gas limit is estimated when it is not set, and the fees are capped
+// at the max gas price when it is set, e.g. to the price a sweep budgeted its gas at
+type TxRequest struct {
+	From        Address
+	To          Address
+	Value       *big.Int
+	Data        string
+	GasLimit    uint64
+	MaxGasPrice *big.Int
+}
+
+// UnsignedTx legacy or EIP-1559 transaction ready to be signed
+type UnsignedTx struct {
+	Type     uint8
+	ChainID  *big.Int
+	Nonce    uint64
+	To       Address
+	Value    *big.Int
+	Data     string
+	GasLimit uint64
+	Fees
+}
+
+// SignedTx raw signed transaction, as broadcast, and its hash
+type SignedTx struct {
+	Raw  string
+	Hash string
+}
+
+// TransferData calldata of the ERC-20 transfer of an amount of tokens to an address
+func TransferData(to Address, amount *big.Int) string {
+	return transferSelector + addressTopic(to.String())[2:] + fmt.Sprintf("%064x", amount)
+}
+
+// TxRequest returns the transaction of a step of a sweep, a call of the transfer function of the contract
+// for the tokens and a call with the data of the step for the forwarders. Its gas is the one the sweep
+// budgeted
+func (s *SweepStep) TxRequest() *TxRequest {
+	req := &TxRequest{
+		From:        s.From,
+		To:          s.To,
+		Value:       s.Amount,
+		GasLimit:    s.GasLimit,
+		MaxGasPrice: s.GasPrice,
+	}
+	switch s.Kind {
+	case SweepToken:
+		req.To = s.Contract
+		req.Value = new(big.Int)
+		req.Data = TransferData(s.To, s.Amount)
+	case SweepDeploy, SweepFlush:
+		req.Value = new(big.Int)
+		req.Data = s.Data
+	}
+	return req
+}
+
+// ChainID get the chain id of the transactions, requested once
+func (e *Eth) ChainID() (*big.Int, error) {
+	e.txMu.Lock()
+	defer e.txMu.Unlock()
+
+	if e.chainID != nil {
+		return e.chainID, nil
+	}
+	t, err := e.txAPI()
+	if err != nil {
+		return nil, err
+	}
+	id, err := t.ChainID()
+	if err != nil {
+		return nil, err
+	}
+	e.chainID = id
+	return id, nil
+}
+
+// SuggestFees suggest the fees of a transaction to be mined in the next blocks. The priority fee is the
+// median of the ones paid in the recent blocks and the max fee covers the next base fee doubling. The
+// chains whose blocks have no base fee get the gas price of a legacy transaction
+func (e *Eth) SuggestFees() (*Fees, error) {
+	t, err := e.txAPI()
+	if err != nil {
+		return nil, err
+	}
+	history, errHistory := t.FeeHistory(feeHistoryBlocks, []float64{priorityPercentile})
+	if errHistory != nil || len(history.BaseFees) == 0 || history.BaseFees[len(history.BaseFees)-1] == nil || history.BaseFees[len(history.BaseFees)-1].Sign() == 0 {
+		price, errPrice := e.GasPrice()
+		if errPrice != nil {
+			return nil, errPrice
+		}
+		return &Fees{GasPrice: price}, nil
+	}
+
+	var rewards []*big.Int
+	for _, r := range history.Rewards {
+		if len(r) > 0 && r[0] != nil {
+			rewards = append(rewards, r[0])
+		}
+	}
+	priority := big.NewInt(defaultPriorityFee)
+	if len(rewards) > 0 {
+		sort.Slice(rewards, func(i, j int) bool { return rewards[i].Cmp(rewards[j]) < 0 })
+		priority = rewards[len(rewards)/2]
+	}
+	base := history.BaseFees[len(history.BaseFees)-1]
+	maxFee := new(big.Int).Add(new(big.Int).Mul(base, big.NewInt(2)), priority)
+	return &Fees{MaxFee: maxFee, MaxPriorityFee: new(big.Int).Set(priority)}, nil
+}
+
+// BuildTransaction build the transaction of a request with the suggested fees, its nonce is set by the
+// sender. The gas of a contract call is estimated with a margin, the state can change before it is mined
+func (e *Eth) BuildTransaction(req *TxRequest) (*UnsignedTx, error) {
+	t, err := e.txAPI()
+	if err != nil {
+		return nil, err
+	}
+	chainID, err := e.ChainID()
+	if err != nil {
+		return nil, err
+	}
+	fees, err := e.SuggestFees()
+	if err != nil {
+		return nil, err
+	}
+	capFees(fees, req.MaxGasPrice)
+
+	value := req.Value
+	if value == nil {
+		value = new(big.Int)
+	}
+	gas := req.GasLimit
+	if gas == 0 {
+		gas, err = t.EstimateGas(&CallMsg{From: req.From, To: req.To, Value: value, Data: req.Data})
+		if err != nil {
+			return nil, fmt.Errorf("gas of the transaction from %s to %s: %v", req.From, req.To, err)
+		}
+		if req.Data != "" {
+			gas += gas / 5
+		}
+	}
+
+	tx := &UnsignedTx{
+		Type:     DynamicFeeTxType,
+		ChainID:  chainID,
+		To:       req.To,
+		Value:    value,
+		Data:     req.Data,
+		GasLimit: gas,
+		Fees:     *fees,
+	}
+	if fees.Legacy() {
+		tx.Type = LegacyTxType
+	}
+	return tx, nil
+}
+
+// SendRawTransaction broadcast a signed transaction and returns its hash
+func (e *Eth) SendRawTransaction(raw string) (string, error) {
+	t, err := e.txAPI()
+	if err != nil {
+		return "", err
+	}
+	return t.SendRawTransaction(raw)
+}
+
+// txAPI returns the provider as a TxAPI, if it can build transactions
+func (e *Eth) txAPI() (TxAPI, error) {
+	t, ok := e.api.(TxAPI)
+	if !ok {
+		return nil, fmt.Errorf("the provider of %s cannot build transactions", e.config.Chain)
+	}
+	return t, nil
+}
+
+// capFees lower the fees to the max gas price, when it is set
+func capFees(fees *Fees, max *big.Int) {
+	if max == nil || max.Sign() == 0 || fees.Cap().Cmp(max) <= 0 {
+		return
+	}
+	if fees.Legacy() {
+		fees.GasPrice = new(big.Int).Set(max)
+		return
+	}
+	fees.MaxFee = new(big.Int).Set(max)
+	if fees.MaxPriorityFee.Cmp(max) > 0 {
+		fees.MaxPriorityFee = new(big.Int).Set(max)
+	}
+}
+
+// SigningHash hash of the transaction that is signed, with the chain id as replay protection
+func (t *UnsignedTx) SigningHash() ([]byte, error) {
+	var payload string
+	var err error
+	switch t.Type {
+	case LegacyTxType:
+		payload, err = rlp.Value{List: append(t.fields(), rlpInt(t.ChainID), rlpUint(0), rlpUint(0))}.Encode()
+	case DynamicFeeTxType:
+		payload, err = t.typedPayload(nil)
+	default:
+		return nil, fmt.Errorf("unsupported transaction type %d", t.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return keccak256(payload)
+}
+
+// Encode encode the transaction with its signature, made of r, s and the recovery id
+func (t *UnsignedTx) Encode(sig []byte) (*SignedTx, error) {
+	if len(sig) != 65 {
+		return nil, fmt.Errorf("signature of %d bytes is invalid", len(sig))
+	}
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:64])
+	recID := uint64(sig[64])
+
+	var raw string
+	var err error
+	switch t.Type {
+	case LegacyTxType:
+		v := new(big.Int).Add(new(big.Int).Mul(t.ChainID, big.NewInt(2)), new(big.Int).SetUint64(35+recID))
+		raw, err = rlp.Value{List: append(t.fields(), rlpInt(v), rlpInt(r), rlpInt(s))}.Encode()
+	case DynamicFeeTxType:
+		raw, err = t.typedPayload([]rlp.Value{rlpUint(recID), rlpInt(r), rlpInt(s)})
+	default:
+		return nil, fmt.Errorf("unsupported transaction type %d", t.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	hash, err := keccak256(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedTx{Raw: raw, Hash: "0x" + hex.EncodeToString(hash)}, nil
+}
+
+// fields fields of a legacy transaction before its signature
+func (t *UnsignedTx) fields() []rlp.Value {
+	return []rlp.Value{
+		rlpUint(t.Nonce),
+		rlpInt(t.GasPrice),
+		rlpUint(t.GasLimit),
+		rlpHex(t.To.String()),
+		rlpInt(t.Value),
+		rlpHex(t.Data),
+	}
+}
+
+// typedPayload EIP-2718 envelope of an EIP-1559 transaction, its type followed by the rlp of its fields
+// with an empty access list, and of its signature when it is given
+func (t *UnsignedTx) typedPayload(signature []rlp.Value) (string, error) {
+	fields := []rlp.Value{
+		rlpInt(t.ChainID),
+		rlpUint(t.Nonce),
+		rlpInt(t.MaxPriorityFee),
+		rlpInt(t.MaxFee),
+		rlpUint(t.GasLimit),
+		rlpHex(t.To.String()),
+		rlpInt(t.Value),
+		rlpHex(t.Data),
+		{List: []rlp.Value{}},
+	}
+	encoded, err := rlp.Value{List: append(fields, signature...)}.Encode()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("0x%02x", t.Type) + encoded[2:], nil
+}
+
+// rlpInt rlp value of an integer, its big endian bytes without leading zeros
+func rlpInt(i *big.Int) rlp.Value {
+	if i == nil || i.Sign() == 0 {
+		return rlp.Value{String: "0x"}
+	}
+	return rlp.Value{String: "0x" + hex.EncodeToString(i.Bytes())}
+}
+
+func rlpUint(u uint64) rlp.Value {
+	return rlpInt(new(big.Int).SetUint64(u))
+}
+
+// rlpHex rlp value of hexadecimal bytes, empty ones included
+func rlpHex(h string) rlp.Value {
+	return rlp.Value{String: "0x" + strings.ToLower(strings.TrimPrefix(h, "0x"))}
+}
+
+func keccak256(h string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(h, "0x"))
+	if err != nil {
+		return nil, err
+	}
+	sha := sha3.NewLegacyKeccak256()
+	sha.Write(b)
+	return sha.Sum(nil), nil
+}
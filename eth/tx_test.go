@@ -0,0 +1,114 @@
+package eth
+
+import (
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/INFURA/go-ethlibs/rlp"
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// EIP-155 example, a legacy transaction signed for chain 1
+func TestLegacyTransactionVector(t *testing.T) {
+	keyBytes, _ := hex.DecodeString(strings.Repeat("46", 32))
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(), keyBytes)
+	if got := KeyAddress(key); got != "0x9d8A62f656a8d1615C1294fd71e9CFb3E4855A4F" {
+		t.Errorf("KeyAddress = %s", got)
+	}
+
+	tx := &UnsignedTx{
+		Type:     LegacyTxType,
+		ChainID:  big.NewInt(1),
+		Nonce:    9,
+		To:       ToAddress("0x" + strings.Repeat("35", 20)),
+		Value:    new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil),
+		GasLimit: 21000,
+		Fees:     Fees{GasPrice: big.NewInt(20000000000)},
+	}
+	hash, err := tx.SigningHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(hash); got != "daf5a779ae972f972197303d7b574746c7ef83eadac0f2791ad23db92e4c8e53" {
+		t.Errorf("SigningHash = %s", got)
+	}
+
+	signed, err := signTransaction(key, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "0xf86c098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a76400008025a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276a067cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83"
+	if signed.Raw != want {
+		t.Errorf("signed transaction %s, want %s", signed.Raw, want)
+	}
+	if h, _ := keccak256(want); signed.Hash != "0x"+hex.EncodeToString(h) {
+		t.Errorf("hash %s of the signed transaction", signed.Hash)
+	}
+}
+
+func TestDynamicFeeTransactionSignature(t *testing.T) {
+	keyBytes, _ := hex.DecodeString(strings.Repeat("46", 32))
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(), keyBytes)
+	tx := &UnsignedTx{
+		Type:     DynamicFeeTxType,
+		ChainID:  big.NewInt(5),
+		Nonce:    1,
+		To:       ToAddress("0x" + strings.Repeat("35", 20)),
+		Value:    new(big.Int),
+		Data:     TransferData(ToAddress("0x"+strings.Repeat("36", 20)), big.NewInt(1000)),
+		GasLimit: 60000,
+		Fees:     Fees{MaxFee: big.NewInt(30000000000), MaxPriorityFee: big.NewInt(1000000000)},
+	}
+	signed, err := signTransaction(key, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(signed.Raw, "0x02f8") {
+		t.Errorf("EIP-2718 envelope of type 2 expected, got %s", signed.Raw)
+	}
+
+	// the sender is recovered from the signature over the signing hash
+	v, err := rlp.From("0x" + signed.Raw[4:])
+	if err != nil || len(v.List) != 12 {
+		t.Fatalf("decoded %d fields: %v", len(v.List), err)
+	}
+	word := func(f rlp.Value) []byte {
+		b, _ := hex.DecodeString(strings.TrimPrefix(f.String, "0x"))
+		return append(make([]byte, 32-len(b)), b...)
+	}
+	recID, _ := hex.DecodeString(strings.TrimPrefix(v.List[9].String, "0x"))
+	compact := append([]byte{27}, append(word(v.List[10]), word(v.List[11])...)...)
+	if len(recID) == 1 {
+		compact[0] += recID[0]
+	}
+	hash, _ := tx.SigningHash()
+	pub, _, err := btcec.RecoverCompact(btcec.S256(), compact, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pub.IsEqual(key.PubKey()) {
+		t.Errorf("recovered key %x, want %x", pub.SerializeCompressed(), key.PubKey().SerializeCompressed())
+	}
+}
+
+func TestCapFees(t *testing.T) {
+	legacy := &Fees{GasPrice: big.NewInt(200)}
+	capFees(legacy, big.NewInt(150))
+	if legacy.GasPrice.Int64() != 150 {
+		t.Errorf("capped gas price %s, want 150", legacy.GasPrice)
+	}
+
+	dynamic := &Fees{MaxFee: big.NewInt(200), MaxPriorityFee: big.NewInt(180)}
+	capFees(dynamic, big.NewInt(150))
+	if dynamic.MaxFee.Int64() != 150 || dynamic.MaxPriorityFee.Int64() != 150 {
+		t.Errorf("capped fees %s %s, want 150 150", dynamic.MaxFee, dynamic.MaxPriorityFee)
+	}
+
+	uncapped := &Fees{GasPrice: big.NewInt(200)}
+	capFees(uncapped, nil)
+	if uncapped.GasPrice.Int64() != 200 {
+		t.Errorf("fees capped without a max gas price")
+	}
+}
@@ -2,6 +2,9 @@ package cloudfunctions
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
@@ -13,10 +16,14 @@ import (
 	"github.com/SoteriaTech/blockchain-functions/functions"
 	"github.com/SoteriaTech/blockchain-functions/store"
 	"github.com/SoteriaTech/blockchain-functions/utils"
+	"github.com/SoteriaTech/blockchain-functions/validation"
 )
 
 var config *env.Config
 
+// ethSenders senders of the transactions of the evm chains with a keystore, by chain name
+var ethSenders = make(map[string]*eth.TxSender)
+
 // init function is ran automatically by GCP prior to the rest
 func init() {
 	config = env.InitConfig()
@@ -24,11 +31,43 @@ func init() {
 	utils.InitErrorReporting(config.ProjectID)
 	store.InitFirestoreStore(config.ProjectID, config.KeyPath)
 
-	api.InitBlockInfoClient(config.Bitcoin.Endpoint)
-	btc.InitBtcService(api.BlockInfo)
+	if err := btc.InitBtcService(api.InitBitcoinProvider(&config.Bitcoin), &config.Bitcoin); err != nil {
+		log.Fatal(err)
+	}
+	for _, chain := range config.UtxoChains() {
+		if chain.Chain == config.Bitcoin.Chain {
+			continue
+		}
+		if _, err := btc.InitService(api.InitBitcoinProvider(chain), chain); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	api.InitInfuraClient(config.Ethereum.Endpoint)
-	eth.InitEthService(api.Infura, &config.Ethereum)
+	for _, chain := range config.EvmChains() {
+		svc, err := eth.InitEthService(api.InitEthereumProvider(chain), chain)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// wrong decimals would scale every balance of a token, the service refuses to start with them, but a
+		// provider failing to answer must not stop the functions of every chain from starting
+		unverified, err := svc.VerifyCurrencies()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, errToken := range unverified {
+			utils.ErrorReport.LogAndPrintError(errToken)
+		}
+		if chain.Transactions == nil {
+			continue
+		}
+		signer, err := eth.NewKeystoreSigner(chain.Transactions.Keystore, chain.Transactions.Passphrase)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if ethSenders[chain.Chain], err = functions.NewEthTxSender(chain, signer); err != nil {
+			log.Fatal(err)
+		}
+	}
 }
 
 /***********************************************
@@ -37,21 +76,176 @@ func init() {
 *
 ***********************************************/
 
-// SyncBtcBalance function sync the btc balance of a given user's account
+// SyncBtcBalance function reconcile the btc balance of a given user's account with the provider
 func SyncBtcBalance(w http.ResponseWriter, r *http.Request) {
 
 	data, errReq := utils.RequestData(r)
 	if errReq != nil {
 		utils.ErrorReport.LogAndPrintError(errReq)
 		utils.RespondJSONWithError(w, 400, errReq.Error())
+		return
+	}
+
+	chain, errChain := utxoChainConfig(data["chain"])
+	if errChain != nil {
+		utils.RespondJSONWithError(w, 400, errChain.Error())
+		return
+	}
+
+	drift, err := functions.SyncBtcBalance(data["uid"], chain)
+	if err != nil {
+		utils.ErrorReport.LogAndPrintError(err.Err)
+		utils.RespondJSONWithError(w, err.Code, err.Err.Error())
+		return
+	}
+	utils.RespondJSON(w, 200, drift)
+}
+
+// GetBtcBalance function compute the btc balance of a given user from its utxos. The confirmations
+// default to the ones of the config
+func GetBtcBalance(w http.ResponseWriter, r *http.Request) {
+	data, errReq := utils.RequestData(r)
+	if errReq != nil {
+		utils.RespondJSONWithError(w, 400, errReq.Error())
+		return
+	}
+
+	chain, errChain := utxoChainConfig(data["chain"])
+	if errChain != nil {
+		utils.RespondJSONWithError(w, 400, errChain.Error())
+		return
+	}
+
+	confirmations := chain.Confirmations
+	if c, ok := data["confirmations"]; ok && c != "" {
+		n, errConv := strconv.Atoi(c)
+		if errConv != nil || n < 0 {
+			utils.RespondJSONWithError(w, 400, "confirmations must be a positive integer")
+			return
+		}
+		confirmations = n
+	}
+
+	balance, err := functions.GetBtcBalance(data["uid"], confirmations, chain)
+	if err != nil {
+		utils.ErrorReport.LogAndPrintError(err.Err)
+		utils.RespondJSONWithError(w, err.Code, err.Err.Error())
+		return
+	}
+	utils.RespondJSON(w, 200, balance)
+}
+
+// BuildBtcWithdrawal build the unsigned psbt of a withdrawal from the tracked addresses. The amount is in
+// satoshis and the fee rate in satoshis per vbyte, estimated for the given speed (medium by default) when not set
+func BuildBtcWithdrawal(w http.ResponseWriter, r *http.Request) {
+	data, errReq := utils.RequestData(r)
+	if errReq != nil {
+		utils.RespondJSONWithError(w, 400, errReq.Error())
+		return
+	}
+
+	chain, errChain := utxoChainConfig(data["chain"])
+	if errChain != nil {
+		utils.RespondJSONWithError(w, 400, errChain.Error())
+		return
+	}
+
+	amount, errAmount := strconv.ParseInt(data["amount"], 10, 64)
+	if errAmount != nil || amount <= 0 {
+		utils.RespondJSONWithError(w, 400, "amount must be a positive number of satoshis")
+		return
+	}
+	feeRate, errFee := strconv.ParseFloat(data["fee_rate"], 64)
+	if data["fee_rate"] == "" {
+		feeRate, errFee = btcFeeRate(data["speed"], chain)
+	}
+	if errFee != nil {
+		utils.RespondJSONWithError(w, 400, "fee_rate must be a number of satoshis per vbyte: "+errFee.Error())
+		return
+	}
+
+	withdrawal, err := functions.BuildBtcWithdrawal(&functions.BtcWithdrawalRequest{
+		UID:           data["uid"],
+		To:            data["to"],
+		Amount:        amount,
+		FeeRate:       feeRate,
+		Strategy:      data["strategy"],
+		WalletID:      data["wallet_id"],
+		ChangeAddress: data["change_address"],
+	}, chain)
+	if err != nil {
+		utils.ErrorReport.LogAndPrintError(err.Err)
+		utils.RespondJSONWithError(w, err.Code, err.Err.Error())
+		return
+	}
+	utils.RespondJSON(w, 200, withdrawal)
+}
+
+// EstimateBtcFees returns the fee rates in satoshis per vbyte by confirmation speed
+func EstimateBtcFees(w http.ResponseWriter, r *http.Request) {
+	chain, errChain := utxoChainConfig(r.URL.Query().Get("chain"))
+	if errChain != nil {
+		utils.RespondJSONWithError(w, 400, errChain.Error())
+		return
+	}
+
+	estimate, err := functions.EstimateBtcFees(chain)
+	if err != nil {
+		utils.ErrorReport.LogAndPrintError(err.Err)
+		utils.RespondJSONWithError(w, err.Code, err.Err.Error())
+		return
+	}
+	utils.RespondJSON(w, 200, estimate)
+}
+
+// btcFeeRate estimated fee rate of the given speed, medium by default
+func btcFeeRate(speed string, chain *env.ChainConfig) (float64, error) {
+	if speed == "" {
+		speed = btc.FeeMedium
+	}
+	estimate, err := functions.EstimateBtcFees(chain)
+	if err != nil {
+		return 0, err.Err
+	}
+	return estimate.Rate(speed)
+}
+
+// RegisterBtcWallet register an HD wallet of a user from an output descriptor or an extended public key
+func RegisterBtcWallet(w http.ResponseWriter, r *http.Request) {
+	data, errReq := utils.RequestData(r)
+	if errReq != nil {
+		utils.RespondJSONWithError(w, 400, errReq.Error())
+		return
+	}
+
+	chain, errChain := utxoChainConfig(data["chain"])
+	if errChain != nil {
+		utils.RespondJSONWithError(w, 400, errChain.Error())
+		return
 	}
 
-	btcAccount, err := functions.SyncBtcBalance(data["uid"])
+	var purpose, gapLimit int
+	var errConv error
+	if data["purpose"] != "" {
+		if purpose, errConv = strconv.Atoi(data["purpose"]); errConv != nil {
+			utils.RespondJSONWithError(w, 400, "error purpose format is incorrect")
+			return
+		}
+	}
+	if data["gap_limit"] != "" {
+		if gapLimit, errConv = strconv.Atoi(data["gap_limit"]); errConv != nil {
+			utils.RespondJSONWithError(w, 400, "error gap_limit format is incorrect")
+			return
+		}
+	}
+
+	wallet, err := functions.RegisterBtcWallet(data["uid"], data["descriptor"], data["xpub"], purpose, gapLimit, chain)
 	if err != nil {
 		utils.ErrorReport.LogAndPrintError(err.Err)
 		utils.RespondJSONWithError(w, err.Code, err.Err.Error())
+		return
 	}
-	utils.RespondJSON(w, 200, btcAccount)
+	utils.RespondJSON(w, 200, wallet)
 }
 
 // ScanBtcBlock scan a bitcoin blockchain block and parse it
@@ -68,7 +262,13 @@ func ScanBtcBlock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rsp, err := functions.ScanBtcBlock(height, &config.Bitcoin)
+	chain, errChain := utxoChainConfig(data["chain"])
+	if errChain != nil {
+		utils.RespondJSONWithError(w, 400, errChain.Error())
+		return
+	}
+
+	rsp, err := functions.ScanBtcBlock(height, chain)
 	if err != nil {
 		utils.ErrorReport.LogAndPrintError(err)
 		utils.RespondJSONWithError(w, 500, err.Error())
@@ -79,7 +279,13 @@ func ScanBtcBlock(w http.ResponseWriter, r *http.Request) {
 
 // ScanBtcHead scan this is a replica of the pub/sub to test on the local server
 func ScanBtcHead(w http.ResponseWriter, r *http.Request) {
-	blocks, err := functions.ScanBtcHead(&config.Bitcoin)
+	chain, errChain := utxoChainConfig(r.URL.Query().Get("chain"))
+	if errChain != nil {
+		utils.RespondJSONWithError(w, 400, errChain.Error())
+		return
+	}
+
+	blocks, err := functions.ScanBtcHead(chain)
 	if err != nil {
 		utils.RespondJSONWithError(w, err.Code, err.Err.Error())
 		return
@@ -88,7 +294,48 @@ func ScanBtcHead(w http.ResponseWriter, r *http.Request) {
 	utils.RespondJSON(w, 200, blocks)
 }
 
-// ScanEthBlock scan an ethereum block for transactions
+// ValidateAddress validate an address before it is saved by a client app. The family is btc or eth
+func ValidateAddress(w http.ResponseWriter, r *http.Request) {
+	data, errReq := utils.RequestData(r)
+	if errReq != nil {
+		utils.RespondJSONWithError(w, 400, errReq.Error())
+		return
+	}
+
+	chain := &config.Ethereum
+	if data["family"] != validation.FamilyEth {
+		var errChain error
+		if chain, errChain = utxoChainConfig(data["chain"]); errChain != nil {
+			utils.RespondJSONWithError(w, 400, errChain.Error())
+			return
+		}
+	}
+	utils.RespondJSON(w, 200, functions.ValidateAddress(data["family"], data["address"], chain))
+}
+
+// SweepAccountAddresses validate the address of every account and flag the invalid ones
+func SweepAccountAddresses(w http.ResponseWriter, r *http.Request) {
+	invalid, err := functions.SweepAccountAddresses(config.UtxoChains(), config.EvmChains())
+	if err != nil {
+		utils.ErrorReport.LogAndPrintError(err.Err)
+		utils.RespondJSONWithError(w, err.Code, err.Err.Error())
+		return
+	}
+
+	utils.RespondJSON(w, 200, invalid)
+}
+
+// ProviderMetrics returns the request metrics of the chain providers by host, since the start of the instance
+func ProviderMetrics(w http.ResponseWriter, r *http.Request) {
+	utils.RespondJSON(w, 200, api.ProviderTransport.Metrics())
+}
+
+// ProviderCacheStats returns the hits and misses of the response caches by chain and kind of response
+func ProviderCacheStats(w http.ResponseWriter, r *http.Request) {
+	utils.RespondJSON(w, 200, api.AllCacheStats())
+}
+
+// ScanEthBlock scan a block of an evm chain for transactions, ethereum when no chain is given
 func ScanEthBlock(w http.ResponseWriter, r *http.Request) {
 	data, errReq := utils.RequestData(r)
 	if errReq != nil {
@@ -102,7 +349,13 @@ func ScanEthBlock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	b, err := functions.ScanEthBlock(uint64(h), &config.Ethereum)
+	chain, errChain := evmChainConfig(data["chain"])
+	if errChain != nil {
+		utils.RespondJSONWithError(w, 400, errChain.Error())
+		return
+	}
+
+	b, err := functions.ScanEthBlock(uint64(h), chain)
 	if err != nil {
 		utils.RespondJSONWithError(w, 400, err.Error())
 		return
@@ -110,9 +363,16 @@ func ScanEthBlock(w http.ResponseWriter, r *http.Request) {
 	utils.RespondJSON(w, 200, b)
 }
 
-// ScanEthHead scan this is a replica of the pub/sub to test on the local server
+// ScanEthHead scan this is a replica of the pub/sub to test on the local server. The evm chain is
+// given in the chain query parameter, ethereum by default
 func ScanEthHead(w http.ResponseWriter, r *http.Request) {
-	blocks, err := functions.ScanEthHead(&config.Ethereum)
+	chain, errChain := evmChainConfig(r.URL.Query().Get("chain"))
+	if errChain != nil {
+		utils.RespondJSONWithError(w, 400, errChain.Error())
+		return
+	}
+
+	blocks, err := functions.ScanEthHead(chain)
 	if err != nil {
 		utils.RespondJSONWithError(w, err.Code, err.Err.Error())
 		return
@@ -121,6 +381,76 @@ func ScanEthHead(w http.ResponseWriter, r *http.Request) {
 	utils.RespondJSON(w, 200, blocks)
 }
 
+// PlanEthSweep plan the sweep of the deposit addresses of an evm chain to its hot wallet, with the top-ups of
+// the gas station paying the gas of the token transfers
+func PlanEthSweep(w http.ResponseWriter, r *http.Request) {
+	data, errReq := utils.RequestData(r)
+	if errReq != nil {
+		utils.RespondJSONWithError(w, 400, errReq.Error())
+		return
+	}
+
+	chain, errChain := evmChainConfig(data["chain"])
+	if errChain != nil {
+		utils.RespondJSONWithError(w, 400, errChain.Error())
+		return
+	}
+
+	sender, ok := ethSenders[chain.Chain]
+	if !ok {
+		utils.RespondJSONWithError(w, 400, fmt.Sprintf("no keystore configured for %s", chain.Chain))
+		return
+	}
+
+	sweep, err := functions.PlanEthSweep(chain, sender)
+	if err != nil {
+		utils.ErrorReport.LogAndPrintError(err.Err)
+		utils.RespondJSONWithError(w, err.Code, err.Err.Error())
+		return
+	}
+	utils.RespondJSON(w, 200, sweep)
+}
+
+// RegisterEthForwarder set the address of the forwarder of a user as the deposit address of its account
+func RegisterEthForwarder(w http.ResponseWriter, r *http.Request) {
+	data, errReq := utils.RequestData(r)
+	if errReq != nil {
+		utils.RespondJSONWithError(w, 400, errReq.Error())
+		return
+	}
+
+	chain, errChain := evmChainConfig(data["chain"])
+	if errChain != nil {
+		utils.RespondJSONWithError(w, 400, errChain.Error())
+		return
+	}
+
+	acc, err := functions.RegisterEthForwarder(data["uid"], chain, config.EvmChains())
+	if err != nil {
+		utils.ErrorReport.LogAndPrintError(err.Err)
+		utils.RespondJSONWithError(w, err.Code, err.Err.Error())
+		return
+	}
+	utils.RespondJSON(w, 200, acc)
+}
+
+/***********************************************
+*
+* Standalone server
+*
+***********************************************/
+
+// FollowEvmHeads follow the new heads of every evm chain with a websocket endpoint until the context
+// is done, scanning each block as it arrives. Used by the standalone server instead of the pub/sub scans
+func FollowEvmHeads(ctx context.Context) {
+	for _, chain := range config.EvmChains() {
+		if chain.Websocket == "" {
+			continue
+		}
+		go functions.FollowEthHead(ctx, chain, api.NewWebsocketHeads(chain.Websocket, functions.FollowStaleAfter(chain)))
+	}
+}
+
 /***********************************************
 *
 * Pub/Sub functions
@@ -146,6 +476,48 @@ func ScanBtcPubSub(ctx context.Context, m PubSubMessage) error {
 	return nil
 }
 
+// ScanLtcPubSub ping the litecoin blockchain for new block and scan them for transactions
+func ScanLtcPubSub(ctx context.Context, m PubSubMessage) error {
+	return scanUtxoHead(&config.Litecoin)
+}
+
+// ScanDogePubSub ping the dogecoin blockchain for new block and scan them for transactions
+func ScanDogePubSub(ctx context.Context, m PubSubMessage) error {
+	return scanUtxoHead(&config.Dogecoin)
+}
+
+// ScanBchPubSub ping the bitcoin cash blockchain for new block and scan them for transactions
+func ScanBchPubSub(ctx context.Context, m PubSubMessage) error {
+	return scanUtxoHead(&config.BitcoinCash)
+}
+
+// utxoChainConfig config of the utxo chain of the given name, bitcoin when the name is empty
+func utxoChainConfig(name string) (*env.ChainConfig, error) {
+	if name == "" {
+		return &config.Bitcoin, nil
+	}
+	chain := config.UtxoChain(name)
+	if chain == nil {
+		return nil, fmt.Errorf("utxo chain %s is not configured", name)
+	}
+	return chain, nil
+}
+
+// scanUtxoHead scan the new blocks of a utxo chain, with the same code path as bitcoin
+func scanUtxoHead(chain *env.ChainConfig) error {
+	if chain.Chain == "" {
+		return errors.New("chain is not configured")
+	}
+	blocks, err := functions.ScanBtcHead(chain)
+	if err != nil {
+		utils.NotifySlack(err.Err.Error(), config.ProjectID)
+		return err.Err
+	}
+
+	log.Printf("%s Blocks aggregated: %v", chain.Chain, blocks)
+	return nil
+}
+
 // ScanEthPubSub ping the ethereum blockchain for new block and scan them for transactions
 func ScanEthPubSub(ctx context.Context, m PubSubMessage) error {
 	blocks, err := functions.ScanEthHead(&config.Ethereum)
@@ -158,6 +530,87 @@ func ScanEthPubSub(ctx context.Context, m PubSubMessage) error {
 	return nil
 }
 
+// ScanPolygonPubSub ping the polygon blockchain for new block and scan them for transactions
+func ScanPolygonPubSub(ctx context.Context, m PubSubMessage) error {
+	return scanEvmHead(&config.Polygon)
+}
+
+// ScanArbitrumPubSub ping the arbitrum blockchain for new block and scan them for transactions
+func ScanArbitrumPubSub(ctx context.Context, m PubSubMessage) error {
+	return scanEvmHead(&config.Arbitrum)
+}
+
+// ScanBscPubSub ping the bnb smart chain for new block and scan them for transactions
+func ScanBscPubSub(ctx context.Context, m PubSubMessage) error {
+	return scanEvmHead(&config.BSC)
+}
+
+// ScanBasePubSub ping the base blockchain for new block and scan them for transactions
+func ScanBasePubSub(ctx context.Context, m PubSubMessage) error {
+	return scanEvmHead(&config.Base)
+}
+
+// ExecuteEthSweepPubSub advance the running sweeps of an evm chain, sending the transfers that are ready
+// with the keys of the keystore of the chain. It signs with the keys of the deposit addresses, so it is only
+// triggered through pub/sub, never over http. The message is {"chain": ..., "id": ...}, ethereum and
+// every running sweep when they are empty
+func ExecuteEthSweepPubSub(ctx context.Context, m PubSubMessage) error {
+	var data struct {
+		Chain string `json:"chain"`
+		ID    string `json:"id"`
+	}
+	if len(m.Data) > 0 {
+		if err := json.Unmarshal(m.Data, &data); err != nil {
+			return err
+		}
+	}
+	chain, err := evmChainConfig(data.Chain)
+	if err != nil {
+		return err
+	}
+	sender, ok := ethSenders[chain.Chain]
+	if !ok {
+		return fmt.Errorf("no keystore configured for %s", chain.Chain)
+	}
+
+	sweeps, errSweep := functions.ExecuteEthSweeps(data.ID, chain, sender)
+	if errSweep != nil {
+		utils.NotifySlack(errSweep.Err.Error(), config.ProjectID)
+		return errSweep.Err
+	}
+	for _, s := range sweeps {
+		log.Printf("%s sweep %s: %s", chain.Chain, s.ID, s.Status)
+	}
+	return nil
+}
+
+// evmChainConfig config of the evm chain of the given name, ethereum when the name is empty
+func evmChainConfig(name string) (*env.ChainConfig, error) {
+	if name == "" {
+		return &config.Ethereum, nil
+	}
+	chain := config.EvmChain(name)
+	if chain == nil {
+		return nil, fmt.Errorf("evm chain %s is not configured", name)
+	}
+	return chain, nil
+}
+
+// scanEvmHead scan the new blocks of an evm chain, with the same code path as ethereum
+func scanEvmHead(chain *env.ChainConfig) error {
+	if chain.Chain == "" {
+		return errors.New("chain is not configured")
+	}
+	blocks, err := functions.ScanEthHead(chain)
+	if err != nil {
+		utils.NotifySlack(err.Err.Error(), config.ProjectID)
+		return err.Err
+	}
+
+	log.Printf("%s Blocks aggregated: %v", chain.Chain, blocks)
+	return nil
+}
+
 /***********************************************
 *
 * DO NOT CALL
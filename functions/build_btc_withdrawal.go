@@ -0,0 +1,169 @@
+package functions
+
+import (
+	"errors"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// BtcWithdrawalRequest parameters of a withdrawal. The change goes to the given address or to the next
+// unused address of the given wallet. When uid is set, only the coins of this user are spent
+type BtcWithdrawalRequest struct {
+	UID           string
+	To            string
+	Amount        int64   // in satoshis
+	FeeRate       float64 // in satoshis per vbyte
+	Strategy      string
+	WalletID      string
+	ChangeAddress string
+}
+
+// storeUtxoSource coins of the tracked addresses from the utxos recorded by the scanner, with
+// at least the configured confirmations
+type storeUtxoSource struct {
+	store         *store.FireStoreStore
+	uid           string
+	height        int
+	confirmations int
+	net           *btc.Network
+}
+
+// BuildBtcWithdrawal select the coins of the tracked addresses paying the withdrawal and build its
+// unsigned psbt, to be signed outside of the functions
+func BuildBtcWithdrawal(req *BtcWithdrawalRequest, config *env.ChainConfig) (*btc.Withdrawal, *utils.ErrorService) {
+	svc, s, err := utxoChain(config)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	height, err := scannedBtcHeight(config)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	wr := &btc.WithdrawalRequest{
+		To:            req.To,
+		Amount:        req.Amount,
+		FeeRate:       req.FeeRate,
+		Strategy:      req.Strategy,
+		ChangeAddress: req.ChangeAddress,
+	}
+	if wr.Strategy == "" {
+		wr.Strategy = config.CoinSelection
+	}
+	if wr.Strategy == "" {
+		wr.Strategy = btc.SelectBranchAndBound
+	}
+
+	switch {
+	case req.ChangeAddress != "":
+	case req.WalletID != "":
+		w, errW := s.FindBtcWallet(req.WalletID)
+		if errW != nil {
+			return nil, &utils.ErrorService{Code: 404, Err: errW}
+		}
+		if wr.ChangeAddress, wr.ChangeOrigin, err = nextBtcWalletAddress(w, svc.Network()); err != nil {
+			return nil, &utils.ErrorService{Code: 500, Err: err}
+		}
+	default:
+		return nil, &utils.ErrorService{Code: 400, Err: errors.New("a change address or a wallet id is required")}
+	}
+
+	src := &storeUtxoSource{
+		store:         s,
+		uid:           req.UID,
+		height:        height,
+		confirmations: config.Confirmations,
+		net:           svc.Network(),
+	}
+	w, err := svc.BuildWithdrawal(src, wr)
+	if err != nil {
+		code := 400
+		if err == btc.ErrRawTransactionAPI {
+			code = 500
+		}
+		return nil, &utils.ErrorService{Code: code, Err: err}
+	}
+	return w, nil
+}
+
+// SpendableCoins returns the unspent outputs with enough confirmations, with the derivation of their key
+// when their address is derived from a watched wallet
+func (s *storeUtxoSource) SpendableCoins() ([]*btc.Coin, error) {
+	var utxos []*store.BtcUtxoSchema
+	var err error
+	if s.uid != "" {
+		utxos, err = s.store.FindUnspentBtcUtxosByUID(s.uid)
+	} else {
+		utxos, err = s.store.GetAllUnspentBtcUtxos()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	walletAddrs, err := s.store.GetAllBtcWalletAddresses()
+	if err != nil {
+		return nil, err
+	}
+	derived := make(map[string]*store.BtcWalletAddressSchema, len(walletAddrs))
+	for _, a := range walletAddrs {
+		derived[a.Address] = a
+	}
+	descriptors := make(map[string]*btc.Descriptor)
+
+	var coins []*btc.Coin
+	for _, u := range utxos {
+		if s.height-u.BlockHeight+1 < s.confirmations {
+			continue
+		}
+		script, errScript := btc.AddressToScript(u.Address, s.net)
+		if errScript != nil {
+			return nil, errScript
+		}
+		c := &btc.Coin{Hash: u.TxHash, N: u.VoutIdx, Value: u.Value, Address: u.Address, PkScript: script}
+
+		if a, ok := derived[u.Address]; ok {
+			d, ok := descriptors[a.WalletID]
+			if !ok {
+				w, errW := s.store.FindBtcWallet(a.WalletID)
+				if errW != nil {
+					return nil, errW
+				}
+				if d, err = btc.ParseDescriptor(w.Descriptor); err != nil {
+					return nil, err
+				}
+				descriptors[a.WalletID] = d
+			}
+			if c.Origin, err = d.KeyOrigin(uint32(a.Index)); err != nil {
+				return nil, err
+			}
+		}
+		coins = append(coins, c)
+	}
+	return coins, nil
+}
+
+// nextBtcWalletAddress returns the first address of a wallet after the last used one, with its key origin.
+// It is always watched since the gap limit addresses after the last used one are derived
+func nextBtcWalletAddress(w *store.BtcWalletSchema, net *btc.Network) (string, *btc.KeyOrigin, error) {
+	d, err := btc.ParseDescriptor(w.Descriptor)
+	if err != nil {
+		return "", nil, err
+	}
+	for i := w.LastUsed + 1; ; i++ {
+		addr, _, errAddr := d.Address(uint32(i), net)
+		if errAddr == btc.ErrInvalidChild {
+			continue
+		}
+		if errAddr != nil {
+			return "", nil, errAddr
+		}
+		origin, errOrigin := d.KeyOrigin(uint32(i))
+		if errOrigin != nil {
+			return "", nil, errOrigin
+		}
+		return addr, origin, nil
+	}
+}
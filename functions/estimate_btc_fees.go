@@ -0,0 +1,87 @@
+package functions
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// Default fee estimation config, rates in satoshis per vbyte
+const (
+	defaultMinFeeRate  float64 = 1
+	defaultMaxFeeRate  float64 = 1000
+	defaultFeeCacheTTL int     = 60
+	defaultFeeBlocks   int     = 6
+)
+
+// btcFeeCache last fee estimate of each chain, kept between the invocations of a function instance
+var btcFeeCache = struct {
+	sync.Mutex
+	estimates map[string]*btc.FeeEstimate
+	expires   map[string]time.Time
+}{
+	estimates: make(map[string]*btc.FeeEstimate),
+	expires:   make(map[string]time.Time),
+}
+
+// EstimateBtcFees estimate the fee rates by confirmation speed from the provider estimates and the fee
+// rates of the recently scanned blocks. The estimate is cached for the configured duration
+func EstimateBtcFees(config *env.ChainConfig) (*btc.FeeEstimate, *utils.ErrorService) {
+	fc := feeConfig(config)
+	svc, s, err := utxoChain(config)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	btcFeeCache.Lock()
+	defer btcFeeCache.Unlock()
+	if e, ok := btcFeeCache.estimates[config.Chain]; ok && time.Now().Before(btcFeeCache.expires[config.Chain]) {
+		return e, nil
+	}
+
+	provider, err := svc.GetFeeEstimates()
+	if err != nil && err != btc.ErrFeeEstimateAPI {
+		utils.ErrorReport.LogAndPrintError(err)
+	}
+
+	recent, err := s.FindRecentBtcBlockFees(fc.Blocks)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	var blocks []map[string]float64
+	for _, b := range recent {
+		blocks = append(blocks, b.Percentiles)
+	}
+
+	estimate, err := btc.CombineFeeEstimates(provider, blocks, fc.MinRate, fc.MaxRate)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 503, Err: err}
+	}
+	btcFeeCache.estimates[config.Chain] = estimate
+	btcFeeCache.expires[config.Chain] = time.Now().Add(time.Duration(fc.CacheTTL) * time.Second)
+	return estimate, nil
+}
+
+// feeConfig returns the fee config of the chain with the defaults for the missing values
+func feeConfig(config *env.ChainConfig) *env.FeeConfig {
+	fc := &env.FeeConfig{}
+	if config.Fees != nil {
+		*fc = *config.Fees
+	}
+	if fc.MinRate <= 0 {
+		fc.MinRate = defaultMinFeeRate
+	}
+	if fc.MaxRate <= 0 {
+		fc.MaxRate = defaultMaxFeeRate
+	}
+	if fc.CacheTTL <= 0 {
+		fc.CacheTTL = defaultFeeCacheTTL
+	}
+	if fc.Blocks <= 0 {
+		fc.Blocks = defaultFeeBlocks
+	}
+	return fc
+}
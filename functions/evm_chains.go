@@ -0,0 +1,16 @@
+package functions
+
+import (
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/eth"
+	"github.com/SoteriaTech/blockchain-functions/store"
+)
+
+// evmChain returns the service of the evm chain of the config and the store scoped to its collections
+func evmChain(config *env.ChainConfig) (*eth.Eth, *store.FireStoreStore, error) {
+	svc, err := eth.Service(config.Chain)
+	if err != nil {
+		return nil, nil, err
+	}
+	return svc, store.Firestore.EvmChain(config.Prefix), nil
+}
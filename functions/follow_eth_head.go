@@ -0,0 +1,113 @@
+package functions
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/eth"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+const (
+	// followPollInterval interval of the polling while the subscription is down, when the config does not set one
+	followPollInterval time.Duration = 15 * time.Second
+	// followMinBackoff and followMaxBackoff bounds of the delay before subscribing again after a failure
+	followMinBackoff time.Duration = time.Second
+	followMaxBackoff time.Duration = 5 * time.Minute
+	// followStaleIntervals number of poll intervals without new head after which a subscription is stale
+	followStaleIntervals = 4
+)
+
+// FollowEthHead scan the blocks of the evm chain of the config as their heads are pushed by the
+// subscription, until the context is done. Whenever the subscription is down, the head is polled
+// until subscribing again, and the blocks missed in between are scanned from the stored chain state
+// before following the new heads
+func FollowEthHead(ctx context.Context, config *env.ChainConfig, heads eth.NewHeadsAPI) {
+	interval := followInterval(config)
+
+	backoff := followMinBackoff
+	for ctx.Err() == nil {
+		scanFollowedHead(config, 0)
+
+		ch, err := heads.SubscribeNewHeads(ctx)
+		if err != nil {
+			utils.ErrorReport.LogAndPrintError(fmt.Errorf("%s new heads subscription failed: %v", config.Chain, err))
+		} else {
+			received := false
+			for h := range ch {
+				received = true
+				scanFollowedHead(config, h)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("%s new heads subscription ended, polling until it is back", config.Chain)
+			// only a subscription that delivered heads was healthy, the others keep backing off
+			if received {
+				backoff = followMinBackoff
+			}
+		}
+
+		pollEthHead(ctx, config, interval, backoff)
+		if backoff *= 2; backoff > followMaxBackoff {
+			backoff = followMaxBackoff
+		}
+	}
+}
+
+// FollowStaleAfter time without new head after which the subscription of the evm chain of the config is
+// closed, so that its head is polled until subscribing again
+func FollowStaleAfter(config *env.ChainConfig) time.Duration {
+	return followStaleIntervals * followInterval(config)
+}
+
+// followInterval interval of the polling of the head of the evm chain of the config
+func followInterval(config *env.ChainConfig) time.Duration {
+	if config.PollInterval > 0 {
+		return time.Duration(config.PollInterval) * time.Second
+	}
+	return followPollInterval
+}
+
+// pollEthHead scan the head at the given interval for the given duration, at least once
+func pollEthHead(ctx context.Context, config *env.ChainConfig, interval time.Duration, duration time.Duration) {
+	deadline := time.Now().Add(duration)
+	for {
+		wait := interval
+		if remaining := time.Until(deadline); remaining < wait {
+			wait = remaining
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		scanFollowedHead(config, 0)
+		if !time.Now().Before(deadline) {
+			return
+		}
+	}
+}
+
+// scanFollowedHead scan the blocks up to the given head, or up to the head of the provider when it is 0.
+// A failed scan is reported and retried with the next head, from the stored chain state
+func scanFollowedHead(config *env.ChainConfig, head uint64) {
+	var blocks []int
+	var err *utils.ErrorService
+	if head == 0 {
+		blocks, err = ScanEthHead(config)
+	} else {
+		blocks, err = ScanEthHeadTo(config, head)
+	}
+	if err != nil {
+		utils.ErrorReport.LogAndPrintError(err.Err)
+		return
+	}
+	if len(blocks) > 0 {
+		log.Printf("%s Blocks aggregated: %v", config.Chain, blocks)
+	}
+}
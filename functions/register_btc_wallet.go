@@ -0,0 +1,66 @@
+package functions
+
+import (
+	"errors"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/helpers"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// defaultGapLimit number of unused addresses watched after the last used one when not configured
+const defaultGapLimit int = 20
+
+// RegisterBtcWallet register an HD wallet of a user from an output descriptor or an extended public key
+// and derive its first addresses. For an extended public key, purpose is one of 44, 49, 84 or 86, or 0
+// to deduce it from the key version
+func RegisterBtcWallet(uid string, descriptor string, xpub string, purpose int, gapLimit int, config *env.ChainConfig) (*store.BtcWalletSchema, *utils.ErrorService) {
+	if uid == "" {
+		return nil, &utils.ErrorService{Code: 400, Err: errors.New("uid is required")}
+	}
+
+	svc, s, err := utxoChain(config)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	var d *btc.Descriptor
+	switch {
+	case descriptor != "":
+		d, err = btc.ParseDescriptor(descriptor)
+	case xpub != "":
+		d, err = btc.NewDescriptorFromKey(xpub, uint32(purpose))
+	default:
+		err = errors.New("a descriptor or an extended public key is required")
+	}
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 400, Err: err}
+	}
+	if err = d.Key.CheckNetwork(svc.Network()); err != nil {
+		return nil, &utils.ErrorService{Code: 400, Err: err}
+	}
+
+	if gapLimit <= 0 {
+		gapLimit = config.GapLimit
+	}
+	if gapLimit <= 0 {
+		gapLimit = defaultGapLimit
+	}
+
+	w := &store.BtcWalletSchema{
+		UID:        uid,
+		Descriptor: d.String(),
+		GapLimit:   gapLimit,
+		LastUsed:   -1,
+	}
+	if err = s.CreateBtcWallet(w); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	if err = helpers.ExtendBtcWallet(s, w, -1, svc.Network()); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	return w, nil
+}
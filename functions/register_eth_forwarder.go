@@ -0,0 +1,66 @@
+package functions
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/eth"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// RegisterEthForwarder set the counterfactual address of the forwarder of an account as its deposit address,
+// so that its deposits are matched like the ones of any address before the forwarder is even deployed. An
+// account already holding another address keeps it, the deposits sent to it would be lost otherwise. The
+// accounts are shared by the evm chains, the forwarder is only registered when every one of them computes
+// the same address, a chain without it would sweep the address as an address of the keystore
+func RegisterEthForwarder(uid string, config *env.ChainConfig, chains []*env.ChainConfig) (*store.EthAccountSchema, *utils.ErrorService) {
+	if uid == "" {
+		return nil, &utils.ErrorService{Code: 400, Err: errors.New("uid is required")}
+	}
+	if err := sameForwarders(config, chains); err != nil {
+		return nil, &utils.ErrorService{Code: 409, Err: err}
+	}
+	svc, s, err := evmChain(config)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	addr, err := svc.ForwarderAddress(uid)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 400, Err: err}
+	}
+
+	acc, err := s.FindEthAccount(uid)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 404, Err: err}
+	}
+	if acc.Address != "" && eth.ToAddress(acc.Address) != addr {
+		return nil, &utils.ErrorService{Code: 409, Err: fmt.Errorf("account %s already has the deposit address %s", uid, acc.Address)}
+	}
+	if err = s.UpdateEthAccountAddress(uid, addr); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	acc.Address = addr.String()
+	return acc, nil
+}
+
+// sameForwarders check that every evm chain has the forwarders of the given chain, the same factory and init
+// code giving the same addresses
+func sameForwarders(config *env.ChainConfig, chains []*env.ChainConfig) error {
+	f := config.Forwarders
+	if f == nil {
+		return fmt.Errorf("no forwarders configured for %s", config.Chain)
+	}
+	for _, c := range chains {
+		o := c.Forwarders
+		if o == nil {
+			return fmt.Errorf("no forwarders configured for %s, its accounts are shared with %s", c.Chain, config.Chain)
+		}
+		if eth.ToAddress(o.Factory) != eth.ToAddress(f.Factory) || !strings.EqualFold(o.InitCodeHash, f.InitCodeHash) {
+			return fmt.Errorf("the forwarders of %s differ from the ones of %s", c.Chain, config.Chain)
+		}
+	}
+	return nil
+}
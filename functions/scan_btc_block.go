@@ -8,40 +8,51 @@ import (
 	"github.com/SoteriaTech/blockchain-functions/utils"
 )
 
-// ScanBtcBlock scan a btc block for transactions
+// ScanBtcBlock scan a block of the utxo chain of the config for transactions
 func ScanBtcBlock(height int, config *env.ChainConfig) ([]*store.BtcAccountSchema, error) {
+	svc, s, err := utxoChain(config)
+	if err != nil {
+		return nil, err
+	}
+	_, decimals := svc.Currency()
 
-	accs, errAccs := store.Firestore.GetAllBtcAccountAddresses()
+	accs, errAccs := s.GetAllBtcAccountAddresses()
 	if errAccs != nil {
 		return nil, errAccs
 	}
 
 	// get transactions from 3 blocks earlier from store
-	prevTxs, _ := store.Firestore.FindBtcTransactionsFromBlockHeight(height - config.Confirmations)
+	prevTxs, _ := s.FindBtcTransactionsFromBlockHeight(height - config.Confirmations)
 	if len(prevTxs) > 0 {
 		var tbc []string
 		for _, t := range prevTxs {
 			tbc = append(tbc, t.TxHash)
 		}
-		hashes, _ := btc.BtcService.ConfirmTransactions(tbc)
+		hashes, _ := svc.ConfirmTransactions(tbc)
 		if len(hashes) > 0 {
 			cTxs := helpers.FilterBtcTransactionsByHash(prevTxs, hashes)
-			if err := helpers.ConfirmBtcTransactions(cTxs); err != nil {
+			if err := helpers.ConfirmBtcTransactions(s, cTxs, svc.Network()); err != nil {
 				utils.ErrorReport.LogAndPrintError(err)
 			}
 		}
 	}
 
-	txs, err := btc.BtcService.ScanBlock(height)
+	block, err := svc.ScanBlockDetails(height)
 	if err != nil {
 		return nil, err
 	}
+	txs := block.Transactions
+	if len(block.FeeRates) > 0 {
+		if errFees := s.CreateBtcBlockFees(helpers.FormatBtcBlockFees(block)); errFees != nil {
+			utils.ErrorReport.LogAndPrintError(errFees)
+		}
+	}
 
-	walletTxs := helpers.FilterBtcTransactionsByAccountAddress(txs, accs)
+	walletTxs := helpers.FilterBtcTransactionsByAccountAddress(txs, accs, svc.Network(), decimals)
 	var uaccs []*store.BtcAccountSchema
 	for uid, t := range walletTxs {
 		t.Confirmed = false
-		exists, errTx := helpers.FindOrCreateBtcTransaction(t)
+		exists, errTx := helpers.FindOrCreateBtcTransaction(s, t)
 		if errTx != nil {
 			return nil, errTx
 		}
@@ -51,5 +62,50 @@ func ScanBtcBlock(height int, config *env.ChainConfig) ([]*store.BtcAccountSchem
 		uaccs = append(uaccs, &store.BtcAccountSchema{UID: uid, Address: t.To, BTC: t.Amount})
 	}
 
+	walletAddrs, errAddrs := s.GetAllBtcWalletAddresses()
+	if errAddrs != nil {
+		return nil, errAddrs
+	}
+	indexes := make(map[string]int, len(walletAddrs))
+	owners := make(map[string]string, len(accs)+len(walletAddrs))
+	for _, a := range accs {
+		owners[btc.ToCanonicalAddress(a.Address, svc.Network())] = a.UID
+	}
+	for _, a := range walletAddrs {
+		indexes[a.Address] = a.Index
+		owners[a.Address] = a.UID
+	}
+	if errUtxos := helpers.RecordBtcUtxos(s, txs, block.Spends, owners); errUtxos != nil {
+		return nil, errUtxos
+	}
+
+	// index of the last address of each wallet that received funds in this block
+	used := make(map[string]int)
+	for _, t := range helpers.FilterBtcTransactionsByWalletAddress(txs, walletAddrs, decimals) {
+		t.Confirmed = false
+		exists, errTx := helpers.FindOrCreateBtcTransaction(s, t)
+		if errTx != nil {
+			return nil, errTx
+		}
+		if exists != nil {
+			continue
+		}
+		if idx, ok := used[t.WalletID]; !ok || indexes[t.To] > idx {
+			used[t.WalletID] = indexes[t.To]
+		}
+		uaccs = append(uaccs, &store.BtcAccountSchema{UID: t.UID, Address: t.To, BTC: t.Amount})
+	}
+
+	for id, idx := range used {
+		w, errW := s.FindBtcWallet(id)
+		if errW != nil {
+			utils.ErrorReport.LogAndPrintError(errW)
+			continue
+		}
+		if errExt := helpers.ExtendBtcWallet(s, w, idx, svc.Network()); errExt != nil {
+			utils.ErrorReport.LogAndPrintError(errExt)
+		}
+	}
+
 	return uaccs, nil
 }
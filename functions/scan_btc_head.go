@@ -10,9 +10,13 @@ import (
 	"github.com/SoteriaTech/blockchain-functions/utils"
 )
 
-// ScanBtcHead scan the head block of the btc blockchain for transactions
+// ScanBtcHead scan the head block of the utxo chain of the config for transactions
 // also catches on missing blocks between two pings
 func ScanBtcHead(config *env.ChainConfig) ([]int, *utils.ErrorService) {
+	svc, err := btc.Service(config.Chain)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
 	state, err := store.Firestore.GetChainState(config.Chain)
 	if err != nil {
 		return nil, &utils.ErrorService{Code: 500, Err: err}
@@ -22,7 +26,7 @@ func ScanBtcHead(config *env.ChainConfig) ([]int, *utils.ErrorService) {
 	cs := &btc.HeadBlock{}
 	json.Unmarshal(jsonState, cs)
 
-	headBlock, err := btc.BtcService.GetHeadInfo()
+	headBlock, err := svc.GetHeadInfo()
 	if err != nil {
 		return nil, &utils.ErrorService{Code: 500, Err: err}
 	}
@@ -10,51 +10,185 @@ import (
 	"github.com/SoteriaTech/blockchain-functions/utils"
 )
 
-// ScanEthBlock scan an ethereum block for transactions
+// ScanEthBlock scan a block of the evm chain of the config for transactions
 func ScanEthBlock(h uint64, config *env.ChainConfig) (*eth.Header, error) {
+	svc, s, err := evmChain(config)
+	if err != nil {
+		return nil, err
+	}
+
+	accs, errAccs := s.GetAllEthAccountAddresses()
+	if errAccs != nil {
+		return nil, errAccs
+	}
+
+	b, errB := svc.ScanBlock(h, watchedEthAddresses(accs, config))
+	if errB != nil {
+		return nil, errB
+	}
+
+	if err := recordEthBlock(svc, s, b, accs, config); err != nil {
+		return nil, err
+	}
+	return &b.Meta, nil
+}
+
+// recordEthBlock confirm the transactions recorded at the confirmation depth of a scanned block and
+// record the new transactions of the accounts and the NFTs they received
+func recordEthBlock(svc *eth.Eth, s *store.FireStoreStore, b *eth.BlockData, accs []*store.EthAccountSchema, config *env.ChainConfig) error {
 
 	// get transactions from 3 blocks earlier from store
-	conf := int(h) - config.Confirmations
-	prevTxs, _ := store.Firestore.FindEthTransactionsFromBlockHeight(conf)
+	conf := b.Meta.Height - config.Confirmations
+	prevTxs, _ := s.FindEthTransactionsFromBlockHeight(conf)
 	if len(prevTxs) > 0 {
 		var tbc []string
 		for _, t := range prevTxs {
 			tbc = append(tbc, t.TxHash)
 		}
-		hashes, _ := eth.ConfirmTransactions(tbc, conf)
+		hashes, reverted, _ := svc.ConfirmTransactions(tbc, conf)
 		if len(hashes) > 0 {
 			cTxs := helpers.FilterEthTransactionsByHash(prevTxs, hashes)
-			if err := helpers.ConfirmEthTransactions(cTxs, config); err != nil {
+			if err := helpers.ConfirmEthTransactions(s, cTxs, config); err != nil {
+				utils.ErrorReport.LogAndPrintError(err)
+			}
+		}
+		if len(reverted) > 0 {
+			rTxs := helpers.FilterEthTransactionsByHash(prevTxs, reverted)
+			if err := helpers.RecordRevertedEthTransactions(s, rTxs); err != nil {
 				utils.ErrorReport.LogAndPrintError(err)
 			}
 		}
 	}
 
-	b, errB := eth.ScanBlock(h)
-	if errB != nil {
-		log.Fatal("error scan block")
-		return nil, errB
+	confirmNftHoldings(svc, s, conf)
+
+	walletTxs := helpers.FilterEthTransactionsByAccountAddress(b.Txs, accs)
+	costs, errCosts := ethTransactionCosts(svc, walletTxs)
+	if errCosts != nil {
+		return errCosts
 	}
+	for uid, txs := range walletTxs {
+		for _, t := range txs {
+			cost := costs[t.TxHash]
+			helpers.SetEthTransactionCost(t, cost)
+			// token transfers come from logs, which reverted transactions do not emit, and internal
+			// transfers from the calls that did not fail, so only ether transfers can be reverted
+			if t.LogIdx == "" && !cost.Succeeded {
+				log.Println("Reverted transaction found for account:", uid, t.TxHash)
+				if errRevert := helpers.RecordRevertedEthTransactions(s, []*store.EthTransactionSchema{t}); errRevert != nil {
+					return errRevert
+				}
+				continue
+			}
 
-	accs, errAccs := store.Firestore.GetAllEthAccountAddresses()
-	if errAccs != nil {
-		return nil, errAccs
+			t.Confirmed = false
+			exists, errTx := helpers.FindOrCreateEthTransaction(s, t)
+			if errTx != nil {
+				log.Println("error find or create tx &v", t)
+				return errTx
+			}
+			if exists != nil {
+				continue
+			}
+			a := &store.EthAccountSchema{UID: uid, Address: t.Receiver.String()}
+			log.Println("Transaction found for account: &v", helpers.SetCurrencyAmount(a, t))
+		}
 	}
 
-	walletTxs := helpers.FilterEthTransactionsByAccountAddress(b.Txs, accs)
-	for uid, t := range walletTxs {
-		t.Confirmed = false
-		exists, errTx := helpers.FindOrCreateEthTransaction(t)
-		if errTx != nil {
-			log.Println("error find or create tx &v", t)
-			return nil, errTx
+	// reverted transactions emit no logs, the NFT transfers are all received, unconfirmed until the block
+	// is at the confirmation depth
+	holdings := helpers.FilterNftTransfersByAccountAddress(b.Nfts, accs)
+	if err := s.CreateNftHoldings(holdings); err != nil {
+		return err
+	}
+	for _, h := range holdings {
+		log.Println("NFT found for account:", h.UID, h.Contract, h.TokenID, h.Amount)
+	}
+
+	return nil
+}
+
+// confirmNftHoldings confirm the NFT holdings recorded at the confirmation depth whose transactions are
+// still mined in their block, and delete the ones a reorg dropped or moved. A moved transaction is recorded
+// again when its new block is scanned. The holdings whose receipt cannot be fetched are left unconfirmed
+func confirmNftHoldings(svc *eth.Eth, s *store.FireStoreStore, conf int) {
+	holdings, err := s.FindNftHoldingsFromBlockHeight(conf)
+	if err != nil {
+		utils.ErrorReport.LogAndPrintError(err)
+		return
+	}
+	if len(holdings) == 0 {
+		return
+	}
+	var hashes []string
+	for _, h := range holdings {
+		hashes = append(hashes, h.TxHash)
+	}
+	mined, errs, err := svc.TransactionsMinedAt(hashes, uint64(conf))
+	if err != nil {
+		utils.ErrorReport.LogAndPrintError(err)
+		return
+	}
+
+	var confirmed []*store.NftHoldingSchema
+	for i, h := range holdings {
+		switch {
+		case errs[i] != nil:
+			utils.ErrorReport.LogAndPrintError(errs[i])
+		case mined[i]:
+			confirmed = append(confirmed, h)
+		default:
+			log.Println("NFT dropped by a reorg for account:", h.UID, h.Contract, h.TokenID, h.TxHash)
+			if errDelete := s.DeleteNftHolding(h); errDelete != nil {
+				utils.ErrorReport.LogAndPrintError(errDelete)
+			}
 		}
-		if exists != nil {
-			continue
+	}
+	if err = s.UpdateNftHoldingsConfirmation(confirmed); err != nil {
+		utils.ErrorReport.LogAndPrintError(err)
+	}
+}
+
+// ethTransactionCosts get the costs of the transactions of the accounts by hash, with the receipts and
+// the transactions of the block requested at once
+func ethTransactionCosts(svc *eth.Eth, walletTxs map[string][]*store.EthTransactionSchema) (map[string]*eth.TxCost, error) {
+	var hashes []string
+	seen := make(map[string]bool)
+	for _, txs := range walletTxs {
+		for _, t := range txs {
+			if !seen[t.TxHash] {
+				seen[t.TxHash] = true
+				hashes = append(hashes, t.TxHash)
+			}
 		}
-		a := &store.EthAccountSchema{UID: uid, Address: t.To}
-		log.Println("Transaction found for account: &v", helpers.SetCurrencyAmount(a, t))
+	}
+	costs := make(map[string]*eth.TxCost)
+	if len(hashes) == 0 {
+		return costs, nil
 	}
 
-	return &b.Meta, nil
+	cs, errs, err := svc.TransactionCosts(hashes)
+	if err != nil {
+		return nil, err
+	}
+	for i, h := range hashes {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		costs[h] = cs[i]
+	}
+	return costs, nil
+}
+
+// watchedEthAddresses addresses of the accounts the token transfer logs are filtered on, when the config asks for it
+func watchedEthAddresses(accs []*store.EthAccountSchema, config *env.ChainConfig) (addresses []string) {
+	if !config.WatchedLogs {
+		return nil
+	}
+	for _, a := range accs {
+		if a.Address != "" {
+			addresses = append(addresses, a.Address)
+		}
+	}
+	return
 }
@@ -1,55 +1,91 @@
 package functions
 
 import (
-	"encoding/json"
+	"log"
 
 	"github.com/SoteriaTech/blockchain-functions/env"
 	"github.com/SoteriaTech/blockchain-functions/eth"
 	"github.com/SoteriaTech/blockchain-functions/helpers"
-	"github.com/SoteriaTech/blockchain-functions/store"
 	"github.com/SoteriaTech/blockchain-functions/utils"
 )
 
-// ScanEthHead scan the head block of the ethereum blockchain for transactions
+// ethScanRange number of blocks scanned at once when the config does not set a log range
+const ethScanRange uint64 = 100
+
+// ScanEthHead scan the head block of the evm chain of the config for transactions
 // also catches on missing blocks between two pings
 func ScanEthHead(config *env.ChainConfig) ([]int, *utils.ErrorService) {
+	svc, _, errChain := evmChain(config)
+	if errChain != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errChain}
+	}
 
-	state, err := store.Firestore.GetChainState(config.Chain)
+	headBlock, err := svc.GetHeadBlock()
 	if err != nil {
 		return nil, &utils.ErrorService{Code: 500, Err: err}
 	}
+	return ScanEthHeadTo(config, headBlock)
+}
 
-	cs := &eth.Header{}
-	jsonState, _ := json.Marshal(&state)
-	json.Unmarshal(jsonState, &cs)
+// ScanEthHeadTo scan the blocks of the evm chain of the config from the stored chain state up to the
+// given head, which is already known when it is pushed by a subscription
+func ScanEthHeadTo(config *env.ChainConfig, headBlock uint64) ([]int, *utils.ErrorService) {
+	svc, s, errChain := evmChain(config)
+	if errChain != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errChain}
+	}
 
-	headBlock, err := eth.GetHeadBlock()
+	state, err := s.GetChainState(config.Chain)
 	if err != nil {
 		return nil, &utils.ErrorService{Code: 500, Err: err}
 	}
 
-	if cs.Height == int(headBlock) {
+	cs := helpers.EthChainStateHeader(state)
+
+	if cs.Height >= int(headBlock) {
 		return nil, nil
 	}
 
-	currHeight := cs.Height
+	accs, errAccs := s.GetAllEthAccountAddresses()
+	if errAccs != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errAccs}
+	}
+	receivers := watchedEthAddresses(accs, config)
+
+	// the missing blocks are scanned in ranges, so that their token transfers come from a single request
+	step := uint64(config.LogRange)
+	if step == 0 {
+		step = ethScanRange
+	}
 	var blocks []int
 	var newCS *eth.Header
-	for {
-		currHeight++
+	for from := uint64(cs.Height + 1); from <= headBlock; from += step {
+		to := from + step - 1
+		if to > headBlock {
+			to = headBlock
+		}
 
-		bd, errScan := ScanEthBlock(uint64(currHeight), config)
+		bds, errScan := svc.ScanBlocks(from, to, receivers)
 		if errScan != nil {
 			utils.ErrorReport.LogAndPrintError(errScan)
 			return nil, &utils.ErrorService{Code: 500, Err: errScan}
 		}
-		blocks = append(blocks, currHeight)
-		newCS = bd
-		if currHeight == int(headBlock) {
-			break
+		for _, bd := range bds {
+			if errRecord := recordEthBlock(svc, s, bd, accs, config); errRecord != nil {
+				utils.ErrorReport.LogAndPrintError(errRecord)
+				return nil, &utils.ErrorService{Code: 500, Err: errRecord}
+			}
+			blocks = append(blocks, bd.Meta.Height)
+			newCS = &bd.Meta
 		}
 	}
-	errUpdate := store.Firestore.UpdateChainState(config.Chain, helpers.FormatEthChainState(newCS))
+	// the chains without finality and the providers that do not know the tags have no checkpoints, that is
+	// expected and not reported
+	cp, errCp := svc.Checkpoints()
+	if errCp != nil {
+		log.Printf("no checkpoints for %s: %v", config.Chain, errCp)
+	}
+	errUpdate := s.UpdateChainState(config.Chain, helpers.FormatEthChainState(newCS, cp))
 	if errUpdate != nil {
 		return nil, &utils.ErrorService{Code: 500, Err: errUpdate}
 
@@ -0,0 +1,346 @@
+package functions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/eth"
+	"github.com/SoteriaTech/blockchain-functions/helpers"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultStuckAfter time after which a sent transfer is replaced with higher fees, when the config does
+// not set one
+const defaultStuckAfter time.Duration = 10 * time.Minute
+
+// sweepLease time an execution holds a sweep, longer than the timeout of the functions so that the lease of
+// an execution that was interrupted is the only one to expire
+const sweepLease time.Duration = 10 * time.Minute
+
+// maxSweepSendAttempts sends of a transfer of a sweep that can fail before it is failed, so that a sweep
+// whose transfer can never be sent is over
+const maxSweepSendAttempts int = 5
+
+// permanentSendErrors errors of the sender no retry can fix, the transfer is failed at once
+var permanentSendErrors = []string{
+	"in the keystore",
+	"insufficient funds",
+	"execution reverted",
+	"gas required exceeds",
+	"intrinsic gas too low",
+}
+
+// NewEthTxSender create the sender of the transactions of an evm chain signed by the signer, with the
+// pending transactions of its addresses kept in the store of the chain
+func NewEthTxSender(config *env.ChainConfig, signer eth.Signer) (*eth.TxSender, error) {
+	svc, s, err := evmChain(config)
+	if err != nil {
+		return nil, err
+	}
+	return svc.NewTxSender(signer, helpers.NewEthNonceStore(s)), nil
+}
+
+// PlanEthSweep plan the sweep of the balances of the deposit addresses confirmed at the confirmation depth
+// and save it, to be executed by ExecuteEthSweep. A sweep is only planned once the previous one is over,
+// the balances it moves would be swept twice otherwise. The addresses the sender has no key for are left
+// out. Nothing is saved when there is nothing to sweep
+func PlanEthSweep(config *env.ChainConfig, sender *eth.TxSender) (*store.EthSweepSchema, *utils.ErrorService) {
+	svc, s, err := evmChain(config)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	running, err := s.FindEthSweepsByStatus(eth.SweepRunning)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	if len(running) > 0 {
+		return nil, &utils.ErrorService{Code: 409, Err: fmt.Errorf("sweep %s of %s is still running", running[0].ID, config.Chain)}
+	}
+
+	head, err := svc.GetHeadBlock()
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	height := head - uint64(config.Confirmations)
+
+	accs, err := s.GetAllEthAccountAddresses()
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	var accounts []*eth.SweepAccount
+	for _, a := range accs {
+		// the invalid addresses are reported by the address sweeps, they cannot hold anything
+		if addr, errAddr := eth.ParseAddress(a.Address); errAddr == nil {
+			accounts = append(accounts, &eth.SweepAccount{
+				UID:       a.UID,
+				Address:   addr,
+				Forwarder: svc.IsForwarder(a.UID, addr),
+				Keyless:   !sender.HasKey(addr),
+			})
+		}
+	}
+	if err = svc.LoadSweepBalances(accounts, height); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	// the gas is budgeted at the highest price the transfers can pay, the max fee of EIP-1559 chains
+	fees, err := svc.SuggestFees()
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	plan, err := svc.PlanSweep(accounts, height, fees.Cap())
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 400, Err: err}
+	}
+
+	sweep := helpers.FormatEthSweep(strconv.FormatUint(height, 10), plan)
+	if len(sweep.Steps) == 0 {
+		sweep.Status = eth.SweepDone
+		return sweep, nil
+	}
+	if err = s.CreateEthSweep(sweep); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	return sweep, nil
+}
+
+// ExecuteEthSweep advance a sweep as far as it can go: the stuck transfers are replaced, the sent ones are
+// checked against their receipts, the planned ones whose dependencies are mined are sent with their fees
+// capped at the planned gas price, and the ones depending on a failed transfer are skipped. A transfer the
+// sender cannot send is failed once its error is one no retry fixes or after a few attempts. The state is
+// saved after each transfer, so that a sweep interrupted by a failure resumes where it stopped when it is
+// executed again. The sweep is leased to the execution, the pub/sub messages delivered twice or the
+// executions overlapping leave it to the one holding it
+func ExecuteEthSweep(id string, config *env.ChainConfig, sender *eth.TxSender) (*store.EthSweepSchema, *utils.ErrorService) {
+	svc, s, err := evmChain(config)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	holder, err := sweepLeaseHolder()
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	sweep, leased, err := s.ClaimEthSweep(id, holder, time.Now().Add(sweepLease))
+	if status.Code(err) == codes.NotFound {
+		return nil, &utils.ErrorService{Code: 404, Err: err}
+	}
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	if !leased {
+		return sweep, nil
+	}
+
+	stuckAfter := defaultStuckAfter
+	if config.Transactions != nil && config.Transactions.StuckAfter > 0 {
+		stuckAfter = time.Duration(config.Transactions.StuckAfter) * time.Second
+	}
+	replaceStuckEthSweepSteps(sender, sweep, stuckAfter)
+	if err = checkSentEthSweepSteps(svc, sweep); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	if err = s.UpdateEthSweep(sweep); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	statuses := make(map[string]string, len(sweep.Steps))
+	for _, st := range sweep.Steps {
+		statuses[st.ID] = st.Status
+	}
+	for _, st := range sweep.Steps {
+		if st.Status != eth.SweepPlanned {
+			continue
+		}
+		ready := true
+		for _, dep := range st.DependsOn {
+			switch statuses[dep] {
+			case eth.SweepFailed, eth.SweepSkipped:
+				st.Status = eth.SweepSkipped
+			case eth.SweepMined:
+			default:
+				ready = false
+			}
+		}
+		if st.Status == eth.SweepSkipped {
+			statuses[st.ID] = st.Status
+			continue
+		}
+		if !ready {
+			continue
+		}
+
+		pending, errSend := sender.Send(helpers.EthSweepStep(st, sweep.GasPrice).TxRequest())
+		if errSend != nil {
+			utils.ErrorReport.LogAndPrintError(fmt.Errorf("sweep %s step %s: %v", sweep.ID, st.ID, errSend))
+			st.Error = errSend.Error()
+			st.Attempts++
+			if st.Attempts >= maxSweepSendAttempts || permanentSendError(errSend) {
+				st.Status = eth.SweepFailed
+				statuses[st.ID] = st.Status
+			}
+		} else {
+			st.Status = eth.SweepSent
+			st.TxHash = pending.Hash()
+			st.Nonce = int64(pending.Tx.Nonce)
+			st.Error = ""
+			statuses[st.ID] = st.Status
+		}
+		if err = s.UpdateEthSweep(sweep); err != nil {
+			return nil, &utils.ErrorService{Code: 500, Err: err}
+		}
+	}
+
+	sweep.Status = ethSweepStatus(sweep)
+	sweep.LeaseHolder = ""
+	sweep.LeaseUntil = time.Time{}
+	if err = s.UpdateEthSweep(sweep); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	return sweep, nil
+}
+
+// ExecuteEthSweeps execute the sweep of the given id, or every running sweep of the chain when it is empty
+func ExecuteEthSweeps(id string, config *env.ChainConfig, sender *eth.TxSender) ([]*store.EthSweepSchema, *utils.ErrorService) {
+	ids := []string{id}
+	if id == "" {
+		_, s, err := evmChain(config)
+		if err != nil {
+			return nil, &utils.ErrorService{Code: 500, Err: err}
+		}
+		running, err := s.FindEthSweepsByStatus(eth.SweepRunning)
+		if err != nil {
+			return nil, &utils.ErrorService{Code: 500, Err: err}
+		}
+		ids = nil
+		for _, r := range running {
+			ids = append(ids, r.ID)
+		}
+	}
+
+	var sweeps []*store.EthSweepSchema
+	for _, i := range ids {
+		sweep, err := ExecuteEthSweep(i, config, sender)
+		if err != nil {
+			return sweeps, err
+		}
+		sweeps = append(sweeps, sweep)
+	}
+	return sweeps, nil
+}
+
+// replaceStuckEthSweepSteps replace the stuck transactions of the senders of the sent transfers, up to the
+// price the gas of the sweep was budgeted at, the transfers keep the hashes of the versions they replace.
+// A replacement that fails is reported, the transfer waits for its transaction as it was
+func replaceStuckEthSweepSteps(sender *eth.TxSender, sweep *store.EthSweepSchema, after time.Duration) {
+	price, ok := new(big.Int).SetString(sweep.GasPrice, 10)
+	if !ok {
+		utils.ErrorReport.LogAndPrintError(fmt.Errorf("sweep %s has an invalid gas price %s", sweep.ID, sweep.GasPrice))
+		return
+	}
+	budget := eth.SweepBudgetPrice(price)
+
+	var senders []eth.Address
+	seen := make(map[eth.Address]bool)
+	for _, st := range sweep.Steps {
+		if st.Status == eth.SweepSent && !seen[st.From] {
+			seen[st.From] = true
+			senders = append(senders, st.From)
+		}
+	}
+
+	for _, from := range senders {
+		replaced, err := sender.ReplaceStuck(from, after, budget)
+		if err != nil {
+			utils.ErrorReport.LogAndPrintError(fmt.Errorf("sweep %s: %v", sweep.ID, err))
+		}
+		for _, p := range replaced {
+			for _, st := range sweep.Steps {
+				if st.Status == eth.SweepSent && st.From == from && uint64(st.Nonce) == p.Tx.Nonce {
+					st.Replaced = p.Hashes[:len(p.Hashes)-1]
+					st.TxHash = p.Hash()
+				}
+			}
+		}
+	}
+}
+
+// checkSentEthSweepSteps mark the sent transfers mined or failed from their receipts, with the receipts of
+// every version of their transactions requested at once. The transfers without receipt yet stay sent
+func checkSentEthSweepSteps(svc *eth.Eth, sweep *store.EthSweepSchema) error {
+	var steps []*store.EthSweepStepSchema
+	var hashes []string
+	for _, st := range sweep.Steps {
+		if st.Status != eth.SweepSent {
+			continue
+		}
+		for _, h := range append([]string{st.TxHash}, st.Replaced...) {
+			steps = append(steps, st)
+			hashes = append(hashes, h)
+		}
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	succeeded, errs, err := svc.TransactionsSucceeded(hashes)
+	if err != nil {
+		return err
+	}
+	for i, st := range steps {
+		if errs[i] != nil {
+			continue
+		}
+		// a single version of a transaction can be mined, it becomes the one of the transfer
+		st.TxHash = hashes[i]
+		if succeeded[i] {
+			st.Status = eth.SweepMined
+		} else {
+			st.Status = eth.SweepFailed
+		}
+	}
+	return nil
+}
+
+// sweepLeaseHolder random id of an execution of a sweep
+func sweepLeaseHolder() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// permanentSendError returns whether an error of the sender cannot be fixed by sending again
+func permanentSendError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, e := range permanentSendErrors {
+		if strings.Contains(msg, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// ethSweepStatus status of a sweep from the status of its steps
+func ethSweepStatus(sweep *store.EthSweepSchema) string {
+	status := eth.SweepDone
+	for _, st := range sweep.Steps {
+		switch st.Status {
+		case eth.SweepPlanned, eth.SweepSent:
+			return eth.SweepRunning
+		case eth.SweepFailed:
+			status = eth.SweepFailed
+		}
+	}
+	return status
+}
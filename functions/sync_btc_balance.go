@@ -1,30 +1,113 @@
 package functions
 
 import (
+	"encoding/json"
+	"fmt"
 	"math/big"
 
 	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
 	"github.com/SoteriaTech/blockchain-functions/helpers"
 	"github.com/SoteriaTech/blockchain-functions/store"
 	"github.com/SoteriaTech/blockchain-functions/utils"
 )
 
-// SyncBtcBalance sync the balance of user's account from its uid
-func SyncBtcBalance(uid string) (*store.BtcAccountSchema, *utils.ErrorService) {
-	btcAccount, errFind := store.Firestore.FindBtcAccount(uid)
+// BtcBalance balance computed from the utxos of the watched addresses at a confirmation depth
+type BtcBalance struct {
+	UID           string  `json:"uid"`
+	Address       string  `json:"address,omitempty"`
+	Height        int     `json:"height"` // last scanned height the confirmations are counted from
+	Confirmations int     `json:"confirmations"`
+	Balance       float64 `json:"balance"`
+}
+
+// BtcBalanceDrift difference between the balance computed from the utxos and the balance of the provider
+type BtcBalanceDrift struct {
+	BtcBalance
+	ProviderBalance float64 `json:"provider_balance"`
+	Drift           float64 `json:"drift"` // provider balance minus our balance
+}
+
+// GetBtcBalance compute the balance of every address of a user, accounts and wallets, from the unspent
+// outputs having at least the given number of confirmations
+func GetBtcBalance(uid string, confirmations int, config *env.ChainConfig) (*BtcBalance, *utils.ErrorService) {
+	svc, s, err := utxoChain(config)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	_, decimals := svc.Currency()
+	height, err := scannedBtcHeight(config)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	utxos, err := s.FindUnspentBtcUtxosByUID(uid)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	return &BtcBalance{
+		UID:           uid,
+		Height:        height,
+		Confirmations: confirmations,
+		Balance:       helpers.FromBaseUnits(helpers.BtcUtxosBalance(utxos, height, confirmations), decimals),
+	}, nil
+}
+
+// SyncBtcBalance reconcile the balance of user's account computed from its utxos with the balance reported
+// by the provider. The provider's balance also counts the outputs that are not scanned yet, so every
+// output is counted on our side whatever its confirmations. The stored balance is left untouched
+func SyncBtcBalance(uid string, config *env.ChainConfig) (*BtcBalanceDrift, *utils.ErrorService) {
+	svc, s, err := utxoChain(config)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	_, decimals := svc.Currency()
+	btcAccount, errFind := s.FindBtcAccount(uid)
 	if errFind != nil {
 		return nil, &utils.ErrorService{Code: 404, Err: errFind}
 	}
-	newBalance, errBalance := btc.BtcService.GetAccountBalance(btcAccount.Address)
+	height, err := scannedBtcHeight(config)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	utxos, err := s.FindUnspentBtcUtxosByAddress(btc.ToCanonicalAddress(btcAccount.Address, svc.Network()))
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	providerBalance, errBalance := svc.GetAccountBalance(btcAccount.Address)
 	if errBalance != nil {
 		return nil, &utils.ErrorService{Code: 400, Err: errBalance}
 	}
 
-	updatedBalance, errUpdate := store.Firestore.UpdateBtcBalance(btcAccount.UID, big.NewFloat(helpers.FromSatoshiToBtc(newBalance)))
-	if errUpdate != nil {
-		return nil, &utils.ErrorService{Code: 400, Err: errUpdate}
+	balance := helpers.BtcUtxosBalance(utxos, height, 0)
+	drift := new(big.Int).Sub(providerBalance, balance)
+	if drift.Sign() != 0 {
+		utils.ErrorReport.LogAndPrintError(fmt.Errorf("btc balance of %s drifts by %s satoshis from the provider at height %d", btcAccount.Address, drift, height))
 	}
 
-	btcAccount.BTC = updatedBalance
-	return btcAccount, nil
+	return &BtcBalanceDrift{
+		BtcBalance: BtcBalance{
+			UID:     uid,
+			Address: btcAccount.Address,
+			Height:  height,
+			Balance: helpers.FromBaseUnits(balance, decimals),
+		},
+		ProviderBalance: helpers.FromBaseUnits(providerBalance, decimals),
+		Drift:           helpers.FromBaseUnits(drift, decimals),
+	}, nil
+}
+
+// scannedBtcHeight returns the height of the last scanned block of the chain
+func scannedBtcHeight(config *env.ChainConfig) (int, error) {
+	state, err := store.Firestore.GetChainState(config.Chain)
+	if err != nil {
+		return 0, err
+	}
+
+	jsonState, _ := json.Marshal(&state)
+	cs := &btc.HeadBlock{}
+	if err = json.Unmarshal(jsonState, cs); err != nil {
+		return 0, err
+	}
+	return cs.Height, nil
 }
@@ -0,0 +1,17 @@
+package functions
+
+import (
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/store"
+)
+
+// utxoChain returns the service of the utxo chain of the config and the store scoped to its collections
+func utxoChain(config *env.ChainConfig) (*btc.Btc, *store.FireStoreStore, error) {
+	svc, err := btc.Service(config.Chain)
+	if err != nil {
+		return nil, nil, err
+	}
+	currency, _ := svc.Currency()
+	return svc, store.Firestore.UtxoChain(currency), nil
+}
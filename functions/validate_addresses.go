@@ -0,0 +1,89 @@
+package functions
+
+import (
+	"strings"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+	"github.com/SoteriaTech/blockchain-functions/validation"
+)
+
+// AddressValidation result of the validation of an address
+type AddressValidation struct {
+	Address string `json:"address"`
+	Valid   bool   `json:"valid"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// InvalidAccountAddress account whose address has been flagged as invalid
+type InvalidAccountAddress struct {
+	UID        string `json:"uid"`
+	Collection string `json:"collection"`
+	Address    string `json:"address"`
+	Reason     string `json:"reason"`
+}
+
+// ValidateAddress validate an address of the given family (btc or eth) against the configured network
+func ValidateAddress(family string, addr string, config *env.ChainConfig) *AddressValidation {
+	v := &AddressValidation{Address: addr, Valid: true}
+	if err := validation.ValidateAddress(family, addr, config.Chain); err != nil {
+		v.Valid = false
+		v.Reason = err.Error()
+	}
+	return v
+}
+
+// SweepAccountAddresses validate the address of every account of the utxo and evm chains, flag each
+// account with the result and returns the invalid ones. The accounts of the evm chains are shared, their
+// address must be valid on each of them
+func SweepAccountAddresses(utxoChains []*env.ChainConfig, evmChains []*env.ChainConfig) ([]*InvalidAccountAddress, *utils.ErrorService) {
+	var invalid []*InvalidAccountAddress
+
+	for _, chain := range utxoChains {
+		svc, s, err := utxoChain(chain)
+		if err != nil {
+			return nil, &utils.ErrorService{Code: 500, Err: err}
+		}
+		currency, _ := svc.Currency()
+		collection := strings.ToLower(currency) + "_accounts"
+
+		accs, err := s.GetAllBtcAccountAddresses()
+		if err != nil {
+			return nil, &utils.ErrorService{Code: 500, Err: err}
+		}
+		for _, a := range accs {
+			var reason string
+			if errAddr := validation.ValidateBtcAddress(a.Address, chain.Chain); errAddr != nil {
+				reason = errAddr.Error()
+				invalid = append(invalid, &InvalidAccountAddress{UID: a.UID, Collection: collection, Address: a.Address, Reason: reason})
+			}
+			if errUpdate := s.UpdateBtcAccountAddressValidity(a.UID, reason); errUpdate != nil {
+				return nil, &utils.ErrorService{Code: 500, Err: errUpdate}
+			}
+		}
+	}
+
+	if len(evmChains) == 0 {
+		return invalid, nil
+	}
+	ethAccs, err := store.Firestore.GetAllEthAccountAddresses()
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	for _, a := range ethAccs {
+		var reason string
+		for _, chain := range evmChains {
+			if errAddr := validation.ValidateAddress(validation.FamilyEth, a.Address, chain.Chain); errAddr != nil {
+				reason = errAddr.Error()
+				invalid = append(invalid, &InvalidAccountAddress{UID: a.UID, Collection: "eth_accounts", Address: a.Address, Reason: reason})
+				break
+			}
+		}
+		if errUpdate := store.Firestore.UpdateEthAccountAddressValidity(a.UID, reason); errUpdate != nil {
+			return nil, &utils.ErrorService{Code: 500, Err: errUpdate}
+		}
+	}
+
+	return invalid, nil
+}
@@ -8,10 +8,11 @@ require (
 	github.com/GoogleCloudPlatform/functions-framework-go v1.2.0
 	github.com/INFURA/go-ethlibs v0.0.0-20210329194929-717938b2f623
 	github.com/blockcypher/gobcy v2.0.1+incompatible
-	github.com/btcsuite/btcd v0.21.0-beta // indirect
+	github.com/btcsuite/btcd v0.21.0-beta
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
 	github.com/google/go-cmp v0.5.6 // indirect
 	github.com/google/uuid v1.2.0 // indirect
+	github.com/gorilla/websocket v1.4.2
 	github.com/magiconair/properties v1.8.5 // indirect
 	github.com/mitchellh/mapstructure v1.4.1 // indirect
 	github.com/onsi/ginkgo v1.14.0 // indirect
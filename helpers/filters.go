@@ -1,24 +1,28 @@
 package helpers
 
 import (
+	"math/big"
+	"strconv"
+
 	"github.com/SoteriaTech/blockchain-functions/btc"
 	"github.com/SoteriaTech/blockchain-functions/eth"
 	"github.com/SoteriaTech/blockchain-functions/store"
 )
 
-// FilterBtcTransactionsByAccountAddress filter a list of transactions by a list of btc addresses
-func FilterBtcTransactionsByAccountAddress(txs []*btc.Transaction, accs []*store.BtcAccountSchema) map[string]*store.BtcTransactionSchema {
+// FilterBtcTransactionsByAccountAddress filter a list of transactions by a list of btc addresses of the given
+// network compared by their canonical form, amounts converted with the decimals of the currency of the chain
+func FilterBtcTransactionsByAccountAddress(txs []*btc.Transaction, accs []*store.BtcAccountSchema, net *btc.Network, decimals int) map[string]*store.BtcTransactionSchema {
 	f := make(map[string]store.BtcAccountSchema, len(accs))
 	out := make(map[string]*store.BtcTransactionSchema)
 	for _, a := range accs {
-		f[a.Address] = *a
+		f[btc.ToCanonicalAddress(a.Address, net)] = *a
 	}
 	for _, t := range txs {
 		if acc, ok := f[t.Address]; ok {
 			tx := &store.BtcTransactionSchema{
 				To:          t.Address,
 				TxHash:      t.Hash,
-				Amount:      FromSatoshiToBtc(&t.Value),
+				Amount:      FromBaseUnits(&t.Value, decimals),
 				BlockHeight: t.BlockHeight,
 				VoutIdx:     t.N,
 			}
@@ -29,12 +33,98 @@ func FilterBtcTransactionsByAccountAddress(txs []*btc.Transaction, accs []*store
 	return out
 }
 
-// FilterEthTransactionsByAccountAddress filter a list of transactions by a list of btc addresses
-func FilterEthTransactionsByAccountAddress(txs []*eth.Transaction, accs []*store.EthAccountSchema) map[string]*store.EthTransactionSchema {
-	f := make(map[string]store.EthAccountSchema, len(accs))
-	out := make(map[string]*store.EthTransactionSchema)
+// FilterBtcTransactionsByWalletAddress filter a list of transactions by the addresses derived from watched wallets.
+// Each deposit is attributed to the user, the wallet and the derivation path of the receiving address
+func FilterBtcTransactionsByWalletAddress(txs []*btc.Transaction, addrs []*store.BtcWalletAddressSchema, decimals int) (out []*store.BtcTransactionSchema) {
+	f := make(map[string]*store.BtcWalletAddressSchema, len(addrs))
+	for _, a := range addrs {
+		f[a.Address] = a
+	}
+	for _, t := range txs {
+		if a, ok := f[t.Address]; ok {
+			out = append(out, &store.BtcTransactionSchema{
+				To:          t.Address,
+				TxHash:      t.Hash,
+				Amount:      FromBaseUnits(&t.Value, decimals),
+				BlockHeight: t.BlockHeight,
+				VoutIdx:     t.N,
+				UID:         a.UID,
+				WalletID:    a.WalletID,
+				Path:        a.Path,
+			})
+		}
+	}
+	return
+}
+
+// FilterBtcUtxosByAddress keep the outputs paying a watched address, owners maps the canonical form of each
+// watched address to its user
+func FilterBtcUtxosByAddress(txs []*btc.Transaction, owners map[string]string) (out []*store.BtcUtxoSchema) {
+	for _, t := range txs {
+		if uid, ok := owners[t.Address]; ok {
+			out = append(out, &store.BtcUtxoSchema{
+				TxHash:      t.Hash,
+				VoutIdx:     t.N,
+				TxIndex:     t.TxIndex.Int64(),
+				Address:     t.Address,
+				UID:         uid,
+				Value:       t.Value.Int64(),
+				BlockHeight: t.BlockHeight,
+			})
+		}
+	}
+	return
+}
+
+// FilterSpentBtcUtxos returns the outputs spent by the given inputs, marked with their spending transaction.
+// Inputs are matched on the previous hash or, when the provider does not return it, on the previous tx index
+func FilterSpentBtcUtxos(spends []*btc.Spend, utxos []*store.BtcUtxoSchema) (out []*store.BtcUtxoSchema) {
+	byHash := make(map[string]*store.BtcUtxoSchema, len(utxos))
+	byIndex := make(map[string]*store.BtcUtxoSchema, len(utxos))
+	for _, u := range utxos {
+		byHash[u.TxHash+":"+strconv.Itoa(u.VoutIdx)] = u
+		if u.TxIndex != 0 {
+			byIndex[strconv.FormatInt(u.TxIndex, 10)+":"+strconv.Itoa(u.VoutIdx)] = u
+		}
+	}
+	for _, s := range spends {
+		var u *store.BtcUtxoSchema
+		if s.PrevHash != "" {
+			u = byHash[s.PrevHash+":"+strconv.Itoa(s.PrevN)]
+		} else {
+			u = byIndex[s.PrevTxIndex.String()+":"+strconv.Itoa(s.PrevN)]
+		}
+		if u == nil || u.Spent {
+			continue
+		}
+		u.Spent = true
+		u.SpentBy = s.Hash
+		u.SpentHeight = s.BlockHeight
+		out = append(out, u)
+	}
+	return
+}
+
+// BtcUtxosBalance sum the outputs having at least the given number of confirmations at the given height
+func BtcUtxosBalance(utxos []*store.BtcUtxoSchema, height int, confirmations int) *big.Int {
+	bal := new(big.Int)
+	for _, u := range utxos {
+		if u.Spent || height-u.BlockHeight+1 < confirmations {
+			continue
+		}
+		bal.Add(bal, big.NewInt(u.Value))
+	}
+	return bal
+}
+
+// FilterEthTransactionsByAccountAddress filter a list of transactions by a list of eth addresses compared by their
+// canonical form, grouped by account uid. An account can receive several transfers in a block, each token
+// transfer being its own transaction
+func FilterEthTransactionsByAccountAddress(txs []*eth.Transaction, accs []*store.EthAccountSchema) map[string][]*store.EthTransactionSchema {
+	f := make(map[eth.Address]store.EthAccountSchema, len(accs))
+	out := make(map[string][]*store.EthTransactionSchema)
 	for _, a := range accs {
-		f[a.Address] = *a
+		f[eth.ToAddress(a.Address)] = *a
 	}
 	for _, t := range txs {
 		if acc, ok := f[t.Receiver]; ok {
@@ -48,12 +138,39 @@ func FilterEthTransactionsByAccountAddress(txs []*eth.Transaction, accs []*store
 				Receiver:    t.Receiver,
 				Currency:    t.Currency,
 			}
-			out[acc.UID] = tx
+			out[acc.UID] = append(out[acc.UID], tx)
 		}
 	}
 	return out
 }
 
+// FilterNftTransfersByAccountAddress keep the NFT transfers to a list of eth addresses compared by their
+// canonical form, as holdings of the accounts
+func FilterNftTransfersByAccountAddress(nfts []*eth.NftTransfer, accs []*store.EthAccountSchema) (out []*store.NftHoldingSchema) {
+	f := make(map[eth.Address]string, len(accs))
+	for _, a := range accs {
+		f[eth.ToAddress(a.Address)] = a.UID
+	}
+	for _, t := range nfts {
+		if uid, ok := f[t.To]; ok {
+			out = append(out, &store.NftHoldingSchema{
+				UID:         uid,
+				Contract:    t.Contract,
+				Collection:  t.Collection,
+				Standard:    t.Standard,
+				TokenID:     t.TokenID.String(),
+				Amount:      t.Amount.String(),
+				From:        t.From,
+				Receiver:    t.To,
+				TxHash:      t.Hash,
+				LogIdx:      t.LogIdx,
+				BlockHeight: t.BlockHeight,
+			})
+		}
+	}
+	return
+}
+
 // FilterBtcTransactionsByHash filter transactions by a slice of hashes
 func FilterBtcTransactionsByHash(txs []*store.BtcTransactionSchema, hashes []string) (out []*store.BtcTransactionSchema) {
 	f := make(map[string]*store.BtcTransactionSchema, len(txs))
@@ -70,17 +187,18 @@ func FilterBtcTransactionsByHash(txs []*store.BtcTransactionSchema, hashes []str
 	return
 }
 
-// FilterEthTransactionsByHash filter transactions by a slice of hashes
+// FilterEthTransactionsByHash filter transactions by a slice of hashes, keeping every transfer of a
+// transaction with several token transfers
 func FilterEthTransactionsByHash(txs []*store.EthTransactionSchema, hashes []string) (out []*store.EthTransactionSchema) {
-	f := make(map[string]*store.EthTransactionSchema, len(txs))
+	f := make(map[string]bool, len(hashes))
 
-	for _, t := range txs {
-		f[t.TxHash] = t
+	for _, h := range hashes {
+		f[h] = true
 	}
 
-	for _, h := range hashes {
-		if _, ok := f[h]; ok {
-			out = append(out, f[h])
+	for _, t := range txs {
+		if f[t.TxHash] {
+			out = append(out, t)
 		}
 	}
 	return
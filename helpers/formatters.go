@@ -21,17 +21,196 @@ func FormatBtcChainState(head *btc.HeadBlock) map[string]interface{} {
 	return state
 }
 
-// FormatEthChainState format the block header for database persistence
-func FormatEthChainState(head *eth.Header) map[string]interface{} {
+// FormatBtcBlockFees format the fee rates of a scanned block for database persistence
+func FormatBtcBlockFees(block *btc.ScannedBlock) *store.BtcBlockFeesSchema {
+	return &store.BtcBlockFeesSchema{
+		Height:      block.Height,
+		TxCount:     len(block.FeeRates),
+		Percentiles: btc.FeeRatePercentiles(block.FeeRates),
+	}
+}
+
+// FormatEthChainState format the block header and the finalized and safe blocks, when the chain has
+// them, for database persistence
+func FormatEthChainState(head *eth.Header, cp *eth.Checkpoints) map[string]interface{} {
 	state := make(map[string]interface{})
 	state["height"] = head.Height
 	state["hash"] = head.Hash
+	state["parent_hash"] = head.ParentHash
 	state["time"] = head.Time
 	state["last_updated"] = time.Now()
-	state["nonce"] = head.Nonce
+	state["gas_used"] = int64(head.GasUsed)
+	state["gas_limit"] = int64(head.GasLimit)
+	state["miner"] = head.Miner.String()
+	if head.BaseFee != nil {
+		state["base_fee"] = head.BaseFee.String()
+	}
+	if cp != nil && cp.Finalized != nil {
+		state["finalized_height"] = cp.Finalized.Height
+		state["finalized_hash"] = cp.Finalized.Hash
+	}
+	if cp != nil && cp.Safe != nil {
+		state["safe_height"] = cp.Safe.Height
+		state["safe_hash"] = cp.Safe.Hash
+	}
 	return state
 }
 
+// EthChainStateHeader returns the block header of a persisted chain state
+func EthChainStateHeader(state map[string]interface{}) *eth.Header {
+	h := &eth.Header{}
+	h.Height = int(stateInt(state["height"]))
+	h.Time = int(stateInt(state["time"]))
+	h.GasUsed = uint64(stateInt(state["gas_used"]))
+	h.GasLimit = uint64(stateInt(state["gas_limit"]))
+	h.Hash, _ = state["hash"].(string)
+	h.ParentHash, _ = state["parent_hash"].(string)
+	if miner, ok := state["miner"].(string); ok {
+		h.Miner = eth.Address(miner)
+	}
+	if fee, ok := state["base_fee"].(string); ok {
+		h.BaseFee = parseBig(fee)
+	}
+	if t, ok := state["last_updated"].(time.Time); ok {
+		h.LastUpdated = t
+	}
+	return h
+}
+
+// stateInt returns a number of a persisted chain state, firestore returns the integers as int64
+func stateInt(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+// SetEthTransactionCost set the type, gas and fee of the transaction it comes from on a transaction of
+// an account
+func SetEthTransactionCost(t *store.EthTransactionSchema, cost *eth.TxCost) {
+	t.TxType = int(cost.Type)
+	t.GasUsed = int64(cost.GasUsed)
+	t.EffectiveGasPrice = cost.EffectiveGasPrice.String()
+	t.Fee = cost.Fee.String()
+}
+
+// FormatEthSweep format a sweep plan for database persistence, each step waiting to be sent
+func FormatEthSweep(id string, plan *eth.SweepPlan) *store.EthSweepSchema {
+	s := &store.EthSweepSchema{
+		ID:        id,
+		Height:    int(plan.Height),
+		GasPrice:  plan.GasPrice.String(),
+		Status:    eth.SweepRunning,
+		CreatedAt: time.Now(),
+	}
+	for _, st := range plan.Steps {
+		s.Steps = append(s.Steps, &store.EthSweepStepSchema{
+			ID:        st.ID,
+			Kind:      st.Kind,
+			UID:       st.UID,
+			From:      st.From,
+			To:        st.To,
+			Currency:  st.Currency,
+			Contract:  st.Contract,
+			Amount:    st.Amount.String(),
+			Data:      st.Data,
+			GasLimit:  int64(st.GasLimit),
+			DependsOn: st.DependsOn,
+			Status:    eth.SweepPlanned,
+		})
+	}
+	return s
+}
+
+// EthSweepStep returns the transfer of a persisted step of a sweep
+func EthSweepStep(st *store.EthSweepStepSchema, gasPrice string) *eth.SweepStep {
+	amount, _ := new(big.Int).SetString(st.Amount, 10)
+	price, _ := new(big.Int).SetString(gasPrice, 10)
+	return &eth.SweepStep{
+		ID:        st.ID,
+		Kind:      st.Kind,
+		UID:       st.UID,
+		From:      st.From,
+		To:        st.To,
+		Currency:  st.Currency,
+		Contract:  st.Contract,
+		Amount:    amount,
+		Data:      st.Data,
+		GasLimit:  uint64(st.GasLimit),
+		GasPrice:  price,
+		DependsOn: st.DependsOn,
+	}
+}
+
+// FormatEthNonces format the pending transactions of an address for database persistence
+func FormatEthNonces(state *eth.NonceState) *store.EthNonceSchema {
+	n := &store.EthNonceSchema{Address: state.Address, Pending: []*store.EthPendingTxSchema{}}
+	for _, p := range state.Pending {
+		n.Pending = append(n.Pending, &store.EthPendingTxSchema{
+			Nonce:          int64(p.Tx.Nonce),
+			Type:           int(p.Tx.Type),
+			ChainID:        p.Tx.ChainID.String(),
+			To:             p.Tx.To,
+			Value:          p.Tx.Value.String(),
+			Data:           p.Tx.Data,
+			GasLimit:       int64(p.Tx.GasLimit),
+			GasPrice:       bigString(p.Tx.GasPrice),
+			MaxFee:         bigString(p.Tx.MaxFee),
+			MaxPriorityFee: bigString(p.Tx.MaxPriorityFee),
+			Hashes:         p.Hashes,
+			SentAt:         p.SentAt,
+		})
+	}
+	return n
+}
+
+// EthNonceState returns the pending transactions of an address from their persisted state
+func EthNonceState(n *store.EthNonceSchema) *eth.NonceState {
+	state := &eth.NonceState{Address: n.Address}
+	for _, p := range n.Pending {
+		state.Pending = append(state.Pending, &eth.PendingTx{
+			Tx: &eth.UnsignedTx{
+				Type:     uint8(p.Type),
+				ChainID:  parseBig(p.ChainID),
+				Nonce:    uint64(p.Nonce),
+				To:       p.To,
+				Value:    parseBig(p.Value),
+				Data:     p.Data,
+				GasLimit: uint64(p.GasLimit),
+				Fees: eth.Fees{
+					GasPrice:       parseBig(p.GasPrice),
+					MaxFee:         parseBig(p.MaxFee),
+					MaxPriorityFee: parseBig(p.MaxPriorityFee),
+				},
+			},
+			Hashes: p.Hashes,
+			SentAt: p.SentAt,
+		})
+	}
+	return state
+}
+
+func bigString(i *big.Int) string {
+	if i == nil {
+		return ""
+	}
+	return i.String()
+}
+
+// parseBig parse a persisted integer, nil when it is not set
+func parseBig(s string) *big.Int {
+	i, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil
+	}
+	return i
+}
+
 // SetCurrencyAmount set the amount of a specific eth currency for a given account
 func SetCurrencyAmount(acc *store.EthAccountSchema, t *store.EthTransactionSchema) *store.EthAccountSchema {
 
@@ -54,6 +233,12 @@ func updateEthDecimal(i *big.Int, dec int) *big.Float {
 	return intToFloat(i, dec)
 }
 
+// FromBaseUnits convert a value in the base units of a utxo chain (int) to a value in its currency (float)
+func FromBaseUnits(i *big.Int, decimals int) (f float64) {
+	f, _ = intToFloat(i, decimals).Float64()
+	return
+}
+
 // FromSatoshiToBtc convert a value in satoshi (int) to a value in btc (float)
 func FromSatoshiToBtc(i *big.Int) (f float64) {
 	f, _ = intToFloat(i, 9).Float64()
@@ -5,25 +5,27 @@ import (
 	"math/big"
 	"strconv"
 
+	"github.com/SoteriaTech/blockchain-functions/btc"
 	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/eth"
 	"github.com/SoteriaTech/blockchain-functions/store"
 )
 
 // FindOrCreateBtcTransaction find a btc transaction and returns it, or create it if not exist and returns nothing
-func FindOrCreateBtcTransaction(t *store.BtcTransactionSchema) (tx *store.BtcTransactionSchema, err error) {
-	tx, err = store.Firestore.FindBtcTransaction(t.TxHash + strconv.Itoa(t.VoutIdx))
+func FindOrCreateBtcTransaction(s *store.FireStoreStore, t *store.BtcTransactionSchema) (tx *store.BtcTransactionSchema, err error) {
+	tx, err = s.FindBtcTransaction(t.TxHash + strconv.Itoa(t.VoutIdx))
 	if err != nil {
 		log.Fatal(err)
 		return
 	}
 
-	err = store.Firestore.CreateBtcTransaction(t)
+	err = s.CreateBtcTransaction(t)
 	return
 }
 
 // FindOrCreateEthTransaction find an ethereum transaction and returns it, or create it if not exist and returns nothing
-func FindOrCreateEthTransaction(t *store.EthTransactionSchema) (tx *store.EthTransactionSchema, err error) {
-	tx, err = store.Firestore.FindEthTransaction(t.TxHash + t.LogIdx)
+func FindOrCreateEthTransaction(s *store.FireStoreStore, t *store.EthTransactionSchema) (tx *store.EthTransactionSchema, err error) {
+	tx, err = s.FindEthTransaction(t.TxHash + t.LogIdx)
 	if err != nil {
 		log.Fatal(err)
 		return
@@ -31,19 +33,34 @@ func FindOrCreateEthTransaction(t *store.EthTransactionSchema) (tx *store.EthTra
 	if tx != nil {
 		return
 	}
-	err = store.Firestore.CreateEthTransaction(t)
+	err = s.CreateEthTransaction(t)
 	return
 }
 
+// RecordRevertedEthTransactions move reverted transactions out of the transactions to credit, into the
+// reverted transactions kept for support
+func RecordRevertedEthTransactions(s *store.FireStoreStore, txs []*store.EthTransactionSchema) error {
+	for _, t := range txs {
+		t.Confirmed = false
+		if err := s.CreateEthRevertedTransaction(t); err != nil {
+			return err
+		}
+		if err := s.DeleteEthTransaction(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // UpdateAccountBtcBalance update the btc balance of a user UID by a given amount
-func UpdateAccountBtcBalance(uid string, amount *big.Float) (*big.Float, error) {
-	bal, errBal := store.Firestore.FindBtcBalance(uid)
+func UpdateAccountBtcBalance(s *store.FireStoreStore, uid string, amount *big.Float) (*big.Float, error) {
+	bal, errBal := s.FindBtcBalance(uid)
 	if errBal != nil {
 		return nil, errBal
 	}
 	newBalance := new(big.Float).Add(amount, big.NewFloat(bal))
 
-	updatedBalance, errUpdate := store.Firestore.UpdateBtcBalance(uid, newBalance)
+	updatedBalance, errUpdate := s.UpdateBtcBalance(uid, newBalance)
 	if errUpdate != nil {
 		return nil, errUpdate
 	}
@@ -51,20 +68,24 @@ func UpdateAccountBtcBalance(uid string, amount *big.Float) (*big.Float, error)
 	return big.NewFloat(updatedBalance), nil
 }
 
-// ConfirmBtcTransactions confirm transactions and update corresponding balances
-func ConfirmBtcTransactions(txs []*store.BtcTransactionSchema) (err error) {
-	if err = store.Firestore.UpdateBtcTransactionsConfirmation(txs); err != nil {
+// ConfirmBtcTransactions confirm transactions of the given network and update corresponding balances
+func ConfirmBtcTransactions(s *store.FireStoreStore, txs []*store.BtcTransactionSchema, net *btc.Network) (err error) {
+	if err = s.UpdateBtcTransactionsConfirmation(txs); err != nil {
 		log.Fatal(err)
 		return
 	}
 
 	for _, t := range txs {
-		a, err := store.Firestore.FindBtcAccountByAddress(t.To)
-		if err != nil {
-			log.Fatal(err)
-			continue
+		uid := t.UID
+		if uid == "" {
+			a, err := s.FindBtcAccountByAddress(t.To, net)
+			if err != nil {
+				log.Fatal(err)
+				continue
+			}
+			uid = a.UID
 		}
-		if _, err = UpdateAccountBtcBalance(a.UID, big.NewFloat(t.Amount)); err != nil {
+		if _, err = UpdateAccountBtcBalance(s, uid, big.NewFloat(t.Amount)); err != nil {
 			log.Fatal(err)
 			continue
 		}
@@ -73,26 +94,105 @@ func ConfirmBtcTransactions(txs []*store.BtcTransactionSchema) (err error) {
 	return
 }
 
+// RecordBtcUtxos record the outputs of a block paying the watched addresses, then mark the watched
+// outputs spent by its inputs, including the ones created in the same block. Only the outputs the inputs
+// spend are read, by outpoint or by the provider index of their transaction
+func RecordBtcUtxos(s *store.FireStoreStore, txs []*btc.Transaction, spends []*btc.Spend, owners map[string]string) error {
+	utxos := FilterBtcUtxosByAddress(txs, owners)
+	if err := s.CreateBtcUtxos(utxos); err != nil {
+		return err
+	}
+
+	var outpoints []string
+	var indexes []int64
+	seen := make(map[int64]bool)
+	for _, sp := range spends {
+		// the providers that label the spent outputs tell the ones of the watched addresses apart, the
+		// inputs of raw blocks are all looked up
+		if _, ok := owners[sp.Address]; sp.Address != "" && !ok {
+			continue
+		}
+		if sp.PrevHash != "" {
+			outpoints = append(outpoints, sp.PrevHash+":"+strconv.Itoa(sp.PrevN))
+			continue
+		}
+		if i := sp.PrevTxIndex.Int64(); !seen[i] {
+			seen[i] = true
+			indexes = append(indexes, i)
+		}
+	}
+	spent, err := s.FindBtcUtxosByOutpoint(outpoints)
+	if err != nil {
+		return err
+	}
+	byIndex, err := s.FindBtcUtxosByTxIndex(indexes)
+	if err != nil {
+		return err
+	}
+	return s.SpendBtcUtxos(FilterSpentBtcUtxos(spends, append(spent, byIndex...)))
+}
+
+// ExtendBtcWallet mark the address at the given index of a wallet as used and derive new addresses
+// so that gap limit unused addresses are always watched after the last used one
+func ExtendBtcWallet(s *store.FireStoreStore, w *store.BtcWalletSchema, used int, net *btc.Network) error {
+	if used > w.LastUsed {
+		w.LastUsed = used
+	}
+	target := w.LastUsed + 1 + w.GapLimit
+	if target <= w.Derived {
+		return s.UpdateBtcWalletIndexes(w)
+	}
+
+	d, err := btc.ParseDescriptor(w.Descriptor)
+	if err != nil {
+		return err
+	}
+	var addrs []*store.BtcWalletAddressSchema
+	for i := w.Derived; i < target; i++ {
+		addr, path, errAddr := d.Address(uint32(i), net)
+		if errAddr == btc.ErrInvalidChild {
+			// BIP32 skips the indexes that do not produce a valid key
+			continue
+		}
+		if errAddr != nil {
+			return errAddr
+		}
+		addrs = append(addrs, &store.BtcWalletAddressSchema{
+			Address:  addr,
+			UID:      w.UID,
+			WalletID: w.ID,
+			Path:     path,
+			Index:    i,
+		})
+	}
+
+	if err = s.CreateBtcWalletAddresses(addrs); err != nil {
+		return err
+	}
+	w.Derived = target
+	return s.UpdateBtcWalletIndexes(w)
+}
+
 // ConfirmEthTransactions confirm transactions and update corresponding balances
-func ConfirmEthTransactions(txs []*store.EthTransactionSchema, config *env.ChainConfig) (err error) {
-	if err = store.Firestore.UpdateEthTransactionsConfirmation(txs); err != nil {
+func ConfirmEthTransactions(s *store.FireStoreStore, txs []*store.EthTransactionSchema, config *env.ChainConfig) (err error) {
+	if err = s.UpdateEthTransactionsConfirmation(txs); err != nil {
 		log.Fatal(err)
 		return
 	}
 
 	for _, t := range txs {
 		// if the transaction if from the gas station then we do not update the balance
-		if t.From == config.GasStation {
+		if t.From.Equal(config.GasStation) {
 			continue
 		}
-		a, err := store.Firestore.FindEthAccountByAddress(t.Receiver)
+		a, err := s.FindEthAccountByAddress(t.Receiver)
 		if err != nil {
 			log.Print(err)
 			continue
 		}
 		weiAmount, _ := new(big.Int).SetString(t.Amount, 10)
-		curr := env.FindCurrency(t.To, config.Currencies)
-		if _, err = updateAccountEthBalance(a.UID, updateEthDecimal(weiAmount, curr.Decimals), t.Currency); err != nil {
+		curr := env.FindCurrency(t.To.String(), config.Currencies)
+		if _, err = updateAccountEthBalance(s, a.UID, updateEthDecimal(weiAmount, curr.Decimals), t.Currency); err != nil {
 			log.Print(err)
 			continue
 		}
@@ -101,8 +201,8 @@ func ConfirmEthTransactions(txs []*store.EthTransactionSchema, config *env.Chain
 }
 
 // UpdateAccountEthBalance update the eth balance of a user UID by a given amount
-func updateAccountEthBalance(uid string, toAdd *big.Float, curr string) (float64, error) {
-	base, errBal := store.Firestore.FindEthBalance(uid, curr)
+func updateAccountEthBalance(s *store.FireStoreStore, uid string, toAdd *big.Float, curr string) (float64, error) {
+	base, errBal := s.FindEthBalance(uid, curr)
 	if errBal != nil {
 		return 0, errBal
 	}
@@ -111,10 +211,35 @@ func updateAccountEthBalance(uid string, toAdd *big.Float, curr string) (float64
 		base = big.NewFloat(0)
 	}
 	total := new(big.Float).Add(base, toAdd)
-	updatedBalance, errUpdate := store.Firestore.UpdateEthBalance(uid, total, curr)
+	updatedBalance, errUpdate := s.UpdateEthBalance(uid, total, curr)
 	if errUpdate != nil {
 		return 0, errUpdate
 	}
 
 	return updatedBalance, nil
 }
+
+// EthNonceStore eth.NonceStore of the pending transactions of the addresses of an evm chain in firestore
+type EthNonceStore struct {
+	s *store.FireStoreStore
+}
+
+// NewEthNonceStore create the nonce store of the evm chain of a store
+func NewEthNonceStore(s *store.FireStoreStore) *EthNonceStore {
+	return &EthNonceStore{s: s}
+}
+
+// UpdateNonces update the pending transactions of an address in a firestore transaction
+func (n *EthNonceStore) UpdateNonces(addr eth.Address, update func(state *eth.NonceState) error) error {
+	return n.s.UpdateEthNonces(addr, func(nonces *store.EthNonceSchema) (*store.EthNonceSchema, error) {
+		state := &eth.NonceState{Address: addr}
+		if nonces != nil {
+			state = EthNonceState(nonces)
+		}
+		state.Address = addr
+		if err := update(state); err != nil {
+			return nil, err
+		}
+		return FormatEthNonces(state), nil
+	})
+}
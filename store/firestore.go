@@ -2,28 +2,85 @@ package store
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"math/big"
 	"strconv"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/eth"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-// FireStoreStore struct for firestore DB
+// FireStoreStore struct for firestore DB. The btc methods read and write the collections of the
+// utxo chain the store is scoped to, bitcoin by default, and the eth methods the ones of the evm
+// chain it is scoped to, ethereum by default
 type FireStoreStore struct {
-	Client *firestore.Client
-	ctx    context.Context
+	Client   *firestore.Client
+	ctx      context.Context
+	currency string
+	prefix   string
+}
+
+// defaultUtxoCurrency currency of the utxo chain of the unscoped store
+const defaultUtxoCurrency string = "BTC"
+
+const (
+	// utxoBatchSize number of outputs read at once by document id
+	utxoBatchSize int = 100
+	// inQuerySize max number of values of an in query
+	inQuerySize int = 10
+)
+
+// UtxoChain returns a copy of the store scoped to the utxo chain of the given currency. Its btc methods
+// use the collections prefixed by the lowercase currency (ltc_accounts, doge_transactions...) and
+// the currency field of the balances
+func (f *FireStoreStore) UtxoChain(currency string) *FireStoreStore {
+	return &FireStoreStore{Client: f.Client, ctx: f.ctx, currency: currency, prefix: f.prefix}
+}
+
+// defaultEvmPrefix prefix of the collections of the evm chain of the unscoped store
+const defaultEvmPrefix string = "eth"
+
+// EvmChain returns a copy of the store scoped to the evm chain of the given collection prefix. Its eth
+// methods use the transactions collections of the prefix (polygon_transactions...), while the accounts
+// are shared by all the evm chains
+func (f *FireStoreStore) EvmChain(prefix string) *FireStoreStore {
+	return &FireStoreStore{Client: f.Client, ctx: f.ctx, prefix: prefix}
+}
+
+// evmCollection returns the name of a collection of the evm chain of the store
+func (f *FireStoreStore) evmCollection(name string) string {
+	prefix := f.prefix
+	if prefix == "" {
+		prefix = defaultEvmPrefix
+	}
+	return prefix + "_" + name
+}
+
+// utxoCurrency returns the currency of the utxo chain of the store
+func (f *FireStoreStore) utxoCurrency() string {
+	if f.currency == "" {
+		return defaultUtxoCurrency
+	}
+	return f.currency
+}
+
+// utxoCollection returns the name of a collection of the utxo chain of the store
+func (f *FireStoreStore) utxoCollection(name string) string {
+	return strings.ToLower(f.utxoCurrency()) + "_" + name
 }
 
 // Firestore instance of Firestore store
 var Firestore *FireStoreStore
 
-//InitFirestoreStore initialize a new firestore client
+// InitFirestoreStore initialize a new firestore client
 func InitFirestoreStore(projectID string, keyPath string) {
 	ctx := context.Background()
 	client := newFireStoreClient(ctx, projectID, keyPath)
@@ -46,7 +103,7 @@ func newFireStoreClient(ctx context.Context, projectID string, keyPath string) *
 func (f *FireStoreStore) FindBtcAccount(uid string) (*BtcAccountSchema, error) {
 	var btcAccount *BtcAccountSchema
 
-	doc, err := f.Client.Collection("btc_accounts").Doc(uid).Get(f.ctx)
+	doc, err := f.Client.Collection(f.utxoCollection("accounts")).Doc(uid).Get(f.ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -60,51 +117,43 @@ func (f *FireStoreStore) FindBtcAccount(uid string) (*BtcAccountSchema, error) {
 
 // FindBtcBalance find the btc balance of a user UID
 func (f *FireStoreStore) FindBtcBalance(uid string) (float64, error) {
-	data := make(map[string]float64)
-
-	doc, err := f.Client.Collection("balances").Doc(uid).Get(f.ctx)
-	if err != nil {
-		return 0, err
-	}
-
-	if err := doc.DataTo(&data); err != nil {
-		return 0, err
-	}
-
-	return data["BTC"], nil
+	return f.findBalance(uid, f.utxoCurrency())
 }
 
-// FindEthBalance find the eth balance of a user UID
+// FindEthBalance find the balance of a user UID in the given currency of an evm chain
 func (f *FireStoreStore) FindEthBalance(uid string, curr string) (*big.Float, error) {
-	data := &EthAccountSchema{}
-
-	doc, err := f.Client.Collection("balances").Doc(uid).Get(f.ctx)
+	balance, err := f.findBalance(uid, curr)
 	if err != nil {
 		return nil, err
 	}
+	return big.NewFloat(balance), nil
+}
 
-	if err := doc.DataTo(&data); err != nil {
-		log.Fatalf("error here %v", err)
-		return nil, err
-	}
-	// TODO: that's bad, need to refactor
-	val := data.ETH
-	if curr == "USDC" {
-		val = data.USDC
+// findBalance find the balance of a user UID in a currency, 0 when it has none. The balances doc holds
+// the balances of every chain and may hold other fields, only the one of the currency is read
+func (f *FireStoreStore) findBalance(uid string, curr string) (float64, error) {
+	doc, err := f.Client.Collection("balances").Doc(uid).Get(f.ctx)
+	if err != nil {
+		return 0, err
 	}
 
-	if curr == "USDT" {
-		val = data.USDT
+	switch v := doc.Data()[curr].(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	default:
+		return 0, fmt.Errorf("balance %s of %s is not a number: %v", curr, uid, v)
 	}
-
-	return big.NewFloat(val), nil
 }
 
 // UpdateBtcBalance update the btc balance of a user's account
 func (f *FireStoreStore) UpdateBtcBalance(uid string, newBalance *big.Float) (float64, error) {
 	doc := make(map[string]interface{})
 	flBalance, _ := newBalance.Float64()
-	doc["BTC"] = flBalance
+	doc[f.utxoCurrency()] = flBalance
 
 	_, err := f.Client.Collection("balances").Doc(uid).Set(f.ctx, doc, firestore.MergeAll)
 	if err != nil {
@@ -128,7 +177,7 @@ func (f *FireStoreStore) UpdateEthBalance(uid string, bal *big.Float, curr strin
 // GetAllBtcAccountAddresses get all the current bitcoin accounts and addresses from Soteria
 func (f *FireStoreStore) GetAllBtcAccountAddresses() ([]*BtcAccountSchema, error) {
 	var accs []*BtcAccountSchema
-	iter := f.Client.Collection("btc_accounts").Documents(f.ctx)
+	iter := f.Client.Collection(f.utxoCollection("accounts")).Documents(f.ctx)
 	for {
 		doc, err := iter.Next()
 		if err == iterator.Done {
@@ -188,7 +237,7 @@ func (f *FireStoreStore) GetConvertRequests(uid string) (map[string]interface{},
 
 // FindBtcTransaction find a btc transaction by hash
 func (f *FireStoreStore) FindBtcTransaction(idx string) (t *BtcTransactionSchema, err error) {
-	doc, errStore := f.Client.Collection("btc_transactions").Doc(idx).Get(f.ctx)
+	doc, errStore := f.Client.Collection(f.utxoCollection("transactions")).Doc(idx).Get(f.ctx)
 
 	if errStore != nil && status.Code(errStore) != codes.NotFound {
 		err = errStore
@@ -206,7 +255,7 @@ func (f *FireStoreStore) FindBtcTransaction(idx string) (t *BtcTransactionSchema
 
 // FindEthTransaction find an ethereum transaction by hash
 func (f *FireStoreStore) FindEthTransaction(idx string) (t *EthTransactionSchema, err error) {
-	doc, errStore := f.Client.Collection("eth_transactions").Doc(idx).Get(f.ctx)
+	doc, errStore := f.Client.Collection(f.evmCollection("transactions")).Doc(idx).Get(f.ctx)
 
 	if errStore != nil && status.Code(errStore) != codes.NotFound {
 		err = errStore
@@ -224,19 +273,186 @@ func (f *FireStoreStore) FindEthTransaction(idx string) (t *EthTransactionSchema
 
 // CreateBtcTransaction create a btc transaction
 func (f *FireStoreStore) CreateBtcTransaction(t *BtcTransactionSchema) (err error) {
-	_, err = f.Client.Collection("btc_transactions").Doc(t.TxHash+strconv.Itoa(t.VoutIdx)).Create(f.ctx, &t)
+	_, err = f.Client.Collection(f.utxoCollection("transactions")).Doc(t.TxHash+strconv.Itoa(t.VoutIdx)).Create(f.ctx, &t)
 	return
 }
 
 // CreateEthTransaction create an eth transactions
 func (f *FireStoreStore) CreateEthTransaction(t *EthTransactionSchema) (err error) {
-	_, err = f.Client.Collection("eth_transactions").Doc(t.TxHash+t.LogIdx).Create(f.ctx, &t)
+	_, err = f.Client.Collection(f.evmCollection("transactions")).Doc(t.TxHash+t.LogIdx).Create(f.ctx, &t)
 	if err != nil {
 		log.Fatal(err)
 	}
 	return
 }
 
+// CreateEthRevertedTransaction record a transaction to an account that reverted, apart from the credited
+// transactions. Recording it again on a rescan overwrites it
+func (f *FireStoreStore) CreateEthRevertedTransaction(t *EthTransactionSchema) (err error) {
+	_, err = f.Client.Collection(f.evmCollection("reverted_transactions")).Doc(t.TxHash+t.LogIdx).Set(f.ctx, &t)
+	return
+}
+
+// DeleteEthTransaction delete an eth transaction, deleting a missing transaction is not an error
+func (f *FireStoreStore) DeleteEthTransaction(t *EthTransactionSchema) (err error) {
+	_, err = f.Client.Collection(f.evmCollection("transactions")).Doc(t.TxHash + t.LogIdx).Delete(f.ctx)
+	return
+}
+
+// CreateNftHoldings record the NFTs received by the accounts, unconfirmed. Recording them again on a rescan
+// overwrites them, except the ones confirmed in the same block
+func (f *FireStoreStore) CreateNftHoldings(holdings []*NftHoldingSchema) error {
+	for _, h := range holdings {
+		ref := f.Client.Collection(f.evmCollection("nft_holdings")).Doc(h.TxHash + h.LogIdx)
+		doc, err := ref.Get(f.ctx)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var prev *NftHoldingSchema
+			if err = doc.DataTo(&prev); err != nil {
+				return err
+			}
+			if prev.Confirmed && prev.BlockHeight == h.BlockHeight {
+				continue
+			}
+		}
+		if _, err = ref.Set(f.ctx, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindNftHoldingsFromBlockHeight find the unconfirmed NFT holdings recorded at a block height
+func (f *FireStoreStore) FindNftHoldingsFromBlockHeight(h int) ([]*NftHoldingSchema, error) {
+	var holdings []*NftHoldingSchema
+	iter := f.Client.Collection(f.evmCollection("nft_holdings")).Where("block_height", "==", h).Where("confirmed", "==", false).Documents(f.ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var nh *NftHoldingSchema
+		if err = doc.DataTo(&nh); err != nil {
+			return nil, err
+		}
+		holdings = append(holdings, nh)
+	}
+	return holdings, nil
+}
+
+// UpdateNftHoldingsConfirmation confirm each given NFT holding
+func (f *FireStoreStore) UpdateNftHoldingsConfirmation(holdings []*NftHoldingSchema) error {
+	for _, h := range holdings {
+		_, err := f.Client.Collection(f.evmCollection("nft_holdings")).Doc(h.TxHash+h.LogIdx).Set(f.ctx, NftHoldingSchema{Confirmed: true}, firestore.Merge([]string{"confirmed"}))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteNftHolding delete an NFT holding, deleting a missing holding is not an error
+func (f *FireStoreStore) DeleteNftHolding(h *NftHoldingSchema) (err error) {
+	_, err = f.Client.Collection(f.evmCollection("nft_holdings")).Doc(h.TxHash + h.LogIdx).Delete(f.ctx)
+	return
+}
+
+// CreateEthSweep create a sweep, a sweep of the same ID cannot be created twice
+func (f *FireStoreStore) CreateEthSweep(s *EthSweepSchema) (err error) {
+	_, err = f.Client.Collection(f.evmCollection("sweeps")).Doc(s.ID).Create(f.ctx, s)
+	return
+}
+
+// FindEthSweep find a sweep by ID
+func (f *FireStoreStore) FindEthSweep(id string) (s *EthSweepSchema, err error) {
+	doc, err := f.Client.Collection(f.evmCollection("sweeps")).Doc(id).Get(f.ctx)
+	if err != nil {
+		return
+	}
+	err = doc.DataTo(&s)
+	return
+}
+
+// FindEthSweepsByStatus find the sweeps having the given status
+func (f *FireStoreStore) FindEthSweepsByStatus(st string) ([]*EthSweepSchema, error) {
+	var sweeps []*EthSweepSchema
+	iter := f.Client.Collection(f.evmCollection("sweeps")).Where("status", "==", st).Documents(f.ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var s *EthSweepSchema
+		if err = doc.DataTo(&s); err != nil {
+			return nil, err
+		}
+		sweeps = append(sweeps, s)
+	}
+	return sweeps, nil
+}
+
+// ClaimEthSweep lease a running sweep to a holder until the given time, in a transaction so that two
+// executions never hold it at once. The sweep is returned with ok false, without lease, when it is not
+// running or another holder has an unexpired lease
+func (f *FireStoreStore) ClaimEthSweep(id string, holder string, until time.Time) (s *EthSweepSchema, ok bool, err error) {
+	ref := f.Client.Collection(f.evmCollection("sweeps")).Doc(id)
+	err = f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		s, ok = nil, false
+		doc, errGet := tx.Get(ref)
+		if errGet != nil {
+			return errGet
+		}
+		if errGet = doc.DataTo(&s); errGet != nil {
+			return errGet
+		}
+		if s.Status != eth.SweepRunning || (s.LeaseHolder != holder && s.LeaseUntil.After(time.Now())) {
+			return nil
+		}
+		s.LeaseHolder = holder
+		s.LeaseUntil = until
+		ok = true
+		return tx.Set(ref, s)
+	})
+	return
+}
+
+// UpdateEthSweep save the execution state of a sweep
+func (f *FireStoreStore) UpdateEthSweep(s *EthSweepSchema) (err error) {
+	_, err = f.Client.Collection(f.evmCollection("sweeps")).Doc(s.ID).Set(f.ctx, s)
+	return
+}
+
+// UpdateEthNonces update the pending transactions of an address in a transaction, the update gets nil when
+// the address has never sent any. The transaction holds the document until the state is saved, the senders
+// of the address wait for each other
+func (f *FireStoreStore) UpdateEthNonces(addr eth.Address, update func(n *EthNonceSchema) (*EthNonceSchema, error)) error {
+	ref := f.Client.Collection(f.evmCollection("nonces")).Doc(addr.String())
+	return f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var n *EthNonceSchema
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if err = doc.DataTo(&n); err != nil {
+				return err
+			}
+		}
+		if n, err = update(n); err != nil {
+			return err
+		}
+		return tx.Set(ref, n)
+	})
+}
+
 // GetChainState get the latest block data of the given chain from the store
 func (f *FireStoreStore) GetChainState(chain string) (map[string]interface{}, error) {
 	hs := make(map[string]interface{})
@@ -260,7 +476,7 @@ func (f *FireStoreStore) UpdateChainState(chain string, data map[string]interfac
 
 // FindBtcTransactionsFromBlockHeight find transactions that have been recorded from a specific block height
 func (f *FireStoreStore) FindBtcTransactionsFromBlockHeight(h int) (txs []*BtcTransactionSchema, err error) {
-	iter := f.Client.Collection("btc_transactions").Where("block_height", "==", h).Where("confirmed", "==", false).Documents(f.ctx)
+	iter := f.Client.Collection(f.utxoCollection("transactions")).Where("block_height", "==", h).Where("confirmed", "==", false).Documents(f.ctx)
 	for {
 		doc, errIter := iter.Next()
 		if errIter == iterator.Done {
@@ -283,7 +499,7 @@ func (f *FireStoreStore) FindBtcTransactionsFromBlockHeight(h int) (txs []*BtcTr
 // FindEthTransactionsFromBlockHeight find transactions that have been recorded from a specific block height
 func (f *FireStoreStore) FindEthTransactionsFromBlockHeight(h int) ([]*EthTransactionSchema, error) {
 	var txs []*EthTransactionSchema
-	iter := f.Client.Collection("eth_transactions").Where("block_height", "==", h).Where("confirmed", "==", false).Documents(f.ctx)
+	iter := f.Client.Collection(f.evmCollection("transactions")).Where("block_height", "==", h).Where("confirmed", "==", false).Documents(f.ctx)
 	for {
 		doc, err := iter.Next()
 		if err == iterator.Done {
@@ -310,7 +526,7 @@ func (f *FireStoreStore) UpdateBtcTransactionsConfirmation(txs []*BtcTransaction
 		if t.VoutIdx >= 0 {
 			uid = uid + strconv.Itoa(t.VoutIdx)
 		}
-		_, errSet := f.Client.Collection("btc_transactions").Doc(uid).Set(f.ctx, BtcTransactionSchema{Confirmed: true}, firestore.Merge([]string{"confirmed"}))
+		_, errSet := f.Client.Collection(f.utxoCollection("transactions")).Doc(uid).Set(f.ctx, BtcTransactionSchema{Confirmed: true}, firestore.Merge([]string{"confirmed"}))
 		if err != nil {
 			err = errSet
 			continue
@@ -327,7 +543,7 @@ func (f *FireStoreStore) UpdateEthTransactionsConfirmation(txs []*EthTransaction
 		if t.LogIdx != "" {
 			uid = uid + t.LogIdx
 		}
-		_, errSet := f.Client.Collection("eth_transactions").Doc(uid).Set(f.ctx, BtcTransactionSchema{Confirmed: true}, firestore.Merge([]string{"confirmed"}))
+		_, errSet := f.Client.Collection(f.evmCollection("transactions")).Doc(uid).Set(f.ctx, BtcTransactionSchema{Confirmed: true}, firestore.Merge([]string{"confirmed"}))
 		if err != nil {
 			err = errSet
 			continue
@@ -337,9 +553,10 @@ func (f *FireStoreStore) UpdateEthTransactionsConfirmation(txs []*EthTransaction
 	return
 }
 
-// FindBtcAccountByAddress find a firestore bitcoin account from an address
-func (f *FireStoreStore) FindBtcAccountByAddress(addr string) (a *BtcAccountSchema, err error) {
-	doc, errQ := f.Client.Collection("btc_accounts").Where("address", "==", addr).Documents(f.ctx).Next()
+// FindBtcAccountByAddress find a firestore bitcoin account from an address of the given network, saved
+// with any of its forms
+func (f *FireStoreStore) FindBtcAccountByAddress(addr string, net *btc.Network) (a *BtcAccountSchema, err error) {
+	doc, errQ := f.Client.Collection(f.utxoCollection("accounts")).Where("address", "in", btc.AddressForms(addr, net)).Documents(f.ctx).Next()
 	if errQ != nil {
 		err = errQ
 		return
@@ -351,9 +568,28 @@ func (f *FireStoreStore) FindBtcAccountByAddress(addr string) (a *BtcAccountSche
 	return
 }
 
-// FindEthAccountByAddress find a firestore bitcoin account from an address
-func (f *FireStoreStore) FindEthAccountByAddress(addr string) (a *EthAccountSchema, err error) {
-	doc, errQ := f.Client.Collection("eth_accounts").Where("address", "==", addr).Documents(f.ctx).Next()
+// FindEthAccount find the ethereum account of a user UID
+func (f *FireStoreStore) FindEthAccount(uid string) (a *EthAccountSchema, err error) {
+	doc, err := f.Client.Collection("eth_accounts").Doc(uid).Get(f.ctx)
+	if err != nil {
+		return
+	}
+	if err = doc.DataTo(&a); err != nil {
+		return
+	}
+	a.UID = doc.Ref.ID
+	return
+}
+
+// UpdateEthAccountAddress set the deposit address of an ethereum account
+func (f *FireStoreStore) UpdateEthAccountAddress(uid string, addr eth.Address) (err error) {
+	_, err = f.Client.Collection("eth_accounts").Doc(uid).Set(f.ctx, map[string]interface{}{"address": addr.String()}, firestore.MergeAll)
+	return
+}
+
+// FindEthAccountByAddress find a firestore ethereum account from an address, saved with any of its forms
+func (f *FireStoreStore) FindEthAccountByAddress(addr eth.Address) (a *EthAccountSchema, err error) {
+	doc, errQ := f.Client.Collection("eth_accounts").Where("address", "in", addr.Forms()).Documents(f.ctx).Next()
 	if errQ != nil {
 		err = errQ
 		return
@@ -365,6 +601,214 @@ func (f *FireStoreStore) FindEthAccountByAddress(addr string) (a *EthAccountSche
 	return
 }
 
+// UpdateBtcAccountAddressValidity flag the address of a btc account as valid or not, with the reason it is invalid
+func (f *FireStoreStore) UpdateBtcAccountAddressValidity(uid string, reason string) error {
+	return f.updateAddressValidity(f.utxoCollection("accounts"), uid, reason)
+}
+
+// UpdateEthAccountAddressValidity flag the address of an eth account as valid or not, with the reason it is invalid
+func (f *FireStoreStore) UpdateEthAccountAddressValidity(uid string, reason string) error {
+	return f.updateAddressValidity("eth_accounts", uid, reason)
+}
+
+func (f *FireStoreStore) updateAddressValidity(collection string, uid string, reason string) (err error) {
+	doc := map[string]interface{}{
+		"address_valid": reason == "",
+		"address_error": reason,
+	}
+	_, err = f.Client.Collection(collection).Doc(uid).Set(f.ctx, doc, firestore.MergeAll)
+	return
+}
+
+// CreateBtcUtxos create the given outputs, keyed by transaction hash and output index. Outputs already
+// recorded are left untouched so that rescanning a block does not reset their spent state
+func (f *FireStoreStore) CreateBtcUtxos(utxos []*BtcUtxoSchema) error {
+	for _, u := range utxos {
+		_, err := f.Client.Collection(f.utxoCollection("utxos")).Doc(u.TxHash+":"+strconv.Itoa(u.VoutIdx)).Create(f.ctx, u)
+		if err != nil && status.Code(err) != codes.AlreadyExists {
+			return err
+		}
+	}
+	return nil
+}
+
+// SpendBtcUtxos mark the given outputs as spent
+func (f *FireStoreStore) SpendBtcUtxos(utxos []*BtcUtxoSchema) (err error) {
+	for _, u := range utxos {
+		doc := map[string]interface{}{
+			"spent":        true,
+			"spent_by":     u.SpentBy,
+			"spent_height": u.SpentHeight,
+		}
+		if _, err = f.Client.Collection(f.utxoCollection("utxos")).Doc(u.TxHash+":"+strconv.Itoa(u.VoutIdx)).Set(f.ctx, doc, firestore.MergeAll); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// GetAllUnspentBtcUtxos get all the outputs of the watched addresses that are not spent yet
+func (f *FireStoreStore) GetAllUnspentBtcUtxos() ([]*BtcUtxoSchema, error) {
+	return f.findBtcUtxos(f.Client.Collection(f.utxoCollection("utxos")).Where("spent", "==", false))
+}
+
+// FindBtcUtxosByOutpoint find the outputs of the given outpoints, "hash:index", that are recorded. They
+// are read by document id, in batches
+func (f *FireStoreStore) FindBtcUtxosByOutpoint(outpoints []string) (utxos []*BtcUtxoSchema, err error) {
+	for start := 0; start < len(outpoints); start += utxoBatchSize {
+		end := start + utxoBatchSize
+		if end > len(outpoints) {
+			end = len(outpoints)
+		}
+		refs := make([]*firestore.DocumentRef, 0, end-start)
+		for _, o := range outpoints[start:end] {
+			refs = append(refs, f.Client.Collection(f.utxoCollection("utxos")).Doc(o))
+		}
+		docs, errGet := f.Client.GetAll(f.ctx, refs)
+		if errGet != nil {
+			return nil, errGet
+		}
+		for _, doc := range docs {
+			if !doc.Exists() {
+				continue
+			}
+			var u *BtcUtxoSchema
+			if err = doc.DataTo(&u); err != nil {
+				return nil, err
+			}
+			utxos = append(utxos, u)
+		}
+	}
+	return
+}
+
+// FindBtcUtxosByTxIndex find the recorded outputs of the transactions of the given provider indexes, with
+// in queries of at most ten values
+func (f *FireStoreStore) FindBtcUtxosByTxIndex(indexes []int64) (utxos []*BtcUtxoSchema, err error) {
+	for start := 0; start < len(indexes); start += inQuerySize {
+		end := start + inQuerySize
+		if end > len(indexes) {
+			end = len(indexes)
+		}
+		found, errFind := f.findBtcUtxos(f.Client.Collection(f.utxoCollection("utxos")).Where("tx_index", "in", indexes[start:end]))
+		if errFind != nil {
+			return nil, errFind
+		}
+		utxos = append(utxos, found...)
+	}
+	return
+}
+
+// FindUnspentBtcUtxosByAddress find the outputs paying the given address that are not spent yet
+func (f *FireStoreStore) FindUnspentBtcUtxosByAddress(addr string) ([]*BtcUtxoSchema, error) {
+	return f.findBtcUtxos(f.Client.Collection(f.utxoCollection("utxos")).Where("address", "==", addr).Where("spent", "==", false))
+}
+
+// FindUnspentBtcUtxosByUID find the outputs paying any address of a user that are not spent yet
+func (f *FireStoreStore) FindUnspentBtcUtxosByUID(uid string) ([]*BtcUtxoSchema, error) {
+	return f.findBtcUtxos(f.Client.Collection(f.utxoCollection("utxos")).Where("uid", "==", uid).Where("spent", "==", false))
+}
+
+func (f *FireStoreStore) findBtcUtxos(q firestore.Query) (utxos []*BtcUtxoSchema, err error) {
+	iter := q.Documents(f.ctx)
+	for {
+		doc, errIter := iter.Next()
+		if errIter == iterator.Done {
+			break
+		}
+		if errIter != nil {
+			return nil, errIter
+		}
+		var u *BtcUtxoSchema
+		if err = doc.DataTo(&u); err != nil {
+			return nil, err
+		}
+		utxos = append(utxos, u)
+	}
+	return
+}
+
+// CreateBtcBlockFees create or overwrite the fee rate percentiles of a block
+func (f *FireStoreStore) CreateBtcBlockFees(fees *BtcBlockFeesSchema) (err error) {
+	_, err = f.Client.Collection(f.utxoCollection("block_fees")).Doc(strconv.Itoa(fees.Height)).Set(f.ctx, fees)
+	return
+}
+
+// FindRecentBtcBlockFees find the fee rate percentiles of the n last scanned blocks
+func (f *FireStoreStore) FindRecentBtcBlockFees(n int) (fees []*BtcBlockFeesSchema, err error) {
+	iter := f.Client.Collection(f.utxoCollection("block_fees")).OrderBy("height", firestore.Desc).Limit(n).Documents(f.ctx)
+	for {
+		doc, errIter := iter.Next()
+		if errIter == iterator.Done {
+			break
+		}
+		if errIter != nil {
+			return nil, errIter
+		}
+		var bf *BtcBlockFeesSchema
+		if err = doc.DataTo(&bf); err != nil {
+			return nil, err
+		}
+		fees = append(fees, bf)
+	}
+	return
+}
+
+// CreateBtcWallet create a watched bitcoin wallet and set its generated ID
+func (f *FireStoreStore) CreateBtcWallet(w *BtcWalletSchema) (err error) {
+	ref := f.Client.Collection(f.utxoCollection("wallets")).NewDoc()
+	w.ID = ref.ID
+	_, err = ref.Create(f.ctx, w)
+	return
+}
+
+// FindBtcWallet find a watched bitcoin wallet by ID
+func (f *FireStoreStore) FindBtcWallet(id string) (w *BtcWalletSchema, err error) {
+	doc, err := f.Client.Collection(f.utxoCollection("wallets")).Doc(id).Get(f.ctx)
+	if err != nil {
+		return
+	}
+	err = doc.DataTo(&w)
+	return
+}
+
+// UpdateBtcWalletIndexes update the last used index and the number of derived addresses of a wallet
+func (f *FireStoreStore) UpdateBtcWalletIndexes(w *BtcWalletSchema) (err error) {
+	_, err = f.Client.Collection(f.utxoCollection("wallets")).Doc(w.ID).Set(f.ctx, w, firestore.Merge([]string{"last_used"}, []string{"derived"}))
+	return
+}
+
+// CreateBtcWalletAddresses save the addresses derived from a wallet, keyed by address
+func (f *FireStoreStore) CreateBtcWalletAddresses(addrs []*BtcWalletAddressSchema) (err error) {
+	for _, a := range addrs {
+		if _, err = f.Client.Collection(f.utxoCollection("wallet_addresses")).Doc(a.Address).Set(f.ctx, a); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// GetAllBtcWalletAddresses get all the addresses derived from the watched wallets
+func (f *FireStoreStore) GetAllBtcWalletAddresses() ([]*BtcWalletAddressSchema, error) {
+	var addrs []*BtcWalletAddressSchema
+	iter := f.Client.Collection(f.utxoCollection("wallet_addresses")).Documents(f.ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var a *BtcWalletAddressSchema
+		if err = doc.DataTo(&a); err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, a)
+	}
+	return addrs, nil
+}
+
 // FindAndUpdateLatestHistories find latest histories
 func (f *FireStoreStore) FindAndUpdateLatestHistories(timestamp string, target int) (res []map[string]interface{}, err error) {
 	iter := f.Client.Collection("interest_payment_histories").Documents(f.ctx)
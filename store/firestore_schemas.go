@@ -1,19 +1,23 @@
 package store
 
-import "time"
+import (
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/eth"
+)
 
 //BtcAccountSchema firestore schema of a firebase bitcoin account
 type BtcAccountSchema struct {
 	UID     string  `firestore:"uid"`
-	Address string  `firestore:"address"`
+	Address string  `firestore:"address"` // as saved by the client, compared by its canonical form
 	BTC     float64 `firestore:"BTC"`
 }
 
 //EthAccountSchema firestore schema of a firebase ETH account
 type EthAccountSchema struct {
 	UID     string  `firestore:"uid"`
-	Address string  `firestore:"address"`
-	ETH     float64 `firestore:"ETH"` // because of the 18 decimals, eth balance is stored as a string, converted in WEI (10**-18 ETH)
+	Address string  `firestore:"address"` // as saved by the client, compared by its canonical form
+	ETH     float64 `firestore:"ETH"`     // because of the 18 decimals, eth balance is stored as a string, converted in WEI (10**-18 ETH)
 	USDC    float64 `firestore:"USDC"`
 	USDT    float64 `firestore:"USDT"`
 }
@@ -26,6 +30,49 @@ type BtcTransactionSchema struct {
 	VoutIdx     int     `firestore:"vout_idx"`
 	BlockHeight int     `firestore:"block_height"`
 	Confirmed   bool    `firestore:"confirmed"`
+	UID         string  `firestore:"uid,omitempty"`       // set when the receiving address is derived from a wallet
+	WalletID    string  `firestore:"wallet_id,omitempty"` // wallet the receiving address is derived from
+	Path        string  `firestore:"path,omitempty"`      // derivation path of the receiving address in the wallet
+}
+
+// BtcWalletSchema firestore schema of a watched bitcoin HD wallet
+type BtcWalletSchema struct {
+	ID         string `firestore:"id"`
+	UID        string `firestore:"uid"`
+	Descriptor string `firestore:"descriptor"`
+	GapLimit   int    `firestore:"gap_limit"`
+	LastUsed   int    `firestore:"last_used"` // index of the last derived address that received funds, -1 if none
+	Derived    int    `firestore:"derived"`   // number of addresses derived and watched
+}
+
+// BtcWalletAddressSchema firestore schema of an address derived from a watched wallet
+type BtcWalletAddressSchema struct {
+	Address  string `firestore:"address"`
+	UID      string `firestore:"uid"`
+	WalletID string `firestore:"wallet_id"`
+	Path     string `firestore:"path"`
+	Index    int    `firestore:"index"`
+}
+
+// BtcUtxoSchema firestore schema of an output paying a watched address, spent or not
+type BtcUtxoSchema struct {
+	TxHash      string `firestore:"txHash"`
+	VoutIdx     int    `firestore:"vout_idx"`
+	TxIndex     int64  `firestore:"tx_index"` // provider index of the transaction, matches spends that don't carry the previous hash
+	Address     string `firestore:"address"`
+	UID         string `firestore:"uid"`
+	Value       int64  `firestore:"value"` // in satoshis
+	BlockHeight int    `firestore:"block_height"`
+	Spent       bool   `firestore:"spent"`
+	SpentBy     string `firestore:"spent_by,omitempty"` // hash of the spending transaction
+	SpentHeight int    `firestore:"spent_height,omitempty"`
+}
+
+// BtcBlockFeesSchema firestore schema of the percentiles of the fee rates of a scanned block, in satoshis per vbyte
+type BtcBlockFeesSchema struct {
+	Height      int                `firestore:"height"`
+	TxCount     int                `firestore:"tx_count"`
+	Percentiles map[string]float64 `firestore:"percentiles"`
 }
 
 // ChainStateSchema firestore schema of a chain state
@@ -40,13 +87,93 @@ type ChainStateSchema struct {
 
 // EthTransactionSchema firestore schema of an ethereum transaction
 type EthTransactionSchema struct {
-	From        string `firestore:"from"`
-	Amount      string `firestore:"amount"`
-	To          string `firestore:"to"`
-	TxHash      string `firestore:"txHash"`
-	LogIdx      string `firestore:"log_idx"`
-	BlockHeight int    `firestore:"block_height"`
-	Confirmed   bool   `firestore:"confirmed"`
-	Currency    string `firestore:"currency"`
-	Receiver    string `firestore:"receiver"`
+	From        eth.Address `firestore:"from"`
+	Amount      string      `firestore:"amount"`
+	To          eth.Address `firestore:"to"`
+	TxHash      string      `firestore:"txHash"`
+	LogIdx      string      `firestore:"log_idx"`
+	BlockHeight int         `firestore:"block_height"`
+	Confirmed   bool        `firestore:"confirmed"`
+	Currency    string      `firestore:"currency"`
+	Receiver    eth.Address `firestore:"receiver"`
+	// type, gas and fee in wei paid by the sender of the transaction
+	TxType            int    `firestore:"tx_type"`
+	GasUsed           int64  `firestore:"gas_used"`
+	EffectiveGasPrice string `firestore:"effective_gas_price"`
+	Fee               string `firestore:"fee"`
+}
+
+// NftHoldingSchema firestore schema of an ERC-721 or ERC-1155 token received by an account, with the
+// transaction and the log it comes from
+type NftHoldingSchema struct {
+	UID         string      `firestore:"uid"`
+	Contract    eth.Address `firestore:"contract"`
+	Collection  string      `firestore:"collection,omitempty"` // name of the configured collection
+	Standard    string      `firestore:"standard"`
+	TokenID     string      `firestore:"token_id"`
+	Amount      string      `firestore:"amount"`
+	From        eth.Address `firestore:"from"`
+	Receiver    eth.Address `firestore:"receiver"`
+	TxHash      string      `firestore:"txHash"`
+	LogIdx      string      `firestore:"log_idx"`
+	BlockHeight int         `firestore:"block_height"`
+	Confirmed   bool        `firestore:"confirmed"`
+}
+
+// EthSweepSchema firestore schema of a sweep of the deposit addresses to the hot wallet, with the execution
+// state of its steps so that an interrupted sweep resumes where it stopped
+type EthSweepSchema struct {
+	ID        string                `firestore:"id"`
+	Height    int                   `firestore:"height"` // height of the confirmed balances that are swept
+	GasPrice  string                `firestore:"gas_price"`
+	Status    string                `firestore:"status"`
+	CreatedAt time.Time             `firestore:"created_at"`
+	Steps     []*EthSweepStepSchema `firestore:"steps"`
+	// execution holding the sweep until the lease expires, a single one sends its transfers
+	LeaseHolder string    `firestore:"lease_holder,omitempty"`
+	LeaseUntil  time.Time `firestore:"lease_until,omitempty"`
+}
+
+// EthSweepStepSchema firestore schema of a transfer of a sweep
+type EthSweepStepSchema struct {
+	ID        string      `firestore:"id"`
+	Kind      string      `firestore:"kind"`
+	UID       string      `firestore:"uid"`
+	From      eth.Address `firestore:"from"`
+	To        eth.Address `firestore:"to"`
+	Currency  string      `firestore:"currency"`
+	Contract  eth.Address `firestore:"contract,omitempty"`
+	Amount    string      `firestore:"amount"`
+	Data      string      `firestore:"data,omitempty"` // calldata of the deployments and flushes of the forwarders
+	GasLimit  int64       `firestore:"gas_limit"`
+	DependsOn []string    `firestore:"depends_on"`
+	Status    string      `firestore:"status"`
+	TxHash    string      `firestore:"txHash,omitempty"`
+	Nonce     int64       `firestore:"nonce,omitempty"`
+	Replaced  []string    `firestore:"replaced,omitempty"` // hashes of the stuck versions of the transaction
+	Error     string      `firestore:"error,omitempty"`    // last error of the sender, the step is retried
+	Attempts  int         `firestore:"attempts,omitempty"` // sends that failed, the step fails after too many
+}
+
+// EthNonceSchema firestore schema of the pending transactions of an address, whose nonces are not reused
+type EthNonceSchema struct {
+	Address eth.Address           `firestore:"address"`
+	Pending []*EthPendingTxSchema `firestore:"pending"`
+}
+
+// EthPendingTxSchema firestore schema of a pending transaction, with the fields it is rebuilt from when
+// it is replaced
+type EthPendingTxSchema struct {
+	Nonce          int64       `firestore:"nonce"`
+	Type           int         `firestore:"type"`
+	ChainID        string      `firestore:"chain_id"`
+	To             eth.Address `firestore:"to"`
+	Value          string      `firestore:"value"`
+	Data           string      `firestore:"data,omitempty"`
+	GasLimit       int64       `firestore:"gas_limit"`
+	GasPrice       string      `firestore:"gas_price,omitempty"`
+	MaxFee         string      `firestore:"max_fee,omitempty"`
+	MaxPriorityFee string      `firestore:"max_priority_fee,omitempty"`
+	Hashes         []string    `firestore:"hashes"`
+	SentAt         time.Time   `firestore:"sent_at"`
 }
@@ -0,0 +1,75 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/eth"
+)
+
+// Families of chains an address can be validated for
+const (
+	FamilyBtc string = "btc"
+	FamilyEth string = "eth"
+)
+
+// AddressError error of an invalid address with the reason it was rejected
+type AddressError struct {
+	Address string `json:"address"`
+	Reason  string `json:"reason"`
+}
+
+func (e *AddressError) Error() string {
+	return fmt.Sprintf("invalid address %s: %s", e.Address, e.Reason)
+}
+
+// ValidateBtcAddress check that an address is a valid Base58Check, bech32 or bech32m address of
+// the network of the given chain. An address valid on another network is reported as such
+func ValidateBtcAddress(addr string, chain string) error {
+	net, err := btc.NetworkFromChain(chain)
+	if err != nil {
+		return err
+	}
+
+	_, errScript := btc.AddressToScript(addr, net)
+	if errScript == nil {
+		return nil
+	}
+
+	// the chains share some prefixes, so every chain the address is valid for is reported
+	var others []string
+	for _, other := range btc.Chains() {
+		n, _ := btc.NetworkFromChain(other)
+		if n == net {
+			continue
+		}
+		if _, errOther := btc.AddressToScript(addr, n); errOther == nil {
+			others = append(others, other)
+		}
+	}
+	if len(others) > 0 {
+		return &AddressError{Address: addr, Reason: fmt.Sprintf("address belongs to %s, expected %s", strings.Join(others, " or "), chain)}
+	}
+	return &AddressError{Address: addr, Reason: errScript.Error()}
+}
+
+// ValidateEthAddress check that an address is a valid ethereum address with a valid EIP55 checksum
+func ValidateEthAddress(addr string) error {
+	if err := eth.ValidateAddress(addr); err != nil {
+		return &AddressError{Address: addr, Reason: err.Error()}
+	}
+	return nil
+}
+
+// ValidateAddress validate an address for the given family of chains
+func ValidateAddress(family string, addr string, chain string) error {
+	switch family {
+	case FamilyBtc:
+		return ValidateBtcAddress(addr, chain)
+	case FamilyEth:
+		return ValidateEthAddress(addr)
+	default:
+		return fmt.Errorf("unknown chain family %s", family)
+	}
+}